@@ -0,0 +1,195 @@
+// Package api defines the versioned public API served by the gateway and its
+// published OpenAPI document.
+package api
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/pavitra93/go-multi-tenant-system/shared/middleware"
+	"github.com/pavitra93/go-multi-tenant-system/shared/models"
+	"github.com/pavitra93/go-multi-tenant-system/shared/openapi"
+	"github.com/pavitra93/go-multi-tenant-system/shared/pagination"
+	"github.com/pavitra93/go-multi-tenant-system/shared/utils"
+)
+
+// V1 is the path prefix of version 1 of the public API
+const V1 = "/v1"
+
+// SpecFile is the published document, relative to the repository root
+const SpecFile = "api/openapi.json"
+
+//go:embed openapi.json
+var publishedSpec []byte
+
+// idempotencyKey documents the optional Idempotency-Key request header
+var idempotencyKey = openapi.Parameter{
+	Name:        middleware.IdempotencyKeyHeader,
+	In:          "header",
+	Description: "Client-generated key; retries with the same key and body replay the original response",
+	Schema:      &openapi.Schema{Type: "string", MaxLength: intPtr(255)},
+}
+
+// V1Routes lists every operation of version 1 with the types its handler binds and returns
+func V1Routes() []openapi.Route {
+	return []openapi.Route{
+		// Authentication
+		{Method: http.MethodPost, Path: "/auth/login", Tag: "auth", Summary: "Log in and create a session",
+			Request: models.LoginRequest{}, Response: models.LoginResponse{}},
+		{Method: http.MethodPost, Path: "/auth/register", Tag: "auth", Summary: "Register a tenant user",
+			Request: models.RegisterRequest{}, Response: models.RegisterResponse{}, Status: http.StatusCreated},
+		{Method: http.MethodPost, Path: "/auth/invitations/accept", Tag: "auth", Summary: "Accept an invitation and create the account",
+			Request: models.AcceptInvitationRequest{}, Response: models.RegisterResponse{}, Status: http.StatusCreated},
+		{Method: http.MethodPost, Path: "/auth/refresh", Tag: "auth", Summary: "Refresh an access token",
+			Request: models.RefreshTokenRequest{}, Response: models.RefreshTokenResponse{}},
+		{Method: http.MethodPost, Path: "/auth/logout", Tag: "auth", Summary: "Revoke the current session", Auth: true,
+			Response: models.LogoutResponse{}},
+		{Method: http.MethodPost, Path: "/auth/confirm-email", Tag: "auth", Summary: "Confirm a user's email on their behalf (admin)", Auth: true,
+			Request: models.ConfirmEmailRequest{}, Response: models.ConfirmEmailResponse{}},
+
+		// Tenant management
+		{Method: http.MethodPost, Path: "/tenants/", Tag: "tenants", Summary: "Create a tenant (admin)", Auth: true,
+			Request: models.CreateTenantRequest{}, Response: models.Tenant{}, Status: http.StatusCreated},
+		{Method: http.MethodGet, Path: "/tenants/", Tag: "tenants", Summary: "List tenants (admin)", Auth: true,
+			Query: paged(models.TenantListQuery{}), Response: []models.Tenant{}},
+		{Method: http.MethodGet, Path: "/tenants/stats", Tag: "tenants", Summary: "Get every tenant's activity and delivery statistics (admin)", Auth: true,
+			Query: paged(models.TenantStatsListQuery{}), Response: []models.TenantStats{}},
+		{Method: http.MethodGet, Path: "/tenants/audit", Tag: "tenants", Summary: "List audit events across tenants (admin)", Auth: true,
+			Query: []interface{}{models.AuditEventListQuery{}, models.AuditTenantQuery{}, pagination.Params{}}, Response: []models.AuditEvent{}},
+		{Method: http.MethodGet, Path: "/tenants/audit/export", Tag: "tenants", Summary: "Export audit events across tenants as JSON or CSV (admin)", Auth: true,
+			Query: []interface{}{models.AuditEventListQuery{}, models.AuditTenantQuery{}, models.AuditExportQuery{}}, Response: models.AuditExport{}},
+		{Method: http.MethodGet, Path: "/tenants/:id", Tag: "tenants", Summary: "Get a tenant", Auth: true,
+			Response: models.Tenant{}},
+		{Method: http.MethodPut, Path: "/tenants/:id", Tag: "tenants", Summary: "Update a tenant", Auth: true,
+			Request: models.UpdateTenantRequest{}, Response: models.Tenant{}},
+		{Method: http.MethodPost, Path: "/tenants/:id/suspend", Tag: "tenants", Summary: "Suspend a tenant and revoke its sessions (admin)", Auth: true,
+			Request: models.SuspendTenantRequest{}, Response: models.Tenant{}},
+		{Method: http.MethodPost, Path: "/tenants/:id/reactivate", Tag: "tenants", Summary: "Reactivate a tenant or cancel its deletion (admin)", Auth: true,
+			Response: models.Tenant{}},
+		{Method: http.MethodDelete, Path: "/tenants/:id", Tag: "tenants", Summary: "Schedule a tenant for deletion (admin)", Auth: true,
+			Response: models.DeleteTenantResponse{}, Status: http.StatusAccepted},
+		{Method: http.MethodGet, Path: "/tenants/:id/deletion-report", Tag: "tenants", Summary: "Get the signed deletion report of a purged tenant (admin)", Auth: true,
+			Response: models.TenantDeletionReport{}},
+		{Method: http.MethodPut, Path: "/tenants/:id/plan", Tag: "tenants", Summary: "Move a tenant to another plan (admin)", Auth: true,
+			Request: models.ChangePlanRequest{}, Response: models.Tenant{}},
+		{Method: http.MethodGet, Path: "/tenants/:id/usage", Tag: "tenants", Summary: "Get the tenant's plan and quota usage", Auth: true,
+			Response: models.TenantUsageResponse{}},
+		{Method: http.MethodGet, Path: "/tenants/:id/stats", Tag: "tenants", Summary: "Get the tenant's activity and delivery statistics", Auth: true,
+			Query: []interface{}{models.TenantStatsQuery{}}, Response: models.TenantStats{}},
+		{Method: http.MethodGet, Path: "/tenants/:id/settings", Tag: "tenants", Summary: "Get the tenant's settings overrides", Auth: true,
+			Response: models.TenantSettingsRecord{}},
+		{Method: http.MethodPut, Path: "/tenants/:id/settings", Tag: "tenants", Summary: "Replace the tenant's settings overrides (admin)", Auth: true,
+			Request: models.UpdateTenantSettingsRequest{}, Response: models.TenantSettingsRecord{}},
+		{Method: http.MethodGet, Path: "/tenants/:id/settings/history", Tag: "tenants", Summary: "List versions of the tenant's settings", Auth: true,
+			Query: []interface{}{pagination.Params{}}, Response: []models.TenantSettingsChange{}},
+		{Method: http.MethodGet, Path: "/tenants/:id/audit", Tag: "tenants", Summary: "List the tenant's audit events", Auth: true,
+			Query: paged(models.AuditEventListQuery{}), Response: []models.AuditEvent{}},
+		{Method: http.MethodGet, Path: "/tenants/:id/audit/export", Tag: "tenants", Summary: "Export the tenant's audit events as JSON or CSV", Auth: true,
+			Query: []interface{}{models.AuditEventListQuery{}, models.AuditExportQuery{}}, Response: models.AuditExport{}},
+		{Method: http.MethodPost, Path: "/tenants/:id/exports", Tag: "tenants", Summary: "Request an archive of all of the tenant's data", Auth: true,
+			Request: models.CreateTenantExportRequest{}, Response: models.TenantExport{}, Status: http.StatusAccepted},
+		{Method: http.MethodGet, Path: "/tenants/:id/exports", Tag: "tenants", Summary: "List the tenant's data exports", Auth: true,
+			Query: paged(models.TenantExportListQuery{}), Response: []models.TenantExport{}},
+		{Method: http.MethodGet, Path: "/tenants/:id/exports/:export_id", Tag: "tenants", Summary: "Get a data export's progress and download link", Auth: true,
+			Response: models.TenantExport{}},
+		{Method: http.MethodGet, Path: "/tenants/:id/domain", Tag: "tenants", Summary: "Get the custom domain's verification status and challenge", Auth: true,
+			Response: models.DomainVerificationResponse{}},
+		{Method: http.MethodPost, Path: "/tenants/:id/domain/verify", Tag: "tenants", Summary: "Check the custom domain's TXT record or well-known file now", Auth: true,
+			Response: models.DomainVerificationResponse{}},
+		{Method: http.MethodPost, Path: "/tenants/:id/legal-holds", Tag: "tenants", Summary: "Place a legal hold on the tenant's data (admin)", Auth: true,
+			Request: models.PlaceLegalHoldRequest{}, Response: models.LegalHold{}, Status: http.StatusCreated},
+		{Method: http.MethodGet, Path: "/tenants/:id/legal-holds", Tag: "tenants", Summary: "List the tenant's legal holds (admin)", Auth: true,
+			Response: []models.LegalHold{}},
+		{Method: http.MethodDelete, Path: "/tenants/:id/legal-holds/:hold_id", Tag: "tenants", Summary: "Release a legal hold (admin)", Auth: true,
+			Response: models.LegalHold{}},
+		{Method: http.MethodGet, Path: "/tenants/:id/users", Tag: "tenants", Summary: "List tenant users", Auth: true,
+			Query: paged(models.TenantUserListQuery{}), Response: []models.User{}},
+		{Method: http.MethodPost, Path: "/tenants/:id/users", Tag: "tenants", Summary: "Invite a user to a tenant by email", Auth: true,
+			Request: models.InviteUserRequest{}, Response: models.Invitation{}, Status: http.StatusCreated},
+		{Method: http.MethodPatch, Path: "/tenants/:id/users/:cognito_id", Tag: "tenants", Summary: "Change a tenant user's role", Auth: true,
+			Request: models.UpdateTenantUserRequest{}, Response: models.User{}},
+		{Method: http.MethodDelete, Path: "/tenants/:id/users/:cognito_id", Tag: "tenants", Summary: "Remove a user from a tenant", Auth: true},
+		{Method: http.MethodPost, Path: "/tenants/:id/transfer-ownership", Tag: "tenants", Summary: "Transfer tenant ownership to another user", Auth: true,
+			Request: models.TransferOwnershipRequest{}, Response: models.TransferOwnershipResponse{}},
+		{Method: http.MethodPost, Path: "/tenants/:id/users/:cognito_id/erasure", Tag: "tenants", Summary: "Request the erasure of a user's personal data", Auth: true,
+			Request: models.RequestUserErasureRequest{}, Response: models.UserErasure{}, Status: http.StatusAccepted},
+		{Method: http.MethodGet, Path: "/tenants/:id/erasures", Tag: "tenants", Summary: "List the tenant's user erasures", Auth: true,
+			Query: paged(models.UserErasureListQuery{}), Response: []models.UserErasure{}},
+		{Method: http.MethodGet, Path: "/tenants/:id/erasures/:erasure_id", Tag: "tenants", Summary: "Get a user erasure and its signed completion record", Auth: true,
+			Response: models.UserErasure{}},
+		{Method: http.MethodGet, Path: "/tenants/:id/invitations", Tag: "tenants", Summary: "List tenant invitations (?status=pending|expired|accepted|revoked|all)", Auth: true,
+			Response: []models.Invitation{}},
+		{Method: http.MethodPost, Path: "/tenants/:id/invitations/:invitation_id/resend", Tag: "tenants", Summary: "Resend an invitation with a new link", Auth: true,
+			Response: models.Invitation{}},
+		{Method: http.MethodDelete, Path: "/tenants/:id/invitations/:invitation_id", Tag: "tenants", Summary: "Revoke a pending invitation", Auth: true,
+			Response: models.Invitation{}},
+
+		// Export downloads
+		{Method: http.MethodGet, Path: "/exports/:export_id/download", Tag: "exports", Summary: "Download a tenant export archive (zip) through its signed link",
+			Query: []interface{}{models.ExportDownloadQuery{}}},
+
+		// Location tracking
+		{Method: http.MethodPost, Path: "/location/session/start", Tag: "location", Summary: "Start a tracking session", Auth: true,
+			Request: models.StartSessionRequest{}, Response: models.LocationSession{}, Status: http.StatusCreated,
+			Headers: []openapi.Parameter{idempotencyKey}},
+		{Method: http.MethodPost, Path: "/location/session/:id/stop", Tag: "location", Summary: "Stop a tracking session", Auth: true,
+			Response: models.LocationSession{}, Headers: []openapi.Parameter{idempotencyKey}},
+		{Method: http.MethodGet, Path: "/location/sessions", Tag: "location", Summary: "List the caller's sessions", Auth: true,
+			Query: paged(models.SessionListQuery{}), Response: []models.LocationSession{}},
+		{Method: http.MethodPost, Path: "/location/update", Tag: "location", Summary: "Submit a location update", Auth: true,
+			Request: models.LocationUpdateRequest{}, Response: models.Location{}, Headers: []openapi.Parameter{idempotencyKey}},
+		{Method: http.MethodGet, Path: "/location/session/:id/locations", Tag: "location", Summary: "List a session's locations", Auth: true,
+			Query: paged(models.LocationListQuery{}), Response: []models.Location{}},
+
+		// Billing
+		{Method: http.MethodGet, Path: "/billing/usage", Tag: "billing", Summary: "Export metered usage for a billing period as JSON or CSV (admin)", Auth: true,
+			Query: []interface{}{models.UsageExportQuery{}}, Response: models.UsageExport{}},
+
+		// Streaming
+		{Method: http.MethodGet, Path: "/streaming/health", Tag: "streaming", Summary: "Streaming pipeline health", Auth: true,
+			Response: map[string]interface{}{}},
+
+		// Retry management
+		{Method: http.MethodGet, Path: "/retry/stats", Tag: "retry", Summary: "Dead letter queue statistics (admin)", Auth: true,
+			Response: map[string]interface{}{}},
+	}
+}
+
+// GenerateV1 builds the version 1 document from the route table and handler types
+func GenerateV1() *openapi.Document {
+	generator := openapi.NewGenerator(openapi.Info{
+		Title:       "Multi-Tenant Location Tracking API",
+		Description: "Public API served by the API gateway. Every response uses the APIResponse envelope; errors carry a machine-readable code and are available as RFC 7807 problem+json via the Accept header.",
+		Version:     "1.0.0",
+	}, V1)
+	generator.SetEnvelope(utils.APIResponse{})
+	generator.SetProblem(utils.ProblemDetails{})
+	generator.Add(V1Routes()...)
+	return generator.Document()
+}
+
+// PublishedSpec returns the published OpenAPI document as served at /openapi.json
+func PublishedSpec() []byte {
+	return publishedSpec
+}
+
+// CheckContract compares a published document with the one generated from the handler types
+// and returns the drift, if any
+func CheckContract(published []byte) ([]string, error) {
+	var document openapi.Document
+	if err := json.Unmarshal(published, &document); err != nil {
+		return nil, fmt.Errorf("failed to parse published spec: %w", err)
+	}
+	return openapi.Diff(&document, GenerateV1()), nil
+}
+
+// paged documents a paginated list's filters together with the shared pagination parameters
+func paged(filters interface{}) []interface{} {
+	return []interface{}{filters, pagination.Params{}}
+}
+
+func intPtr(value int) *int {
+	return &value
+}
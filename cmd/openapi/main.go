@@ -0,0 +1,55 @@
+// Command openapi regenerates or checks the published OpenAPI document.
+//
+//	go run ./cmd/openapi          # exit non-zero if api/openapi.json drifted from the handler types
+//	go run ./cmd/openapi -write   # regenerate api/openapi.json
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/pavitra93/go-multi-tenant-system/api"
+)
+
+func main() {
+	write := flag.Bool("write", false, "regenerate the spec instead of checking it")
+	specFile := flag.String("spec", api.SpecFile, "path of the published spec")
+	flag.Parse()
+
+	if *write {
+		encoded, err := json.MarshalIndent(api.GenerateV1(), "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to encode spec: %v\n", err)
+			os.Exit(1)
+		}
+		if err := os.WriteFile(*specFile, append(encoded, '\n'), 0644); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to write spec: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("wrote %s\n", *specFile)
+		return
+	}
+
+	published, err := os.ReadFile(*specFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to read spec: %v\n", err)
+		os.Exit(1)
+	}
+
+	drift, err := api.CheckContract(published)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if len(drift) > 0 {
+		fmt.Fprintf(os.Stderr, "%s is out of date with the handler types (run `make openapi`):\n", *specFile)
+		for _, problem := range drift {
+			fmt.Fprintf(os.Stderr, "  - %s\n", problem)
+		}
+		os.Exit(1)
+	}
+
+	fmt.Printf("%s matches the handler types\n", *specFile)
+}
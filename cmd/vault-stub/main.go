@@ -0,0 +1,66 @@
+// Command vault-stub serves secrets over the Vault KV v2 read API for local development.
+// The file is re-read on every request, so editing it simulates a rotation.
+//
+//	go run ./cmd/vault-stub -file secrets.json -token dev-token
+//	SECRET_PROVIDER=vault VAULT_ADDR=http://localhost:8200 VAULT_TOKEN=dev-token
+//
+// secrets.json is a flat object keyed by variable name, e.g. {"DB_PASSWORD": "password"}.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+func main() {
+	addr := flag.String("addr", ":8200", "listen address")
+	file := flag.String("file", "secrets.json", "JSON object of secrets")
+	token := flag.String("token", "", "required X-Vault-Token (empty accepts any)")
+	flag.Parse()
+
+	http.HandleFunc("/v1/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || !strings.Contains(r.URL.Path, "/data/") {
+			writeErrors(w, http.StatusNotFound, "unsupported path")
+			return
+		}
+		if *token != "" && r.Header.Get("X-Vault-Token") != *token {
+			writeErrors(w, http.StatusForbidden, "permission denied")
+			return
+		}
+
+		data, err := os.ReadFile(*file)
+		if err != nil {
+			writeErrors(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		var secrets map[string]interface{}
+		if err := json.Unmarshal(data, &secrets); err != nil {
+			writeErrors(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		// Every path serves the same secrets
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{
+				"data":     secrets,
+				"metadata": map[string]interface{}{"created_time": time.Now().UTC(), "version": 1},
+			},
+		})
+	})
+
+	log.Printf("vault-stub serving %s on %s", *file, *addr)
+	log.Fatal(http.ListenAndServe(*addr, nil))
+}
+
+// writeErrors writes a Vault-style error body
+func writeErrors(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string][]string{"errors": {message}})
+}
@@ -9,9 +9,24 @@
 \c multi_tenant_db;
 
 -- Run migrations in order
-\i migrations/001_initial_schema.sql
-\i migrations/002_row_level_security.sql
-\i migrations/003_sample_data.sql
+\ir migrations/001_schema.sql
+\ir migrations/002_indexes.sql
+\ir migrations/003_sample_data.sql
+\ir migrations/004_dlq_schema.sql
+\ir migrations/005_request_tracing.sql
+\ir migrations/006_tenant_slug.sql
+\ir migrations/007_tenant_lifecycle.sql
+\ir migrations/008_invitations.sql
+\ir migrations/009_plans.sql
+\ir migrations/010_usage_metering.sql
+\ir migrations/011_tenant_settings.sql
+\ir migrations/012_tenant_stats.sql
+\ir migrations/013_audit_events.sql
+\ir migrations/014_tenant_exports.sql
+\ir migrations/015_user_erasure.sql
+\ir migrations/016_domain_verification.sql
+\ir migrations/017_session_statuses.sql
+\ir migrations/018_tenant_purging.sql
 
 -- Create a function to check database health
 CREATE OR REPLACE FUNCTION check_database_health()
@@ -31,7 +46,7 @@ BEGIN
     SELECT 
         'users'::TEXT,
         COUNT(*)::BIGINT,
-        MAX(updated_at)
+        MAX(created_at)
     FROM users
     UNION ALL
     SELECT 
@@ -43,7 +58,7 @@ BEGIN
     SELECT 
         'locations'::TEXT,
         COUNT(*)::BIGINT,
-        MAX(updated_at)
+        MAX(created_at)
     FROM locations;
 END;
 $$ LANGUAGE plpgsql;
@@ -54,39 +69,4 @@ GRANT ALL PRIVILEGES ON ALL TABLES IN SCHEMA public TO postgres;
 GRANT ALL PRIVILEGES ON ALL SEQUENCES IN SCHEMA public TO postgres;
 GRANT EXECUTE ON ALL FUNCTIONS IN SCHEMA public TO postgres;
 
--- Create a view for tenant statistics
-CREATE OR REPLACE VIEW tenant_stats AS
-SELECT 
-    t.id,
-    t.name,
-    t.domain,
-    t.is_active,
-    COUNT(DISTINCT u.id) as user_count,
-    COUNT(DISTINCT ls.id) as session_count,
-    COUNT(DISTINCT l.id) as location_count,
-    MAX(l.timestamp) as last_location_update
-FROM tenants t
-LEFT JOIN users u ON t.id = u.tenant_id AND u.deleted_at IS NULL
-LEFT JOIN location_sessions ls ON t.id = ls.tenant_id AND ls.deleted_at IS NULL
-LEFT JOIN locations l ON t.id = l.tenant_id AND l.deleted_at IS NULL
-WHERE t.deleted_at IS NULL
-GROUP BY t.id, t.name, t.domain, t.is_active;
-
--- Create a view for user activity
-CREATE OR REPLACE VIEW user_activity AS
-SELECT 
-    u.id,
-    u.username,
-    u.email,
-    u.tenant_id,
-    t.name as tenant_name,
-    COUNT(DISTINCT ls.id) as total_sessions,
-    COUNT(DISTINCT l.id) as total_locations,
-    MAX(ls.started_at) as last_session_start,
-    MAX(l.timestamp) as last_location_update
-FROM users u
-JOIN tenants t ON u.tenant_id = t.id
-LEFT JOIN location_sessions ls ON u.id = ls.user_id AND ls.deleted_at IS NULL
-LEFT JOIN locations l ON u.id = l.user_id AND l.deleted_at IS NULL
-WHERE u.deleted_at IS NULL AND t.deleted_at IS NULL
-GROUP BY u.id, u.username, u.email, u.tenant_id, t.name;
+-- The tenant_stats and user_activity views are defined in migrations/012_tenant_stats.sql
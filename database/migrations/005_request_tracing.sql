@@ -0,0 +1,14 @@
+-- =====================================================
+-- REQUEST TRACING
+-- Correlate DLQ rows with the originating request
+-- =====================================================
+
+ALTER TABLE failed_location_updates
+    ADD COLUMN IF NOT EXISTS request_id VARCHAR(255),
+    ADD COLUMN IF NOT EXISTS trace_parent VARCHAR(55);
+
+CREATE INDEX IF NOT EXISTS idx_failed_location_updates_request_id ON failed_location_updates(request_id);
+
+-- =====================================================
+-- REQUEST TRACING COMPLETE
+-- =====================================================
@@ -0,0 +1,14 @@
+-- =====================================================
+-- TENANT SLUG
+-- Subdomain used for host-based tenant resolution
+-- =====================================================
+
+ALTER TABLE tenants
+    ADD COLUMN IF NOT EXISTS slug VARCHAR(63) UNIQUE;
+
+-- Lookup by custom domain is case-insensitive
+CREATE INDEX IF NOT EXISTS idx_tenants_domain_lower ON tenants(LOWER(domain));
+
+-- =====================================================
+-- TENANT SLUG COMPLETE
+-- =====================================================
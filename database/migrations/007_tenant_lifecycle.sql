@@ -0,0 +1,51 @@
+-- =====================================================
+-- TENANT LIFECYCLE
+-- active -> suspended / pending_deletion -> deleted
+-- =====================================================
+
+ALTER TABLE tenants
+    ADD COLUMN IF NOT EXISTS status VARCHAR(20) NOT NULL DEFAULT 'active'
+        CHECK (status IN ('active', 'suspended', 'pending_deletion', 'deleted')),
+    ADD COLUMN IF NOT EXISTS status_reason TEXT,
+    ADD COLUMN IF NOT EXISTS suspended_at TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN IF NOT EXISTS deletion_requested_at TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN IF NOT EXISTS deletion_requested_by VARCHAR(255),
+    ADD COLUMN IF NOT EXISTS purge_after TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN IF NOT EXISTS purged_at TIMESTAMP WITH TIME ZONE;
+
+-- Tenants deactivated through is_active become suspended
+UPDATE tenants SET status = 'suspended', suspended_at = updated_at
+WHERE is_active = false AND status = 'active';
+
+-- Purged tenants are kept as tombstones; their domain and slug can be reused
+ALTER TABLE tenants DROP CONSTRAINT IF EXISTS tenants_domain_key;
+ALTER TABLE tenants DROP CONSTRAINT IF EXISTS tenants_slug_key;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_tenants_domain_live ON tenants(domain) WHERE status <> 'deleted';
+CREATE UNIQUE INDEX IF NOT EXISTS idx_tenants_slug_live ON tenants(slug) WHERE status <> 'deleted';
+
+-- Purger lookup of tenants whose grace period has ended
+CREATE INDEX IF NOT EXISTS idx_tenants_purge_due ON tenants(purge_after) WHERE status = 'pending_deletion';
+
+-- Signed record of each completed purge
+CREATE TABLE IF NOT EXISTS tenant_deletion_reports (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    tenant_id UUID NOT NULL UNIQUE, -- No foreign key: the report outlives the tenant's data
+    tenant_name VARCHAR(255) NOT NULL,
+    tenant_domain VARCHAR(255) NOT NULL,
+    deletion_requested_at TIMESTAMP WITH TIME ZONE,
+    deletion_requested_by VARCHAR(255),
+    started_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    completed_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    locations_deleted BIGINT NOT NULL DEFAULT 0,
+    location_sessions_deleted BIGINT NOT NULL DEFAULT 0,
+    failed_updates_deleted BIGINT NOT NULL DEFAULT 0,
+    users_deleted BIGINT NOT NULL DEFAULT 0,
+    cognito_users_deleted BIGINT NOT NULL DEFAULT 0,
+    token_sessions_revoked BIGINT NOT NULL DEFAULT 0,
+    signature_algorithm VARCHAR(32) NOT NULL,
+    signature VARCHAR(128) NOT NULL
+);
+
+-- =====================================================
+-- TENANT LIFECYCLE COMPLETE
+-- =====================================================
@@ -0,0 +1,43 @@
+-- =====================================================
+-- INVITATIONS
+-- Tenant owners invite users by email; the link carries a token
+-- whose SHA256 is stored here
+-- =====================================================
+
+CREATE TABLE IF NOT EXISTS invitations (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    email VARCHAR(255) NOT NULL,
+    role user_role NOT NULL,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending'
+        CHECK (status IN ('pending', 'accepted', 'revoked')),
+    invited_by VARCHAR(255) NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    send_count INTEGER NOT NULL DEFAULT 1,
+    last_sent_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    accepted_at TIMESTAMP WITH TIME ZONE,
+    accepted_by VARCHAR(255),
+    revoked_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- At most one pending invitation per email in a tenant
+CREATE UNIQUE INDEX IF NOT EXISTS idx_invitations_pending_email
+    ON invitations(tenant_id, LOWER(email)) WHERE status = 'pending';
+
+CREATE INDEX IF NOT EXISTS idx_invitations_tenant_status ON invitations(tenant_id, status, created_at DESC);
+
+ALTER TABLE invitations ENABLE ROW LEVEL SECURITY;
+
+CREATE POLICY invitations_isolation_policy ON invitations
+    USING (tenant_id = current_setting('app.current_tenant_id', TRUE)::UUID);
+
+-- Tenant purges also remove invitations
+ALTER TABLE tenant_deletion_reports
+    ADD COLUMN IF NOT EXISTS invitations_deleted BIGINT NOT NULL DEFAULT 0;
+
+-- =====================================================
+-- INVITATIONS COMPLETE
+-- =====================================================
@@ -0,0 +1,32 @@
+-- =====================================================
+-- PLANS AND QUOTAS
+-- Each tenant is on a plan; NULL limits are unlimited
+-- =====================================================
+
+CREATE TABLE IF NOT EXISTS plans (
+    id VARCHAR(50) PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    max_users INTEGER CHECK (max_users >= 0),
+    max_concurrent_sessions INTEGER CHECK (max_concurrent_sessions >= 0),
+    max_location_updates_per_day INTEGER CHECK (max_location_updates_per_day >= 0),
+    retention_days INTEGER CHECK (retention_days > 0),
+    max_webhook_endpoints INTEGER CHECK (max_webhook_endpoints >= 0),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO plans (id, name, max_users, max_concurrent_sessions, max_location_updates_per_day, retention_days, max_webhook_endpoints) VALUES
+    ('free', 'Free', 5, 2, 10000, 7, 1),
+    ('pro', 'Pro', 50, 25, 500000, 90, 10),
+    ('enterprise', 'Enterprise', NULL, NULL, NULL, NULL, NULL)
+ON CONFLICT (id) DO NOTHING;
+
+-- Existing tenants start on the free plan
+ALTER TABLE tenants
+    ADD COLUMN IF NOT EXISTS plan_id VARCHAR(50) NOT NULL DEFAULT 'free' REFERENCES plans(id);
+
+CREATE INDEX IF NOT EXISTS idx_tenants_plan_id ON tenants(plan_id);
+
+-- =====================================================
+-- PLANS AND QUOTAS COMPLETE
+-- =====================================================
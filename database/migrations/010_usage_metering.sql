@@ -0,0 +1,43 @@
+-- =====================================================
+-- USAGE METERING
+-- usage_events is the ledger that makes metering idempotent;
+-- usage_hourly holds each tenant's billable totals per hour
+-- =====================================================
+
+CREATE TABLE IF NOT EXISTS usage_events (
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    metric VARCHAR(50) NOT NULL,
+    event_key VARCHAR(255) NOT NULL,
+    quantity BIGINT NOT NULL CHECK (quantity >= 0),
+    hour TIMESTAMP WITH TIME ZONE NOT NULL,
+    recorded_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (tenant_id, metric, event_key)
+);
+
+-- Pruning of ledger rows older than METERING_EVENT_RETENTION
+CREATE INDEX IF NOT EXISTS idx_usage_events_recorded_at ON usage_events(recorded_at);
+
+CREATE TABLE IF NOT EXISTS usage_hourly (
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    metric VARCHAR(50) NOT NULL,
+    hour TIMESTAMP WITH TIME ZONE NOT NULL,
+    quantity BIGINT NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (tenant_id, metric, hour)
+);
+
+-- Billing exports scan a period across all tenants
+CREATE INDEX IF NOT EXISTS idx_usage_hourly_hour ON usage_hourly(hour);
+
+ALTER TABLE usage_events ENABLE ROW LEVEL SECURITY;
+ALTER TABLE usage_hourly ENABLE ROW LEVEL SECURITY;
+
+CREATE POLICY usage_events_isolation_policy ON usage_events
+    USING (tenant_id = current_setting('app.current_tenant_id', TRUE)::UUID);
+
+CREATE POLICY usage_hourly_isolation_policy ON usage_hourly
+    USING (tenant_id = current_setting('app.current_tenant_id', TRUE)::UUID);
+
+-- =====================================================
+-- USAGE METERING COMPLETE
+-- =====================================================
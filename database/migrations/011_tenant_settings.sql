@@ -0,0 +1,45 @@
+-- =====================================================
+-- TENANT SETTINGS
+-- tenant_settings holds the current version of each tenant's
+-- overrides; tenant_settings_changes records every version
+-- =====================================================
+
+CREATE TABLE IF NOT EXISTS tenant_settings (
+    tenant_id UUID PRIMARY KEY REFERENCES tenants(id) ON DELETE CASCADE,
+    version INTEGER NOT NULL CHECK (version > 0),
+    settings JSONB NOT NULL DEFAULT '{}',
+    updated_by VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS tenant_settings_changes (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    version INTEGER NOT NULL,
+    settings JSONB NOT NULL,
+    previous JSONB NOT NULL,
+    changed_fields JSONB NOT NULL DEFAULT '[]',
+    changed_by VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (tenant_id, version)
+);
+
+-- Settings history, newest first
+CREATE INDEX IF NOT EXISTS idx_tenant_settings_changes_tenant ON tenant_settings_changes(tenant_id, created_at DESC);
+
+-- Retention pruning deletes each tenant's oldest locations
+CREATE INDEX IF NOT EXISTS idx_locations_tenant_created_at ON locations(tenant_id, created_at);
+
+ALTER TABLE tenant_settings ENABLE ROW LEVEL SECURITY;
+ALTER TABLE tenant_settings_changes ENABLE ROW LEVEL SECURITY;
+
+CREATE POLICY tenant_settings_isolation_policy ON tenant_settings
+    USING (tenant_id = current_setting('app.current_tenant_id', TRUE)::UUID);
+
+CREATE POLICY tenant_settings_changes_isolation_policy ON tenant_settings_changes
+    USING (tenant_id = current_setting('app.current_tenant_id', TRUE)::UUID);
+
+-- =====================================================
+-- TENANT SETTINGS COMPLETE
+-- =====================================================
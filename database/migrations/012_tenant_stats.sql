@@ -0,0 +1,106 @@
+-- =====================================================
+-- TENANT STATISTICS VIEWS
+-- tenant_stats backs GET /tenants/:id/stats; user_activity
+-- summarises each user. Replaces the views init.sql defined
+-- against columns the schema doesn't have
+-- =====================================================
+
+DROP VIEW IF EXISTS tenant_stats;
+DROP VIEW IF EXISTS user_activity;
+
+-- Each table is aggregated on its own before joining, so counts aren't multiplied
+-- across tables, and a filter on tenant_id is pushed into every aggregate.
+-- Session statuses are compared as text: the Go services write ended and cancelled.
+CREATE VIEW tenant_stats AS
+SELECT
+    t.id AS tenant_id,
+    t.name AS tenant_name,
+    t.status,
+    COALESCE(u.user_count, 0) AS user_count,
+    COALESCE(u.owner_count, 0) AS owner_count,
+    u.last_login_at,
+    COALESCE(s.session_count, 0) AS session_count,
+    COALESCE(s.active_sessions, 0) AS active_sessions,
+    COALESCE(s.ended_sessions, 0) AS ended_sessions,
+    COALESCE(s.expired_sessions, 0) AS expired_sessions,
+    COALESCE(s.cancelled_sessions, 0) AS cancelled_sessions,
+    s.last_session_start,
+    COALESCE(l.location_count, 0) AS location_count,
+    l.last_location_update,
+    COALESCE(f.dlq_backlog, 0) AS dlq_backlog,
+    f.oldest_backlog_at,
+    GREATEST(u.last_login_at, s.last_session_start, l.last_location_update) AS last_activity_at
+FROM tenants t
+LEFT JOIN (
+    SELECT tenant_id,
+        COUNT(*) AS user_count,
+        COUNT(*) FILTER (WHERE role = 'tenant_owner') AS owner_count,
+        MAX(last_login_at) AS last_login_at
+    FROM users
+    GROUP BY tenant_id
+) u ON u.tenant_id = t.id
+LEFT JOIN (
+    SELECT tenant_id,
+        COUNT(*) AS session_count,
+        COUNT(*) FILTER (WHERE status::TEXT = 'active') AS active_sessions,
+        COUNT(*) FILTER (WHERE status::TEXT IN ('ended', 'completed')) AS ended_sessions,
+        COUNT(*) FILTER (WHERE status::TEXT = 'expired') AS expired_sessions,
+        COUNT(*) FILTER (WHERE status::TEXT = 'cancelled') AS cancelled_sessions,
+        MAX(started_at) AS last_session_start
+    FROM location_sessions
+    GROUP BY tenant_id
+) s ON s.tenant_id = t.id
+LEFT JOIN (
+    SELECT tenant_id,
+        COUNT(*) AS location_count,
+        MAX(created_at) AS last_location_update
+    FROM locations
+    GROUP BY tenant_id
+) l ON l.tenant_id = t.id
+LEFT JOIN (
+    SELECT tenant_id,
+        COUNT(*) AS dlq_backlog,
+        MIN(created_at) AS oldest_backlog_at
+    FROM failed_location_updates
+    WHERE status = 'pending'
+    GROUP BY tenant_id
+) f ON f.tenant_id = t.id
+WHERE t.status <> 'deleted';
+
+CREATE VIEW user_activity AS
+SELECT
+    u.cognito_id,
+    u.tenant_id,
+    t.name AS tenant_name,
+    u.role,
+    u.created_at,
+    u.last_login_at,
+    COALESCE(s.total_sessions, 0) AS total_sessions,
+    s.last_session_start,
+    COALESCE(l.total_locations, 0) AS total_locations,
+    l.last_location_update
+FROM users u
+JOIN tenants t ON t.id = u.tenant_id
+LEFT JOIN (
+    SELECT cognito_user_id,
+        COUNT(*) AS total_sessions,
+        MAX(started_at) AS last_session_start
+    FROM location_sessions
+    GROUP BY cognito_user_id
+) s ON s.cognito_user_id = u.cognito_id
+LEFT JOIN (
+    SELECT cognito_user_id,
+        COUNT(*) AS total_locations,
+        MAX(created_at) AS last_location_update
+    FROM locations
+    GROUP BY cognito_user_id
+) l ON l.cognito_user_id = u.cognito_id
+WHERE t.status <> 'deleted';
+
+-- Windowed counts of stats requests
+CREATE INDEX IF NOT EXISTS idx_location_sessions_tenant_started_at ON location_sessions(tenant_id, started_at);
+CREATE INDEX IF NOT EXISTS idx_failed_location_updates_tenant_created_at ON failed_location_updates(tenant_id, created_at);
+
+-- =====================================================
+-- TENANT STATISTICS VIEWS COMPLETE
+-- =====================================================
@@ -0,0 +1,58 @@
+-- =====================================================
+-- AUDIT EVENTS
+-- Append-only log of administrative actions: who did what
+-- to which target, what changed, and the request it came
+-- from. Events outlive their tenant, so there is no foreign
+-- key to tenants; purging a tenant keeps its audit trail.
+-- =====================================================
+
+CREATE TABLE IF NOT EXISTS audit_events (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    tenant_id UUID, -- NULL for platform-wide actions
+    actor_id VARCHAR(255) NOT NULL, -- Cognito ID, or 'system' for background jobs
+    actor_role VARCHAR(50) NOT NULL,
+    action VARCHAR(100) NOT NULL,
+    target_type VARCHAR(50) NOT NULL,
+    target_id VARCHAR(255) NOT NULL,
+    changes JSONB NOT NULL DEFAULT '{}', -- {"field": {"before": ..., "after": ...}}
+    metadata JSONB NOT NULL DEFAULT '{}',
+    request_id VARCHAR(255),
+    ip_address VARCHAR(64),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- A tenant's events, newest first, and the admin listing across tenants
+CREATE INDEX IF NOT EXISTS idx_audit_events_tenant_created_at ON audit_events(tenant_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_audit_events_created_at ON audit_events(created_at DESC);
+
+-- Filters
+CREATE INDEX IF NOT EXISTS idx_audit_events_action ON audit_events(action, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_audit_events_actor ON audit_events(actor_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_audit_events_target ON audit_events(target_type, target_id, created_at DESC);
+
+-- Rows can be inserted but never changed or removed
+CREATE OR REPLACE FUNCTION audit_events_append_only()
+RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_events is append-only; % is not allowed', TG_OP;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_events_no_update_delete ON audit_events;
+CREATE TRIGGER audit_events_no_update_delete
+    BEFORE UPDATE OR DELETE ON audit_events
+    FOR EACH ROW EXECUTE FUNCTION audit_events_append_only();
+
+DROP TRIGGER IF EXISTS audit_events_no_truncate ON audit_events;
+CREATE TRIGGER audit_events_no_truncate
+    BEFORE TRUNCATE ON audit_events
+    FOR EACH STATEMENT EXECUTE FUNCTION audit_events_append_only();
+
+ALTER TABLE audit_events ENABLE ROW LEVEL SECURITY;
+
+CREATE POLICY audit_events_isolation_policy ON audit_events
+    USING (tenant_id = current_setting('app.current_tenant_id', TRUE)::UUID);
+
+-- =====================================================
+-- AUDIT EVENTS COMPLETE
+-- =====================================================
@@ -0,0 +1,53 @@
+-- =====================================================
+-- TENANT EXPORTS
+-- Requests for a zip archive of a tenant's data, built in
+-- the background by the tenant service
+-- =====================================================
+
+CREATE TABLE IF NOT EXISTS tenant_exports (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    requested_by VARCHAR(255) NOT NULL,
+    format VARCHAR(10) NOT NULL CHECK (format IN ('ndjson', 'csv')),
+    status VARCHAR(20) NOT NULL DEFAULT 'pending'
+        CHECK (status IN ('pending', 'running', 'completed', 'failed', 'expired')),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    files_total INTEGER NOT NULL DEFAULT 0,
+    files_done INTEGER NOT NULL DEFAULT 0,
+    current_file VARCHAR(100),
+    records_total BIGINT NOT NULL DEFAULT 0,
+    records_exported BIGINT NOT NULL DEFAULT 0,
+    blob_key VARCHAR(500),
+    size_bytes BIGINT NOT NULL DEFAULT 0,
+    sha256 VARCHAR(64),
+    error TEXT,
+    started_at TIMESTAMP WITH TIME ZONE,
+    completed_at TIMESTAMP WITH TIME ZONE,
+    expires_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- A tenant's exports, newest first
+CREATE INDEX IF NOT EXISTS idx_tenant_exports_tenant ON tenant_exports(tenant_id, created_at DESC);
+
+-- The exporter claims the oldest waiting export
+CREATE INDEX IF NOT EXISTS idx_tenant_exports_active ON tenant_exports(status, created_at)
+    WHERE status IN ('pending', 'running');
+
+-- The exporter deletes archives once they expire
+CREATE INDEX IF NOT EXISTS idx_tenant_exports_expires_at ON tenant_exports(expires_at)
+    WHERE status = 'completed';
+
+-- At most one export per tenant is waiting or running
+CREATE UNIQUE INDEX IF NOT EXISTS idx_tenant_exports_one_active ON tenant_exports(tenant_id)
+    WHERE status IN ('pending', 'running');
+
+ALTER TABLE tenant_exports ENABLE ROW LEVEL SECURITY;
+
+CREATE POLICY tenant_exports_isolation_policy ON tenant_exports
+    USING (tenant_id = current_setting('app.current_tenant_id', TRUE)::UUID);
+
+-- =====================================================
+-- TENANT EXPORTS COMPLETE
+-- =====================================================
@@ -0,0 +1,167 @@
+-- =====================================================
+-- USER ERASURE AND LEGAL HOLDS
+-- user_erasures records right-to-erasure requests and what
+-- they erased; legal_holds preserve a tenant's data while
+-- in effect. Audit events of an erased user are
+-- pseudonymised through pseudonymise_audit_subject, which
+-- runs as audit_pseudonymiser, the only role whose changes
+-- audit_events accepts
+-- =====================================================
+
+CREATE TABLE IF NOT EXISTS legal_holds (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    reason TEXT NOT NULL,
+    reference VARCHAR(255),
+    placed_by VARCHAR(255) NOT NULL,
+    released_by VARCHAR(255),
+    released_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Active holds are checked before anything of a tenant is deleted
+CREATE INDEX IF NOT EXISTS idx_legal_holds_active ON legal_holds(tenant_id) WHERE released_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS user_erasures (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    cognito_id VARCHAR(255),
+    subject_hash VARCHAR(64) NOT NULL,
+    pseudonym VARCHAR(100) NOT NULL,
+    reason TEXT,
+    requested_by VARCHAR(255) NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending'
+        CHECK (status IN ('pending', 'held', 'blocked', 'completed', 'failed')),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    locations_deleted BIGINT NOT NULL DEFAULT 0,
+    location_sessions_deleted BIGINT NOT NULL DEFAULT 0,
+    failed_updates_deleted BIGINT NOT NULL DEFAULT 0,
+    invitations_deleted BIGINT NOT NULL DEFAULT 0,
+    usage_events_deleted BIGINT NOT NULL DEFAULT 0,
+    audit_events_pseudonymised BIGINT NOT NULL DEFAULT 0,
+    exports_expired BIGINT NOT NULL DEFAULT 0,
+    user_deleted BOOLEAN NOT NULL DEFAULT false,
+    cognito_user_deleted BOOLEAN NOT NULL DEFAULT false,
+    data_erased_at TIMESTAMP WITH TIME ZONE,
+    completed_at TIMESTAMP WITH TIME ZONE,
+    signature_algorithm VARCHAR(50),
+    signature VARCHAR(128),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- A tenant's erasures, newest first
+CREATE INDEX IF NOT EXISTS idx_user_erasures_tenant ON user_erasures(tenant_id, created_at DESC);
+
+-- The eraser works through outstanding requests, oldest first
+CREATE INDEX IF NOT EXISTS idx_user_erasures_outstanding ON user_erasures(status, created_at)
+    WHERE status IN ('pending', 'held', 'blocked');
+
+-- At most one outstanding erasure per user
+CREATE UNIQUE INDEX IF NOT EXISTS idx_user_erasures_one_outstanding ON user_erasures(tenant_id, subject_hash)
+    WHERE status IN ('pending', 'held', 'blocked');
+
+-- pseudonymise_audit_subject runs as this role, the only one whose audit_events updates
+-- the append-only trigger lets through. It can't log in, so the application can't take
+-- it on; it bypasses RLS because the function scopes itself to one tenant.
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_roles WHERE rolname = 'audit_pseudonymiser') THEN
+        CREATE ROLE audit_pseudonymiser NOLOGIN BYPASSRLS;
+    END IF;
+END
+$$;
+
+GRANT SELECT, UPDATE ON audit_events TO audit_pseudonymiser;
+GRANT SELECT ON user_erasures TO audit_pseudonymiser;
+
+-- Audit events stay append-only, except for updates made by pseudonymise_audit_subject:
+-- each must replace exactly the subject it was given with the pseudonym, leaving every
+-- other column as it was
+CREATE OR REPLACE FUNCTION audit_events_append_only()
+RETURNS trigger AS $$
+DECLARE
+    subject TEXT := current_setting('audit.pseudonymise_subject', TRUE);
+    pseudonym TEXT := current_setting('audit.pseudonymise_as', TRUE);
+BEGIN
+    IF TG_OP = 'UPDATE'
+        AND current_user = 'audit_pseudonymiser'
+        AND COALESCE(subject, '') <> ''
+        AND COALESCE(pseudonym, '') <> ''
+        AND NEW.id = OLD.id
+        AND NEW.tenant_id IS NOT DISTINCT FROM OLD.tenant_id
+        AND NEW.actor_role = OLD.actor_role
+        AND NEW.action = OLD.action
+        AND NEW.target_type = OLD.target_type
+        AND NEW.request_id IS NOT DISTINCT FROM OLD.request_id
+        AND NEW.created_at = OLD.created_at
+        AND NEW.actor_id = CASE WHEN OLD.actor_id = subject THEN pseudonym ELSE OLD.actor_id END
+        AND NEW.target_id = CASE WHEN OLD.target_id = subject THEN pseudonym ELSE OLD.target_id END
+        AND NEW.ip_address IS NOT DISTINCT FROM CASE WHEN OLD.actor_id = subject THEN NULL ELSE OLD.ip_address END
+        AND NEW.changes = replace(OLD.changes::text, to_jsonb(subject)::text, to_jsonb(pseudonym)::text)::jsonb
+        AND NEW.metadata = replace(OLD.metadata::text, to_jsonb(subject)::text, to_jsonb(pseudonym)::text)::jsonb THEN
+        RETURN NEW;
+    END IF;
+    RAISE EXCEPTION 'audit_events is append-only; % is not allowed', TG_OP;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Replaces p_subject (a Cognito ID or email) with p_pseudonym in the tenant's audit log:
+-- as actor or target, and as a whole string value in changes and metadata. Events the
+-- subject performed lose their IP address. p_pseudonym must be that of a pending erasure
+-- of the tenant. Returns the number of events changed.
+CREATE OR REPLACE FUNCTION pseudonymise_audit_subject(p_tenant_id UUID, p_subject TEXT, p_pseudonym TEXT)
+RETURNS BIGINT
+SECURITY DEFINER
+SET search_path = public, pg_temp
+AS $$
+DECLARE
+    quoted_subject TEXT := to_jsonb(p_subject)::text;
+    quoted_pseudonym TEXT := to_jsonb(p_pseudonym)::text;
+    changed BIGINT;
+BEGIN
+    IF COALESCE(p_subject, '') = '' OR NOT EXISTS (
+        SELECT 1 FROM user_erasures
+        WHERE tenant_id = p_tenant_id AND pseudonym = p_pseudonym AND status = 'pending'
+    ) THEN
+        RAISE EXCEPTION 'no pending erasure of tenant % has pseudonym %', p_tenant_id, p_pseudonym;
+    END IF;
+
+    PERFORM set_config('audit.pseudonymise_subject', p_subject, TRUE);
+    PERFORM set_config('audit.pseudonymise_as', p_pseudonym, TRUE);
+
+    UPDATE audit_events SET
+        ip_address = CASE WHEN actor_id = p_subject THEN NULL ELSE ip_address END,
+        actor_id = CASE WHEN actor_id = p_subject THEN p_pseudonym ELSE actor_id END,
+        target_id = CASE WHEN target_id = p_subject THEN p_pseudonym ELSE target_id END,
+        changes = replace(changes::text, quoted_subject, quoted_pseudonym)::jsonb,
+        metadata = replace(metadata::text, quoted_subject, quoted_pseudonym)::jsonb
+    WHERE tenant_id = p_tenant_id
+        AND (actor_id = p_subject
+            OR target_id = p_subject
+            OR strpos(changes::text, quoted_subject) > 0
+            OR strpos(metadata::text, quoted_subject) > 0);
+    GET DIAGNOSTICS changed = ROW_COUNT;
+
+    PERFORM set_config('audit.pseudonymise_subject', '', TRUE);
+    PERFORM set_config('audit.pseudonymise_as', '', TRUE);
+    RETURN changed;
+END;
+$$ LANGUAGE plpgsql;
+
+ALTER FUNCTION pseudonymise_audit_subject(UUID, TEXT, TEXT) OWNER TO audit_pseudonymiser;
+
+ALTER TABLE legal_holds ENABLE ROW LEVEL SECURITY;
+ALTER TABLE user_erasures ENABLE ROW LEVEL SECURITY;
+
+CREATE POLICY legal_holds_isolation_policy ON legal_holds
+    USING (tenant_id = current_setting('app.current_tenant_id', TRUE)::UUID);
+
+CREATE POLICY user_erasures_isolation_policy ON user_erasures
+    USING (tenant_id = current_setting('app.current_tenant_id', TRUE)::UUID);
+
+-- =====================================================
+-- USER ERASURE AND LEGAL HOLDS COMPLETE
+-- =====================================================
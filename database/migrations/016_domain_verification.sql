@@ -0,0 +1,33 @@
+-- =====================================================
+-- DOMAIN VERIFICATION
+-- A tenant's custom domain only resolves to it once the
+-- tenant proves control of it with a DNS TXT record or a
+-- well-known file; verified domains are re-checked
+-- =====================================================
+
+ALTER TABLE tenants
+    ADD COLUMN IF NOT EXISTS domain_status VARCHAR(20) NOT NULL DEFAULT 'pending'
+        CHECK (domain_status IN ('pending', 'verified', 'failed')),
+    ADD COLUMN IF NOT EXISTS domain_verification_token VARCHAR(64),
+    ADD COLUMN IF NOT EXISTS domain_token_issued_at TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN IF NOT EXISTS domain_verified_at TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN IF NOT EXISTS domain_verified_via VARCHAR(10),
+    ADD COLUMN IF NOT EXISTS domain_checked_at TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN IF NOT EXISTS domain_check_due TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN IF NOT EXISTS domain_check_failures INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS domain_error TEXT;
+
+-- Existing domains were never verified; they get a token and are checked right away
+UPDATE tenants SET
+    domain_verification_token = replace(gen_random_uuid()::text, '-', ''),
+    domain_token_issued_at = CURRENT_TIMESTAMP,
+    domain_check_due = CURRENT_TIMESTAMP
+WHERE domain_verification_token IS NULL AND status <> 'deleted';
+
+-- The domain checker picks up pending domains and verified ones due for re-verification
+CREATE INDEX IF NOT EXISTS idx_tenants_domain_check_due ON tenants(domain_check_due)
+    WHERE domain_status IN ('pending', 'verified');
+
+-- =====================================================
+-- DOMAIN VERIFICATION COMPLETE
+-- =====================================================
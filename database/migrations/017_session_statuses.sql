@@ -0,0 +1,13 @@
+-- =====================================================
+-- SESSION STATUSES
+-- The services end sessions as 'ended' and cancel them as
+-- 'cancelled' when their tenant leaves active; neither
+-- value was in the session_status enum
+-- =====================================================
+
+ALTER TYPE session_status ADD VALUE IF NOT EXISTS 'ended';
+ALTER TYPE session_status ADD VALUE IF NOT EXISTS 'cancelled';
+
+-- =====================================================
+-- SESSION STATUSES COMPLETE
+-- =====================================================
@@ -0,0 +1,14 @@
+-- =====================================================
+-- TENANT PURGING
+-- The purger claims a tenant by moving it from
+-- pending_deletion to purging before deleting anything
+-- outside the database; a purging tenant can't be reactivated
+-- =====================================================
+
+ALTER TABLE tenants DROP CONSTRAINT IF EXISTS tenants_status_check;
+ALTER TABLE tenants ADD CONSTRAINT tenants_status_check
+    CHECK (status IN ('active', 'suspended', 'pending_deletion', 'purging', 'deleted'));
+
+-- =====================================================
+-- TENANT PURGING COMPLETE
+-- =====================================================
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"time"
+
+	"github.com/pavitra93/go-multi-tenant-system/shared/config"
+	"github.com/pavitra93/go-multi-tenant-system/shared/middleware"
+)
+
+// Config is the API gateway configuration
+type Config struct {
+	Port     string `env:"API_GATEWAY_PORT" default:"8080" validate:"required"`
+	Server   config.ServerConfig
+	Secrets  config.SecretsConfig
+	Database config.DatabaseConfig
+	Redis    config.RedisConfig
+	Metrics  config.MetricsConfig
+
+	CORS           middleware.CORSConfig
+	TenantResolver middleware.TenantResolverConfig
+
+	Services ServiceURLs
+	Upstream UpstreamConfig
+}
+
+// ServiceURLs holds the base URL of each downstream service
+type ServiceURLs struct {
+	Auth          string `env:"AUTH_SERVICE_URL" validate:"required,url"`
+	Tenant        string `env:"TENANT_SERVICE_URL" validate:"required,url"`
+	Location      string `env:"LOCATION_SERVICE_URL" validate:"required,url"`
+	Streaming     string `env:"STREAMING_SERVICE_URL" validate:"required,url"`
+	RetryConsumer string `env:"RETRY_CONSUMER_SERVICE_URL" validate:"required,url"`
+}
+
+// UpstreamConfig tunes how the gateway calls downstream services
+type UpstreamConfig struct {
+	Timeout        time.Duration               `env:"UPSTREAM_TIMEOUT" default:"30s" validate:"gt=0"`
+	MaxRetries     int                         `env:"UPSTREAM_MAX_RETRIES" default:"2" validate:"min=0,max=10"`
+	RetryBaseDelay time.Duration               `env:"UPSTREAM_RETRY_BASE_DELAY" default:"100ms" validate:"gt=0"`
+	CircuitBreaker config.CircuitBreakerConfig `envPrefix:"UPSTREAM_"`
+}
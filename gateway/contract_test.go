@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/pavitra93/go-multi-tenant-system/api"
+	"github.com/pavitra93/go-multi-tenant-system/shared/middleware"
+)
+
+// TestAPIContract fails when the routes the gateway registers, the handler types and
+// api/openapi.json disagree. Regenerate the spec with `make openapi`.
+func TestAPIContract(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	upstream := UpstreamConfig{}
+	upstream.CircuitBreaker.MaxFailures = 5
+	serviceClients := &ServiceClients{
+		AuthService:          NewServiceClient("auth-service", "http://auth", upstream),
+		TenantService:        NewServiceClient("tenant-service", "http://tenant", upstream),
+		LocationService:      NewServiceClient("location-service", "http://location", upstream),
+		StreamingService:     NewServiceClient("streaming-service", "http://streaming", upstream),
+		RetryConsumerService: NewServiceClient("retry-consumer", "http://retry-consumer", upstream),
+	}
+
+	router := gin.New()
+	registerV1Routes(router.Group(api.V1), middleware.NewAuthMiddleware(nil),
+		middleware.NewTenantResolver(nil, middleware.TenantResolverConfig{}, nil), serviceClients)
+
+	drift, err := contractDrift(router)
+	if err != nil {
+		t.Fatalf("checking the published spec: %v", err)
+	}
+	for _, problem := range drift {
+		t.Error(problem)
+	}
+}
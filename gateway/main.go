@@ -1,131 +1,184 @@
 package main
 
 import (
-	"log"
-	"os"
+	"context"
+	"fmt"
+	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
+	"github.com/pavitra93/go-multi-tenant-system/api"
+	"github.com/pavitra93/go-multi-tenant-system/shared/config"
+	"github.com/pavitra93/go-multi-tenant-system/shared/logger"
+	"github.com/pavitra93/go-multi-tenant-system/shared/metrics"
 	"github.com/pavitra93/go-multi-tenant-system/shared/middleware"
+	"github.com/pavitra93/go-multi-tenant-system/shared/openapi"
+	"github.com/pavitra93/go-multi-tenant-system/shared/server"
+	"github.com/pavitra93/go-multi-tenant-system/shared/tracing"
 	"github.com/pavitra93/go-multi-tenant-system/shared/utils"
 	"github.com/sirupsen/logrus"
 )
 
 func main() {
-	// Load environment variables
-	if err := godotenv.Load(); err != nil {
+	// Load environment variables before configuring the logger so LOG_LEVEL/LOG_FORMAT apply
+	envErr := godotenv.Load()
+	logger.Init("api-gateway")
+	if envErr != nil {
 		logrus.Warn("No .env file found, using environment variables")
 	}
 
-	// Initialize Redis for caching
-	if err := utils.InitRedis(); err != nil {
-		logrus.Warnf("Failed to connect to Redis, caching disabled: %v", err)
+	// Initialize tracing (no-op exporter unless OTEL_TRACES_EXPORTER is set)
+	shutdownTracing, err := tracing.Init("api-gateway")
+	if err != nil {
+		logrus.WithError(err).Fatal("Failed to initialize tracing")
+	}
+	defer shutdownTracing(context.Background())
+
+	// Load and validate configuration; any problem stops startup
+	var cfg Config
+	if err := config.Load(&cfg); err != nil {
+		logrus.WithError(err).Fatal("Invalid configuration")
 	}
+	metrics.Configure(cfg.Metrics)
 
-	// Get AWS configuration
-	awsRegion := os.Getenv("AWS_REGION")
-	cognitoUserPoolID := os.Getenv("COGNITO_USER_POOL_ID")
+	// Cancelled on SIGINT/SIGTERM to begin graceful shutdown
+	ctx, stop := server.SignalContext()
+	defer stop()
 
-	if awsRegion == "" || cognitoUserPoolID == "" {
-		log.Fatal("AWS_REGION and COGNITO_USER_POOL_ID must be set")
+	// Metrics are scraped on an internal listener, not the public port
+	metrics.Serve(ctx, cfg.Metrics, cfg.Server)
+
+	// Resolve credentials from the secret provider and refresh them in the background
+	secrets, err := config.NewSecretManager(ctx, cfg.Secrets, &cfg)
+	if err != nil {
+		logrus.WithError(err).Fatal("Failed to load secrets")
 	}
+	go secrets.Run(ctx)
 
-	// Initialize authentication middleware
-	authMiddleware, err := middleware.NewAuthMiddleware(
-		awsRegion,
-		cognitoUserPoolID,
-	)
+	// Initialize Redis for caching
+	if err := utils.InitRedis(cfg.Redis.Options(secrets)); err != nil {
+		logrus.Warnf("Failed to connect to Redis, caching disabled: %v", err)
+	} else if err := metrics.RegisterRedisStats(utils.GetRedisClient()); err != nil {
+		logrus.Warnf("Failed to register Redis metrics: %v", err)
+	}
+
+	// Initialize database (user lookups for auth, tenant lookups for CORS)
+	db, err := cfg.Database.Connect(secrets)
 	if err != nil {
-		log.Fatal("Failed to initialize auth middleware:", err)
+		logrus.WithError(err).Fatal("Failed to connect to database")
+	}
+	if err := metrics.RegisterDBStats(db, cfg.Database.DBName); err != nil {
+		logrus.Warnf("Failed to register database metrics: %v", err)
 	}
 
+	// Initialize authentication middleware
+	authMiddleware := middleware.NewAuthMiddleware(db)
+
 	// Initialize service clients
 	serviceClients := &ServiceClients{
-		AuthService:          NewServiceClient(os.Getenv("AUTH_SERVICE_URL")),
-		TenantService:        NewServiceClient(os.Getenv("TENANT_SERVICE_URL")),
-		LocationService:      NewServiceClient(os.Getenv("LOCATION_SERVICE_URL")),
-		StreamingService:     NewServiceClient(os.Getenv("STREAMING_SERVICE_URL")),
-		RetryConsumerService: NewServiceClient(os.Getenv("RETRY_CONSUMER_SERVICE_URL")),
+		AuthService:          NewServiceClient("auth-service", cfg.Services.Auth, cfg.Upstream),
+		TenantService:        NewServiceClient("tenant-service", cfg.Services.Tenant, cfg.Upstream),
+		LocationService:      NewServiceClient("location-service", cfg.Services.Location, cfg.Upstream),
+		StreamingService:     NewServiceClient("streaming-service", cfg.Services.Streaming, cfg.Upstream),
+		RetryConsumerService: NewServiceClient("retry-consumer", cfg.Services.RetryConsumer, cfg.Upstream),
 	}
 
 	// Initialize Gin router
-	router := gin.Default()
+	router := gin.New()
+	// The client address is only taken from X-Forwarded-For when a trusted proxy set it
+	if err := router.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		logrus.WithError(err).Fatal("Invalid trusted proxies")
+	}
+	router.Use(gin.Recovery(), logger.RequestLogger())
 
-	// Add CORS middleware
-	router.Use(func(c *gin.Context) {
-		c.Header("Access-Control-Allow-Origin", "*")
-		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Accept, Authorization")
+	// Assign request IDs and start a trace for every request
+	router.Use(middleware.RequestTracing("api-gateway"))
+	router.Use(metrics.HTTPMiddleware("api-gateway"))
 
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(204)
-			return
-		}
+	// Add CORS middleware (configured origins plus active tenant domains)
+	router.Use(middleware.NewCORSMiddleware(db, cfg.CORS).Handler())
 
-		c.Next()
-	})
+	// Resolve the tenant from the Host header (custom domain or subdomain)
+	tenantResolver := middleware.NewTenantResolver(db, cfg.TenantResolver, cfg.Server.TrustedProxies)
+	router.Use(tenantResolver.ResolveTenant())
 
 	// Health check endpoint
 	router.GET("/health", func(c *gin.Context) {
 		utils.OKResponse(c, "API Gateway is healthy", nil)
 	})
 
-	// Authentication routes
-	auth := router.Group("/auth")
-	{
-		auth.POST("/login", serviceClients.AuthService.ProxyRequest)
-		auth.POST("/register", serviceClients.AuthService.ProxyRequest)
-		auth.POST("/refresh", serviceClients.AuthService.ProxyRequest)
-		auth.POST("/logout", authMiddleware.RequireAuth(), serviceClients.AuthService.ProxyRequest)
-	}
+	// Downstream service status with circuit breaker state (admin only)
+	router.GET("/status", authMiddleware.RequireAuth(), authMiddleware.RequireRole("admin"), func(c *gin.Context) {
+		utils.OKResponse(c, "Service status retrieved successfully", serviceClients.GetServiceStatus())
+	})
 
-	// Tenant management routes
-	tenants := router.Group("/tenants")
-	tenants.Use(authMiddleware.RequireAuth())
-	{
-		tenants.POST("/", authMiddleware.RequireRole("admin"), serviceClients.TenantService.ProxyRequest)
-		tenants.GET("/", authMiddleware.RequireRole("admin"), serviceClients.TenantService.ProxyRequest)
-
-		tenants.GET("/:id", authMiddleware.RequireTenantAccess(), serviceClients.TenantService.ProxyRequest)
-		tenants.PUT("/:id", authMiddleware.RequireTenantOwnerOrAdmin(), serviceClients.TenantService.ProxyRequest)
-		tenants.GET("/:id/users", authMiddleware.RequireTenantOwnerOrAdmin(), serviceClients.TenantService.ProxyRequest)
-		tenants.POST("/:id/users", authMiddleware.RequireTenantOwnerOrAdmin(), serviceClients.TenantService.ProxyRequest)
-	}
+	// Redacted effective configuration of the gateway or a downstream service (admin only)
+	router.GET("/admin/config/:service", authMiddleware.RequireAuth(), authMiddleware.RequireRole("admin"), handleConfigDump(&cfg, serviceClients))
+
+	// Published OpenAPI document for the versioned API
+	router.GET("/openapi.json", func(c *gin.Context) {
+		c.Data(http.StatusOK, "application/json", api.PublishedSpec())
+	})
 
-	// Location tracking routes
-	location := router.Group("/location")
-	location.Use(authMiddleware.RequireAuth())
-	{
-		location.POST("/session/start", serviceClients.LocationService.ProxyRequest)
-		location.POST("/session/:id/stop", serviceClients.LocationService.ProxyRequest)
-		location.GET("/sessions", serviceClients.LocationService.ProxyRequest)
+	// Versioned public API; add /v2 alongside when a breaking change ships
+	registerV1Routes(router.Group(api.V1, apiVersion(api.V1)), authMiddleware, tenantResolver, serviceClients)
 
-		location.POST("/update", serviceClients.LocationService.ProxyRequest)
-		location.GET("/session/:id/locations", serviceClients.LocationService.ProxyRequest)
+	// Unversioned aliases kept for existing clients
+	registerV1Routes(router.Group("", deprecatedUnversioned(api.V1)), authMiddleware, tenantResolver, serviceClients)
+
+	checkAPIContract(router)
+
+	// Serve until SIGINT/SIGTERM, then drain in-flight requests
+	runner := server.New("API Gateway", ":"+cfg.Port, router, cfg.Server)
+	if err := runner.Run(ctx); err != nil {
+		logrus.WithError(err).Fatal("API Gateway did not shut down cleanly")
 	}
+}
 
-	// Streaming observability routes
-	streaming := router.Group("/streaming")
-	streaming.Use(authMiddleware.RequireAuth())
-	{
-		streaming.GET("/health", serviceClients.StreamingService.ProxyRequest)
+// checkAPIContract logs drift between the published spec, the handler types and the registered routes.
+// `make contract` and the gateway's tests fail the build on the same drift; this catches images built
+// without them.
+func checkAPIContract(router *gin.Engine) {
+	drift, err := contractDrift(router)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to check published OpenAPI spec")
+		return
 	}
 
-	// Retry management routes (admin only)
-	retry := router.Group("/retry")
-	retry.Use(authMiddleware.RequireAuth(), authMiddleware.RequireRole("admin"))
-	{
-		retry.GET("/stats", serviceClients.RetryConsumerService.ProxyRequest)
+	for _, problem := range drift {
+		logrus.WithField("problem", problem).Error("OpenAPI spec drift detected")
 	}
+}
 
-	// Start server
-	port := os.Getenv("API_GATEWAY_PORT")
-	if port == "" {
-		port = "8080"
+// contractDrift lists the differences between the published spec, the handler types and
+// the routes registered on router
+func contractDrift(router *gin.Engine) ([]string, error) {
+	drift, err := api.CheckContract(api.PublishedSpec())
+	if err != nil {
+		return nil, err
 	}
+	return append(drift, openapi.UndocumentedRoutes(api.GenerateV1(), router.Routes(), api.V1)...), nil
+}
+
+// handleConfigDump serves the gateway's own redacted configuration, or proxies to the
+// internal /admin/config endpoint of the named downstream service
+func handleConfigDump(cfg *Config, serviceClients *ServiceClients) gin.HandlerFunc {
+	gatewayDump := config.DumpHandler("api-gateway", cfg)
+
+	return func(c *gin.Context) {
+		service := c.Param("service")
+		if service == "api-gateway" {
+			gatewayDump(c)
+			return
+		}
+
+		client := serviceClients.ByName(service)
+		if client == nil {
+			utils.NotFoundResponse(c, fmt.Sprintf("Unknown service %q", service))
+			return
+		}
 
-	logrus.Infof("API Gateway starting on port %s", port)
-	if err := router.Run(":" + port); err != nil {
-		log.Fatal("Failed to start API Gateway:", err)
+		c.Set(upstreamPathKey, "/admin/config")
+		client.ProxyRequest(c)
 	}
 }
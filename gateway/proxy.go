@@ -2,19 +2,41 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"math/rand"
+	"net"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/pavitra93/go-multi-tenant-system/shared/metrics"
+	"github.com/pavitra93/go-multi-tenant-system/shared/middleware"
+	"github.com/pavitra93/go-multi-tenant-system/shared/tracing"
 	"github.com/pavitra93/go-multi-tenant-system/shared/utils"
 )
 
+// errUpstreamUnavailable marks a 502/503/504 response so the circuit breaker counts it as a failure
+var errUpstreamUnavailable = errors.New("upstream service unavailable")
+
 // ServiceClient handles HTTP communication with microservices
 type ServiceClient struct {
-	baseURL    string
-	httpClient *http.Client
+	name           string
+	baseURL        string
+	httpClient     *http.Client
+	streamClient   *http.Client // Only the response headers are timed, see StreamRequest
+	circuitBreaker *utils.CircuitBreaker
+	maxRetries     int
+	retryBaseDelay time.Duration
+	retryAfter     time.Duration // Advertised to clients while the circuit is open
 }
 
 // ServiceClients holds all service clients
@@ -26,40 +48,238 @@ type ServiceClients struct {
 	RetryConsumerService *ServiceClient
 }
 
-// NewServiceClient creates a new service client
-func NewServiceClient(baseURL string) *ServiceClient {
-	return &ServiceClient{
+// NewServiceClient creates a new service client with its own circuit breaker
+func NewServiceClient(name, baseURL string, upstream UpstreamConfig) *ServiceClient {
+	streamTransport := http.DefaultTransport.(*http.Transport).Clone()
+	streamTransport.ResponseHeaderTimeout = upstream.Timeout
+
+	sc := &ServiceClient{
+		name:    name,
 		baseURL: baseURL,
 		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
+			Timeout: upstream.Timeout,
+		},
+		streamClient: &http.Client{
+			Transport: streamTransport,
 		},
+		// Open after MaxFailures consecutive failures, probe again after ResetTimeout
+		circuitBreaker: utils.NewCircuitBreaker(upstream.CircuitBreaker.MaxFailures, upstream.CircuitBreaker.ResetTimeout),
+		maxRetries:     upstream.MaxRetries,
+		retryBaseDelay: upstream.RetryBaseDelay,
+		retryAfter:     upstream.CircuitBreaker.ResetTimeout,
 	}
+
+	metrics.ObserveCircuitBreaker(name, sc.circuitBreaker)
+	return sc
 }
 
 // ProxyRequest proxies requests to the appropriate microservice
 func (sc *ServiceClient) ProxyRequest(c *gin.Context) {
 	// Build target URL
-	targetURL := sc.baseURL + c.Request.URL.Path
+	targetURL := sc.baseURL + upstreamPath(c)
 	if c.Request.URL.RawQuery != "" {
 		targetURL += "?" + c.Request.URL.RawQuery
 	}
 
-	// Create request
-	var body io.Reader
+	// Buffer the body so the request can be replayed on retry
+	var bodyBytes []byte
 	if c.Request.Body != nil {
-		bodyBytes, err := io.ReadAll(c.Request.Body)
+		var err error
+		bodyBytes, err = io.ReadAll(c.Request.Body)
 		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				utils.ErrorResponse(c, http.StatusRequestEntityTooLarge, fmt.Sprintf("Request body exceeds %d bytes", maxBytesErr.Limit))
+				return
+			}
 			utils.InternalServerErrorResponse(c, "Failed to read request body")
 			return
 		}
-		body = bytes.NewBuffer(bodyBytes)
 	}
 
-	req, err := http.NewRequest(c.Request.Method, targetURL, body)
+	// Client span for the upstream call; its context is injected into the outgoing headers
+	ctx, span := tracing.Tracer("api-gateway").Start(c.Request.Context(), "proxy "+sc.name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("http.url", targetURL)),
+	)
+	defer span.End()
+
+	var resp *http.Response
+	var responseBody []byte
+	err := sc.circuitBreaker.Call(func() error {
+		var callErr error
+		resp, callErr = sc.doWithRetry(ctx, c, targetURL, bodyBytes)
+		if callErr != nil {
+			return callErr
+		}
+		defer resp.Body.Close()
+
+		// Read response body
+		responseBody, callErr = io.ReadAll(resp.Body)
+		if callErr != nil {
+			return callErr
+		}
+
+		if isUnavailableStatus(resp.StatusCode) {
+			return errUpstreamUnavailable
+		}
+		return nil
+	})
+
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+	}
+	if resp != nil {
+		span.SetAttributes(attribute.Int("http.status_code", resp.StatusCode))
+	}
+
+	if err != nil && !errors.Is(err, errUpstreamUnavailable) {
+		sc.failureResponse(c, err, resp != nil)
+		return
+	}
+
+	// Copy response headers
+	copyResponseHeaders(c, resp)
+
+	// Set status and return response
+	c.Data(resp.StatusCode, resp.Header.Get("Content-Type"), responseBody)
+}
+
+// StreamRequest proxies a request whose response may be too large to buffer, such as an
+// export archive. The body is copied to the client as it arrives; only the wait for the
+// response headers is timed, and the request is never retried, since each attempt would
+// transfer the whole response again.
+func (sc *ServiceClient) StreamRequest(c *gin.Context) {
+	targetURL := sc.baseURL + upstreamPath(c)
+	if c.Request.URL.RawQuery != "" {
+		targetURL += "?" + c.Request.URL.RawQuery
+	}
+
+	ctx, span := tracing.Tracer("api-gateway").Start(c.Request.Context(), "proxy "+sc.name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("http.url", targetURL)),
+	)
+	defer span.End()
+
+	// The breaker judges the upstream by its response headers; a slow client reading the
+	// body is not the upstream's failure
+	var resp *http.Response
+	err := sc.circuitBreaker.Call(func() error {
+		req, callErr := sc.newUpstreamRequest(ctx, c, targetURL, nil)
+		if callErr != nil {
+			return callErr
+		}
+		resp, callErr = sc.streamClient.Do(req)
+		if callErr != nil {
+			return callErr
+		}
+		if isUnavailableStatus(resp.StatusCode) {
+			return errUpstreamUnavailable
+		}
+		return nil
+	})
+
 	if err != nil {
-		utils.InternalServerErrorResponse(c, "Failed to create request")
+		span.SetStatus(codes.Error, err.Error())
+	}
+	if resp != nil {
+		defer resp.Body.Close()
+		span.SetAttributes(attribute.Int("http.status_code", resp.StatusCode))
+	}
+
+	if err != nil && !errors.Is(err, errUpstreamUnavailable) {
+		sc.failureResponse(c, err, false)
+		return
+	}
+
+	copyResponseHeaders(c, resp)
+	c.Status(resp.StatusCode)
+	if _, err := io.Copy(c.Writer, resp.Body); err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		span.RecordError(err)
+	}
+}
+
+// failureResponse answers a request the upstream could not serve; read reports whether a
+// response arrived but could not be read
+func (sc *ServiceClient) failureResponse(c *gin.Context, err error, read bool) {
+	if err == utils.ErrCircuitOpen || err == utils.ErrTooManyRequests {
+		retryAfterSeconds := int(sc.retryAfter.Seconds())
+		c.Header("Retry-After", strconv.Itoa(retryAfterSeconds))
+		utils.CodedErrorResponse(c, utils.CodeCircuitOpen, fmt.Sprintf("%s is temporarily unavailable", sc.name), map[string]interface{}{
+			"service":             sc.name,
+			"retry_after_seconds": retryAfterSeconds,
+		})
+		return
+	}
+	if read {
+		utils.InternalServerErrorResponse(c, "Failed to read response")
 		return
 	}
+	utils.CodedErrorResponse(c, utils.CodeUpstreamUnavailable, "Failed to communicate with service", map[string]interface{}{
+		"service": sc.name,
+	})
+}
+
+// copyResponseHeaders passes the upstream response's headers on to the client
+func copyResponseHeaders(c *gin.Context, resp *http.Response) {
+	for key, values := range resp.Header {
+		for _, value := range values {
+			c.Header(key, value)
+		}
+	}
+}
+
+// doWithRetry sends the proxied request, retrying idempotent methods that could not connect
+func (sc *ServiceClient) doWithRetry(ctx context.Context, c *gin.Context, targetURL string, bodyBytes []byte) (*http.Response, error) {
+	attempts := 1
+	if isIdempotentMethod(c.Request.Method) {
+		attempts += sc.maxRetries
+	}
+
+	var lastErr error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			backoff := time.NewTimer(jitteredBackoff(sc.retryBaseDelay, attempt))
+			select {
+			case <-ctx.Done():
+				backoff.Stop()
+				return nil, ctx.Err()
+			case <-backoff.C:
+			}
+		}
+
+		req, err := sc.newUpstreamRequest(ctx, c, targetURL, bodyBytes)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := sc.httpClient.Do(req)
+		if err == nil {
+			return resp, nil
+		}
+		lastErr = err
+
+		// Client went away, or the upstream may still be working on the request
+		if ctx.Err() != nil || !isConnectError(err) {
+			break
+		}
+	}
+
+	return nil, lastErr
+}
+
+// newUpstreamRequest builds the outgoing request with the original headers and user context
+func (sc *ServiceClient) newUpstreamRequest(ctx context.Context, c *gin.Context, targetURL string, bodyBytes []byte) (*http.Request, error) {
+	var body io.Reader
+	if bodyBytes != nil {
+		body = bytes.NewReader(bodyBytes)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, c.Request.Method, targetURL, body)
+	if err != nil {
+		return nil, err
+	}
 
 	// Copy headers
 	for key, values := range c.Request.Header {
@@ -68,6 +288,9 @@ func (sc *ServiceClient) ProxyRequest(c *gin.Context) {
 		}
 	}
 
+	// Services see the client's address, not the gateway's, e.g. in audit events
+	req.Header.Set("X-Forwarded-For", c.ClientIP())
+
 	// Add user context headers
 	if userID, exists := c.Get("user_id"); exists {
 		req.Header.Set("X-User-ID", userID.(string))
@@ -81,31 +304,55 @@ func (sc *ServiceClient) ProxyRequest(c *gin.Context) {
 	if role, exists := c.Get("role"); exists {
 		req.Header.Set("X-User-Role", role.(string))
 	}
+	if resolvedTenantID := middleware.GetResolvedTenantID(c); resolvedTenantID != "" {
+		req.Header.Set(middleware.ResolvedTenantHeader, resolvedTenantID)
+	}
 
-	// Send request
-	resp, err := sc.httpClient.Do(req)
-	if err != nil {
-		utils.InternalServerErrorResponse(c, "Failed to communicate with service")
-		return
+	// Propagate request ID and trace context
+	if requestID := middleware.GetRequestIDFromContext(c); requestID != "" {
+		req.Header.Set(tracing.RequestIDHeader, requestID)
 	}
-	defer resp.Body.Close()
+	tracing.Inject(ctx, propagation.HeaderCarrier(req.Header))
 
-	// Read response body
-	responseBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		utils.InternalServerErrorResponse(c, "Failed to read response")
-		return
+	return req, nil
+}
+
+// isIdempotentMethod reports whether a request can be safely replayed
+func isIdempotentMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
 	}
+	return false
+}
 
-	// Copy response headers
-	for key, values := range resp.Header {
-		for _, value := range values {
-			c.Header(key, value)
-		}
+// isConnectError reports whether err means the request never reached the upstream, e.g. the
+// connection was refused. Timeouts are not, as a slow upstream would only get more load.
+func isConnectError(err error) bool {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return false
 	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
 
-	// Set status and return response
-	c.Data(resp.StatusCode, resp.Header.Get("Content-Type"), responseBody)
+// isUnavailableStatus reports whether an upstream status should count against the circuit breaker
+func isUnavailableStatus(statusCode int) bool {
+	return statusCode == http.StatusBadGateway ||
+		statusCode == http.StatusServiceUnavailable ||
+		statusCode == http.StatusGatewayTimeout
+}
+
+// jitteredBackoff returns an exponential delay with full jitter for the given attempt (1-based)
+func jitteredBackoff(base time.Duration, attempt int) time.Duration {
+	maxDelay := base * time.Duration(1<<(attempt-1))
+	return time.Duration(rand.Int63n(int64(maxDelay) + 1))
+}
+
+// CircuitState returns the current state of the client's circuit breaker
+func (sc *ServiceClient) CircuitState() utils.CircuitState {
+	return sc.circuitBreaker.GetState()
 }
 
 // HealthCheck checks if a service is healthy
@@ -128,59 +375,45 @@ func (sc *ServiceClient) HealthCheck() error {
 	return nil
 }
 
+// ByName returns the client for a downstream service, or nil if there is none
+func (scs *ServiceClients) ByName(name string) *ServiceClient {
+	for _, client := range []*ServiceClient{scs.AuthService, scs.TenantService, scs.LocationService, scs.StreamingService, scs.RetryConsumerService} {
+		if client.name == name {
+			return client
+		}
+	}
+	return nil
+}
+
 // GetServiceStatus returns the status of all services
 func (scs *ServiceClients) GetServiceStatus() map[string]interface{} {
 	status := make(map[string]interface{})
 
-	// Check auth service
-	if err := scs.AuthService.HealthCheck(); err != nil {
-		status["auth_service"] = map[string]interface{}{
-			"healthy": false,
-			"error":   err.Error(),
-		}
-	} else {
-		status["auth_service"] = map[string]interface{}{
-			"healthy": true,
-		}
-	}
+	status["auth_service"] = scs.AuthService.status()
+	status["tenant_service"] = scs.TenantService.status()
+	status["location_service"] = scs.LocationService.status()
 
-	// Check tenant service
-	if err := scs.TenantService.HealthCheck(); err != nil {
-		status["tenant_service"] = map[string]interface{}{
-			"healthy": false,
-			"error":   err.Error(),
-		}
-	} else {
-		status["tenant_service"] = map[string]interface{}{
-			"healthy": true,
-		}
-	}
+	// Streaming service is optional - background worker
+	streamingStatus := scs.StreamingService.status()
+	streamingStatus["note"] = "Background Kafka consumer"
+	status["streaming_service"] = streamingStatus
 
-	// Check location service
-	if err := scs.LocationService.HealthCheck(); err != nil {
-		status["location_service"] = map[string]interface{}{
-			"healthy": false,
-			"error":   err.Error(),
-		}
-	} else {
-		status["location_service"] = map[string]interface{}{
-			"healthy": true,
-		}
+	status["retry_consumer_service"] = scs.RetryConsumerService.status()
+
+	return status
+}
+
+// status reports health and circuit breaker state for a single service
+func (sc *ServiceClient) status() map[string]interface{} {
+	result := map[string]interface{}{
+		"healthy":         true,
+		"circuit_breaker": sc.CircuitState(),
 	}
 
-	// Check streaming service (optional - background worker)
-	if err := scs.StreamingService.HealthCheck(); err != nil {
-		status["streaming_service"] = map[string]interface{}{
-			"healthy": false,
-			"error":   err.Error(),
-			"note":    "Background Kafka consumer",
-		}
-	} else {
-		status["streaming_service"] = map[string]interface{}{
-			"healthy": true,
-			"note":    "Background Kafka consumer",
-		}
+	if err := sc.HealthCheck(); err != nil {
+		result["healthy"] = false
+		result["error"] = err.Error()
 	}
 
-	return status
+	return result
 }
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/pavitra93/go-multi-tenant-system/shared/config"
+	"github.com/pavitra93/go-multi-tenant-system/shared/utils"
+)
+
+// failingTransport fails every request with err, counting them
+type failingTransport struct {
+	err   error
+	calls atomic.Int32
+}
+
+func (t *failingTransport) RoundTrip(*http.Request) (*http.Response, error) {
+	t.calls.Add(1)
+	return nil, t.err
+}
+
+// timeoutError is a network error reporting a timeout
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+// newTestServiceClient returns a client whose requests all fail with err
+func newTestServiceClient(err error) (*ServiceClient, *failingTransport) {
+	transport := &failingTransport{err: err}
+	sc := NewServiceClient("test-service", "http://upstream.invalid", UpstreamConfig{
+		Timeout:        time.Second,
+		MaxRetries:     2,
+		RetryBaseDelay: time.Millisecond,
+		CircuitBreaker: config.CircuitBreakerConfig{MaxFailures: 2, ResetTimeout: time.Minute},
+	})
+	sc.httpClient.Transport = transport
+	return sc, transport
+}
+
+// testProxyContext returns a gin context for a request to the proxy with ctx
+func testProxyContext(ctx context.Context, method string) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(method, "/v1/tenants/", nil).WithContext(ctx)
+	return c
+}
+
+func TestDoWithRetry(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+
+	tests := []struct {
+		name      string
+		method    string
+		err       error
+		wantCalls int32
+	}{
+		{name: "GET connection refused", method: http.MethodGet, err: refused, wantCalls: 3},
+		{name: "DELETE connection refused", method: http.MethodDelete, err: refused, wantCalls: 3},
+		{name: "POST connection refused", method: http.MethodPost, err: refused, wantCalls: 1},
+		{name: "GET dial timeout", method: http.MethodGet, err: &net.OpError{Op: "dial", Net: "tcp", Err: timeoutError{}}, wantCalls: 1},
+		{name: "GET response timeout", method: http.MethodGet, err: timeoutError{}, wantCalls: 1},
+		{name: "GET connection reset", method: http.MethodGet, err: &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}, wantCalls: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc, transport := newTestServiceClient(tt.err)
+			c := testProxyContext(context.Background(), tt.method)
+
+			if _, err := sc.doWithRetry(c.Request.Context(), c, sc.baseURL+"/tenants/", nil); err == nil {
+				t.Fatal("doWithRetry() succeeded, want an error")
+			}
+			if calls := transport.calls.Load(); calls != tt.wantCalls {
+				t.Errorf("upstream calls = %d, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestDoWithRetryStopsWhenCancelled(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	sc, transport := newTestServiceClient(&net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED})
+	sc.retryBaseDelay = time.Hour
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c := testProxyContext(ctx, http.MethodGet)
+	time.AfterFunc(10*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, err := sc.doWithRetry(ctx, c, sc.baseURL+"/tenants/", nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("doWithRetry() error = %v, want context.Canceled", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("doWithRetry() returned after %v, want it to stop backing off when cancelled", elapsed)
+	}
+	if calls := transport.calls.Load(); calls != 1 {
+		t.Errorf("upstream calls = %d, want 1", calls)
+	}
+}
+
+func TestProxyRequestCancelledKeepsCircuitClosed(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	sc, _ := newTestServiceClient(context.Canceled)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	for i := 0; i < 5; i++ {
+		sc.ProxyRequest(testProxyContext(ctx, http.MethodGet))
+	}
+	if state := sc.CircuitState(); state != utils.StateClosed {
+		t.Errorf("circuit state = %q after cancelled requests, want %q", state, utils.StateClosed)
+	}
+
+	// Upstream failures still open it
+	sc.httpClient.Transport = &failingTransport{err: timeoutError{}}
+	for i := 0; i < 2; i++ {
+		sc.ProxyRequest(testProxyContext(context.Background(), http.MethodGet))
+	}
+	if state := sc.CircuitState(); state != utils.StateOpen {
+		t.Errorf("circuit state = %q after upstream timeouts, want %q", state, utils.StateOpen)
+	}
+}
+
+func TestStreamRequestOutlastsUpstreamTimeout(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var calls atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Content-Type", "application/zip")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("first part,"))
+		w.(http.Flusher).Flush()
+		// Longer than the upstream timeout, as a large archive would take
+		time.Sleep(300 * time.Millisecond)
+		w.Write([]byte("second part"))
+	}))
+	t.Cleanup(upstream.Close)
+
+	sc := NewServiceClient("tenant-service", upstream.URL, UpstreamConfig{
+		Timeout:        100 * time.Millisecond,
+		MaxRetries:     2,
+		RetryBaseDelay: time.Millisecond,
+		CircuitBreaker: config.CircuitBreakerConfig{MaxFailures: 5, ResetTimeout: time.Minute},
+	})
+
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodGet, "/v1/exports/1/download", nil)
+	sc.StreamRequest(c)
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", recorder.Code, http.StatusOK, recorder.Body)
+	}
+	if body := recorder.Body.String(); body != "first part,second part" {
+		t.Errorf("body = %q, want the whole archive", body)
+	}
+	if contentType := recorder.Header().Get("Content-Type"); contentType != "application/zip" {
+		t.Errorf("Content-Type = %q, want application/zip", contentType)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("upstream calls = %d, want 1", n)
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pavitra93/go-multi-tenant-system/shared/middleware"
+)
+
+// apiVersionKey is the gin context key holding the version prefix of the matched route
+const apiVersionKey = "api_version_prefix"
+
+// upstreamPathKey is the gin context key overriding the path a request is proxied to
+const upstreamPathKey = "upstream_path"
+
+// Request body limits enforced before a body is buffered for proxying
+const (
+	defaultBodyLimit  = 1 << 20 // 1 MiB
+	authBodyLimit     = 4 << 10
+	tenantBodyLimit   = 16 << 10
+	locationBodyLimit = 2 << 10
+)
+
+// registerV1Routes registers version 1 of the public API on group.
+// Keep it in sync with api.V1Routes; the gateway logs any mismatch at startup.
+func registerV1Routes(group *gin.RouterGroup, authMiddleware *middleware.AuthMiddleware, tenantResolver *middleware.TenantResolver, serviceClients *ServiceClients) {
+	group.Use(middleware.BodyLimit(defaultBodyLimit))
+
+	// Authentication routes
+	auth := group.Group("/auth", middleware.BodyLimit(authBodyLimit))
+	{
+		auth.POST("/login", serviceClients.AuthService.ProxyRequest)
+		auth.POST("/register", serviceClients.AuthService.ProxyRequest)
+		auth.POST("/invitations/accept", serviceClients.AuthService.ProxyRequest)
+		auth.POST("/refresh", serviceClients.AuthService.ProxyRequest)
+		auth.POST("/logout", authMiddleware.RequireAuth(), tenantResolver.RequireTenantMatch(), serviceClients.AuthService.ProxyRequest)
+		auth.POST("/confirm-email", authMiddleware.RequireAuth(), authMiddleware.RequireRole("admin"), serviceClients.AuthService.ProxyRequest)
+	}
+
+	// Tenant management routes
+	tenants := group.Group("/tenants", middleware.BodyLimit(tenantBodyLimit))
+	tenants.Use(authMiddleware.RequireAuth(), tenantResolver.RequireTenantMatch())
+	{
+		tenants.POST("/", authMiddleware.RequireRole("admin"), serviceClients.TenantService.ProxyRequest)
+		tenants.GET("/", authMiddleware.RequireRole("admin"), serviceClients.TenantService.ProxyRequest)
+		tenants.GET("/stats", authMiddleware.RequireRole("admin"), serviceClients.TenantService.ProxyRequest)
+		tenants.GET("/audit", authMiddleware.RequireRole("admin"), serviceClients.TenantService.ProxyRequest)
+		tenants.GET("/audit/export", authMiddleware.RequireRole("admin"), serviceClients.TenantService.ProxyRequest)
+
+		tenants.GET("/:id", authMiddleware.RequireTenantAccess(), serviceClients.TenantService.ProxyRequest)
+		tenants.PUT("/:id", authMiddleware.RequireTenantOwnerOrAdmin(), serviceClients.TenantService.ProxyRequest)
+		tenants.POST("/:id/suspend", authMiddleware.RequireRole("admin"), serviceClients.TenantService.ProxyRequest)
+		tenants.POST("/:id/reactivate", authMiddleware.RequireRole("admin"), serviceClients.TenantService.ProxyRequest)
+		tenants.DELETE("/:id", authMiddleware.RequireRole("admin"), serviceClients.TenantService.ProxyRequest)
+		tenants.GET("/:id/deletion-report", authMiddleware.RequireRole("admin"), serviceClients.TenantService.ProxyRequest)
+		tenants.PUT("/:id/plan", authMiddleware.RequireRole("admin"), serviceClients.TenantService.ProxyRequest)
+		tenants.GET("/:id/usage", authMiddleware.RequireTenantOwnerOrAdmin(), serviceClients.TenantService.ProxyRequest)
+		tenants.GET("/:id/stats", authMiddleware.RequireTenantOwnerOrAdmin(), serviceClients.TenantService.ProxyRequest)
+		tenants.GET("/:id/settings", authMiddleware.RequireTenantOwnerOrAdmin(), serviceClients.TenantService.ProxyRequest)
+		tenants.PUT("/:id/settings", authMiddleware.RequireRole("admin"), serviceClients.TenantService.ProxyRequest)
+		tenants.GET("/:id/settings/history", authMiddleware.RequireTenantOwnerOrAdmin(), serviceClients.TenantService.ProxyRequest)
+		tenants.GET("/:id/audit", authMiddleware.RequireTenantOwnerOrAdmin(), serviceClients.TenantService.ProxyRequest)
+		tenants.GET("/:id/audit/export", authMiddleware.RequireTenantOwnerOrAdmin(), serviceClients.TenantService.ProxyRequest)
+		tenants.POST("/:id/exports", authMiddleware.RequireTenantOwnerOrAdmin(), serviceClients.TenantService.ProxyRequest)
+		tenants.GET("/:id/exports", authMiddleware.RequireTenantOwnerOrAdmin(), serviceClients.TenantService.ProxyRequest)
+		tenants.GET("/:id/exports/:export_id", authMiddleware.RequireTenantOwnerOrAdmin(), serviceClients.TenantService.ProxyRequest)
+		tenants.GET("/:id/domain", authMiddleware.RequireTenantOwnerOrAdmin(), serviceClients.TenantService.ProxyRequest)
+		tenants.POST("/:id/domain/verify", authMiddleware.RequireTenantOwnerOrAdmin(), serviceClients.TenantService.ProxyRequest)
+		tenants.POST("/:id/legal-holds", authMiddleware.RequireRole("admin"), serviceClients.TenantService.ProxyRequest)
+		tenants.GET("/:id/legal-holds", authMiddleware.RequireRole("admin"), serviceClients.TenantService.ProxyRequest)
+		tenants.DELETE("/:id/legal-holds/:hold_id", authMiddleware.RequireRole("admin"), serviceClients.TenantService.ProxyRequest)
+		tenants.GET("/:id/users", authMiddleware.RequireTenantOwnerOrAdmin(), serviceClients.TenantService.ProxyRequest)
+		tenants.POST("/:id/users", authMiddleware.RequireTenantOwnerOrAdmin(), serviceClients.TenantService.ProxyRequest)
+		tenants.PATCH("/:id/users/:cognito_id", authMiddleware.RequireTenantOwnerOrAdmin(), serviceClients.TenantService.ProxyRequest)
+		tenants.DELETE("/:id/users/:cognito_id", authMiddleware.RequireTenantOwnerOrAdmin(), serviceClients.TenantService.ProxyRequest)
+		tenants.POST("/:id/transfer-ownership", authMiddleware.RequireTenantOwnerOrAdmin(), serviceClients.TenantService.ProxyRequest)
+		tenants.POST("/:id/users/:cognito_id/erasure", authMiddleware.RequireTenantOwnerOrAdmin(), serviceClients.TenantService.ProxyRequest)
+		tenants.GET("/:id/erasures", authMiddleware.RequireTenantOwnerOrAdmin(), serviceClients.TenantService.ProxyRequest)
+		tenants.GET("/:id/erasures/:erasure_id", authMiddleware.RequireTenantOwnerOrAdmin(), serviceClients.TenantService.ProxyRequest)
+		tenants.GET("/:id/invitations", authMiddleware.RequireTenantOwnerOrAdmin(), serviceClients.TenantService.ProxyRequest)
+		tenants.POST("/:id/invitations/:invitation_id/resend", authMiddleware.RequireTenantOwnerOrAdmin(), serviceClients.TenantService.ProxyRequest)
+		tenants.DELETE("/:id/invitations/:invitation_id", authMiddleware.RequireTenantOwnerOrAdmin(), serviceClients.TenantService.ProxyRequest)
+	}
+
+	// Export downloads; the signed link authorizes the request. Archives are streamed, not buffered.
+	exports := group.Group("/exports")
+	{
+		exports.GET("/:export_id/download", serviceClients.TenantService.StreamRequest)
+	}
+
+	// Location tracking routes
+	location := group.Group("/location", middleware.BodyLimit(locationBodyLimit))
+	location.Use(authMiddleware.RequireAuth(), tenantResolver.RequireTenantMatch())
+	{
+		location.POST("/session/start", serviceClients.LocationService.ProxyRequest)
+		location.POST("/session/:id/stop", serviceClients.LocationService.ProxyRequest)
+		location.GET("/sessions", serviceClients.LocationService.ProxyRequest)
+
+		location.POST("/update", serviceClients.LocationService.ProxyRequest)
+		location.GET("/session/:id/locations", serviceClients.LocationService.ProxyRequest)
+	}
+
+	// Billing exports (admin only)
+	billing := group.Group("/billing")
+	billing.Use(authMiddleware.RequireAuth(), authMiddleware.RequireRole("admin"))
+	{
+		billing.GET("/usage", serviceClients.TenantService.ProxyRequest)
+	}
+
+	// Streaming observability routes
+	streaming := group.Group("/streaming")
+	streaming.Use(authMiddleware.RequireAuth(), tenantResolver.RequireTenantMatch())
+	{
+		streaming.GET("/health", serviceClients.StreamingService.ProxyRequest)
+	}
+
+	// Retry management routes (admin only)
+	retry := group.Group("/retry")
+	retry.Use(authMiddleware.RequireAuth(), authMiddleware.RequireRole("admin"))
+	{
+		retry.GET("/stats", serviceClients.RetryConsumerService.ProxyRequest)
+	}
+}
+
+// apiVersion marks requests routed under a version prefix so the prefix is
+// stripped before proxying; services serve unversioned paths
+func apiVersion(prefix string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(apiVersionKey, prefix)
+		c.Next()
+	}
+}
+
+// deprecatedUnversioned flags legacy unversioned routes and points clients at the versioned path
+func deprecatedUnversioned(successor string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Deprecation", "true")
+		c.Header("Link", fmt.Sprintf("<%s%s>; rel=\"successor-version\"", successor, c.Request.URL.Path))
+		c.Next()
+	}
+}
+
+// upstreamPath returns the request path as served by the downstream service
+func upstreamPath(c *gin.Context) string {
+	if path := c.GetString(upstreamPathKey); path != "" {
+		return path
+	}
+	return strings.TrimPrefix(c.Request.URL.Path, c.GetString(apiVersionKey))
+}
@@ -0,0 +1,18 @@
+package main
+
+import (
+	"github.com/pavitra93/go-multi-tenant-system/shared/config"
+)
+
+// Config is the auth service configuration
+type Config struct {
+	Port     string `env:"AUTH_SERVICE_PORT" default:"8001" validate:"required"`
+	Server   config.ServerConfig
+	Secrets  config.SecretsConfig
+	Database config.DatabaseConfig
+	Redis    config.RedisConfig
+	Metrics  config.MetricsConfig
+
+	Cognito        config.CognitoConfig
+	CognitoBreaker config.CircuitBreakerConfig `envPrefix:"COGNITO_"`
+}
@@ -6,7 +6,6 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
-	"os"
 	"strings"
 	"time"
 
@@ -16,22 +15,30 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
-	"github.com/sirupsen/logrus"
 	"gorm.io/gorm"
 
+	"github.com/pavitra93/go-multi-tenant-system/shared/audit"
+	"github.com/pavitra93/go-multi-tenant-system/shared/config"
+	"github.com/pavitra93/go-multi-tenant-system/shared/logger"
+	"github.com/pavitra93/go-multi-tenant-system/shared/metrics"
+	"github.com/pavitra93/go-multi-tenant-system/shared/middleware"
 	"github.com/pavitra93/go-multi-tenant-system/shared/models"
+	"github.com/pavitra93/go-multi-tenant-system/shared/quota"
 	"github.com/pavitra93/go-multi-tenant-system/shared/utils"
+	"github.com/pavitra93/go-multi-tenant-system/shared/validation"
 )
 
 var (
-	cognitoClient  *cognitoidentityprovider.CognitoIdentityProvider
-	circuitBreaker *utils.CircuitBreaker
+	cognitoConfig       config.CognitoConfig
+	cognitoClientSecret *config.Secret
+	cognitoClient       *cognitoidentityprovider.CognitoIdentityProvider
+	circuitBreaker      *utils.CircuitBreaker
 )
 
 // generateSecretHash creates a secret hash for Cognito authentication
 func generateSecretHash(username string) string {
-	clientSecret := os.Getenv("COGNITO_CLIENT_SECRET")
-	clientId := os.Getenv("COGNITO_CLIENT_ID")
+	clientSecret := cognitoClientSecret.Value()
+	clientId := cognitoConfig.ClientID
 
 	if clientSecret == "" {
 		return ""
@@ -42,49 +49,29 @@ func generateSecretHash(username string) string {
 	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
 }
 
-func init() {
+// initCognito creates the Cognito client and the circuit breaker guarding its calls.
+// The client secret is read on every call so a rotated secret applies immediately.
+func initCognito(cognito config.CognitoConfig, clientSecret *config.Secret, breaker config.CircuitBreakerConfig) error {
 	sess, err := session.NewSession(&aws.Config{
-		Region: aws.String(os.Getenv("AWS_REGION")),
+		Region: aws.String(cognito.Region),
 	})
 	if err != nil {
-		panic("Failed to create AWS session: " + err.Error())
+		return fmt.Errorf("failed to create AWS session: %w", err)
 	}
+	cognitoConfig = cognito
+	cognitoClientSecret = clientSecret
 	cognitoClient = cognitoidentityprovider.New(sess)
 
-	// Initialize circuit breaker for Cognito calls (max 5 failures, 30 second reset)
-	circuitBreaker = utils.NewCircuitBreaker(5, 30*time.Second)
-}
-
-// LoginRequest represents the login request
-type LoginRequest struct {
-	Username string `json:"username" binding:"required"`
-	Password string `json:"password" binding:"required"`
-}
-
-// RegisterRequest represents the registration request
-type RegisterRequest struct {
-	Username string `json:"username" binding:"required"`
-	Password string `json:"password" binding:"required,min=8"`
-	TenantID string `json:"tenant_id,omitempty"` // Optional for admin users
-	Role     string `json:"role,omitempty"`      // Optional: admin, tenant_owner, or user (defaults to user)
-}
-
-// LoginResponse represents the login response
-type LoginResponse struct {
-	AccessToken  string           `json:"access_token"`
-	IdToken      string           `json:"id_token"` // ID token contains custom attributes
-	RefreshToken string           `json:"refresh_token"`
-	ExpiresIn    int64            `json:"expires_in"`
-	TokenType    string           `json:"token_type"`
-	UserInfo     *models.UserInfo `json:"user_info"` // Constructed from JWT claims
+	circuitBreaker = utils.NewCircuitBreaker(breaker.MaxFailures, breaker.ResetTimeout)
+	metrics.ObserveCircuitBreaker("cognito", circuitBreaker)
+	return nil
 }
 
 // handleLogin handles user login with circuit breaker
 func handleLogin(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var req LoginRequest
-		if err := c.ShouldBindJSON(&req); err != nil {
-			utils.BadRequestResponse(c, "Invalid request format")
+		var req models.LoginRequest
+		if !validation.BindJSON(c, &req) {
 			return
 		}
 
@@ -104,7 +91,7 @@ func handleLogin(db *gorm.DB) gin.HandlerFunc {
 
 		authInput := &cognitoidentityprovider.InitiateAuthInput{
 			AuthFlow:       aws.String("USER_PASSWORD_AUTH"),
-			ClientId:       aws.String(os.Getenv("COGNITO_CLIENT_ID")),
+			ClientId:       aws.String(cognitoConfig.ClientID),
 			AuthParameters: authParams,
 		}
 
@@ -117,9 +104,11 @@ func handleLogin(db *gorm.DB) gin.HandlerFunc {
 
 		if err != nil {
 			if err == utils.ErrCircuitOpen {
-				utils.ServiceUnavailableResponse(c, "Authentication service temporarily unavailable")
+				utils.CodedErrorResponse(c, utils.CodeCircuitOpen, "Authentication service temporarily unavailable", map[string]interface{}{
+					"service": "cognito",
+				})
 			} else {
-				utils.UnauthorizedResponse(c, "Invalid credentials")
+				utils.CodedErrorResponse(c, utils.CodeInvalidCredentials, "Invalid credentials", nil)
 			}
 			return
 		}
@@ -139,6 +128,27 @@ func handleLogin(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		// Users may only sign in through their own tenant's domain
+		if resolvedTenantID := middleware.GetResolvedTenantID(c); resolvedTenantID != "" && !userProfile.IsAdmin {
+			if userProfile.TenantID == nil || userProfile.TenantID.String() != resolvedTenantID {
+				utils.CodedErrorResponse(c, utils.CodeInvalidCredentials, "Invalid credentials", nil)
+				return
+			}
+		}
+
+		// Users of a suspended or deleted tenant cannot sign in
+		if !userProfile.IsAdmin && userProfile.TenantID != nil {
+			status, err := middleware.GetTenantStatus(db, *userProfile.TenantID)
+			if err != nil {
+				utils.InternalServerErrorResponse(c, "Failed to verify tenant status")
+				return
+			}
+			if !status.AllowsAccess() {
+				middleware.TenantUnavailableResponse(c, status)
+				return
+			}
+		}
+
 		sessionTTL := time.Duration(*authResult.AuthenticationResult.ExpiresIn) * time.Second
 		session, err := utils.CreateTokenSession(accessToken, userProfile, sessionTTL)
 		if err != nil {
@@ -146,21 +156,26 @@ func handleLogin(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		log := logger.FromContext(c).WithField("user_id", userProfile.CognitoID)
 		go func() {
 			now := time.Now()
+			var err error
 			if userProfile.IsAdmin {
-				db.Model(&models.Admin{}).Where("cognito_id = ?", userProfile.CognitoID).Update("last_login_at", now)
+				err = db.Model(&models.Admin{}).Where("cognito_id = ?", userProfile.CognitoID).Update("last_login_at", now).Error
 			} else {
-				db.Model(&models.User{}).Where("cognito_id = ?", userProfile.CognitoID).Update("last_login_at", now)
+				err = db.Model(&models.User{}).Where("cognito_id = ?", userProfile.CognitoID).Update("last_login_at", now).Error
+			}
+			if err != nil {
+				log.WithError(err).Warn("Failed to update last login timestamp")
 			}
 		}()
 
-		response := map[string]interface{}{
-			"access_token": accessToken,
-			"expires_in":   *authResult.AuthenticationResult.ExpiresIn,
-			"token_type":   "Bearer",
-			"user_info":    userProfile,
-			"session_id":   session.SessionID,
+		response := models.LoginResponse{
+			AccessToken: accessToken,
+			ExpiresIn:   *authResult.AuthenticationResult.ExpiresIn,
+			TokenType:   "Bearer",
+			UserInfo:    userProfile,
+			SessionID:   session.SessionID,
 		}
 
 		utils.OKResponse(c, "Login successful", response)
@@ -168,32 +183,26 @@ func handleLogin(db *gorm.DB) gin.HandlerFunc {
 }
 
 // handleRegister handles user registration with proper distributed transaction handling
-func handleRegister(db *gorm.DB) gin.HandlerFunc {
+func handleRegister(db *gorm.DB, quotas *quota.Enforcer) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var req RegisterRequest
-		if err := c.ShouldBindJSON(&req); err != nil {
-			utils.BadRequestResponse(c, "Invalid request format")
+		var req models.RegisterRequest
+		if !validation.BindJSON(c, &req) {
 			return
 		}
 
-		// Determine user role (default to "user" if not specified)
+		// Anyone can register, so only as a user; owners join by invitation or promotion
 		userRole := models.RoleUser
-		if req.Role != "" {
-			// Validate role
-			switch req.Role {
-			case "tenant_owner", "user":
-				userRole = models.UserRole(req.Role)
-			case "admin":
-				// Admin users are handled separately
-				utils.BadRequestResponse(c, "Admin users must be created through a separate process")
-				return
-			default:
-				utils.BadRequestResponse(c, "Invalid role. Must be 'tenant_owner' or 'user'")
+
+		// Tenant comes from the request host when resolved by the gateway
+		if resolvedTenantID := middleware.GetResolvedTenantID(c); resolvedTenantID != "" {
+			if req.TenantID != "" && req.TenantID != resolvedTenantID {
+				utils.BadRequestResponse(c, "Tenant ID does not match the requested domain")
 				return
 			}
+			req.TenantID = resolvedTenantID
 		}
 
-		// All users must provide a tenant ID
+		// All users must belong to a tenant
 		if req.TenantID == "" {
 			utils.BadRequestResponse(c, "Tenant ID is required")
 			return
@@ -207,7 +216,18 @@ func handleRegister(db *gorm.DB) gin.HandlerFunc {
 
 		var tenant models.Tenant
 		if err := db.Where("id = ?", parsedTenantID).First(&tenant).Error; err != nil {
-			utils.NotFoundResponse(c, "Tenant not found")
+			utils.CodedErrorResponse(c, utils.CodeTenantNotFound, "Tenant not found", nil)
+			return
+		}
+		if !tenant.Status.AllowsAccess() {
+			middleware.TenantUnavailableResponse(c, tenant.Status)
+			return
+		}
+
+		// Hold a place under the plan's user limit; given back if registration fails
+		ctx := c.Request.Context()
+		if err := quotas.ReserveUser(ctx, parsedTenantID); err != nil {
+			quota.ExceededResponse(c, err)
 			return
 		}
 
@@ -224,66 +244,25 @@ func handleRegister(db *gorm.DB) gin.HandlerFunc {
 			Role:      userRole,
 			CreatedAt: time.Now(),
 		}
-		userAttributes := []*cognitoidentityprovider.AttributeType{
-			{
-				Name:  aws.String("custom:role"),
-				Value: aws.String(string(userRole)),
-			},
-			{
-				Name:  aws.String("email"),
-				Value: aws.String(req.Username),
-			},
-		}
-
-		userAttributes = append(userAttributes, &cognitoidentityprovider.AttributeType{
-			Name:  aws.String("custom:tenant_id"),
-			Value: aws.String(parsedTenantID.String()),
-		})
-
-		signUpInput := &cognitoidentityprovider.SignUpInput{
-			ClientId:       aws.String(os.Getenv("COGNITO_CLIENT_ID")),
-			Username:       aws.String(req.Username),
-			Password:       aws.String(req.Password),
-			UserAttributes: userAttributes,
-		}
-
-		if secretHash := generateSecretHash(req.Username); secretHash != "" {
-			signUpInput.SecretHash = aws.String(secretHash)
-		}
-
-		var signUpResult *cognitoidentityprovider.SignUpOutput
-		cognitoErr := circuitBreaker.Call(func() error {
-			var err error
-			signUpResult, err = cognitoClient.SignUp(signUpInput)
-			return err
-		})
 
+		cognitoID, cognitoErr := signUpCognitoUser(req.Username, req.Password, parsedTenantID, userRole)
 		if cognitoErr != nil {
 			tx.Rollback()
+			quotas.ReleaseUser(ctx, parsedTenantID)
 			if cognitoErr == utils.ErrCircuitOpen {
-				utils.ServiceUnavailableResponse(c, "Authentication service temporarily unavailable")
+				utils.CodedErrorResponse(c, utils.CodeCircuitOpen, "Authentication service temporarily unavailable", map[string]interface{}{
+					"service": "cognito",
+				})
 			} else {
 				utils.BadRequestResponse(c, "Failed to register user: "+cognitoErr.Error())
 			}
 			return
 		}
 
-		user.CognitoID = *signUpResult.UserSub
-		if err := tx.Create(&user).Error; err != nil {
-			compensateErr := circuitBreaker.Call(func() error {
-				_, deleteErr := cognitoClient.AdminDeleteUser(&cognitoidentityprovider.AdminDeleteUserInput{
-					UserPoolId: aws.String(os.Getenv("COGNITO_USER_POOL_ID")),
-					Username:   aws.String(req.Username),
-				})
-				return deleteErr
-			})
-
-			if compensateErr != nil {
-				logrus.WithFields(logrus.Fields{
-					"username": req.Username,
-					"error":    compensateErr,
-				}).Warn("Failed to compensate orphaned Cognito user")
-			}
+		user.CognitoID = cognitoID
+		if err := createRegisteredUser(c, tx, &user, req.Username); err != nil {
+			compensateCognitoUser(c, req.Username)
+			quotas.ReleaseUser(ctx, parsedTenantID)
 
 			tx.Rollback()
 			utils.InternalServerErrorResponse(c, "Failed to complete registration")
@@ -291,41 +270,100 @@ func handleRegister(db *gorm.DB) gin.HandlerFunc {
 		}
 
 		if err := tx.Commit().Error; err != nil {
-			_ = circuitBreaker.Call(func() error {
-				_, deleteErr := cognitoClient.AdminDeleteUser(&cognitoidentityprovider.AdminDeleteUserInput{
-					UserPoolId: aws.String(os.Getenv("COGNITO_USER_POOL_ID")),
-					Username:   aws.String(req.Username),
-				})
-				return deleteErr
-			})
+			compensateCognitoUser(c, req.Username)
+			quotas.ReleaseUser(ctx, parsedTenantID)
 
 			utils.InternalServerErrorResponse(c, "Failed to complete registration")
 			return
 		}
 
 		// Return success with user info (no sensitive data exposed)
-		userResponse := map[string]interface{}{
-			"cognito_id": user.CognitoID,
-			"username":   req.Username,
-			"role":       string(userRole),
-			"message":    "User registered successfully. Please confirm email before login.",
+		userResponse := models.RegisterResponse{
+			CognitoID: user.CognitoID,
+			Username:  req.Username,
+			Role:      string(userRole),
+			TenantID:  user.TenantID,
+			Message:   "User registered successfully. Please confirm email before login.",
 		}
 
-		// Include tenant_id for tenant users
-		userResponse["tenant_id"] = user.TenantID
 		utils.CreatedResponse(c, "User registered successfully", userResponse)
 	}
 }
 
+// createRegisteredUser creates the user row of a self-registration and audits it, the
+// new user being the actor
+func createRegisteredUser(c *gin.Context, tx *gorm.DB, user *models.User, username string) error {
+	if err := tx.Create(user).Error; err != nil {
+		return err
+	}
+
+	actor := audit.FromContext(c)
+	actor.ID, actor.Role = user.CognitoID, string(user.Role)
+	event := actor.Event(audit.UserRegistered, user.TenantID, audit.TargetUser, user.CognitoID)
+	event.Changes = audit.Diff(nil, user)
+	event.Metadata["username"] = username
+	return audit.Record(tx, event)
+}
+
+// signUpCognitoUser creates a Cognito user in the tenant with the given role and returns its sub
+func signUpCognitoUser(username, password string, tenantID uuid.UUID, role models.UserRole) (string, error) {
+	signUpInput := &cognitoidentityprovider.SignUpInput{
+		ClientId: aws.String(cognitoConfig.ClientID),
+		Username: aws.String(username),
+		Password: aws.String(password),
+		UserAttributes: []*cognitoidentityprovider.AttributeType{
+			{
+				Name:  aws.String("custom:role"),
+				Value: aws.String(string(role)),
+			},
+			{
+				Name:  aws.String("email"),
+				Value: aws.String(username),
+			},
+			{
+				Name:  aws.String("custom:tenant_id"),
+				Value: aws.String(tenantID.String()),
+			},
+		},
+	}
+
+	if secretHash := generateSecretHash(username); secretHash != "" {
+		signUpInput.SecretHash = aws.String(secretHash)
+	}
+
+	var signUpResult *cognitoidentityprovider.SignUpOutput
+	err := circuitBreaker.Call(func() error {
+		var err error
+		signUpResult, err = cognitoClient.SignUp(signUpInput)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return *signUpResult.UserSub, nil
+}
+
+// compensateCognitoUser deletes a Cognito user whose database record could not be created
+func compensateCognitoUser(c *gin.Context, username string) {
+	err := circuitBreaker.Call(func() error {
+		_, deleteErr := cognitoClient.AdminDeleteUser(&cognitoidentityprovider.AdminDeleteUserInput{
+			UserPoolId: aws.String(cognitoConfig.UserPoolID),
+			Username:   aws.String(username),
+		})
+		return deleteErr
+	})
+	if err != nil {
+		logger.FromContext(c).WithError(err).WithField("username", username).
+			Warn("Failed to compensate orphaned Cognito user")
+	}
+}
+
 // handleRefreshToken handles token refresh
 func handleRefreshToken(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var req struct {
-			RefreshToken string `json:"refresh_token" binding:"required"`
-		}
+		var req models.RefreshTokenRequest
 
-		if err := c.ShouldBindJSON(&req); err != nil {
-			utils.BadRequestResponse(c, "Invalid request format")
+		if !validation.BindJSON(c, &req) {
 			return
 		}
 
@@ -343,20 +381,20 @@ func handleRefreshToken(db *gorm.DB) gin.HandlerFunc {
 
 		authInput := &cognitoidentityprovider.InitiateAuthInput{
 			AuthFlow:       aws.String("REFRESH_TOKEN_AUTH"),
-			ClientId:       aws.String(os.Getenv("COGNITO_CLIENT_ID")),
+			ClientId:       aws.String(cognitoConfig.ClientID),
 			AuthParameters: authParams,
 		}
 
 		authResult, err := cognitoClient.InitiateAuth(authInput)
 		if err != nil {
-			utils.UnauthorizedResponse(c, "Invalid refresh token")
+			utils.CodedErrorResponse(c, utils.CodeInvalidToken, "Invalid refresh token", nil)
 			return
 		}
 
-		response := map[string]interface{}{
-			"access_token": *authResult.AuthenticationResult.AccessToken,
-			"expires_in":   *authResult.AuthenticationResult.ExpiresIn,
-			"token_type":   "Bearer",
+		response := models.RefreshTokenResponse{
+			AccessToken: *authResult.AuthenticationResult.AccessToken,
+			ExpiresIn:   *authResult.AuthenticationResult.ExpiresIn,
+			TokenType:   "Bearer",
 		}
 
 		utils.OKResponse(c, "Token refreshed successfully", response)
@@ -366,19 +404,15 @@ func handleRefreshToken(db *gorm.DB) gin.HandlerFunc {
 // handleConfirmEmail handles manual email confirmation (admin only)
 func handleConfirmEmail(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var req struct {
-			Username string `json:"username" binding:"required"`
-		}
-
-		if err := c.ShouldBindJSON(&req); err != nil {
-			utils.BadRequestResponse(c, "Invalid request format")
+		var req models.ConfirmEmailRequest
+		if !validation.BindJSON(c, &req) {
 			return
 		}
 
 		// Confirm user email in Cognito
 		err := circuitBreaker.Call(func() error {
 			_, confirmErr := cognitoClient.AdminConfirmSignUp(&cognitoidentityprovider.AdminConfirmSignUpInput{
-				UserPoolId: aws.String(os.Getenv("COGNITO_USER_POOL_ID")),
+				UserPoolId: aws.String(cognitoConfig.UserPoolID),
 				Username:   aws.String(req.Username),
 			})
 			return confirmErr
@@ -389,11 +423,55 @@ func handleConfirmEmail(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		utils.OKResponse(c, "Email confirmed successfully", map[string]interface{}{
-			"username": req.Username,
-			"message":  "User can now login",
+		// The event belongs to the user's tenant, so its owners can see it too
+		log := logger.FromContext(c).WithField("username", req.Username)
+		cognitoID, tenantID, err := lookupCognitoUser(req.Username)
+		if err != nil {
+			log.WithError(err).Warn("Failed to look up confirmed user; auditing without their tenant")
+			cognitoID = req.Username
+		}
+		event := audit.FromContext(c).Event(audit.UserEmailConfirmed, tenantID, audit.TargetUser, cognitoID)
+		event.Metadata["username"] = req.Username
+		if err := audit.Record(db, event); err != nil {
+			log.WithError(err).Error("Failed to audit email confirmation")
+		}
+
+		utils.OKResponse(c, "Email confirmed successfully", models.ConfirmEmailResponse{
+			Username: req.Username,
+			Message:  "User can now login",
+		})
+	}
+}
+
+// lookupCognitoUser returns the Cognito ID and tenant of the user named username
+func lookupCognitoUser(username string) (string, uuid.UUID, error) {
+	var output *cognitoidentityprovider.AdminGetUserOutput
+	err := circuitBreaker.Call(func() error {
+		var err error
+		output, err = cognitoClient.AdminGetUser(&cognitoidentityprovider.AdminGetUserInput{
+			UserPoolId: aws.String(cognitoConfig.UserPoolID),
+			Username:   aws.String(username),
 		})
+		return err
+	})
+	if err != nil {
+		return "", uuid.Nil, err
+	}
+
+	var cognitoID string
+	var tenantID uuid.UUID
+	for _, attribute := range output.UserAttributes {
+		switch aws.StringValue(attribute.Name) {
+		case "sub":
+			cognitoID = aws.StringValue(attribute.Value)
+		case "custom:tenant_id":
+			tenantID, _ = uuid.Parse(aws.StringValue(attribute.Value))
+		}
+	}
+	if cognitoID == "" {
+		return "", uuid.Nil, fmt.Errorf("user %s has no sub attribute", username)
 	}
+	return cognitoID, tenantID, nil
 }
 
 // extractUserInfoFromToken parses the JWT access token and extracts user information
@@ -507,8 +585,19 @@ func handleLogout(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		utils.OKResponse(c, "Logout successful", map[string]interface{}{
-			"message": "Session revoked successfully",
+		actor := audit.FromContext(c)
+		tenantID, _ := uuid.Parse(c.GetString("tenant_id"))
+		event := actor.Event(audit.SessionRevoked, tenantID, audit.TargetUser, actor.ID)
+		event.Metadata["cause"] = "logout"
+		if session, ok := c.Value("session").(*models.TokenSession); ok {
+			event.Metadata["session_id"] = session.SessionID
+		}
+		if err := audit.Record(db, event); err != nil {
+			logger.FromContext(c).WithError(err).Warn("Failed to audit logout")
+		}
+
+		utils.OKResponse(c, "Logout successful", models.LogoutResponse{
+			Message: "Session revoked successfully",
 		})
 	}
 }
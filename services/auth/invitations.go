@@ -0,0 +1,168 @@
+package main
+
+import (
+	"errors"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/cognitoidentityprovider"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/pavitra93/go-multi-tenant-system/shared/audit"
+	"github.com/pavitra93/go-multi-tenant-system/shared/logger"
+	"github.com/pavitra93/go-multi-tenant-system/shared/middleware"
+	"github.com/pavitra93/go-multi-tenant-system/shared/models"
+	"github.com/pavitra93/go-multi-tenant-system/shared/quota"
+	"github.com/pavitra93/go-multi-tenant-system/shared/utils"
+	"github.com/pavitra93/go-multi-tenant-system/shared/validation"
+)
+
+// errInvitationTaken means the invitation was accepted or revoked while this request ran
+var errInvitationTaken = errors.New("invitation is no longer pending")
+
+// handleAcceptInvitation creates the invited user in Cognito and the tenant.
+// The invite link proves the email address, so the account is confirmed immediately.
+func handleAcceptInvitation(db *gorm.DB, quotas *quota.Enforcer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req models.AcceptInvitationRequest
+		if !validation.BindJSON(c, &req) {
+			return
+		}
+
+		var invitation models.Invitation
+		if err := db.Where("token_hash = ?", utils.HashToken(req.Token)).First(&invitation).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				utils.CodedErrorResponse(c, utils.CodeInvitationNotFound, "Invitation not found", nil)
+			} else {
+				utils.InternalServerErrorResponse(c, "Failed to fetch invitation")
+			}
+			return
+		}
+		if invitation.Status != models.InvitationStatusPending {
+			utils.CodedErrorResponse(c, utils.CodeInvitationNotPending, "Invitation is no longer pending", map[string]interface{}{
+				"status": invitation.Status,
+			})
+			return
+		}
+		if invitation.IsExpired() {
+			utils.CodedErrorResponse(c, utils.CodeInvitationExpired, "Invitation has expired; ask for it to be resent", map[string]interface{}{
+				"expired_at": invitation.ExpiresAt,
+			})
+			return
+		}
+
+		// Invitations are accepted on their own tenant's host
+		if resolvedTenantID := middleware.GetResolvedTenantID(c); resolvedTenantID != "" && resolvedTenantID != invitation.TenantID.String() {
+			utils.CodedErrorResponse(c, utils.CodeInvitationNotFound, "Invitation not found", nil)
+			return
+		}
+
+		status, err := middleware.GetTenantStatus(db, invitation.TenantID)
+		if err != nil {
+			utils.InternalServerErrorResponse(c, "Failed to verify tenant status")
+			return
+		}
+		if !status.AllowsAccess() {
+			middleware.TenantUnavailableResponse(c, status)
+			return
+		}
+
+		// Invitations don't hold a place under the user limit; it is checked on acceptance
+		ctx := c.Request.Context()
+		if err := quotas.ReserveUser(ctx, invitation.TenantID); err != nil {
+			quota.ExceededResponse(c, err)
+			return
+		}
+
+		log := logger.FromContext(c).WithField("invitation_id", invitation.ID)
+
+		cognitoID, err := signUpCognitoUser(invitation.Email, req.Password, invitation.TenantID, invitation.Role)
+		if err != nil {
+			quotas.ReleaseUser(ctx, invitation.TenantID)
+			var aerr awserr.Error
+			switch {
+			case err == utils.ErrCircuitOpen:
+				utils.CodedErrorResponse(c, utils.CodeCircuitOpen, "Authentication service temporarily unavailable", map[string]interface{}{
+					"service": "cognito",
+				})
+			case errors.As(err, &aerr) && aerr.Code() == cognitoidentityprovider.ErrCodeUsernameExistsException:
+				utils.CodedErrorResponse(c, utils.CodeUserAlreadyExists, "An account with this email already exists", nil)
+			default:
+				utils.BadRequestResponse(c, "Failed to create user: "+err.Error())
+			}
+			return
+		}
+
+		err = circuitBreaker.Call(func() error {
+			_, confirmErr := cognitoClient.AdminConfirmSignUp(&cognitoidentityprovider.AdminConfirmSignUpInput{
+				UserPoolId: aws.String(cognitoConfig.UserPoolID),
+				Username:   aws.String(invitation.Email),
+			})
+			return confirmErr
+		})
+		if err != nil {
+			log.WithError(err).Error("Failed to confirm invited user")
+			compensateCognitoUser(c, invitation.Email)
+			quotas.ReleaseUser(ctx, invitation.TenantID)
+			utils.CodedErrorResponse(c, utils.CodeServiceUnavailable, "Failed to confirm user; try again", nil)
+			return
+		}
+
+		user := models.User{
+			CognitoID: cognitoID,
+			TenantID:  invitation.TenantID,
+			Role:      invitation.Role,
+			CreatedAt: time.Now(),
+		}
+		err = db.Transaction(func(tx *gorm.DB) error {
+			// Conditional so a concurrent accept or revoke wins exactly once
+			result := tx.Model(&invitation).Where("status = ?", models.InvitationStatusPending).Updates(map[string]interface{}{
+				"status":      models.InvitationStatusAccepted,
+				"accepted_at": user.CreatedAt,
+				"accepted_by": cognitoID,
+			})
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return errInvitationTaken
+			}
+			if err := tx.Create(&user).Error; err != nil {
+				return err
+			}
+
+			// The invitee is the actor; the link they followed proved their email address
+			actor := audit.FromContext(c)
+			actor.ID, actor.Role = user.CognitoID, string(user.Role)
+			accepted := actor.Event(audit.UserInvitationAccepted, user.TenantID, audit.TargetUser, user.CognitoID)
+			accepted.Changes = audit.Diff(nil, user)
+			accepted.Metadata["invitation_id"] = invitation.ID
+			accepted.Metadata["invited_by"] = invitation.InvitedBy
+			confirmed := actor.Event(audit.UserEmailConfirmed, user.TenantID, audit.TargetUser, user.CognitoID)
+			confirmed.Metadata["username"] = invitation.Email
+			confirmed.Metadata["invitation_id"] = invitation.ID
+			return audit.Record(tx, accepted, confirmed)
+		})
+		if err != nil {
+			compensateCognitoUser(c, invitation.Email)
+			quotas.ReleaseUser(ctx, invitation.TenantID)
+			if errors.Is(err, errInvitationTaken) {
+				utils.CodedErrorResponse(c, utils.CodeInvitationNotPending, "Invitation is no longer pending", nil)
+				return
+			}
+			log.WithError(err).Error("Failed to accept invitation")
+			utils.InternalServerErrorResponse(c, "Failed to accept invitation")
+			return
+		}
+
+		utils.CreatedResponse(c, "Invitation accepted", models.RegisterResponse{
+			CognitoID: user.CognitoID,
+			Username:  invitation.Email,
+			Role:      string(user.Role),
+			TenantID:  user.TenantID,
+			Message:   "Invitation accepted. You can now log in.",
+		})
+	}
+}
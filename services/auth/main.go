@@ -1,59 +1,116 @@
 package main
 
 import (
-	"log"
-	"os"
+	"context"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 	"github.com/pavitra93/go-multi-tenant-system/shared/config"
+	"github.com/pavitra93/go-multi-tenant-system/shared/logger"
+	"github.com/pavitra93/go-multi-tenant-system/shared/metrics"
+	"github.com/pavitra93/go-multi-tenant-system/shared/middleware"
+	"github.com/pavitra93/go-multi-tenant-system/shared/quota"
+	"github.com/pavitra93/go-multi-tenant-system/shared/server"
+	"github.com/pavitra93/go-multi-tenant-system/shared/tracing"
 	"github.com/pavitra93/go-multi-tenant-system/shared/utils"
 	"github.com/sirupsen/logrus"
 )
 
 func main() {
-	// Load environment variables
-	if err := godotenv.Load(); err != nil {
+	// Load environment variables before configuring the logger so LOG_LEVEL/LOG_FORMAT apply
+	envErr := godotenv.Load()
+	logger.Init("auth-service")
+	if envErr != nil {
 		logrus.Warn("No .env file found, using environment variables")
 	}
 
+	// Initialize tracing (no-op exporter unless OTEL_TRACES_EXPORTER is set)
+	shutdownTracing, err := tracing.Init("auth-service")
+	if err != nil {
+		logrus.WithError(err).Fatal("Failed to initialize tracing")
+	}
+	defer shutdownTracing(context.Background())
+
+	// Load and validate configuration; any problem stops startup
+	var cfg Config
+	if err := config.Load(&cfg); err != nil {
+		logrus.WithError(err).Fatal("Invalid configuration")
+	}
+	metrics.Configure(cfg.Metrics)
+
+	// Cancelled on SIGINT/SIGTERM to begin graceful shutdown
+	ctx, stop := server.SignalContext()
+	defer stop()
+
+	// Metrics are scraped on an internal listener, not the public port
+	metrics.Serve(ctx, cfg.Metrics, cfg.Server)
+
+	// Resolve credentials from the secret provider and refresh them in the background
+	secrets, err := config.NewSecretManager(ctx, cfg.Secrets, &cfg)
+	if err != nil {
+		logrus.WithError(err).Fatal("Failed to load secrets")
+	}
+	go secrets.Run(ctx)
+
+	// Initialize the Cognito client and its circuit breaker
+	if err := initCognito(cfg.Cognito, secrets.Secret(config.CognitoClientSecret), cfg.CognitoBreaker); err != nil {
+		logrus.WithError(err).Fatal("Failed to initialize Cognito client")
+	}
+
 	// Initialize Redis for session management
-	if err := utils.InitRedis(); err != nil {
-		log.Fatal("Failed to connect to Redis:", err)
+	if err := utils.InitRedis(cfg.Redis.Options(secrets)); err != nil {
+		logrus.WithError(err).Fatal("Failed to connect to Redis")
 	}
 	defer utils.CloseRedis()
 
 	// Initialize database
-	db, err := config.ConnectDatabase()
+	db, err := cfg.Database.Connect(secrets)
 	if err != nil {
-		log.Fatal("Failed to connect to database:", err)
+		logrus.WithError(err).Fatal("Failed to connect to database")
+	}
+
+	// Export connection pool statistics
+	if err := metrics.RegisterDBStats(db, cfg.Database.DBName); err != nil {
+		logrus.Warnf("Failed to register database metrics: %v", err)
+	}
+	if err := metrics.RegisterRedisStats(utils.GetRedisClient()); err != nil {
+		logrus.Warnf("Failed to register Redis metrics: %v", err)
 	}
 
+	// Registrations count against the tenant plan's user limit
+	quotas := quota.NewEnforcer(db, utils.GetRedisClient())
+
+	// Logout and admin routes resolve the caller from their session
+	authMiddleware := middleware.NewAuthMiddleware(db)
+
 	// Initialize Gin router
-	router := gin.Default()
+	router := gin.New()
+	router.Use(gin.Recovery(), logger.RequestLogger())
+	router.Use(middleware.RequestTracing("auth-service"))
+	router.Use(metrics.HTTPMiddleware("auth-service"))
 
 	// Health check endpoint
 	router.GET("/health", func(c *gin.Context) {
 		utils.OKResponse(c, "Auth service is healthy", nil)
 	})
 
+	// Redacted configuration (admin only); exposed through the gateway's /admin/config/auth-service
+	router.GET("/admin/config", authMiddleware.RequireAuth(), authMiddleware.RequireRole("admin"), config.DumpHandler("auth-service", &cfg))
+
 	// Authentication routes
 	auth := router.Group("/auth")
 	{
 		auth.POST("/login", handleLogin(db))
-		auth.POST("/register", handleRegister(db))
+		auth.POST("/register", handleRegister(db, quotas))
+		auth.POST("/invitations/accept", handleAcceptInvitation(db, quotas))
 		auth.POST("/refresh", handleRefreshToken(db))
-		auth.POST("/logout", handleLogout(db))
-	}
-
-	// Start server
-	port := os.Getenv("AUTH_SERVICE_PORT")
-	if port == "" {
-		port = "8001"
+		auth.POST("/logout", authMiddleware.RequireAuth(), handleLogout(db))
+		auth.POST("/confirm-email", authMiddleware.RequireAuth(), authMiddleware.RequireRole("admin"), handleConfirmEmail(db))
 	}
 
-	logrus.Infof("Auth service starting on port %s", port)
-	if err := router.Run(":" + port); err != nil {
-		log.Fatal("Failed to start auth service:", err)
+	// Serve until SIGINT/SIGTERM, then drain in-flight requests
+	runner := server.New("Auth service", ":"+cfg.Port, router, cfg.Server)
+	if err := runner.Run(ctx); err != nil {
+		logrus.WithError(err).Fatal("Auth service did not shut down cleanly")
 	}
 }
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"time"
+
+	"github.com/pavitra93/go-multi-tenant-system/shared/config"
+	"github.com/pavitra93/go-multi-tenant-system/shared/middleware"
+)
+
+// Config is the location service configuration
+type Config struct {
+	Port     string `env:"LOCATION_SERVICE_PORT" default:"8003" validate:"required"`
+	Server   config.ServerConfig
+	Secrets  config.SecretsConfig
+	Database config.DatabaseConfig
+	Redis    config.RedisConfig
+	Metrics  config.MetricsConfig
+
+	Kafka       config.KafkaConfig
+	Producer    ProducerConfig
+	Idempotency middleware.IdempotencyConfig
+	Sessions    SessionConfig
+	Retention   RetentionConfig
+}
+
+// ProducerConfig tunes the asynchronous Kafka producer
+type ProducerConfig struct {
+	Workers      int           `env:"KAFKA_PRODUCER_WORKERS" default:"10" validate:"min=1"`
+	QueueSize    int           `env:"KAFKA_PRODUCER_QUEUE_SIZE" default:"1000" validate:"min=1"`
+	BatchSize    int           `env:"KAFKA_PRODUCER_BATCH_SIZE" default:"100" validate:"min=1"`
+	BatchTimeout time.Duration `env:"KAFKA_PRODUCER_BATCH_TIMEOUT" default:"10ms" validate:"gt=0"`
+	WriteTimeout time.Duration `env:"KAFKA_PRODUCER_WRITE_TIMEOUT" default:"5s" validate:"gt=0"`
+}
+
+// SessionConfig holds the platform defaults for tracking sessions
+type SessionConfig struct {
+	DefaultDuration int `env:"SESSION_DEFAULT_DURATION_SECONDS" default:"600" validate:"min=60,max=86400"` // Unless the tenant's settings override it
+}
+
+// RetentionConfig tunes the pruning of locations older than their tenant's retention
+type RetentionConfig struct {
+	Interval  time.Duration `env:"RETENTION_PRUNE_INTERVAL" default:"1h" validate:"gt=0"`
+	BatchSize int           `env:"RETENTION_PRUNE_BATCH_SIZE" default:"5000" validate:"min=1"`
+}
@@ -7,24 +7,44 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/propagation"
 	"gorm.io/gorm"
 
+	"github.com/pavitra93/go-multi-tenant-system/shared/logger"
+	"github.com/pavitra93/go-multi-tenant-system/shared/metering"
 	"github.com/pavitra93/go-multi-tenant-system/shared/middleware"
 	"github.com/pavitra93/go-multi-tenant-system/shared/models"
+	"github.com/pavitra93/go-multi-tenant-system/shared/pagination"
+	"github.com/pavitra93/go-multi-tenant-system/shared/quota"
+	"github.com/pavitra93/go-multi-tenant-system/shared/settings"
+	"github.com/pavitra93/go-multi-tenant-system/shared/tracing"
 	"github.com/pavitra93/go-multi-tenant-system/shared/utils"
+	"github.com/pavitra93/go-multi-tenant-system/shared/validation"
 )
 
-// StartSessionRequest represents the start session request
-type StartSessionRequest struct {
-	Duration int `json:"duration"` // in seconds, default 600 (10 minutes)
+// droppedEventSampler limits warnings while the Kafka producer queue is saturated
+var droppedEventSampler = logger.NewSampler(time.Minute, 10)
+
+// sessionPages orders the caller's tracking sessions, newest first by default
+var sessionPages = &pagination.Spec[models.LocationSession]{
+	Sorts: map[string]pagination.Sort[models.LocationSession]{
+		"created_at": pagination.ByTime("created_at", func(s models.LocationSession) time.Time { return s.CreatedAt }),
+		"started_at": pagination.ByTime("started_at", func(s models.LocationSession) time.Time { return s.StartedAt }),
+	},
+	DefaultSort:  "created_at",
+	DefaultOrder: pagination.Desc,
+	ID:           pagination.ByUUID("id", func(s models.LocationSession) uuid.UUID { return s.ID }),
 }
 
-// LocationUpdateRequest represents the location update request
-type LocationUpdateRequest struct {
-	SessionID uuid.UUID  `json:"session_id" binding:"required"`
-	Latitude  float64    `json:"latitude" binding:"required"`
-	Longitude float64    `json:"longitude" binding:"required"`
-	Timestamp *time.Time `json:"timestamp"`
+// locationPages orders a session's locations, in the order they were recorded by default
+var locationPages = &pagination.Spec[models.Location]{
+	Sorts: map[string]pagination.Sort[models.Location]{
+		"timestamp": pagination.ByTime("timestamp", func(l models.Location) time.Time { return l.Timestamp }),
+	},
+	DefaultSort:  "timestamp",
+	DefaultOrder: pagination.Asc,
+	ID:           pagination.ByUUID("id", func(l models.Location) uuid.UUID { return l.ID }),
 }
 
 // LocationEvent represents a location event for Kafka
@@ -37,28 +57,28 @@ type LocationEvent struct {
 	Longitude     float64   `json:"longitude"`
 	Timestamp     time.Time `json:"timestamp"`
 	EventType     string    `json:"event_type"`
+
+	// Propagated as Kafka headers, not part of the payload
+	RequestID    string            `json:"-"`
+	TraceContext map[string]string `json:"-"`
 }
 
 // handleStartSession handles starting a new location tracking session
-func handleStartSession(db *gorm.DB, kafkaProducer *KafkaProducer) gin.HandlerFunc {
+func handleStartSession(db *gorm.DB, kafkaProducer *KafkaProducer, quotas *quota.Enforcer, tenantSettings *settings.Store, sessions SessionConfig) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userID, _, tenantID, _ := middleware.GetUserFromContext(c)
 
-		var req StartSessionRequest
-		if err := c.ShouldBindJSON(&req); err != nil {
-			utils.BadRequestResponse(c, "Invalid request format")
+		var req models.StartSessionRequest
+		if !validation.BindJSON(c, &req) {
 			return
 		}
 
-		// Set default duration if not provided
-		if req.Duration == 0 {
-			req.Duration = 600 // 10 minutes
-		}
-
 		// Check if user has an active session
 		var activeSession models.LocationSession
 		if err := db.Where("cognito_user_id = ? AND status = ?", userID, models.SessionStatusActive).First(&activeSession).Error; err == nil {
-			utils.BadRequestResponse(c, "User already has an active session")
+			utils.CodedErrorResponse(c, utils.CodeSessionAlreadyActive, "User already has an active session", map[string]interface{}{
+				"session_id": activeSession.ID,
+			})
 			return
 		}
 
@@ -69,6 +89,11 @@ func handleStartSession(db *gorm.DB, kafkaProducer *KafkaProducer) gin.HandlerFu
 			return
 		}
 
+		// Without a duration the tenant's default applies, else the platform's
+		if req.Duration == 0 {
+			req.Duration = tenantSettings.Get(c.Request.Context(), tenantUUID).SessionDuration(sessions.DefaultDuration)
+		}
+
 		// Create new session
 		session := models.LocationSession{
 			ID:            uuid.New(),
@@ -79,7 +104,21 @@ func handleStartSession(db *gorm.DB, kafkaProducer *KafkaProducer) gin.HandlerFu
 			Duration:      req.Duration,
 		}
 
-		if err := db.Create(&session).Error; err != nil {
+		// Count the session against the plan's concurrent session limit until it ends
+		if err := quotas.ReserveSession(c.Request.Context(), &session); err != nil {
+			quota.ExceededResponse(c, err)
+			return
+		}
+
+		// The session and its usage are stored together so a start is billed exactly once
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&session).Error; err != nil {
+				return err
+			}
+			return metering.Record(tx, metering.SessionStarted(&session), metering.UserActive(tenantUUID, userID))
+		})
+		if err != nil {
+			quotas.ReleaseSession(c.Request.Context(), session.TenantID, session.ID)
 			utils.InternalServerErrorResponse(c, "Failed to create session")
 			return
 		}
@@ -90,6 +129,7 @@ func handleStartSession(db *gorm.DB, kafkaProducer *KafkaProducer) gin.HandlerFu
 			cacheDuration := time.Duration(session.Duration) * time.Second
 			if err := utils.CacheSet(cacheKey, string(sessionData), cacheDuration); err != nil {
 				// Cache failure is non-critical
+				logger.FromContext(c).WithError(err).WithField("session_id", session.ID).Warn("Failed to cache active session")
 			}
 		}
 
@@ -100,7 +140,7 @@ func handleStartSession(db *gorm.DB, kafkaProducer *KafkaProducer) gin.HandlerFu
 }
 
 // handleStopSession handles stopping a location tracking session
-func handleStopSession(db *gorm.DB, kafkaProducer *KafkaProducer) gin.HandlerFunc {
+func handleStopSession(db *gorm.DB, kafkaProducer *KafkaProducer, quotas *quota.Enforcer) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userID, _, tenantID, _ := middleware.GetUserFromContext(c)
 		sessionID := c.Param("id")
@@ -122,7 +162,7 @@ func handleStopSession(db *gorm.DB, kafkaProducer *KafkaProducer) gin.HandlerFun
 		var session models.LocationSession
 		if err := db.Where("id = ? AND cognito_user_id = ? AND tenant_id = ?", sessionUUID, userID, tenantUUID).First(&session).Error; err != nil {
 			if err == gorm.ErrRecordNotFound {
-				utils.NotFoundResponse(c, "Session not found")
+				utils.CodedErrorResponse(c, utils.CodeSessionNotFound, "Session not found", nil)
 			} else {
 				utils.InternalServerErrorResponse(c, "Failed to fetch session")
 			}
@@ -130,22 +170,32 @@ func handleStopSession(db *gorm.DB, kafkaProducer *KafkaProducer) gin.HandlerFun
 		}
 
 		if session.Status != models.SessionStatusActive {
-			utils.BadRequestResponse(c, "Session is not active")
+			utils.CodedErrorResponse(c, utils.CodeSessionNotActive, "Session is not active", map[string]interface{}{
+				"status": session.Status,
+			})
 			return
 		}
 
-		// End the session
+		// End the session and bill its tracked time
+		planned := session.Duration
 		session.EndSession()
 
-		if err := db.Save(&session).Error; err != nil {
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Save(&session).Error; err != nil {
+				return err
+			}
+			return metering.Record(tx, metering.SessionEnded(&session, planned))
+		})
+		if err != nil {
 			utils.InternalServerErrorResponse(c, "Failed to update session")
 			return
 		}
+		quotas.ReleaseSession(c.Request.Context(), session.TenantID, session.ID)
 
 		// Invalidate session cache in Redis
 		cacheKey := fmt.Sprintf("session:active:%s", sessionUUID.String())
-		if redisClient := utils.GetRedisClient(); redisClient != nil {
-			redisClient.Del(utils.GetRedisContext(), cacheKey)
+		if err := utils.CacheDelete(cacheKey); err != nil {
+			logger.FromContext(c).WithError(err).WithField("session_id", sessionUUID).Warn("Failed to invalidate session cache")
 		}
 
 		// Send session event to Kafka (async with worker pool)
@@ -154,7 +204,7 @@ func handleStopSession(db *gorm.DB, kafkaProducer *KafkaProducer) gin.HandlerFun
 	}
 }
 
-// handleGetUserSessions handles getting all sessions for a user
+// handleGetUserSessions handles listing the caller's sessions a page at a time
 func handleGetUserSessions(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userID, _, tenantID, _ := middleware.GetUserFromContext(c)
@@ -166,24 +216,44 @@ func handleGetUserSessions(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		var filter models.SessionListQuery
+		if !validation.BindQuery(c, &filter) {
+			return
+		}
+		page, ok := pagination.Parse(c, sessionPages)
+		if !ok {
+			return
+		}
+
+		query := db.Where("cognito_user_id = ? AND tenant_id = ?", userID, tenantUUID)
+		if filter.Status != "" {
+			query = query.Where("status = ?", filter.Status)
+		}
+		if filter.StartedAfter != nil {
+			query = query.Where("started_at >= ?", *filter.StartedAfter)
+		}
+		if filter.StartedBefore != nil {
+			query = query.Where("started_at < ?", *filter.StartedBefore)
+		}
+
 		var sessions []models.LocationSession
-		if err := db.Where("cognito_user_id = ? AND tenant_id = ?", userID, tenantUUID).Order("created_at DESC").Find(&sessions).Error; err != nil {
+		if err := page.Apply(query).Find(&sessions).Error; err != nil {
 			utils.InternalServerErrorResponse(c, "Failed to fetch sessions")
 			return
 		}
 
-		utils.OKResponse(c, "Sessions retrieved successfully", sessions)
+		sessions, info := page.Result(sessions)
+		utils.PaginatedResponse(c, "Sessions retrieved successfully", sessions, info)
 	}
 }
 
 // handleLocationUpdate handles location data updates
-func handleLocationUpdate(db *gorm.DB, kafkaProducer *KafkaProducer) gin.HandlerFunc {
+func handleLocationUpdate(db *gorm.DB, kafkaProducer *KafkaProducer, quotas *quota.Enforcer) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userID, _, tenantID, _ := middleware.GetUserFromContext(c)
 
-		var req LocationUpdateRequest
-		if err := c.ShouldBindJSON(&req); err != nil {
-			utils.BadRequestResponse(c, "Invalid request format")
+		var req models.LocationUpdateRequest
+		if !validation.BindJSON(c, &req) {
 			return
 		}
 
@@ -202,8 +272,8 @@ func handleLocationUpdate(db *gorm.DB, kafkaProducer *KafkaProducer) gin.Handler
 		if cachedData, err := utils.CacheGet(cacheKey); err == nil {
 			// Cache HIT - parse session from Redis
 			if err := json.Unmarshal([]byte(cachedData), &session); err == nil {
-				// Verify user and tenant match (security check)
-				if session.CognitoUserID == userID && session.TenantID == tenantUUID {
+				// Verify user and tenant match (security check) and that the session is still active
+				if session.CognitoUserID == userID && session.TenantID == tenantUUID && session.Status == models.SessionStatusActive {
 					sessionFound = true
 				}
 			}
@@ -213,7 +283,7 @@ func handleLocationUpdate(db *gorm.DB, kafkaProducer *KafkaProducer) gin.Handler
 		if !sessionFound {
 			if err := db.Where("id = ? AND cognito_user_id = ? AND tenant_id = ? AND status = ?", req.SessionID, userID, tenantUUID, models.SessionStatusActive).First(&session).Error; err != nil {
 				if err == gorm.ErrRecordNotFound {
-					utils.NotFoundResponse(c, "Active session not found")
+					utils.CodedErrorResponse(c, utils.CodeSessionNotFound, "Active session not found", nil)
 				} else {
 					utils.InternalServerErrorResponse(c, "Failed to fetch session")
 				}
@@ -225,21 +295,42 @@ func handleLocationUpdate(db *gorm.DB, kafkaProducer *KafkaProducer) gin.Handler
 			remainingTTL := time.Duration(session.Duration)*time.Second - time.Duration(elapsed)*time.Second
 			if remainingTTL > 0 {
 				if sessionData, err := json.Marshal(session); err == nil {
-					_ = utils.CacheSet(cacheKey, string(sessionData), remainingTTL)
+					if err := utils.CacheSet(cacheKey, string(sessionData), remainingTTL); err != nil {
+						logger.FromContext(c).WithError(err).WithField("session_id", session.ID).Warn("Failed to cache active session")
+					}
 				}
 			}
 		}
 
 		// Check if session has expired (for both cache hit and miss)
 		if time.Since(session.StartedAt).Seconds() > float64(session.Duration) {
-			// Auto-end expired session
+			// Auto-end expired session, billing it up to its expiry
+			planned := session.Duration
 			session.EndSession()
-			db.Save(&session)
+			err := db.Transaction(func(tx *gorm.DB) error {
+				if err := tx.Save(&session).Error; err != nil {
+					return err
+				}
+				return metering.Record(tx, metering.SessionEnded(&session, planned))
+			})
+			if err != nil {
+				logger.FromContext(c).WithError(err).WithField("session_id", session.ID).Warn("Failed to end expired session")
+			}
+			quotas.ReleaseSession(c.Request.Context(), session.TenantID, session.ID)
 			// Invalidate cache
-			if redisClient := utils.GetRedisClient(); redisClient != nil {
-				redisClient.Del(utils.GetRedisContext(), cacheKey)
+			if err := utils.CacheDelete(cacheKey); err != nil {
+				logger.FromContext(c).WithError(err).WithField("session_id", session.ID).Warn("Failed to invalidate session cache")
 			}
-			utils.BadRequestResponse(c, "Session has expired")
+			utils.CodedErrorResponse(c, utils.CodeSessionExpired, "Session has expired", map[string]interface{}{
+				"session_id": session.ID,
+			})
+			return
+		}
+
+		// Count the update against the plan's daily limit
+		countedAt := time.Now()
+		if err := quotas.CountLocationUpdate(c.Request.Context(), tenantUUID, countedAt); err != nil {
+			quota.ExceededResponse(c, err)
 			return
 		}
 
@@ -255,12 +346,20 @@ func handleLocationUpdate(db *gorm.DB, kafkaProducer *KafkaProducer) gin.Handler
 			TenantID:      tenantUUID,
 			SessionID:     req.SessionID,
 			CognitoUserID: userID, // userID is cognito_id from JWT
-			Latitude:      req.Latitude,
-			Longitude:     req.Longitude,
+			Latitude:      *req.Latitude,
+			Longitude:     *req.Longitude,
 			Timestamp:     timestamp,
 		}
 
-		if err := db.Create(&location).Error; err != nil {
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&location).Error; err != nil {
+				return err
+			}
+			return metering.Record(tx, metering.LocationStored(&location), metering.UserActive(tenantUUID, userID))
+		})
+		if err != nil {
+			// The update wasn't stored, so it doesn't use up the quota
+			quotas.ReleaseLocationUpdate(c.Request.Context(), tenantUUID, countedAt)
 			utils.InternalServerErrorResponse(c, "Failed to save location")
 			return
 		}
@@ -271,21 +370,31 @@ func handleLocationUpdate(db *gorm.DB, kafkaProducer *KafkaProducer) gin.Handler
 			TenantID:      tenantUUID,
 			CognitoUserID: userID,
 			SessionID:     req.SessionID,
-			Latitude:      req.Latitude,
-			Longitude:     req.Longitude,
+			Latitude:      *req.Latitude,
+			Longitude:     *req.Longitude,
 			Timestamp:     timestamp,
 			EventType:     "location_update",
+			RequestID:     middleware.GetRequestIDFromContext(c),
+			TraceContext:  make(map[string]string),
 		}
+		tracing.Inject(c.Request.Context(), propagation.MapCarrier(locationEvent.TraceContext))
 
 		if err := kafkaProducer.SendLocationEvent(locationEvent); err != nil {
-			// Queue full - event dropped
+			// Queue full - event dropped; the location is still stored in the database
+			if allowed, suppressed := droppedEventSampler.Allow(); allowed {
+				logger.FromContext(c).WithError(err).WithFields(logrus.Fields{
+					"location_id": location.ID,
+					"session_id":  req.SessionID,
+					"suppressed":  suppressed,
+				}).Warn("Location event dropped")
+			}
 		}
 
 		utils.OKResponse(c, "Location updated successfully", location)
 	}
 }
 
-// handleGetSessionLocations handles getting all locations for a session
+// handleGetSessionLocations handles listing a session's locations a page at a time
 func handleGetSessionLocations(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userID, _, tenantID, _ := middleware.GetUserFromContext(c)
@@ -304,23 +413,41 @@ func handleGetSessionLocations(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		var filter models.LocationListQuery
+		if !validation.BindQuery(c, &filter) {
+			return
+		}
+		page, ok := pagination.Parse(c, locationPages)
+		if !ok {
+			return
+		}
+
 		// Verify session belongs to user
 		var session models.LocationSession
 		if err := db.Where("id = ? AND cognito_user_id = ? AND tenant_id = ?", sessionUUID, userID, tenantUUID).First(&session).Error; err != nil {
 			if err == gorm.ErrRecordNotFound {
-				utils.NotFoundResponse(c, "Session not found")
+				utils.CodedErrorResponse(c, utils.CodeSessionNotFound, "Session not found", nil)
 			} else {
 				utils.InternalServerErrorResponse(c, "Failed to fetch session")
 			}
 			return
 		}
 
+		query := db.Where("session_id = ? AND tenant_id = ?", sessionUUID, tenantUUID)
+		if filter.From != nil {
+			query = query.Where("timestamp >= ?", *filter.From)
+		}
+		if filter.To != nil {
+			query = query.Where("timestamp < ?", *filter.To)
+		}
+
 		var locations []models.Location
-		if err := db.Where("session_id = ? AND tenant_id = ?", sessionUUID, tenantUUID).Order("timestamp ASC").Find(&locations).Error; err != nil {
+		if err := page.Apply(query).Find(&locations).Error; err != nil {
 			utils.InternalServerErrorResponse(c, "Failed to fetch locations")
 			return
 		}
 
-		utils.OKResponse(c, "Locations retrieved successfully", locations)
+		locations, info := page.Result(locations)
+		utils.PaginatedResponse(c, "Locations retrieved successfully", locations, info)
 	}
 }
@@ -3,36 +3,54 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
 
 	"github.com/segmentio/kafka-go"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/pavitra93/go-multi-tenant-system/shared/config"
+	"github.com/pavitra93/go-multi-tenant-system/shared/logger"
+	"github.com/pavitra93/go-multi-tenant-system/shared/metrics"
+	"github.com/pavitra93/go-multi-tenant-system/shared/tracing"
 )
 
+// publishFailureSampler keeps a Kafka outage from flooding the logs
+var publishFailureSampler = logger.NewSampler(time.Minute, 10)
+
 // KafkaProducer handles Kafka message production with worker pool
 type KafkaProducer struct {
 	writer            *kafka.Writer
+	topic             string
+	writeTimeout      time.Duration
 	locationEventChan chan LocationEvent
 	workerCount       int
-	shutdownChan      chan struct{}
 	wg                sync.WaitGroup
+
+	// closeMutex guards closed so no event is queued after the channel is closed
+	closeMutex sync.RWMutex
+	closed     bool
 }
 
 // NewKafkaProducer creates a new Kafka producer with worker pool
-func NewKafkaProducer(broker string) (*KafkaProducer, error) {
+func NewKafkaProducer(kafkaConfig config.KafkaConfig, producerConfig ProducerConfig) (*KafkaProducer, error) {
 	writer := &kafka.Writer{
-		Addr:         kafka.TCP(broker),
+		Addr:         kafka.TCP(kafkaConfig.Broker),
 		Balancer:     &kafka.LeastBytes{},
-		BatchTimeout: 10 * time.Millisecond,
-		BatchSize:    100,
+		BatchTimeout: producerConfig.BatchTimeout,
+		BatchSize:    producerConfig.BatchSize,
 	}
 
 	kp := &KafkaProducer{
 		writer:            writer,
-		locationEventChan: make(chan LocationEvent, 1000), // Buffered channel for 1000 events
-		workerCount:       10,                             // 10 worker goroutines
-		shutdownChan:      make(chan struct{}),
+		topic:             kafkaConfig.LocationTopic,
+		writeTimeout:      producerConfig.WriteTimeout,
+		locationEventChan: make(chan LocationEvent, producerConfig.QueueSize), // Events beyond the queue are dropped
+		workerCount:       producerConfig.Workers,
 	}
 
 	// Start worker pool
@@ -51,29 +69,46 @@ func (kp *KafkaProducer) startWorkers() {
 
 }
 
-// locationEventWorker processes location events from the channel
+// locationEventWorker processes location events until the channel is closed and drained
 func (kp *KafkaProducer) locationEventWorker(id int) {
 	defer kp.wg.Done()
 
-	for {
-		select {
-		case event := <-kp.locationEventChan:
-			if err := kp.sendLocationEventSync(event); err != nil {
-				// Log error silently
+	for event := range kp.locationEventChan {
+		metrics.KafkaProducerQueueDepth.Set(float64(len(kp.locationEventChan)))
+		if err := kp.sendLocationEventSync(event); err != nil {
+			metrics.KafkaProducerEvents.WithLabelValues("failed").Inc()
+			if allowed, suppressed := publishFailureSampler.Allow(); allowed {
+				logrus.WithError(err).WithFields(logrus.Fields{
+					"worker_id":  id,
+					"request_id": event.RequestID,
+					"tenant_id":  event.TenantID,
+					"user_id":    event.CognitoUserID,
+					"suppressed": suppressed,
+				}).Warn("Failed to publish location event")
 			}
-		case <-kp.shutdownChan:
-			return
+		} else {
+			metrics.KafkaProducerEvents.WithLabelValues("sent").Inc()
 		}
 	}
 }
 
 // SendLocationEvent queues a location event asynchronously (non-blocking)
 func (kp *KafkaProducer) SendLocationEvent(event LocationEvent) error {
+	kp.closeMutex.RLock()
+	defer kp.closeMutex.RUnlock()
+
+	if kp.closed {
+		metrics.KafkaProducerEvents.WithLabelValues("dropped").Inc()
+		return fmt.Errorf("kafka producer is shutting down, event dropped")
+	}
+
 	select {
 	case kp.locationEventChan <- event:
+		metrics.KafkaProducerQueueDepth.Set(float64(len(kp.locationEventChan)))
 		return nil
 	default:
 		// Channel full - drop event
+		metrics.KafkaProducerEvents.WithLabelValues("dropped").Inc()
 		return fmt.Errorf("location event queue full, event dropped")
 	}
 }
@@ -85,18 +120,33 @@ func (kp *KafkaProducer) sendLocationEventSync(event LocationEvent) error {
 		return fmt.Errorf("failed to marshal location event: %w", err)
 	}
 
+	// Continue the trace of the originating HTTP request with a producer span
+	ctx := tracing.Extract(context.Background(), propagation.MapCarrier(event.TraceContext))
+	ctx, span := tracing.Tracer("location-service").Start(ctx, kp.topic+" publish",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(tracing.RequestIDAttribute(event.RequestID)),
+	)
+	defer span.End()
+
 	msg := kafka.Message{
-		Topic: "location-updates",
+		Topic: kp.topic,
 		Key:   []byte(event.TenantID.String()),
 		Value: message,
 		Headers: []kafka.Header{
 			{Key: "event_type", Value: []byte("location_update")},
 			{Key: "tenant_id", Value: []byte(event.TenantID.String())},
 			{Key: "cognito_user_id", Value: []byte(event.CognitoUserID)},
+			{Key: tracing.RequestIDKey, Value: []byte(event.RequestID)},
 		},
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	traceHeaders := propagation.MapCarrier{}
+	tracing.Inject(ctx, traceHeaders)
+	for key, value := range traceHeaders {
+		msg.Headers = append(msg.Headers, kafka.Header{Key: key, Value: []byte(value)})
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, kp.writeTimeout)
 	defer cancel()
 
 	if err := kp.writer.WriteMessages(ctx, msg); err != nil {
@@ -106,24 +156,44 @@ func (kp *KafkaProducer) sendLocationEventSync(event LocationEvent) error {
 	return nil
 }
 
-// Close gracefully shuts down the Kafka producer and workers
-func (kp *KafkaProducer) Close() error {
-	fmt.Println("[Kafka] Initiating graceful shutdown...")
+// Close stops accepting events, waits for the workers to publish everything
+// already queued, then closes the Kafka writer. Events still queued when ctx
+// expires are lost.
+func (kp *KafkaProducer) Close(ctx context.Context) error {
+	kp.closeMutex.Lock()
+	if kp.closed {
+		kp.closeMutex.Unlock()
+		return nil
+	}
+	kp.closed = true
+	queued := len(kp.locationEventChan)
+	// Closing the channel lets workers drain the remaining events and exit
+	close(kp.locationEventChan)
+	kp.closeMutex.Unlock()
 
-	// Signal all workers to stop
-	close(kp.shutdownChan)
+	logrus.WithField("queued_events", queued).Info("Kafka producer draining queued events")
 
-	// Wait for all workers to finish processing
-	kp.wg.Wait()
+	drained := make(chan struct{})
+	go func() {
+		kp.wg.Wait()
+		close(drained)
+	}()
 
-	// Close channels
-	close(kp.locationEventChan)
+	var drainErr error
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		drainErr = fmt.Errorf("kafka producer drain interrupted with %d events queued: %w", len(kp.locationEventChan), ctx.Err())
+	}
 
-	// Close Kafka writer
+	// Close flushes any batch the writer is still holding
 	if err := kp.writer.Close(); err != nil {
-		return fmt.Errorf("failed to close Kafka writer: %w", err)
+		return errors.Join(drainErr, fmt.Errorf("failed to close Kafka writer: %w", err))
+	}
+	if drainErr != nil {
+		return drainErr
 	}
 
-	fmt.Println("[Kafka] Graceful shutdown complete")
+	logrus.Info("Kafka producer graceful shutdown complete")
 	return nil
 }
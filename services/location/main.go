@@ -1,81 +1,134 @@
 package main
 
 import (
-	"log"
-	"os"
+	"context"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 	"github.com/pavitra93/go-multi-tenant-system/shared/config"
+	"github.com/pavitra93/go-multi-tenant-system/shared/logger"
+	"github.com/pavitra93/go-multi-tenant-system/shared/metrics"
 	"github.com/pavitra93/go-multi-tenant-system/shared/middleware"
+	"github.com/pavitra93/go-multi-tenant-system/shared/quota"
+	"github.com/pavitra93/go-multi-tenant-system/shared/server"
+	"github.com/pavitra93/go-multi-tenant-system/shared/settings"
+	"github.com/pavitra93/go-multi-tenant-system/shared/tracing"
 	"github.com/pavitra93/go-multi-tenant-system/shared/utils"
 	"github.com/sirupsen/logrus"
 )
 
 func main() {
-	// Load environment variables
-	if err := godotenv.Load(); err != nil {
+	// Load environment variables before configuring the logger so LOG_LEVEL/LOG_FORMAT apply
+	envErr := godotenv.Load()
+	logger.Init("location-service")
+	if envErr != nil {
 		logrus.Warn("No .env file found, using environment variables")
 	}
 
+	// Initialize tracing (no-op exporter unless OTEL_TRACES_EXPORTER is set)
+	shutdownTracing, err := tracing.Init("location-service")
+	if err != nil {
+		logrus.WithError(err).Fatal("Failed to initialize tracing")
+	}
+	defer shutdownTracing(context.Background())
+
+	// Load and validate configuration; any problem stops startup
+	var cfg Config
+	if err := config.Load(&cfg); err != nil {
+		logrus.WithError(err).Fatal("Invalid configuration")
+	}
+	metrics.Configure(cfg.Metrics)
+
+	// Cancelled on SIGINT/SIGTERM to begin graceful shutdown
+	ctx, stop := server.SignalContext()
+	defer stop()
+
+	// Metrics are scraped on an internal listener, not the public port
+	metrics.Serve(ctx, cfg.Metrics, cfg.Server)
+
+	// Resolve credentials from the secret provider and refresh them in the background
+	secrets, err := config.NewSecretManager(ctx, cfg.Secrets, &cfg)
+	if err != nil {
+		logrus.WithError(err).Fatal("Failed to load secrets")
+	}
+	go secrets.Run(ctx)
+
 	// Initialize Redis for session caching
-	if err := utils.InitRedis(); err != nil {
-		log.Fatal("Failed to connect to Redis:", err)
+	if err := utils.InitRedis(cfg.Redis.Options(secrets)); err != nil {
+		logrus.WithError(err).Fatal("Failed to connect to Redis")
 	}
 	defer utils.CloseRedis()
 
 	// Initialize database
-	db, err := config.ConnectDatabase()
+	db, err := cfg.Database.Connect(secrets)
 	if err != nil {
-		log.Fatal("Failed to connect to database:", err)
+		logrus.WithError(err).Fatal("Failed to connect to database")
 	}
 
-	// Initialize authentication middleware
-	authMiddleware, err := middleware.NewAuthMiddleware(
-		os.Getenv("AWS_REGION"),
-		os.Getenv("COGNITO_USER_POOL_ID"),
-	)
-	if err != nil {
-		log.Fatal("Failed to initialize auth middleware:", err)
+	// Export connection pool statistics
+	if err := metrics.RegisterDBStats(db, cfg.Database.DBName); err != nil {
+		logrus.Warnf("Failed to register database metrics: %v", err)
+	}
+	if err := metrics.RegisterRedisStats(utils.GetRedisClient()); err != nil {
+		logrus.Warnf("Failed to register Redis metrics: %v", err)
 	}
 
+	// Initialize authentication middleware
+	authMiddleware := middleware.NewAuthMiddleware(db)
+
 	// Initialize Kafka producer
-	kafkaProducer, err := NewKafkaProducer(os.Getenv("KAFKA_BROKER"))
+	kafkaProducer, err := NewKafkaProducer(cfg.Kafka, cfg.Producer)
 	if err != nil {
-		log.Fatal("Failed to initialize Kafka producer:", err)
+		logrus.WithError(err).Fatal("Failed to initialize Kafka producer")
 	}
-	defer kafkaProducer.Close()
+
+	// Sessions and location updates count against the tenant plan's quotas
+	quotas := quota.NewEnforcer(db, utils.GetRedisClient())
+
+	// Tenants' overrides of session defaults and location retention
+	tenantSettings := settings.NewStore(db, utils.GetRedisClient())
+
+	// Delete locations once they are older than their tenant's retention
+	retention := NewRetentionPruner(db, quotas, tenantSettings, cfg.Retention)
+	retention.Start(ctx)
 
 	// Initialize Gin router
-	router := gin.Default()
+	router := gin.New()
+	router.Use(gin.Recovery(), logger.RequestLogger())
+	router.Use(middleware.RequestTracing("location-service"))
+	router.Use(metrics.HTTPMiddleware("location-service"))
 
 	// Health check endpoint
 	router.GET("/health", func(c *gin.Context) {
 		utils.OKResponse(c, "Location service is healthy", nil)
 	})
 
+	// Redacted configuration (admin only); exposed through the gateway's /admin/config/location-service
+	router.GET("/admin/config", authMiddleware.RequireAuth(), authMiddleware.RequireRole("admin"), config.DumpHandler("location-service", &cfg))
+
+	// Idempotency-Key support for mobile client retries
+	idempotency := middleware.NewIdempotencyMiddleware(cfg.Idempotency)
+
 	// Location tracking routes
 	location := router.Group("/location")
 	location.Use(authMiddleware.RequireAuth())
 	{
 		// Session management
-		location.POST("/session/start", handleStartSession(db, kafkaProducer))
-		location.POST("/session/:id/stop", handleStopSession(db, kafkaProducer))
+		location.POST("/session/start", idempotency.Handler(), handleStartSession(db, kafkaProducer, quotas, tenantSettings, cfg.Sessions))
+		location.POST("/session/:id/stop", idempotency.Handler(), handleStopSession(db, kafkaProducer, quotas))
 		location.GET("/sessions", handleGetUserSessions(db))
 
 		// Location data submission
-		location.POST("/update", handleLocationUpdate(db, kafkaProducer))
+		location.POST("/update", idempotency.Handler(), handleLocationUpdate(db, kafkaProducer, quotas))
 		location.GET("/session/:id/locations", handleGetSessionLocations(db))
 	}
 
-	// Start server
-	port := os.Getenv("LOCATION_SERVICE_PORT")
-	if port == "" {
-		port = "8003"
-	}
-
-	logrus.Infof("Location service starting on port %s", port)
-	if err := router.Run(":" + port); err != nil {
-		log.Fatal("Failed to start location service:", err)
+	// Serve until SIGINT/SIGTERM, then drain in-flight requests
+	runner := server.New("Location service", ":"+cfg.Port, router, cfg.Server)
+	// Flush queued location events once no more requests can enqueue them
+	runner.OnShutdown("kafka producer", kafkaProducer.Close)
+	runner.OnShutdown("retention pruner", retention.Stop)
+	if err := runner.Run(ctx); err != nil {
+		logrus.WithError(err).Fatal("Location service did not shut down cleanly")
 	}
 }
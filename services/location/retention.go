@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"github.com/pavitra93/go-multi-tenant-system/shared/models"
+	"github.com/pavitra93/go-multi-tenant-system/shared/quota"
+	"github.com/pavitra93/go-multi-tenant-system/shared/settings"
+)
+
+// RetentionPruner deletes each tenant's locations once they are older than its retention:
+// the plan's retention_days, or the tenant's shorter retention.location_days setting
+type RetentionPruner struct {
+	db        *gorm.DB
+	quotas    *quota.Enforcer
+	settings  *settings.Store
+	interval  time.Duration
+	batchSize int
+
+	// cancel stops the prune loop; done is closed once it has returned
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewRetentionPruner creates a pruner that runs every cfg.Interval
+func NewRetentionPruner(db *gorm.DB, quotas *quota.Enforcer, tenantSettings *settings.Store, cfg RetentionConfig) *RetentionPruner {
+	return &RetentionPruner{
+		db:        db,
+		quotas:    quotas,
+		settings:  tenantSettings,
+		interval:  cfg.Interval,
+		batchSize: cfg.BatchSize,
+	}
+}
+
+// Start prunes locations in the background until ctx is cancelled or Stop is called
+func (p *RetentionPruner) Start(ctx context.Context) {
+	ctx, p.cancel = context.WithCancel(ctx)
+	p.done = make(chan struct{})
+
+	go func() {
+		defer close(p.done)
+		p.run(ctx)
+	}()
+}
+
+// Stop cancels the prune loop and waits for a running prune to finish
+func (p *RetentionPruner) Stop(ctx context.Context) error {
+	if p.cancel == nil {
+		return nil
+	}
+
+	p.cancel()
+	select {
+	case <-p.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("retention pruner did not stop: %w", ctx.Err())
+	}
+}
+
+// run prunes every tenant until ctx is cancelled
+func (p *RetentionPruner) run(ctx context.Context) {
+	for {
+		p.pruneAll(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(p.interval):
+		}
+	}
+}
+
+// pruneAll prunes each tenant that isn't deleted; deleted tenants' data is purged with them
+func (p *RetentionPruner) pruneAll(ctx context.Context) {
+	var tenantIDs []uuid.UUID
+	err := p.db.WithContext(ctx).Model(&models.Tenant{}).
+		Where("status <> ?", models.TenantStatusDeleted).
+		// Legal holds preserve everything of the tenant, expired locations included
+		Where("NOT EXISTS (SELECT 1 FROM legal_holds h WHERE h.tenant_id = tenants.id AND h.released_at IS NULL)").
+		Pluck("id", &tenantIDs).Error
+	if err != nil {
+		if ctx.Err() == nil {
+			logrus.WithError(err).Error("Failed to list tenants for retention pruning")
+		}
+		return
+	}
+
+	for _, tenantID := range tenantIDs {
+		if ctx.Err() != nil {
+			return
+		}
+
+		log := logrus.WithField("tenant_id", tenantID)
+		locations, sessions, err := p.prune(ctx, tenantID)
+		if err != nil && ctx.Err() == nil {
+			log.WithError(err).Error("Error pruning expired locations")
+		} else if locations > 0 || sessions > 0 {
+			log.WithFields(logrus.Fields{
+				"locations": locations,
+				"sessions":  sessions,
+			}).Info("Pruned expired locations")
+		}
+	}
+}
+
+// prune deletes the tenant's locations older than its retention, in batches, then its
+// finished sessions that are as old and have no locations left
+func (p *RetentionPruner) prune(ctx context.Context, tenantID uuid.UUID) (int64, int64, error) {
+	// Without the plan the retention is unknown, so nothing is deleted
+	plan, err := p.quotas.Plan(ctx, tenantID)
+	if err != nil {
+		return 0, 0, err
+	}
+	days := p.settings.Get(ctx, tenantID).LocationRetentionDays(plan.RetentionDays)
+	if days == nil {
+		return 0, 0, nil
+	}
+	cutoff := time.Now().AddDate(0, 0, -*days)
+	db := p.db.WithContext(ctx)
+
+	var locations int64
+	for {
+		result := db.Exec(`DELETE FROM locations WHERE id IN (
+			SELECT id FROM locations WHERE tenant_id = ? AND created_at < ? LIMIT ?)`,
+			tenantID, cutoff, p.batchSize)
+		if result.Error != nil {
+			return locations, 0, fmt.Errorf("failed to delete locations: %w", result.Error)
+		}
+		locations += result.RowsAffected
+		if result.RowsAffected < int64(p.batchSize) {
+			break
+		}
+	}
+
+	result := db.Exec(`DELETE FROM location_sessions s
+		WHERE s.tenant_id = ? AND s.status <> ? AND s.started_at < ?
+		AND NOT EXISTS (SELECT 1 FROM locations l WHERE l.session_id = s.id)`,
+		tenantID, models.SessionStatusActive, cutoff)
+	if result.Error != nil {
+		return locations, 0, fmt.Errorf("failed to delete sessions: %w", result.Error)
+	}
+	return locations, result.RowsAffected, nil
+}
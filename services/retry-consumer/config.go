@@ -0,0 +1,31 @@
+package main
+
+import (
+	"time"
+
+	"github.com/pavitra93/go-multi-tenant-system/shared/config"
+)
+
+// Config is the retry consumer configuration
+type Config struct {
+	Port     string `env:"RETRY_CONSUMER_PORT" default:"8085" validate:"required"`
+	Server   config.ServerConfig
+	Secrets  config.SecretsConfig
+	Database config.DatabaseConfig
+	Redis    config.RedisConfig
+	Metrics  config.MetricsConfig
+
+	ThirdParty config.ThirdPartyConfig
+	Retry      RetryConfig
+}
+
+// RetryConfig tunes how failed location updates are retried.
+// MaxAttempts and BackoffBase apply unless the tenant's settings override them.
+type RetryConfig struct {
+	MaxAttempts   int           `env:"RETRY_MAX_ATTEMPTS" default:"8" validate:"min=1"`
+	BatchSize     int           `env:"RETRY_BATCH_SIZE" default:"100" validate:"min=1"`
+	CheckInterval time.Duration `env:"RETRY_CHECK_INTERVAL" default:"30s" validate:"gt=0"`
+
+	// BackoffBase is the delay before the second attempt; it doubles on each further failure
+	BackoffBase time.Duration `env:"RETRY_BACKOFF_BASE" default:"1m" validate:"gt=0"`
+}
@@ -2,18 +2,32 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
 	"net/http"
-	"os"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
-	"gorm.io/driver/postgres"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 	"gorm.io/gorm"
+
+	"github.com/pavitra93/go-multi-tenant-system/shared/audit"
+	"github.com/pavitra93/go-multi-tenant-system/shared/config"
+	"github.com/pavitra93/go-multi-tenant-system/shared/logger"
+	"github.com/pavitra93/go-multi-tenant-system/shared/metering"
+	"github.com/pavitra93/go-multi-tenant-system/shared/metrics"
+	"github.com/pavitra93/go-multi-tenant-system/shared/middleware"
+	"github.com/pavitra93/go-multi-tenant-system/shared/models"
+	"github.com/pavitra93/go-multi-tenant-system/shared/server"
+	"github.com/pavitra93/go-multi-tenant-system/shared/settings"
+	"github.com/pavitra93/go-multi-tenant-system/shared/tracing"
+	"github.com/pavitra93/go-multi-tenant-system/shared/utils"
 )
 
 // FailedLocationUpdate represents a failed location update in database
@@ -32,8 +46,14 @@ type FailedLocationUpdate struct {
 	CreatedAt       time.Time  `json:"created_at"`
 	UpdatedAt       time.Time  `json:"updated_at"`
 	ResolvedAt      *time.Time `json:"resolved_at,omitempty"`
+	RequestID       string     `json:"request_id,omitempty"`
+	TraceParent     string     `json:"traceparent,omitempty"`
 }
 
+// errUpdateGone means a failed update was deleted, by a user's erasure or a tenant's purge,
+// or stopped being pending while it was retried
+var errUpdateGone = errors.New("failed update is gone")
+
 // LocationEvent represents a location event for retry
 type LocationEvent struct {
 	ID        string    `json:"id"`
@@ -49,43 +69,34 @@ type LocationEvent struct {
 // RetryConsumer handles retry of failed location updates
 type RetryConsumer struct {
 	db            *gorm.DB
+	settings      *settings.Store
 	thirdPartyURL string
+	apiKey        *config.Secret
 	httpClient    *http.Client
 	maxRetries    int
 	batchSize     int
 	checkInterval time.Duration
+	backoffBase   time.Duration
+
+	// cancel stops the processing loop; done is closed once it has returned
+	cancel context.CancelFunc
+	done   chan struct{}
 }
 
 // NewRetryConsumer creates a new retry consumer
-func NewRetryConsumer() (*RetryConsumer, error) {
+func NewRetryConsumer(cfg *Config, secrets *config.SecretManager) (*RetryConsumer, error) {
 	// Initialize database connection
-	dbHost := os.Getenv("DB_HOST")
-	if dbHost == "" {
-		dbHost = "localhost"
-	}
-	dbPort := os.Getenv("DB_PORT")
-	if dbPort == "" {
-		dbPort = "5432"
-	}
-	dbUser := os.Getenv("DB_USER")
-	if dbUser == "" {
-		dbUser = "postgres"
-	}
-	dbPassword := os.Getenv("DB_PASSWORD")
-	if dbPassword == "" {
-		dbPassword = "password"
-	}
-	dbName := os.Getenv("DB_NAME")
-	if dbName == "" {
-		dbName = "multi_tenant_db"
+	db, err := cfg.Database.Connect(secrets)
+	if err != nil {
+		return nil, err
 	}
 
-	dsn := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
-		dbHost, dbPort, dbUser, dbPassword, dbName)
-
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
-	if err != nil {
-		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	// Export connection pool statistics
+	if err := metrics.RegisterDBStats(db, cfg.Database.DBName); err != nil {
+		logrus.Warnf("Failed to register database metrics: %v", err)
+	}
+	if err := metrics.RegisterRedisStats(utils.GetRedisClient()); err != nil {
+		logrus.Warnf("Failed to register Redis metrics: %v", err)
 	}
 
 	// Auto-migrate the failed location updates table
@@ -93,61 +104,107 @@ func NewRetryConsumer() (*RetryConsumer, error) {
 		return nil, fmt.Errorf("failed to migrate database: %w", err)
 	}
 
-	thirdPartyURL := os.Getenv("THIRD_PARTY_ENDPOINT")
-	if thirdPartyURL == "" {
-		thirdPartyURL = "http://httpbin.org/post"
-	}
-
 	return &RetryConsumer{
 		db:            db,
-		thirdPartyURL: thirdPartyURL,
+		settings:      settings.NewStore(db, utils.GetRedisClient()),
+		thirdPartyURL: cfg.ThirdParty.Endpoint,
+		apiKey:        secrets.Secret(config.ThirdPartyAPIKey),
 		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
+			Timeout: cfg.ThirdParty.Timeout,
 		},
-		maxRetries:    8,
-		batchSize:     100,
-		checkInterval: 30 * time.Second,
+		maxRetries:    cfg.Retry.MaxAttempts,
+		batchSize:     cfg.Retry.BatchSize,
+		checkInterval: cfg.Retry.CheckInterval,
+		backoffBase:   cfg.Retry.BackoffBase,
 	}, nil
 }
 
-// ProcessFailedUpdates processes failed location updates for retry
-func (rc *RetryConsumer) ProcessFailedUpdates() {
-	log.Println("Starting retry consumer...")
+// Start processes failed updates in the background until ctx is cancelled or Stop is called
+func (rc *RetryConsumer) Start(ctx context.Context) {
+	ctx, rc.cancel = context.WithCancel(ctx)
+	rc.done = make(chan struct{})
+
+	go func() {
+		defer close(rc.done)
+		rc.ProcessFailedUpdates(ctx)
+	}()
+}
+
+// Stop cancels the processing loop and waits for the update being retried to finish
+func (rc *RetryConsumer) Stop(ctx context.Context) error {
+	if rc.cancel == nil {
+		return nil
+	}
+
+	rc.cancel()
+	select {
+	case <-rc.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("retry consumer did not stop: %w", ctx.Err())
+	}
+}
+
+// ProcessFailedUpdates processes failed location updates for retry until ctx is cancelled
+func (rc *RetryConsumer) ProcessFailedUpdates(ctx context.Context) {
+	logrus.Info("Starting retry consumer")
+	defer logrus.Info("Retry consumer stopped")
 
 	for {
+		rc.refreshDLQMetrics()
+
 		// Get pending failed updates ready for retry
 		var failedUpdates []FailedLocationUpdate
-		err := rc.db.Where("status = ? AND next_retry_at <= ?", "pending", time.Now()).
+		err := rc.db.WithContext(ctx).Where("status = ? AND next_retry_at <= ?", "pending", time.Now()).
 			Order("created_at DESC"). // Latest location updates first
 			Limit(rc.batchSize).
 			Find(&failedUpdates).Error
 
-		if err != nil {
-			log.Printf("Error fetching failed updates: %v", err)
-			time.Sleep(rc.checkInterval)
-			continue
+		if err != nil && ctx.Err() == nil {
+			logrus.WithError(err).Error("Error fetching failed updates")
+		} else if len(failedUpdates) == 0 {
+			logrus.Debug("No failed updates to retry")
+		} else {
+			logrus.WithField("count", len(failedUpdates)).Info("Processing failed updates for retry")
 		}
 
-		if len(failedUpdates) == 0 {
-			log.Println("No failed updates to retry")
-			time.Sleep(rc.checkInterval)
-			continue
-		}
-
-		log.Printf("Processing %d failed updates for retry", len(failedUpdates))
-
 		for _, failed := range failedUpdates {
-			if err := rc.retryFailedUpdate(failed); err != nil {
-				log.Printf("Failed to retry update %s: %v", failed.ID, err)
+			// Finish the update in flight, but don't start new ones once shutdown begins
+			if ctx.Err() != nil {
+				return
+			}
+			err := rc.retryFailedUpdate(failed)
+			if errors.Is(err, errUpdateGone) {
+				logrus.WithField("failed_update_id", failed.ID).Debug("Failed update deleted while it was retried")
+				continue
+			}
+			if err != nil {
+				logrus.WithError(err).WithFields(logrus.Fields{
+					"failed_update_id": failed.ID,
+					"tenant_id":        failed.TenantID,
+					"request_id":       failed.RequestID,
+				}).Warn("Failed to retry update")
 			}
 		}
 
-		time.Sleep(rc.checkInterval)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(rc.checkInterval):
+		}
 	}
 }
 
 // retryFailedUpdate retries a single failed location update
 func (rc *RetryConsumer) retryFailedUpdate(failed FailedLocationUpdate) error {
+	// Continue the trace of the original request that produced this update
+	ctx := tracing.ContextFromTraceParent(context.Background(), failed.TraceParent, failed.RequestID)
+	ctx, span := tracing.Tracer("retry-consumer").Start(ctx, "failed_location_updates retry",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(tracing.RequestIDAttribute(failed.RequestID)),
+	)
+	defer span.End()
+
 	// Check if session is still active (if session_id exists)
 	if failed.SessionID != nil {
 		var sessionStatus string
@@ -158,14 +215,17 @@ func (rc *RetryConsumer) retryFailedUpdate(failed FailedLocationUpdate) error {
 
 		if err != nil {
 			// Session not found or error - mark as permanently failed
-			log.Printf("Session %s not found or error checking status: %v", failed.SessionID, err)
-			return rc.markPermanentlyFailed(failed, "Session not found or inactive")
+			logger.FromCtx(ctx).WithError(err).WithField("session_id", failed.SessionID).Warn("Session not found or error checking status")
+			return rc.markPermanentlyFailed(ctx, failed, "Session not found or inactive")
 		}
 
 		if sessionStatus != "active" {
 			// Session is not active - mark as permanently failed
-			log.Printf("Session %s is not active (status: %s) - marking as permanently failed", failed.SessionID, sessionStatus)
-			return rc.markPermanentlyFailed(failed, fmt.Sprintf("Session inactive (status: %s)", sessionStatus))
+			logger.FromCtx(ctx).WithFields(logrus.Fields{
+				"session_id":     failed.SessionID,
+				"session_status": sessionStatus,
+			}).Info("Session is not active - marking as permanently failed")
+			return rc.markPermanentlyFailed(ctx, failed, fmt.Sprintf("Session inactive (status: %s)", sessionStatus))
 		}
 	}
 
@@ -191,18 +251,28 @@ func (rc *RetryConsumer) retryFailedUpdate(failed FailedLocationUpdate) error {
 		event.Longitude = *failed.Longitude
 	}
 
-	// Try to send to third-party
-	if err := rc.sendToThirdParty(event); err != nil {
+	// Send to the tenant's endpoint as it is now, which may have changed since the failure
+	tenantSettings := rc.settings.Get(ctx, failed.TenantID)
+	endpoint := tenantSettings.StreamingEndpoint(rc.thirdPartyURL)
+	if err := rc.sendToThirdParty(ctx, endpoint, event); err != nil {
+		span.SetStatus(codes.Error, err.Error())
 		// Update retry count and next retry time
-		return rc.updateRetryStatus(failed, err)
+		return rc.updateRetryStatus(ctx, failed, tenantSettings, err)
+	}
+
+	// Keyed by the original event's ID, like the streaming service's deliveries, so an
+	// event is billed once however many attempts it took
+	if err := metering.Record(rc.db.WithContext(ctx), metering.Delivered(failed.TenantID, failed.OriginalEventID)); err != nil {
+		logger.FromCtx(ctx).WithError(err).WithField("event_id", failed.OriginalEventID).Error("Failed to meter third-party delivery")
 	}
 
 	// Success - mark as resolved
 	return rc.markResolved(failed)
 }
 
-// sendToThirdParty sends location event to third-party system
-func (rc *RetryConsumer) sendToThirdParty(event LocationEvent) error {
+// sendToThirdParty sends location event to endpoint, the default or the tenant's own.
+// The platform API key is only sent to the default endpoint.
+func (rc *RetryConsumer) sendToThirdParty(ctx context.Context, endpoint string, event LocationEvent) error {
 	// Prepare payload
 	payload := map[string]interface{}{
 		"event_type": "location_update",
@@ -216,7 +286,7 @@ func (rc *RetryConsumer) sendToThirdParty(event LocationEvent) error {
 	}
 
 	// Send HTTP request
-	req, err := http.NewRequest("POST", rc.thirdPartyURL+"/location", bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint+"/location", bytes.NewBuffer(jsonData))
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
@@ -224,41 +294,53 @@ func (rc *RetryConsumer) sendToThirdParty(event LocationEvent) error {
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("X-Tenant-ID", event.TenantID)
 	req.Header.Set("X-User-ID", event.UserID)
+	if apiKey := rc.apiKey.Value(); apiKey != "" && endpoint == rc.thirdPartyURL {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+	if requestID := tracing.RequestIDFromContext(ctx); requestID != "" {
+		req.Header.Set(tracing.RequestIDHeader, requestID)
+	}
+	tracing.Inject(ctx, propagation.HeaderCarrier(req.Header))
 
+	start := time.Now()
 	resp, err := rc.httpClient.Do(req)
 	if err != nil {
+		metrics.ThirdPartyRequestDuration.WithLabelValues("retry-consumer", "error").Observe(time.Since(start).Seconds())
 		return fmt.Errorf("failed to send location update: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		metrics.ThirdPartyRequestDuration.WithLabelValues("retry-consumer", "failure").Observe(time.Since(start).Seconds())
 		return fmt.Errorf("third-party returned status %d", resp.StatusCode)
 	}
+	metrics.ThirdPartyRequestDuration.WithLabelValues("retry-consumer", "success").Observe(time.Since(start).Seconds())
 
 	return nil
 }
 
-// updateRetryStatus updates retry count and next retry time
-func (rc *RetryConsumer) updateRetryStatus(failed FailedLocationUpdate, err error) error {
+// updateRetryStatus updates retry count and next retry time, using the tenant's retry
+// settings where it has them
+func (rc *RetryConsumer) updateRetryStatus(ctx context.Context, failed FailedLocationUpdate, tenantSettings *models.TenantSettings, err error) error {
 	failed.RetryCount++
 	failed.UpdatedAt = time.Now()
 
-	if failed.RetryCount >= rc.maxRetries {
-		// Mark as permanently failed
-		failed.Status = "permanently_failed"
-		now := time.Now()
-		failed.ResolvedAt = &now
-		failed.ErrorMessage = fmt.Sprintf("Max retries reached: %s", err.Error())
-	} else {
-		// Calculate next retry time with exponential backoff
-		baseDelay := 1 * time.Minute
-		delay := baseDelay * time.Duration(1<<(failed.RetryCount-1)) // 1m, 2m, 4m, 8m, 16m
-		nextRetryAt := time.Now().Add(delay)
-		failed.NextRetryAt = &nextRetryAt
-		failed.ErrorMessage = err.Error()
-	}
-
-	return rc.db.Save(&failed).Error
+	if failed.RetryCount >= tenantSettings.RetryMaxAttempts(rc.maxRetries) {
+		return rc.markPermanentlyFailed(ctx, failed, fmt.Sprintf("Max retries reached: %s", err.Error()))
+	}
+
+	// Calculate next retry time with exponential backoff
+	delay := tenantSettings.RetryBackoffBase(rc.backoffBase) * time.Duration(1<<(failed.RetryCount-1)) // 1m, 2m, 4m, 8m, 16m with the default base
+	nextRetryAt := time.Now().Add(delay)
+	failed.NextRetryAt = &nextRetryAt
+	failed.ErrorMessage = err.Error()
+
+	return savePending(rc.db.WithContext(ctx), &failed, map[string]interface{}{
+		"retry_count":   failed.RetryCount,
+		"updated_at":    failed.UpdatedAt,
+		"next_retry_at": failed.NextRetryAt,
+		"error_message": failed.ErrorMessage,
+	})
 }
 
 // markResolved marks a failed update as resolved
@@ -268,18 +350,79 @@ func (rc *RetryConsumer) markResolved(failed FailedLocationUpdate) error {
 	failed.UpdatedAt = now
 	failed.ResolvedAt = &now
 
-	return rc.db.Save(&failed).Error
+	return savePending(rc.db, &failed, map[string]interface{}{
+		"status":      failed.Status,
+		"updated_at":  failed.UpdatedAt,
+		"resolved_at": failed.ResolvedAt,
+	})
 }
 
-// markPermanentlyFailed marks a failed update as permanently failed (no more retries)
-func (rc *RetryConsumer) markPermanentlyFailed(failed FailedLocationUpdate, reason string) error {
+// savePending writes columns to a failed update that is still pending. Unlike Save it never
+// inserts: an erasure or purge may have deleted the row while it was being retried, and
+// the erased user's location must not come back. Returns errUpdateGone if the row is not
+// there or no longer pending.
+func savePending(db *gorm.DB, failed *FailedLocationUpdate, columns map[string]interface{}) error {
+	result := db.Model(&FailedLocationUpdate{}).
+		Where("id = ? AND status = ?", failed.ID, "pending").
+		Updates(columns)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errUpdateGone
+	}
+	return nil
+}
+
+// markPermanentlyFailed marks a failed update as permanently failed (no more retries).
+// Giving up drops a tenant's location event, so it is audited.
+func (rc *RetryConsumer) markPermanentlyFailed(ctx context.Context, failed FailedLocationUpdate, reason string) error {
+	previous := failed
 	now := time.Now()
 	failed.Status = "permanently_failed"
 	failed.UpdatedAt = now
 	failed.ResolvedAt = &now
 	failed.ErrorMessage = reason
 
-	return rc.db.Save(&failed).Error
+	return rc.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// A deleted update gets no audit event either; it would name the erased user
+		err := savePending(tx, &failed, map[string]interface{}{
+			"status":        failed.Status,
+			"updated_at":    failed.UpdatedAt,
+			"resolved_at":   failed.ResolvedAt,
+			"error_message": failed.ErrorMessage,
+		})
+		if err != nil {
+			return err
+		}
+
+		event := audit.System(ctx).Event(audit.DLQPermanentlyFailed, failed.TenantID, audit.TargetFailedUpdate, failed.ID.String())
+		event.Changes = audit.Diff(previous, failed)
+		event.Metadata["event_id"] = failed.OriginalEventID
+		event.Metadata["user_id"] = failed.UserID
+		event.Metadata["retry_count"] = failed.RetryCount
+		return audit.Record(tx, event)
+	})
+}
+
+// refreshDLQMetrics updates the DLQ gauges with current counts by status
+func (rc *RetryConsumer) refreshDLQMetrics() {
+	var counts []struct {
+		Status string
+		Count  int64
+	}
+
+	if err := rc.db.Model(&FailedLocationUpdate{}).Select("status, COUNT(*) AS count").Group("status").Scan(&counts).Error; err != nil {
+		logrus.WithError(err).Warn("Error counting failed updates by status")
+		return
+	}
+
+	for _, status := range []string{"pending", "retried", "resolved", "permanently_failed"} {
+		metrics.DLQUpdates.WithLabelValues(status).Set(0)
+	}
+	for _, count := range counts {
+		metrics.DLQUpdates.WithLabelValues(count.Status).Set(float64(count.Count))
+	}
 }
 
 // GetRetryStats returns retry statistics
@@ -302,19 +445,62 @@ func (rc *RetryConsumer) GetRetryStats() map[string]interface{} {
 			"max_retries":    rc.maxRetries,
 			"batch_size":     rc.batchSize,
 			"check_interval": rc.checkInterval.String(),
+			"backoff_base":   rc.backoffBase.String(),
 		},
 	}
 }
 
 func main() {
+	logger.Init("retry-consumer")
+
+	// Initialize tracing (no-op exporter unless OTEL_TRACES_EXPORTER is set)
+	shutdownTracing, err := tracing.Init("retry-consumer")
+	if err != nil {
+		logrus.WithError(err).Fatal("Failed to initialize tracing")
+	}
+	defer shutdownTracing(context.Background())
+
+	// Load and validate configuration; any problem stops startup
+	var cfg Config
+	if err := config.Load(&cfg); err != nil {
+		logrus.WithError(err).Fatal("Invalid configuration")
+	}
+	metrics.Configure(cfg.Metrics)
+
+	// Cancelled on SIGINT/SIGTERM to begin graceful shutdown
+	ctx, stop := server.SignalContext()
+	defer stop()
+
+	// Metrics are scraped on an internal listener, not the public port
+	metrics.Serve(ctx, cfg.Metrics, cfg.Server)
+
+	// Resolve credentials from the secret provider and refresh them in the background
+	secrets, err := config.NewSecretManager(ctx, cfg.Secrets, &cfg)
+	if err != nil {
+		logrus.WithError(err).Fatal("Failed to load secrets")
+	}
+	go secrets.Run(ctx)
+
+	// Initialize Redis for caching tenant settings
+	if err := utils.InitRedis(cfg.Redis.Options(secrets)); err != nil {
+		logrus.WithError(err).Fatal("Failed to connect to Redis")
+	}
+	defer utils.CloseRedis()
+
 	// Initialize retry consumer
-	retryConsumer, err := NewRetryConsumer()
+	retryConsumer, err := NewRetryConsumer(&cfg, secrets)
 	if err != nil {
-		log.Fatal("Failed to create retry consumer:", err)
+		logrus.WithError(err).Fatal("Failed to create retry consumer")
 	}
 
+	// Initialize authentication middleware
+	authMiddleware := middleware.NewAuthMiddleware(retryConsumer.db)
+
 	// Initialize Gin router
-	router := gin.Default()
+	router := gin.New()
+	router.Use(gin.Recovery(), logger.RequestLogger())
+	router.Use(middleware.RequestTracing("retry-consumer"))
+	router.Use(metrics.HTTPMiddleware("retry-consumer"))
 
 	// Health check endpoint
 	router.GET("/health", func(c *gin.Context) {
@@ -324,6 +510,9 @@ func main() {
 		})
 	})
 
+	// Redacted configuration (admin only); exposed through the gateway's /admin/config/retry-consumer
+	router.GET("/admin/config", authMiddleware.RequireAuth(), authMiddleware.RequireRole("admin"), config.DumpHandler("retry-consumer", &cfg))
+
 	// Retry statistics endpoint
 	router.GET("/stats", func(c *gin.Context) {
 		stats := retryConsumer.GetRetryStats()
@@ -334,16 +523,12 @@ func main() {
 	})
 
 	// Start retry consumer in background
-	go retryConsumer.ProcessFailedUpdates()
-
-	// Start HTTP server
-	port := os.Getenv("RETRY_CONSUMER_PORT")
-	if port == "" {
-		port = "8085"
-	}
+	retryConsumer.Start(ctx)
 
-	logrus.Infof("Retry Consumer starting on port %s", port)
-	if err := router.Run(":" + port); err != nil {
-		log.Fatal("Failed to start Retry Consumer:", err)
+	// Serve until SIGINT/SIGTERM, then drain in-flight requests
+	runner := server.New("Retry Consumer", ":"+cfg.Port, router, cfg.Server)
+	runner.OnShutdown("retry consumer", retryConsumer.Stop)
+	if err := runner.Run(ctx); err != nil {
+		logrus.WithError(err).Fatal("Retry Consumer did not shut down cleanly")
 	}
 }
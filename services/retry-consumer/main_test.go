@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/pavitra93/go-multi-tenant-system/shared/models"
+	"github.com/pavitra93/go-multi-tenant-system/shared/testdb"
+)
+
+// TestRetryOutcomeOfDeletedUpdate records the outcome of a retry for failed updates that
+// are still pending, or that an erasure or purge deleted while they were retried.
+func TestRetryOutcomeOfDeletedUpdate(t *testing.T) {
+	outcomes := []struct {
+		name   string
+		record func(rc *RetryConsumer, failed FailedLocationUpdate) error
+	}{
+		{name: "retry later", record: func(rc *RetryConsumer, failed FailedLocationUpdate) error {
+			return rc.updateRetryStatus(context.Background(), failed, nil, errors.New("third-party returned status 500"))
+		}},
+		{name: "resolved", record: func(rc *RetryConsumer, failed FailedLocationUpdate) error {
+			return rc.markResolved(failed)
+		}},
+		{name: "given up", record: func(rc *RetryConsumer, failed FailedLocationUpdate) error {
+			return rc.markPermanentlyFailed(context.Background(), failed, "Session not found or inactive")
+		}},
+	}
+
+	for _, outcome := range outcomes {
+		for _, deleted := range []bool{false, true} {
+			name := outcome.name + "/pending"
+			if deleted {
+				name = outcome.name + "/deleted"
+			}
+
+			t.Run(name, func(t *testing.T) {
+				tx := testdb.Tx(t)
+				failed := createTestFailedUpdate(t, tx)
+				if deleted {
+					if err := tx.Delete(&FailedLocationUpdate{}, "id = ?", failed.ID).Error; err != nil {
+						t.Fatal(err)
+					}
+				}
+
+				rc := &RetryConsumer{db: tx, maxRetries: 5, backoffBase: time.Minute}
+				err := outcome.record(rc, failed)
+
+				var stored int64
+				if err := tx.Model(&FailedLocationUpdate{}).Where("id = ?", failed.ID).Count(&stored).Error; err != nil {
+					t.Fatal(err)
+				}
+				var audited int64
+				if err := tx.Model(&models.AuditEvent{}).Where("target_id = ?", failed.ID.String()).Count(&audited).Error; err != nil {
+					t.Fatal(err)
+				}
+
+				if deleted {
+					if !errors.Is(err, errUpdateGone) {
+						t.Errorf("error = %v, want errUpdateGone", err)
+					}
+					if stored != 0 {
+						t.Error("deleted failed update was written back")
+					}
+					if audited != 0 {
+						t.Errorf("%d audit events for the deleted update, want none", audited)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("error = %v", err)
+				}
+				if stored != 1 {
+					t.Errorf("%d failed updates stored, want 1", stored)
+				}
+			})
+		}
+	}
+}
+
+// createTestFailedUpdate stores a tenant and a pending failed update of one of its users
+func createTestFailedUpdate(t *testing.T, tx *gorm.DB) FailedLocationUpdate {
+	t.Helper()
+
+	tenantID := uuid.New()
+	tenant := &models.Tenant{ID: tenantID, Name: "Test " + tenantID.String()[:8], Domain: tenantID.String() + ".example.com", Status: models.TenantStatusActive, IsActive: true, PlanID: "free"}
+	if err := tx.Create(tenant).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	nextRetryAt := time.Now()
+	failed := FailedLocationUpdate{
+		OriginalEventID: uuid.NewString(),
+		TenantID:        tenantID,
+		UserID:          "user-" + tenantID.String(),
+		ErrorMessage:    "third-party returned status 503",
+		Status:          "pending",
+		NextRetryAt:     &nextRetryAt,
+	}
+	if err := tx.Create(&failed).Error; err != nil {
+		t.Fatal(err)
+	}
+	return failed
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"time"
+
+	"github.com/pavitra93/go-multi-tenant-system/shared/config"
+)
+
+// Config is the streaming service configuration
+type Config struct {
+	Port     string `env:"STREAMING_SERVICE_PORT" default:"8004" validate:"required"`
+	Server   config.ServerConfig
+	Secrets  config.SecretsConfig
+	Database config.DatabaseConfig
+	Redis    config.RedisConfig
+	Metrics  config.MetricsConfig
+
+	Kafka      config.KafkaConfig
+	Consumer   ConsumerConfig
+	ThirdParty config.ThirdPartyConfig
+}
+
+// ConsumerConfig tunes the Kafka consumer and the hand-off of failed deliveries
+type ConsumerConfig struct {
+	GroupID        string        `env:"KAFKA_CONSUMER_GROUP" default:"streaming-service" validate:"required"`
+	MinBytes       int           `env:"KAFKA_CONSUMER_MIN_BYTES" default:"10000" validate:"min=1"`
+	MaxBytes       int           `env:"KAFKA_CONSUMER_MAX_BYTES" default:"10000000" validate:"min=1,gtefield=MinBytes"`
+	CommitInterval time.Duration `env:"KAFKA_CONSUMER_COMMIT_INTERVAL" default:"1s" validate:"gt=0"`
+	ReadTimeout    time.Duration `env:"KAFKA_CONSUMER_READ_TIMEOUT" default:"10s" validate:"gt=0"`
+	ErrorBackoff   time.Duration `env:"KAFKA_CONSUMER_ERROR_BACKOFF" default:"1s" validate:"gt=0"`
+
+	// FirstRetryDelay is when the retry consumer first picks up a failed delivery
+	FirstRetryDelay time.Duration `env:"RETRY_BACKOFF_BASE" default:"1m" validate:"gt=0"`
+}
@@ -3,74 +3,191 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/segmentio/kafka-go"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 	"gorm.io/gorm"
+
+	"github.com/pavitra93/go-multi-tenant-system/shared/config"
+	"github.com/pavitra93/go-multi-tenant-system/shared/logger"
+	"github.com/pavitra93/go-multi-tenant-system/shared/metering"
+	"github.com/pavitra93/go-multi-tenant-system/shared/metrics"
+	"github.com/pavitra93/go-multi-tenant-system/shared/models"
+	"github.com/pavitra93/go-multi-tenant-system/shared/settings"
+	"github.com/pavitra93/go-multi-tenant-system/shared/tracing"
 )
 
+// deliveryFailureSampler keeps a third-party outage from flooding the logs
+var deliveryFailureSampler = logger.NewSampler(time.Minute, 10)
+
 // KafkaConsumer handles Kafka message consumption
 type KafkaConsumer struct {
 	locationReader *kafka.Reader
 	db             *gorm.DB
+	settings       *settings.Store
+	topic          string
+	config         ConsumerConfig
+
+	// cancel stops the consume loop; done is closed once it has returned
+	cancel context.CancelFunc
+	done   chan struct{}
 }
 
 // NewKafkaConsumer creates a new Kafka consumer
-func NewKafkaConsumer(broker string, db *gorm.DB) (*KafkaConsumer, error) {
+func NewKafkaConsumer(kafkaConfig config.KafkaConfig, consumerConfig ConsumerConfig, db *gorm.DB, tenantSettings *settings.Store) (*KafkaConsumer, error) {
 	// Create reader for location updates
 	locationReader := kafka.NewReader(kafka.ReaderConfig{
-		Brokers:        []string{broker},
-		Topic:          "location-updates",
-		GroupID:        "streaming-service",
-		MinBytes:       10e3, // 10KB
-		MaxBytes:       10e6, // 10MB
-		CommitInterval: time.Second,
+		Brokers:        []string{kafkaConfig.Broker},
+		Topic:          kafkaConfig.LocationTopic,
+		GroupID:        consumerConfig.GroupID,
+		MinBytes:       consumerConfig.MinBytes,
+		MaxBytes:       consumerConfig.MaxBytes,
+		CommitInterval: consumerConfig.CommitInterval,
 	})
 
 	return &KafkaConsumer{
 		locationReader: locationReader,
 		db:             db,
+		settings:       tenantSettings,
+		topic:          kafkaConfig.LocationTopic,
+		config:         consumerConfig,
 	}, nil
 }
 
-// ConsumeLocationUpdates consumes location update events from Kafka
-func (kc *KafkaConsumer) ConsumeLocationUpdates(thirdPartyClient *ThirdPartyClient) {
-	log.Println("Starting location updates consumer...")
+// Start consumes location updates in the background until ctx is cancelled or Close is called
+func (kc *KafkaConsumer) Start(ctx context.Context, thirdPartyClient *ThirdPartyClient) {
+	ctx, kc.cancel = context.WithCancel(ctx)
+	kc.done = make(chan struct{})
+
+	go func() {
+		defer close(kc.done)
+		kc.ConsumeLocationUpdates(ctx, thirdPartyClient)
+	}()
+}
+
+// ConsumeLocationUpdates consumes location update events from Kafka until ctx is cancelled.
+// The message being processed when ctx is cancelled is still delivered (or stored for retry).
+func (kc *KafkaConsumer) ConsumeLocationUpdates(ctx context.Context, thirdPartyClient *ThirdPartyClient) {
+	logrus.Info("Starting location updates consumer")
 
-	for {
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-		msg, err := kc.locationReader.ReadMessage(ctx)
+	for ctx.Err() == nil {
+		readCtx, cancel := context.WithTimeout(ctx, kc.config.ReadTimeout)
+		msg, err := kc.locationReader.ReadMessage(readCtx)
 		cancel()
 
 		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
 			// Ignore timeout errors - this is expected when no messages available
-			if err == context.DeadlineExceeded || err.Error() == "context deadline exceeded" {
+			if errors.Is(err, context.DeadlineExceeded) {
 				continue
 			}
 			// Only log actual errors
-			log.Printf("Error reading location message: %v", err)
-			time.Sleep(1 * time.Second)
+			logrus.WithError(err).Error("Error reading location message")
+			select {
+			case <-ctx.Done():
+			case <-time.After(kc.config.ErrorBackoff):
+			}
 			continue
 		}
 
+		metrics.KafkaConsumerLag.WithLabelValues(kc.topic, kc.config.GroupID).Set(float64(kc.locationReader.Stats().Lag))
+
 		var locationEvent LocationEvent
 		if err := json.Unmarshal(msg.Value, &locationEvent); err != nil {
-			log.Printf("Error unmarshaling location event: %v", err)
+			logrus.WithError(err).WithField("offset", msg.Offset).Warn("Error unmarshaling location event")
 			continue
 		}
 
-		// Send to third-party system
-		if err := thirdPartyClient.SendLocationUpdate(locationEvent); err != nil {
-			log.Printf("Error sending location update to third-party: %v", err)
-			// Store failed update in database for retry
-			if dlqErr := kc.storeFailedUpdate(locationEvent, err); dlqErr != nil {
-				log.Printf("Failed to store failed update: %v", dlqErr)
-			}
+		kc.processLocationEvent(messageContext(msg), thirdPartyClient, locationEvent)
+	}
+
+	logrus.Info("Location updates consumer stopped")
+}
+
+// processLocationEvent delivers a single event to the third party inside a consumer span
+func (kc *KafkaConsumer) processLocationEvent(ctx context.Context, thirdPartyClient *ThirdPartyClient, locationEvent LocationEvent) {
+	ctx, span := tracing.Tracer("streaming-service").Start(ctx, kc.topic+" process",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(tracing.RequestIDAttribute(tracing.RequestIDFromContext(ctx))),
+	)
+	defer span.End()
+
+	// Send to the tenant's endpoint, if it has one, else the default
+	tenantSettings := kc.tenantSettings(ctx, locationEvent.TenantID)
+	endpoint := tenantSettings.StreamingEndpoint(thirdPartyClient.endpoint)
+	if err := thirdPartyClient.SendLocationUpdate(ctx, endpoint, locationEvent); err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		entry := logger.FromCtx(ctx).WithFields(logrus.Fields{
+			"tenant_id": locationEvent.TenantID,
+			"user_id":   locationEvent.UserID,
+			"event_id":  locationEvent.ID,
+		})
+		if allowed, suppressed := deliveryFailureSampler.Allow(); allowed {
+			entry.WithError(err).WithField("suppressed", suppressed).Warn("Error sending location update to third-party")
 		}
+		// Store failed update in database for retry
+		if dlqErr := kc.storeFailedUpdate(ctx, locationEvent, tenantSettings, err); dlqErr != nil {
+			entry.WithError(dlqErr).Error("Failed to store failed update")
+		}
+		return
 	}
+
+	kc.recordDelivery(ctx, locationEvent)
+}
+
+// tenantSettings returns the settings of the event's tenant, or nil if its ID is invalid
+func (kc *KafkaConsumer) tenantSettings(ctx context.Context, tenantID string) *models.TenantSettings {
+	tenantUUID, err := uuid.Parse(tenantID)
+	if err != nil {
+		return nil
+	}
+	return kc.settings.Get(ctx, tenantUUID)
+}
+
+// recordDelivery bills a successful delivery. A failure is only logged; the event was
+// delivered, so storing it for retry would send it again.
+func (kc *KafkaConsumer) recordDelivery(ctx context.Context, event LocationEvent) {
+	entry := logger.FromCtx(ctx).WithFields(logrus.Fields{
+		"tenant_id": event.TenantID,
+		"event_id":  event.ID,
+	})
+
+	tenantUUID, err := uuid.Parse(event.TenantID)
+	if err != nil {
+		entry.WithError(err).Warn("Delivered event has an invalid tenant ID; not metered")
+		return
+	}
+	if err := metering.Record(kc.db.WithContext(ctx), metering.Delivered(tenantUUID, event.ID)); err != nil {
+		entry.WithError(err).Error("Failed to meter third-party delivery")
+	}
+}
+
+// messageContext rebuilds the request ID and trace context carried in Kafka headers
+func messageContext(msg kafka.Message) context.Context {
+	carrier := propagation.MapCarrier{}
+	requestID := ""
+	for _, header := range msg.Headers {
+		if header.Key == tracing.RequestIDKey {
+			requestID = string(header.Value)
+			continue
+		}
+		carrier.Set(header.Key, string(header.Value))
+	}
+
+	ctx := tracing.Extract(context.Background(), carrier)
+	if requestID != "" {
+		ctx = tracing.WithRequestID(ctx, requestID)
+	}
+	return ctx
 }
 
 // FailedLocationUpdate represents a failed location update in database
@@ -89,16 +206,18 @@ type FailedLocationUpdate struct {
 	CreatedAt       time.Time  `json:"created_at"`
 	UpdatedAt       time.Time  `json:"updated_at"`
 	ResolvedAt      *time.Time `json:"resolved_at,omitempty"`
+	RequestID       string     `json:"request_id,omitempty"`
+	TraceParent     string     `json:"traceparent,omitempty"`
 }
 
-// storeFailedUpdate stores failed location update in database for retry
-func (kc *KafkaConsumer) storeFailedUpdate(event LocationEvent, err error) error {
-	nextRetryAt := time.Now().Add(1 * time.Minute)
+// storeFailedUpdate stores failed location update in database for retry, first retried
+// after the tenant's retry backoff base
+func (kc *KafkaConsumer) storeFailedUpdate(ctx context.Context, event LocationEvent, tenantSettings *models.TenantSettings, err error) error {
+	nextRetryAt := time.Now().Add(tenantSettings.RetryBackoffBase(kc.config.FirstRetryDelay))
 
 	tenantUUID, parseErr := uuid.Parse(event.TenantID)
 	if parseErr != nil {
-		log.Printf("Failed to parse tenant ID: %v", parseErr)
-		return parseErr
+		return fmt.Errorf("failed to parse tenant ID: %w", parseErr)
 	}
 
 	var sessionUUID *uuid.UUID
@@ -123,15 +242,20 @@ func (kc *KafkaConsumer) storeFailedUpdate(event LocationEvent, err error) error
 		NextRetryAt:     &nextRetryAt,
 		CreatedAt:       time.Now(),
 		UpdatedAt:       time.Now(),
+		RequestID:       tracing.RequestIDFromContext(ctx),
+		TraceParent:     tracing.TraceParent(ctx),
 	}
 
 	if dbErr := kc.db.Create(&failedUpdate).Error; dbErr != nil {
-		log.Printf("Failed to store failed update in database: %v", dbErr)
-		return dbErr
+		return fmt.Errorf("failed to store failed update in database: %w", dbErr)
 	}
 
-	log.Printf("Failed location update stored for retry - ID: %s, Tenant: %s, User: %s, Error: %s, Next retry: %s",
-		event.ID, event.TenantID, event.UserID, err.Error(), nextRetryAt.Format(time.RFC3339))
+	logger.FromCtx(ctx).WithFields(logrus.Fields{
+		"event_id":      event.ID,
+		"tenant_id":     event.TenantID,
+		"user_id":       event.UserID,
+		"next_retry_at": nextRetryAt.Format(time.RFC3339),
+	}).Debug("Failed location update stored for retry")
 
 	return nil
 }
@@ -144,8 +268,18 @@ func sessionUUIDPtr(u *uuid.UUID) *string {
 	return &s
 }
 
-// Close closes the Kafka consumer
-func (kc *KafkaConsumer) Close() error {
+// Close stops the consume loop, waits for the in-flight message to finish, then
+// closes the reader, which commits the offsets of processed messages
+func (kc *KafkaConsumer) Close(ctx context.Context) error {
+	if kc.cancel != nil {
+		kc.cancel()
+		select {
+		case <-kc.done:
+		case <-ctx.Done():
+			logrus.WithError(ctx.Err()).Warn("Location updates consumer did not stop before the shutdown timeout")
+		}
+	}
+
 	if err := kc.locationReader.Close(); err != nil {
 		return fmt.Errorf("failed to close location reader: %w", err)
 	}
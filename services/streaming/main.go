@@ -1,49 +1,109 @@
 package main
 
 import (
-	"log"
-	"os"
+	"context"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 	"github.com/pavitra93/go-multi-tenant-system/shared/config"
+	"github.com/pavitra93/go-multi-tenant-system/shared/logger"
+	"github.com/pavitra93/go-multi-tenant-system/shared/metrics"
+	"github.com/pavitra93/go-multi-tenant-system/shared/middleware"
+	"github.com/pavitra93/go-multi-tenant-system/shared/server"
+	"github.com/pavitra93/go-multi-tenant-system/shared/settings"
+	"github.com/pavitra93/go-multi-tenant-system/shared/tracing"
 	"github.com/pavitra93/go-multi-tenant-system/shared/utils"
 	"github.com/sirupsen/logrus"
 )
 
 func main() {
-	// Load environment variables
-	if err := godotenv.Load(); err != nil {
+	// Load environment variables before configuring the logger so LOG_LEVEL/LOG_FORMAT apply
+	envErr := godotenv.Load()
+	logger.Init("streaming-service")
+	if envErr != nil {
 		logrus.Warn("No .env file found, using environment variables")
 	}
 
+	// Initialize tracing (no-op exporter unless OTEL_TRACES_EXPORTER is set)
+	shutdownTracing, err := tracing.Init("streaming-service")
+	if err != nil {
+		logrus.WithError(err).Fatal("Failed to initialize tracing")
+	}
+	defer shutdownTracing(context.Background())
+
+	// Load and validate configuration; any problem stops startup
+	var cfg Config
+	if err := config.Load(&cfg); err != nil {
+		logrus.WithError(err).Fatal("Invalid configuration")
+	}
+	metrics.Configure(cfg.Metrics)
+
+	// Cancelled on SIGINT/SIGTERM to begin graceful shutdown
+	ctx, stop := server.SignalContext()
+	defer stop()
+
+	// Metrics are scraped on an internal listener, not the public port
+	metrics.Serve(ctx, cfg.Metrics, cfg.Server)
+
+	// Resolve credentials from the secret provider and refresh them in the background
+	secrets, err := config.NewSecretManager(ctx, cfg.Secrets, &cfg)
+	if err != nil {
+		logrus.WithError(err).Fatal("Failed to load secrets")
+	}
+	go secrets.Run(ctx)
+
+	// Initialize Redis for caching tenant settings
+	if err := utils.InitRedis(cfg.Redis.Options(secrets)); err != nil {
+		logrus.WithError(err).Fatal("Failed to connect to Redis")
+	}
+	defer utils.CloseRedis()
+
 	// Initialize database connection
-	db, err := config.ConnectDatabase()
+	db, err := cfg.Database.Connect(secrets)
 	if err != nil {
-		log.Fatal("Failed to initialize database:", err)
+		logrus.WithError(err).Fatal("Failed to initialize database")
+	}
+
+	// Export connection pool statistics
+	if err := metrics.RegisterDBStats(db, cfg.Database.DBName); err != nil {
+		logrus.Warnf("Failed to register database metrics: %v", err)
+	}
+	if err := metrics.RegisterRedisStats(utils.GetRedisClient()); err != nil {
+		logrus.Warnf("Failed to register Redis metrics: %v", err)
 	}
 
+	// Tenants' overrides of the third-party endpoint and retry backoff
+	tenantSettings := settings.NewStore(db, utils.GetRedisClient())
+
 	// Initialize Kafka consumer with database connection
-	kafkaConsumer, err := NewKafkaConsumer(os.Getenv("KAFKA_BROKER"), db)
+	kafkaConsumer, err := NewKafkaConsumer(cfg.Kafka, cfg.Consumer, db, tenantSettings)
 	if err != nil {
-		log.Fatal("Failed to initialize Kafka consumer:", err)
+		logrus.WithError(err).Fatal("Failed to initialize Kafka consumer")
 	}
-	defer kafkaConsumer.Close()
 
 	// Initialize third-party client
-	thirdPartyClient := NewThirdPartyClient(os.Getenv("THIRD_PARTY_ENDPOINT"))
+	thirdPartyClient := NewThirdPartyClient(cfg.ThirdParty, secrets.Secret(config.ThirdPartyAPIKey))
 
 	// Start Kafka consumer for location updates only
-	go kafkaConsumer.ConsumeLocationUpdates(thirdPartyClient)
+	kafkaConsumer.Start(ctx, thirdPartyClient)
+
+	// Initialize authentication middleware
+	authMiddleware := middleware.NewAuthMiddleware(db)
 
 	// Initialize Gin router
-	router := gin.Default()
+	router := gin.New()
+	router.Use(gin.Recovery(), logger.RequestLogger())
+	router.Use(middleware.RequestTracing("streaming-service"))
+	router.Use(metrics.HTTPMiddleware("streaming-service"))
 
 	// Health check endpoint
 	router.GET("/health", func(c *gin.Context) {
 		utils.OKResponse(c, "Streaming service is healthy", nil)
 	})
 
+	// Redacted configuration (admin only); exposed through the gateway's /admin/config/streaming-service
+	router.GET("/admin/config", authMiddleware.RequireAuth(), authMiddleware.RequireRole("admin"), config.DumpHandler("streaming-service", &cfg))
+
 	// Observability endpoints (for monitoring/demonstration)
 	// These show that streaming requirements are met
 	streaming := router.Group("/streaming")
@@ -51,14 +111,10 @@ func main() {
 		streaming.GET("/health", handleGetStreamingHealth(thirdPartyClient))
 	}
 
-	// Start server
-	port := os.Getenv("STREAMING_SERVICE_PORT")
-	if port == "" {
-		port = "8004"
-	}
-
-	logrus.Infof("Streaming service starting on port %s", port)
-	if err := router.Run(":" + port); err != nil {
-		log.Fatal("Failed to start streaming service:", err)
+	// Serve until SIGINT/SIGTERM, then drain in-flight requests
+	runner := server.New("Streaming service", ":"+cfg.Port, router, cfg.Server)
+	runner.OnShutdown("kafka consumer", kafkaConsumer.Close)
+	if err := runner.Run(ctx); err != nil {
+		logrus.WithError(err).Fatal("Streaming service did not shut down cleanly")
 	}
 }
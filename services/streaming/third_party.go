@@ -2,16 +2,24 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"sync"
 	"time"
+
+	"go.opentelemetry.io/otel/propagation"
+
+	"github.com/pavitra93/go-multi-tenant-system/shared/config"
+	"github.com/pavitra93/go-multi-tenant-system/shared/metrics"
+	"github.com/pavitra93/go-multi-tenant-system/shared/tracing"
 )
 
 // ThirdPartyClient handles communication with third-party systems
 type ThirdPartyClient struct {
 	endpoint    string
+	apiKey      *config.Secret
 	httpClient  *http.Client
 	connected   bool
 	lastSuccess time.Time
@@ -20,21 +28,42 @@ type ThirdPartyClient struct {
 }
 
 // NewThirdPartyClient creates a new third-party client
-func NewThirdPartyClient(endpoint string) *ThirdPartyClient {
+func NewThirdPartyClient(thirdParty config.ThirdPartyConfig, apiKey *config.Secret) *ThirdPartyClient {
 	return &ThirdPartyClient{
-		endpoint: endpoint,
+		endpoint: thirdParty.Endpoint,
+		apiKey:   apiKey,
 		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
+			Timeout: thirdParty.Timeout,
 		},
 		connected: false,
 	}
 }
 
-// SendLocationUpdate sends location data to third-party system
-func (c *ThirdPartyClient) SendLocationUpdate(event LocationEvent) error {
+// SendLocationUpdate sends location data to endpoint: the default endpoint or the
+// tenant's own. The platform API key is only sent to the default endpoint, and only
+// deliveries to it affect the reported connection status.
+func (c *ThirdPartyClient) SendLocationUpdate(ctx context.Context, endpoint string, event LocationEvent) error {
+	err := c.send(ctx, endpoint, event)
+	if endpoint != c.endpoint {
+		return err
+	}
+
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
+	if err != nil {
+		c.lastError = err
+		return err
+	}
 
+	// Update success status
+	c.connected = true
+	c.lastSuccess = time.Now()
+	c.lastError = nil
+	return nil
+}
+
+// send posts the event to endpoint
+func (c *ThirdPartyClient) send(ctx context.Context, endpoint string, event LocationEvent) error {
 	// Prepare payload
 	payload := map[string]interface{}{
 		"event_type": "location_update",
@@ -44,37 +73,39 @@ func (c *ThirdPartyClient) SendLocationUpdate(event LocationEvent) error {
 
 	jsonData, err := json.Marshal(payload)
 	if err != nil {
-		c.lastError = fmt.Errorf("failed to marshal location data: %w", err)
-		return err
+		return fmt.Errorf("failed to marshal location data: %w", err)
 	}
 
 	// Send HTTP request
-	req, err := http.NewRequest("POST", c.endpoint+"/location", bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint+"/location", bytes.NewBuffer(jsonData))
 	if err != nil {
-		c.lastError = fmt.Errorf("failed to create request: %w", err)
-		return err
+		return fmt.Errorf("failed to create request: %w", err)
 	}
 
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("X-Tenant-ID", event.TenantID)
 	req.Header.Set("X-User-ID", event.UserID)
+	if apiKey := c.apiKey.Value(); apiKey != "" && endpoint == c.endpoint {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+	if requestID := tracing.RequestIDFromContext(ctx); requestID != "" {
+		req.Header.Set(tracing.RequestIDHeader, requestID)
+	}
+	tracing.Inject(ctx, propagation.HeaderCarrier(req.Header))
 
+	start := time.Now()
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		c.lastError = fmt.Errorf("failed to send location update: %w", err)
-		return err
+		metrics.ThirdPartyRequestDuration.WithLabelValues("streaming-service", "error").Observe(time.Since(start).Seconds())
+		return fmt.Errorf("failed to send location update: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		c.lastError = fmt.Errorf("third-party returned status %d", resp.StatusCode)
+		metrics.ThirdPartyRequestDuration.WithLabelValues("streaming-service", "failure").Observe(time.Since(start).Seconds())
 		return fmt.Errorf("third-party returned status %d", resp.StatusCode)
 	}
-
-	// Update success status
-	c.connected = true
-	c.lastSuccess = time.Now()
-	c.lastError = nil
+	metrics.ThirdPartyRequestDuration.WithLabelValues("streaming-service", "success").Observe(time.Since(start).Seconds())
 	return nil
 }
 
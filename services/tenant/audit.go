@@ -0,0 +1,282 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"github.com/pavitra93/go-multi-tenant-system/shared/logger"
+	"github.com/pavitra93/go-multi-tenant-system/shared/models"
+	"github.com/pavitra93/go-multi-tenant-system/shared/pagination"
+	"github.com/pavitra93/go-multi-tenant-system/shared/utils"
+	"github.com/pavitra93/go-multi-tenant-system/shared/validation"
+)
+
+// defaultAuditExportPeriod is the period of an audit export without from
+const defaultAuditExportPeriod = 30 * 24 * time.Hour
+
+// auditCSVHeader is the header row of a CSV audit export
+var auditCSVHeader = []string{
+	"id", "created_at", "tenant_id", "actor_id", "actor_role", "action",
+	"target_type", "target_id", "changes", "metadata", "request_id", "ip_address",
+}
+
+// auditEventPages orders audit events, newest first by default
+var auditEventPages = &pagination.Spec[models.AuditEvent]{
+	Sorts: map[string]pagination.Sort[models.AuditEvent]{
+		"created_at": pagination.ByTime("created_at", func(e models.AuditEvent) time.Time { return e.CreatedAt }),
+	},
+	DefaultSort:  "created_at",
+	DefaultOrder: pagination.Desc,
+	ID:           pagination.ByUUID("id", func(e models.AuditEvent) uuid.UUID { return e.ID }),
+}
+
+// filterAuditEvents narrows query to the events matching filter
+func filterAuditEvents(query *gorm.DB, filter *models.AuditEventListQuery) *gorm.DB {
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+	if filter.ActorID != "" {
+		query = query.Where("actor_id = ?", filter.ActorID)
+	}
+	if filter.TargetType != "" {
+		query = query.Where("target_type = ?", filter.TargetType)
+	}
+	if filter.TargetID != "" {
+		query = query.Where("target_id = ?", filter.TargetID)
+	}
+	if filter.From != nil {
+		query = query.Where("created_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("created_at < ?", *filter.To)
+	}
+	return query
+}
+
+// listAuditEvents writes a page of the events matching filter within query
+func listAuditEvents(c *gin.Context, query *gorm.DB, filter *models.AuditEventListQuery) {
+	page, ok := pagination.Parse(c, auditEventPages)
+	if !ok {
+		return
+	}
+
+	var events []models.AuditEvent
+	if err := page.Apply(filterAuditEvents(query, filter)).Find(&events).Error; err != nil {
+		logger.FromContext(c).WithError(err).Error("Failed to fetch audit events")
+		utils.InternalServerErrorResponse(c, "Failed to fetch audit events")
+		return
+	}
+
+	events, info := page.Result(events)
+	utils.PaginatedResponse(c, "Audit events retrieved successfully", events, info)
+}
+
+// handleGetTenantAuditEvents lists the tenant's audit events a page at a time
+func handleGetTenantAuditEvents(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var filter models.AuditEventListQuery
+		if !validation.BindQuery(c, &filter) {
+			return
+		}
+
+		tenant, ok := loadTenant(c, db)
+		if !ok {
+			return
+		}
+
+		listAuditEvents(c, db.Where("tenant_id = ?", tenant.ID), &filter)
+	}
+}
+
+// handleListAuditEvents lists every tenant's audit events, and platform-wide ones, a page
+// at a time (admin only)
+func handleListAuditEvents(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var filter models.AuditEventListQuery
+		var tenantFilter models.AuditTenantQuery
+		if !validation.BindQuery(c, &filter) || !validation.BindQuery(c, &tenantFilter) {
+			return
+		}
+
+		query := db.Model(&models.AuditEvent{})
+		if tenantFilter.TenantID != "" {
+			query = query.Where("tenant_id = ?", tenantFilter.TenantID)
+		}
+		listAuditEvents(c, query, &filter)
+	}
+}
+
+// auditExportPeriod returns the export's [from, to), writing a 400 response if the
+// filter's period is invalid. Without from it is the 30 days before to; without to it
+// ends now.
+func auditExportPeriod(c *gin.Context, filter *models.AuditEventListQuery) (time.Time, time.Time, bool) {
+	to := time.Now().UTC()
+	if filter.To != nil {
+		to = filter.To.UTC()
+	}
+	from := to.Add(-defaultAuditExportPeriod)
+	if filter.From != nil {
+		from = filter.From.UTC()
+	}
+
+	if !to.After(from) {
+		utils.ValidationErrorResponse(c, []utils.FieldError{{Field: "to", Rule: "gtfield", Message: "must be after from"}})
+		return time.Time{}, time.Time{}, false
+	}
+	if to.Sub(from) > maxExportPeriod {
+		utils.ValidationErrorResponse(c, []utils.FieldError{{Field: "to", Rule: "max", Message: "period can't be longer than 366 days"}})
+		return time.Time{}, time.Time{}, false
+	}
+	filter.From, filter.To = &from, &to
+	return from, to, true
+}
+
+// exportAuditEvents writes the events matching filter within query, oldest first, as a
+// JSON document or a CSV attachment
+func exportAuditEvents(c *gin.Context, query *gorm.DB, filter *models.AuditEventListQuery, format string, name string) {
+	from, to, ok := auditExportPeriod(c, filter)
+	if !ok {
+		return
+	}
+
+	log := logger.FromContext(c).WithFields(logrus.Fields{
+		"from":   from,
+		"to":     to,
+		"format": format,
+		"scope":  name,
+	})
+
+	rows, err := filterAuditEvents(query, filter).Order("created_at, id").Rows()
+	if err != nil {
+		log.WithError(err).Error("Failed to export audit events")
+		utils.InternalServerErrorResponse(c, "Failed to export audit events")
+		return
+	}
+	defer rows.Close()
+
+	if format == "csv" {
+		writeAuditCSV(c, log, query, rows, from, to, name)
+		return
+	}
+
+	export := models.AuditExport{
+		From:        from,
+		To:          to,
+		GeneratedAt: time.Now().UTC(),
+		Events:      []models.AuditEvent{},
+	}
+	for rows.Next() {
+		var event models.AuditEvent
+		if err := query.ScanRows(rows, &event); err != nil {
+			log.WithError(err).Error("Failed to export audit events")
+			utils.InternalServerErrorResponse(c, "Failed to export audit events")
+			return
+		}
+		export.Events = append(export.Events, event)
+	}
+	if err := rows.Err(); err != nil {
+		log.WithError(err).Error("Failed to export audit events")
+		utils.InternalServerErrorResponse(c, "Failed to export audit events")
+		return
+	}
+
+	log.WithField("events", len(export.Events)).Info("Audit events exported")
+	utils.OKResponse(c, "Audit events exported successfully", export)
+}
+
+// writeAuditCSV streams rows as a CSV attachment; changes and metadata are JSON columns
+func writeAuditCSV(c *gin.Context, log *logrus.Entry, db *gorm.DB, rows *sql.Rows, from, to time.Time, name string) {
+	filename := fmt.Sprintf("audit-%s-%s-%s.csv", name, from.Format("20060102T1504"), to.Format("20060102T1504"))
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Status(http.StatusOK)
+
+	writer := csv.NewWriter(c.Writer)
+	if err := writer.Write(auditCSVHeader); err != nil {
+		log.WithError(err).Warn("Failed to write audit export")
+		return
+	}
+
+	events := 0
+	for rows.Next() {
+		var event models.AuditEvent
+		if err := db.ScanRows(rows, &event); err != nil {
+			// The response has started; the client sees a truncated file
+			log.WithError(err).Error("Failed to export audit events")
+			return
+		}
+		events++
+
+		tenantID := ""
+		if event.TenantID != nil {
+			tenantID = event.TenantID.String()
+		}
+		changes, _ := json.Marshal(event.Changes)
+		metadata, _ := json.Marshal(event.Metadata)
+		record := []string{
+			event.ID.String(), event.CreatedAt.UTC().Format(time.RFC3339Nano), tenantID, event.ActorID, event.ActorRole, event.Action,
+			event.TargetType, event.TargetID, string(changes), string(metadata), event.RequestID, event.IPAddress,
+		}
+		if err := writer.Write(record); err != nil {
+			log.WithError(err).Warn("Failed to write audit export")
+			return
+		}
+	}
+	if err := rows.Err(); err != nil {
+		log.WithError(err).Error("Failed to export audit events")
+		return
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		log.WithError(err).Warn("Failed to write audit export")
+		return
+	}
+	log.WithField("events", events).Info("Audit events exported")
+}
+
+// handleExportTenantAuditEvents exports the tenant's audit events as JSON or CSV
+func handleExportTenantAuditEvents(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var filter models.AuditEventListQuery
+		var export models.AuditExportQuery
+		if !validation.BindQuery(c, &filter) || !validation.BindQuery(c, &export) {
+			return
+		}
+
+		tenant, ok := loadTenant(c, db)
+		if !ok {
+			return
+		}
+
+		exportAuditEvents(c, db.Model(&models.AuditEvent{}).Where("tenant_id = ?", tenant.ID), &filter, export.Format, tenant.ID.String())
+	}
+}
+
+// handleExportAuditEvents exports every tenant's audit events, and platform-wide ones, as
+// JSON or CSV (admin only)
+func handleExportAuditEvents(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var filter models.AuditEventListQuery
+		var tenantFilter models.AuditTenantQuery
+		var export models.AuditExportQuery
+		if !validation.BindQuery(c, &filter) || !validation.BindQuery(c, &tenantFilter) || !validation.BindQuery(c, &export) {
+			return
+		}
+
+		query, name := db.Model(&models.AuditEvent{}), "all"
+		if tenantFilter.TenantID != "" {
+			query, name = query.Where("tenant_id = ?", tenantFilter.TenantID), tenantFilter.TenantID
+		}
+		exportAuditEvents(c, query, &filter, export.Format, name)
+	}
+}
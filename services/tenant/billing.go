@@ -0,0 +1,335 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"github.com/pavitra93/go-multi-tenant-system/shared/logger"
+	"github.com/pavitra93/go-multi-tenant-system/shared/metering"
+	"github.com/pavitra93/go-multi-tenant-system/shared/models"
+	"github.com/pavitra93/go-multi-tenant-system/shared/utils"
+	"github.com/pavitra93/go-multi-tenant-system/shared/validation"
+)
+
+// maxExportPeriod bounds the period of one usage export
+const maxExportPeriod = 366 * 24 * time.Hour
+
+// usageRecord is one metric's total for a tenant, and for an hour with granularity=hour
+type usageRecord struct {
+	TenantID   uuid.UUID
+	TenantName string
+	Hour       *time.Time
+	Metric     metering.Metric
+	Quantity   int64
+}
+
+// usageField returns the field of counts that holds metric, or nil for an unknown metric
+func usageField(counts *models.UsageCounts, metric metering.Metric) *int64 {
+	switch metric {
+	case metering.LocationsStored:
+		return &counts.LocationsStored
+	case metering.SessionsStarted:
+		return &counts.SessionsStarted
+	case metering.SessionSeconds:
+		return &counts.SessionSeconds
+	case metering.ThirdPartyDeliveries:
+		return &counts.ThirdPartyDeliveries
+	case metering.ActiveUsers:
+		return &counts.ActiveUsers
+	}
+	return nil
+}
+
+// usagePeriod returns the export's [start, end) in UTC, writing a 400 response if the
+// query's period is invalid
+func usagePeriod(c *gin.Context, query *models.UsageExportQuery) (time.Time, time.Time, bool) {
+	fail := func(field, rule, message string) (time.Time, time.Time, bool) {
+		utils.ValidationErrorResponse(c, []utils.FieldError{{Field: field, Rule: rule, Message: message}})
+		return time.Time{}, time.Time{}, false
+	}
+
+	if query.From == nil && query.To == nil {
+		month := time.Now().UTC()
+		if query.Period != "" {
+			// Already validated by the datetime binding
+			month, _ = time.Parse("2006-01", query.Period)
+		}
+		start := time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, time.UTC)
+		return start, start.AddDate(0, 1, 0), true
+	}
+
+	if query.Period != "" {
+		return fail("period", "excluded_with", "can't be combined with from and to")
+	}
+	if query.From == nil {
+		return fail("from", "required_with", "is required with to")
+	}
+	if query.To == nil {
+		return fail("to", "required_with", "is required with from")
+	}
+
+	start, end := query.From.UTC(), query.To.UTC()
+	if !start.Equal(start.Truncate(time.Hour)) {
+		return fail("from", "hour", "must be on the hour")
+	}
+	if !end.Equal(end.Truncate(time.Hour)) {
+		return fail("to", "hour", "must be on the hour")
+	}
+	if !end.After(start) {
+		return fail("to", "gtfield", "must be after from")
+	}
+	if end.Sub(start) > maxExportPeriod {
+		return fail("to", "max", "period can't be longer than 366 days")
+	}
+	return start, end, true
+}
+
+// exportUsage calls emit with each tenant's usage, per hour when hourly, in tenant name order
+func exportUsage(db *gorm.DB, start, end time.Time, tenantID string, hourly bool, emit func(*models.UsageExportRow) error) error {
+	columns := "u.tenant_id, t.name AS tenant_name, u.metric"
+	group, order := "u.tenant_id, t.name, u.metric", "t.name, u.tenant_id"
+	if hourly {
+		columns, group, order = columns+", u.hour", group+", u.hour", order+", u.hour"
+	}
+
+	query := db.Table("usage_hourly AS u").
+		Select(columns+", SUM(u.quantity) AS quantity").
+		Joins("JOIN tenants t ON t.id = u.tenant_id").
+		Where("u.hour >= ? AND u.hour < ?", start, end)
+	if tenantID != "" {
+		query = query.Where("u.tenant_id = ?", tenantID)
+	}
+
+	rows, err := query.Group(group).Order(order).Rows()
+	if err != nil {
+		return fmt.Errorf("failed to query usage: %w", err)
+	}
+	defer rows.Close()
+	return pivotUsage(db, rows, emit)
+}
+
+// pivotUsage folds rows holding one metric each into a row per tenant and hour. Rows must
+// be ordered so each tenant's (and hour's) metrics are adjacent.
+func pivotUsage(db *gorm.DB, rows *sql.Rows, emit func(*models.UsageExportRow) error) error {
+	var current *models.UsageExportRow
+	for rows.Next() {
+		var record usageRecord
+		if err := db.ScanRows(rows, &record); err != nil {
+			return fmt.Errorf("failed to read usage: %w", err)
+		}
+
+		if current == nil || current.TenantID != record.TenantID || !sameHour(current.Hour, record.Hour) {
+			if current != nil {
+				if err := emit(current); err != nil {
+					return err
+				}
+			}
+			current = &models.UsageExportRow{TenantID: record.TenantID, TenantName: record.TenantName, Hour: record.Hour}
+		}
+		if field := usageField(&current.UsageCounts, record.Metric); field != nil {
+			*field += record.Quantity
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read usage: %w", err)
+	}
+
+	if current != nil {
+		return emit(current)
+	}
+	return nil
+}
+
+// sameHour reports whether a and b are the same hour, or both absent
+func sameHour(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+// handleExportUsage exports metered usage for a billing period as JSON or CSV (admin only)
+func handleExportUsage(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var query models.UsageExportQuery
+		if !validation.BindQuery(c, &query) {
+			return
+		}
+
+		start, end, ok := usagePeriod(c, &query)
+		if !ok {
+			return
+		}
+		if query.Granularity == "" {
+			query.Granularity = "total"
+		}
+		hourly := query.Granularity == "hour"
+
+		log := logger.FromContext(c).WithFields(logrus.Fields{
+			"period_start": start,
+			"period_end":   end,
+			"granularity":  query.Granularity,
+			"format":       query.Format,
+			"tenant_id":    query.TenantID,
+		})
+
+		if query.Format == "csv" {
+			writeUsageCSV(c, log, db, &query, start, end, hourly)
+			return
+		}
+
+		export := models.UsageExport{
+			PeriodStart: start,
+			PeriodEnd:   end,
+			Granularity: query.Granularity,
+			GeneratedAt: time.Now().UTC(),
+			Rows:        []models.UsageExportRow{},
+		}
+		err := exportUsage(db, start, end, query.TenantID, hourly, func(row *models.UsageExportRow) error {
+			export.Rows = append(export.Rows, *row)
+			return nil
+		})
+		if err != nil {
+			log.WithError(err).Error("Failed to export usage")
+			utils.InternalServerErrorResponse(c, "Failed to export usage")
+			return
+		}
+
+		log.WithField("rows", len(export.Rows)).Info("Usage exported")
+		utils.OKResponse(c, "Usage exported successfully", export)
+	}
+}
+
+// writeUsageCSV streams the export as a CSV attachment with one column per metric
+func writeUsageCSV(c *gin.Context, log *logrus.Entry, db *gorm.DB, query *models.UsageExportQuery, start, end time.Time, hourly bool) {
+	header := []string{"tenant_id", "tenant_name", "period_start", "period_end"}
+	if hourly {
+		header = append(header, "hour")
+	}
+	for _, metric := range metering.Metrics {
+		header = append(header, string(metric))
+	}
+
+	periodStart, periodEnd := start.Format(time.RFC3339), end.Format(time.RFC3339)
+	writer := csv.NewWriter(c.Writer)
+	rows := 0
+	err := exportUsage(db, start, end, query.TenantID, hourly, func(row *models.UsageExportRow) error {
+		if rows == 0 {
+			writeUsageCSVHeaders(c, start, end)
+			if err := writer.Write(header); err != nil {
+				return err
+			}
+		}
+		rows++
+
+		record := []string{row.TenantID.String(), row.TenantName, periodStart, periodEnd}
+		if hourly {
+			record = append(record, row.Hour.UTC().Format(time.RFC3339))
+		}
+		for _, metric := range metering.Metrics {
+			record = append(record, strconv.FormatInt(*usageField(&row.UsageCounts, metric), 10))
+		}
+		return writer.Write(record)
+	})
+	if err == nil && rows == 0 {
+		writeUsageCSVHeaders(c, start, end)
+		err = writer.Write(header)
+	}
+	if err != nil {
+		log.WithError(err).Error("Failed to export usage")
+		if rows == 0 {
+			utils.InternalServerErrorResponse(c, "Failed to export usage")
+		}
+		// Otherwise the response has started; the client sees a truncated file
+		return
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		log.WithError(err).Warn("Failed to write usage export")
+		return
+	}
+	log.WithField("rows", rows).Info("Usage exported")
+}
+
+// writeUsageCSVHeaders starts a CSV attachment response named after the period
+func writeUsageCSVHeaders(c *gin.Context, start, end time.Time) {
+	filename := fmt.Sprintf("usage-%s-%s.csv", start.Format("20060102T15"), end.Format("20060102T15"))
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Status(http.StatusOK)
+}
+
+// UsagePruner deletes metering ledger rows once they are too old for their event to repeat
+type UsagePruner struct {
+	db        *gorm.DB
+	retention time.Duration
+	interval  time.Duration
+
+	// cancel stops the prune loop; done is closed once it has returned
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewUsagePruner creates a pruner that runs every cfg.PruneInterval
+func NewUsagePruner(db *gorm.DB, cfg MeteringConfig) *UsagePruner {
+	return &UsagePruner{
+		db:        db,
+		retention: cfg.EventRetention,
+		interval:  cfg.PruneInterval,
+	}
+}
+
+// Start prunes the ledger in the background until ctx is cancelled or Stop is called
+func (p *UsagePruner) Start(ctx context.Context) {
+	ctx, p.cancel = context.WithCancel(ctx)
+	p.done = make(chan struct{})
+
+	go func() {
+		defer close(p.done)
+		p.run(ctx)
+	}()
+}
+
+// Stop cancels the prune loop and waits for a running prune to finish
+func (p *UsagePruner) Stop(ctx context.Context) error {
+	if p.cancel == nil {
+		return nil
+	}
+
+	p.cancel()
+	select {
+	case <-p.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("usage pruner did not stop: %w", ctx.Err())
+	}
+}
+
+// run prunes the ledger until ctx is cancelled
+func (p *UsagePruner) run(ctx context.Context) {
+	for {
+		deleted, err := metering.Prune(p.db.WithContext(ctx), time.Now().Add(-p.retention))
+		if err != nil && ctx.Err() == nil {
+			logrus.WithError(err).Error("Error pruning usage events")
+		} else if deleted > 0 {
+			logrus.WithField("deleted", deleted).Info("Pruned usage events")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(p.interval):
+		}
+	}
+}
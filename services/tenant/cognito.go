@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cognitoidentityprovider"
+
+	"github.com/pavitra93/go-multi-tenant-system/shared/config"
+	"github.com/pavitra93/go-multi-tenant-system/shared/metrics"
+	"github.com/pavitra93/go-multi-tenant-system/shared/models"
+	"github.com/pavitra93/go-multi-tenant-system/shared/utils"
+)
+
+// cognitoDirectory manages tenant users in the Cognito user pool
+type cognitoDirectory struct {
+	client     *cognitoidentityprovider.CognitoIdentityProvider
+	userPoolID string
+	breaker    *utils.CircuitBreaker
+}
+
+// newCognitoDirectory creates the Cognito client and the circuit breaker guarding its calls
+func newCognitoDirectory(cognito config.CognitoConfig, breaker config.CircuitBreakerConfig) (*cognitoDirectory, error) {
+	sess, err := session.NewSession(&aws.Config{
+		Region: aws.String(cognito.Region),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AWS session: %w", err)
+	}
+
+	directory := &cognitoDirectory{
+		client:     cognitoidentityprovider.New(sess),
+		userPoolID: cognito.UserPoolID,
+		breaker:    utils.NewCircuitBreaker(breaker.MaxFailures, breaker.ResetTimeout),
+	}
+	metrics.ObserveCircuitBreaker("cognito", directory.breaker)
+	return directory, nil
+}
+
+// DeleteUser removes the user whose sub is cognitoID. It reports false when
+// the user was already gone, so an interrupted purge can safely run again.
+func (d *cognitoDirectory) DeleteUser(ctx context.Context, cognitoID string) (bool, error) {
+	deleted := true
+	err := d.breaker.Call(func() error {
+		_, err := d.client.AdminDeleteUserWithContext(ctx, &cognitoidentityprovider.AdminDeleteUserInput{
+			UserPoolId: aws.String(d.userPoolID),
+			Username:   aws.String(cognitoID),
+		})
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == cognitoidentityprovider.ErrCodeUserNotFoundException {
+			deleted = false
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to delete Cognito user %s: %w", cognitoID, err)
+	}
+	return deleted, nil
+}
+
+// SetRole updates the user's custom:role attribute. A user missing from the pool
+// is skipped: the database role is authoritative and login reads it from there.
+func (d *cognitoDirectory) SetRole(ctx context.Context, cognitoID string, role models.UserRole) error {
+	err := d.breaker.Call(func() error {
+		_, err := d.client.AdminUpdateUserAttributesWithContext(ctx, &cognitoidentityprovider.AdminUpdateUserAttributesInput{
+			UserPoolId: aws.String(d.userPoolID),
+			Username:   aws.String(cognitoID),
+			UserAttributes: []*cognitoidentityprovider.AttributeType{
+				{Name: aws.String("custom:role"), Value: aws.String(string(role))},
+			},
+		})
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == cognitoidentityprovider.ErrCodeUserNotFoundException {
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update Cognito role of %s: %w", cognitoID, err)
+	}
+	return nil
+}
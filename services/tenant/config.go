@@ -0,0 +1,123 @@
+package main
+
+import (
+	"time"
+
+	"github.com/pavitra93/go-multi-tenant-system/shared/blob"
+	"github.com/pavitra93/go-multi-tenant-system/shared/config"
+	"github.com/pavitra93/go-multi-tenant-system/shared/domains"
+	"github.com/pavitra93/go-multi-tenant-system/shared/notify"
+)
+
+// Config is the tenant service configuration
+type Config struct {
+	Port     string `env:"TENANT_SERVICE_PORT" default:"8002" validate:"required"`
+	Server   config.ServerConfig
+	Secrets  config.SecretsConfig
+	Database config.DatabaseConfig
+	Redis    config.RedisConfig
+	Metrics  config.MetricsConfig
+
+	// TenantBaseDomain is the platform domain whose subdomains are tenant slugs;
+	// needed to invalidate the gateway's host cache when a slug changes
+	TenantBaseDomain string `env:"TENANT_BASE_DOMAIN"`
+
+	// Cognito users are removed when a deleted tenant is purged
+	Cognito        config.CognitoConfig
+	CognitoBreaker config.CircuitBreakerConfig `envPrefix:"COGNITO_"`
+
+	// Custom domains resolve to their tenant once verified
+	Domains DomainConfig
+
+	Deletion DeletionConfig
+
+	// User erasures are signed with the deletion report signing key
+	Erasures ErasureConfig
+
+	Notifier    notify.Config
+	Invitations InvitationConfig
+
+	Metering MeteringConfig
+
+	// Export archives are written to the blob store
+	Exports ExportConfig
+	Blob    blob.Config
+}
+
+// DomainConfig controls how tenants' custom domains are verified and re-verified
+type DomainConfig struct {
+	PollInterval time.Duration `env:"DOMAIN_POLL_INTERVAL" default:"1m" validate:"gt=0"`
+
+	// RetryInterval is how soon a pending domain, or a verified one whose check failed, is
+	// checked again
+	RetryInterval time.Duration `env:"DOMAIN_RETRY_INTERVAL" default:"5m" validate:"gt=0"`
+
+	// PendingTimeout is how long a new domain has to be verified before it fails
+	PendingTimeout time.Duration `env:"DOMAIN_PENDING_TIMEOUT" default:"72h" validate:"gt=0"`
+
+	// ReverifyInterval is how often a verified domain is checked again; it fails after
+	// MaxFailures checks in a row don't find the token
+	ReverifyInterval time.Duration `env:"DOMAIN_REVERIFY_INTERVAL" default:"24h" validate:"gt=0"`
+	MaxFailures      int           `env:"DOMAIN_MAX_FAILURES" default:"3" validate:"min=1"`
+
+	Check domains.Config
+}
+
+// ExportConfig controls tenant data exports and their download links
+type ExportConfig struct {
+	PollInterval time.Duration `env:"TENANT_EXPORT_POLL_INTERVAL" default:"10s" validate:"gt=0"`
+
+	// StaleAfter is how long a running export may go without progress before another
+	// instance takes it over
+	StaleAfter time.Duration `env:"TENANT_EXPORT_STALE_AFTER" default:"10m" validate:"gt=0"`
+
+	// ArchiveTTL is how long a finished archive is kept; LinkTTL how long a download link works
+	ArchiveTTL time.Duration `env:"TENANT_EXPORT_TTL" default:"168h" validate:"gt=0"`
+	LinkTTL    time.Duration `env:"TENANT_EXPORT_LINK_TTL" default:"15m" validate:"gt=0"`
+
+	// DownloadURL is the public address of /v1/exports; links append /{id}/download
+	DownloadURL string `env:"TENANT_EXPORT_DOWNLOAD_URL" default:"http://localhost:8080/v1/exports" validate:"required,url"`
+
+	// SigningKey signs download links; exports have no link until it is set
+	SigningKey string `env:"TENANT_EXPORT_SIGNING_KEY" secret:"true"`
+}
+
+// MeteringConfig controls pruning of the usage metering ledger
+type MeteringConfig struct {
+	// EventRetention is how long ledger rows are kept to recognise a repeated event. It
+	// must cover a month, since active users are recognised by user and month.
+	EventRetention time.Duration `env:"METERING_EVENT_RETENTION" default:"1080h" validate:"gte=768h"`
+	PruneInterval  time.Duration `env:"METERING_PRUNE_INTERVAL" default:"1h" validate:"gt=0"`
+}
+
+// InvitationConfig controls invitation links
+type InvitationConfig struct {
+	TTL time.Duration `env:"INVITATION_TTL" default:"168h" validate:"gt=0"`
+
+	// AcceptURL is the page that receives ?token= and posts it to /v1/auth/invitations/accept
+	AcceptURL string `env:"INVITATION_ACCEPT_URL" default:"http://localhost:3000/invitations/accept" validate:"required,url"`
+}
+
+// DeletionConfig controls how deleted tenants are purged
+type DeletionConfig struct {
+	// GracePeriod is how long a deletion can be cancelled before data is purged
+	GracePeriod   time.Duration `env:"TENANT_DELETION_GRACE_PERIOD" default:"720h" validate:"gte=0"`
+	PurgeInterval time.Duration `env:"TENANT_PURGE_INTERVAL" default:"1h" validate:"gt=0"`
+
+	// ReportSigningKey signs deletion reports and user erasure records; purges and
+	// erasures wait until it is set
+	ReportSigningKey string `env:"TENANT_REPORT_SIGNING_KEY" secret:"true"`
+}
+
+// ErasureConfig controls how requested user erasures are carried out
+type ErasureConfig struct {
+	// Interval is how often outstanding erasures are tried, including those waiting for
+	// a legal hold to be released
+	Interval time.Duration `env:"TENANT_ERASURE_INTERVAL" default:"1m" validate:"gt=0"`
+}
+
+// ReportSigningKey names the deletion report signing key in the secret provider
+const ReportSigningKey = "TENANT_REPORT_SIGNING_KEY"
+
+// ExportSigningKey names the download link signing key in the secret provider
+const ExportSigningKey = "TENANT_EXPORT_SIGNING_KEY"
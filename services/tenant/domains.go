@@ -0,0 +1,318 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/pavitra93/go-multi-tenant-system/shared/audit"
+	"github.com/pavitra93/go-multi-tenant-system/shared/domains"
+	"github.com/pavitra93/go-multi-tenant-system/shared/logger"
+	"github.com/pavitra93/go-multi-tenant-system/shared/middleware"
+	"github.com/pavitra93/go-multi-tenant-system/shared/models"
+	"github.com/pavitra93/go-multi-tenant-system/shared/utils"
+)
+
+// domainCheckBatch is how many due domains one run checks
+const domainCheckBatch = 50
+
+// checkedDomain are the domain states the checker looks at; failed domains wait for the
+// owner to ask for a check
+var checkedDomain = []models.DomainStatus{models.DomainStatusPending, models.DomainStatusVerified}
+
+// DomainChecker verifies tenants' custom domains as they come due: pending ones until they
+// verify or time out, verified ones periodically so a domain that changes hands stops
+// resolving to the tenant
+type DomainChecker struct {
+	db         *gorm.DB
+	verifier   *domains.Verifier
+	cfg        DomainConfig
+	baseDomain string
+
+	// cancel stops the check loop; done is closed once it has returned
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewDomainChecker creates a checker that looks for due domains every cfg.Domains.PollInterval
+func NewDomainChecker(db *gorm.DB, verifier *domains.Verifier, cfg *Config) *DomainChecker {
+	return &DomainChecker{
+		db:         db,
+		verifier:   verifier,
+		cfg:        cfg.Domains,
+		baseDomain: cfg.TenantBaseDomain,
+	}
+}
+
+// Start checks due domains in the background until ctx is cancelled or Stop is called
+func (d *DomainChecker) Start(ctx context.Context) {
+	ctx, d.cancel = context.WithCancel(ctx)
+	d.done = make(chan struct{})
+
+	go func() {
+		defer close(d.done)
+		d.run(ctx)
+	}()
+}
+
+// Stop cancels the check loop and waits for the check in progress to finish
+func (d *DomainChecker) Stop(ctx context.Context) error {
+	if d.cancel == nil {
+		return nil
+	}
+
+	d.cancel()
+	select {
+	case <-d.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("domain checker did not stop: %w", ctx.Err())
+	}
+}
+
+// run checks due domains until ctx is cancelled
+func (d *DomainChecker) run(ctx context.Context) {
+	logrus.Info("Starting domain checker")
+	defer logrus.Info("Domain checker stopped")
+
+	for {
+		d.checkDue(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(d.cfg.PollInterval):
+		}
+	}
+}
+
+// checkDue checks the domains whose next check has come, most overdue first
+func (d *DomainChecker) checkDue(ctx context.Context) {
+	now := time.Now().UTC()
+
+	var tenants []models.Tenant
+	err := d.db.WithContext(ctx).
+		Where("status <> ? AND domain_status IN ? AND domain_check_due <= ?", models.TenantStatusDeleted, checkedDomain, now).
+		Order("domain_check_due").
+		Limit(domainCheckBatch).
+		Find(&tenants).Error
+	if err != nil {
+		if ctx.Err() == nil {
+			logrus.WithError(err).Error("Error fetching due domain checks")
+		}
+		return
+	}
+
+	for i := range tenants {
+		if ctx.Err() != nil {
+			return
+		}
+
+		tenant := &tenants[i]
+		log := logrus.WithFields(logrus.Fields{"tenant_id": tenant.ID, "domain": tenant.Domain})
+
+		// Claim the check by moving it on, so another instance doesn't count the same failure
+		claim := d.db.WithContext(ctx).Model(&models.Tenant{}).
+			Where("id = ? AND domain_check_due = ?", tenant.ID, *tenant.DomainCheckDue).
+			Update("domain_check_due", now.Add(d.cfg.RetryInterval))
+		if claim.Error != nil {
+			log.WithError(claim.Error).Error("Failed to claim domain check")
+			continue
+		}
+		if claim.RowsAffected == 0 {
+			continue
+		}
+
+		if err := d.check(ctx, audit.System(ctx), tenant); err != nil && ctx.Err() == nil {
+			log.WithError(err).Error("Failed to check domain")
+		}
+	}
+}
+
+// check verifies the tenant's domain and records the outcome on tenant, auditing a change
+// of status as actor. If the domain or its token changed meanwhile the outcome is dropped;
+// the new domain gets a check of its own.
+func (d *DomainChecker) check(ctx context.Context, actor audit.Actor, tenant *models.Tenant) error {
+	method, verifyErr := d.verifier.Verify(ctx, tenant.Domain, tenant.DomainToken)
+	if verifyErr != nil && ctx.Err() != nil {
+		// Interrupted, not failed
+		return ctx.Err()
+	}
+
+	var previous, locked models.Tenant
+	err := d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND domain = ? AND domain_verification_token = ?", tenant.ID, tenant.Domain, tenant.DomainToken).
+			First(&locked).Error
+		if err != nil {
+			return err
+		}
+
+		previous = locked
+		d.record(&locked, method, verifyErr, time.Now().UTC().Truncate(time.Microsecond))
+		if err := tx.Save(&locked).Error; err != nil {
+			return fmt.Errorf("failed to record domain check: %w", err)
+		}
+		if locked.DomainStatus == previous.DomainStatus {
+			return nil
+		}
+
+		action := audit.TenantDomainVerified
+		if locked.DomainStatus == models.DomainStatusFailed {
+			action = audit.TenantDomainFailed
+		}
+		event := actor.Event(action, locked.ID, audit.TargetTenant, locked.ID.String())
+		event.Changes = audit.Diff(previous, locked)
+		event.Metadata["domain"] = locked.Domain
+		if verifyErr != nil {
+			event.Metadata["error"] = verifyErr.Error()
+		} else {
+			event.Metadata["method"] = method
+		}
+		return audit.Record(tx, event)
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// Host resolution only follows verified domains
+	if (previous.DomainStatus == models.DomainStatusVerified) != (locked.DomainStatus == models.DomainStatusVerified) {
+		middleware.InvalidateTenantHostCache(&locked, d.baseDomain)
+	}
+	if locked.DomainStatus != previous.DomainStatus {
+		logrus.WithFields(logrus.Fields{
+			"tenant_id": locked.ID,
+			"domain":    locked.Domain,
+			"status":    locked.DomainStatus,
+		}).Info("Domain verification status changed")
+	}
+
+	*tenant = locked
+	return nil
+}
+
+// record applies a check's outcome. A pending domain fails once PendingTimeout has passed
+// since its token was issued; a verified one after MaxFailures failed checks in a row.
+func (d *DomainChecker) record(tenant *models.Tenant, method domains.Method, verifyErr error, now time.Time) {
+	tenant.DomainCheckedAt = &now
+
+	if verifyErr == nil {
+		via := string(method)
+		due := now.Add(d.cfg.ReverifyInterval)
+		tenant.DomainStatus = models.DomainStatusVerified
+		tenant.DomainVerifiedAt = &now
+		tenant.DomainVerifiedVia = &via
+		tenant.DomainCheckFailures = 0
+		tenant.DomainError = nil
+		tenant.DomainCheckDue = &due
+		return
+	}
+
+	message := verifyErr.Error()
+	due := now.Add(d.cfg.RetryInterval)
+	tenant.DomainError = &message
+	tenant.DomainCheckFailures++
+	tenant.DomainCheckDue = &due
+
+	switch tenant.DomainStatus {
+	case models.DomainStatusPending:
+		if tenant.DomainTokenIssuedAt == nil || now.Sub(*tenant.DomainTokenIssuedAt) >= d.cfg.PendingTimeout {
+			tenant.DomainStatus = models.DomainStatusFailed
+		}
+	case models.DomainStatusVerified:
+		if tenant.DomainCheckFailures >= d.cfg.MaxFailures {
+			tenant.DomainStatus = models.DomainStatusFailed
+		}
+	}
+	if tenant.DomainStatus == models.DomainStatusFailed {
+		tenant.DomainCheckDue = nil
+	}
+}
+
+// domainVerificationColumns are the columns Tenant.RestartDomainVerification sets, with tenant's values
+func domainVerificationColumns(tenant *models.Tenant) map[string]interface{} {
+	return map[string]interface{}{
+		"domain_status":             tenant.DomainStatus,
+		"domain_verification_token": tenant.DomainToken,
+		"domain_token_issued_at":    tenant.DomainTokenIssuedAt,
+		"domain_verified_at":        tenant.DomainVerifiedAt,
+		"domain_verified_via":       tenant.DomainVerifiedVia,
+		"domain_checked_at":         tenant.DomainCheckedAt,
+		"domain_check_due":          tenant.DomainCheckDue,
+		"domain_check_failures":     tenant.DomainCheckFailures,
+		"domain_error":              tenant.DomainError,
+	}
+}
+
+// domainVerification describes the tenant's domain and how to verify it
+func domainVerification(tenant *models.Tenant, verifier *domains.Verifier) models.DomainVerificationResponse {
+	return models.DomainVerificationResponse{
+		Domain:      tenant.Domain,
+		Status:      tenant.DomainStatus,
+		VerifiedAt:  tenant.DomainVerifiedAt,
+		VerifiedVia: tenant.DomainVerifiedVia,
+		CheckedAt:   tenant.DomainCheckedAt,
+		NextCheckAt: tenant.DomainCheckDue,
+		Error:       tenant.DomainError,
+		DNS: models.DomainDNSChallenge{
+			Type:  "TXT",
+			Name:  domains.RecordName(tenant.Domain),
+			Value: domains.RecordValue(tenant.DomainToken),
+		},
+		HTTP: models.DomainHTTPChallenge{
+			URL:  verifier.WellKnownURL(tenant.Domain),
+			Body: tenant.DomainToken,
+		},
+	}
+}
+
+// handleGetTenantDomain returns the tenant's domain verification state and the TXT record
+// or file that verifies it
+func handleGetTenantDomain(db *gorm.DB, verifier *domains.Verifier) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tenant, ok := loadTenant(c, db)
+		if !ok {
+			return
+		}
+
+		utils.OKResponse(c, "Domain verification retrieved successfully", domainVerification(tenant, verifier))
+	}
+}
+
+// handleVerifyTenantDomain checks the tenant's domain now rather than waiting for its next
+// scheduled check. This is also how a failed domain is verified again.
+func handleVerifyTenantDomain(db *gorm.DB, checker *DomainChecker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tenant, ok := loadTenant(c, db)
+		if !ok {
+			return
+		}
+		if tenant.Status == models.TenantStatusDeleted {
+			utils.CodedErrorResponse(c, utils.CodeTenantDeleted, "Deleted tenants have no domain to verify", map[string]interface{}{
+				"current_status": tenant.Status,
+			})
+			return
+		}
+
+		if err := checker.check(c.Request.Context(), audit.FromContext(c), tenant); err != nil {
+			logger.FromContext(c).WithError(err).WithField("tenant_id", tenant.ID).Error("Failed to verify domain")
+			utils.InternalServerErrorResponse(c, "Failed to verify domain")
+			return
+		}
+
+		message := "Domain verified"
+		if tenant.DomainStatus != models.DomainStatusVerified {
+			message = "Domain not verified; publish the TXT record or serve the file and try again"
+		}
+		utils.OKResponse(c, message, domainVerification(tenant, checker.verifier))
+	}
+}
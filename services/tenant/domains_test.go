@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"github.com/pavitra93/go-multi-tenant-system/shared/domains"
+	"github.com/pavitra93/go-multi-tenant-system/shared/models"
+	"github.com/pavitra93/go-multi-tenant-system/shared/utils"
+)
+
+// testDomainConfig are the checker timings the tests use
+var testDomainConfig = DomainConfig{
+	RetryInterval:    time.Minute,
+	PendingTimeout:   time.Hour,
+	ReverifyInterval: 24 * time.Hour,
+	MaxFailures:      2,
+}
+
+func TestRecordDomainCheck(t *testing.T) {
+	now := time.Now().UTC()
+	notVerified := errors.New("not verified")
+
+	tests := []struct {
+		name         string
+		status       models.DomainStatus
+		issuedAgo    *time.Duration // Since the token was issued; nil for no issue time
+		failures     int            // Failed checks in a row before this one
+		verifyErr    error
+		wantStatus   models.DomainStatus
+		wantFailures int
+		wantDue      *time.Duration // Until the next check; nil for none
+	}{
+		{name: "pending verifies", status: models.DomainStatusPending, issuedAgo: durationPtr(time.Minute), failures: 3, wantStatus: models.DomainStatusVerified, wantDue: durationPtr(24 * time.Hour)},
+		{name: "pending keeps waiting", status: models.DomainStatusPending, issuedAgo: durationPtr(time.Minute), failures: 3, verifyErr: notVerified, wantStatus: models.DomainStatusPending, wantFailures: 4, wantDue: durationPtr(time.Minute)},
+		{name: "pending times out", status: models.DomainStatusPending, issuedAgo: durationPtr(time.Hour), verifyErr: notVerified, wantStatus: models.DomainStatusFailed, wantFailures: 1},
+		{name: "pending without issue time", status: models.DomainStatusPending, verifyErr: notVerified, wantStatus: models.DomainStatusFailed, wantFailures: 1},
+		{name: "verified reverifies", status: models.DomainStatusVerified, failures: 1, wantStatus: models.DomainStatusVerified, wantDue: durationPtr(24 * time.Hour)},
+		{name: "verified tolerates a failure", status: models.DomainStatusVerified, verifyErr: notVerified, wantStatus: models.DomainStatusVerified, wantFailures: 1, wantDue: durationPtr(time.Minute)},
+		{name: "verified fails at max failures", status: models.DomainStatusVerified, failures: 1, verifyErr: notVerified, wantStatus: models.DomainStatusFailed, wantFailures: 2},
+		{name: "failed verifies again", status: models.DomainStatusFailed, failures: 2, wantStatus: models.DomainStatusVerified, wantDue: durationPtr(24 * time.Hour)},
+		{name: "failed stays failed", status: models.DomainStatusFailed, failures: 2, verifyErr: notVerified, wantStatus: models.DomainStatusFailed, wantFailures: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tenant := &models.Tenant{DomainStatus: tt.status, DomainCheckFailures: tt.failures}
+			if tt.issuedAgo != nil {
+				issuedAt := now.Add(-*tt.issuedAgo)
+				tenant.DomainTokenIssuedAt = &issuedAt
+			}
+
+			checker := &DomainChecker{cfg: testDomainConfig}
+			checker.record(tenant, domains.MethodDNS, tt.verifyErr, now)
+
+			if tenant.DomainStatus != tt.wantStatus {
+				t.Errorf("status = %q, want %q", tenant.DomainStatus, tt.wantStatus)
+			}
+			if tenant.DomainCheckFailures != tt.wantFailures {
+				t.Errorf("failures = %d, want %d", tenant.DomainCheckFailures, tt.wantFailures)
+			}
+			switch {
+			case tt.wantDue == nil && tenant.DomainCheckDue != nil:
+				t.Errorf("next check = %v, want none", tenant.DomainCheckDue)
+			case tt.wantDue != nil && (tenant.DomainCheckDue == nil || !tenant.DomainCheckDue.Equal(now.Add(*tt.wantDue))):
+				t.Errorf("next check = %v, want %v", tenant.DomainCheckDue, now.Add(*tt.wantDue))
+			}
+			if tenant.DomainCheckedAt == nil || !tenant.DomainCheckedAt.Equal(now) {
+				t.Errorf("checked at = %v, want %v", tenant.DomainCheckedAt, now)
+			}
+			if (tenant.DomainError == nil) != (tt.verifyErr == nil) {
+				t.Errorf("domain error = %v, want one only if the check failed", tenant.DomainError)
+			}
+			if tt.verifyErr == nil && (tenant.DomainVerifiedVia == nil || *tenant.DomainVerifiedVia != string(domains.MethodDNS)) {
+				t.Errorf("verified via = %v, want %q", tenant.DomainVerifiedVia, domains.MethodDNS)
+			}
+		})
+	}
+}
+
+// tenantDomainsGeneration reads the generation the CORS middleware and tenant resolver
+// watch for domain changes
+func tenantDomainsGeneration(t *testing.T) int {
+	t.Helper()
+
+	generation, err := utils.RedisClient.Get(context.Background(), "cors:tenant_domains:generation").Int()
+	if errors.Is(err, redis.Nil) {
+		return 0
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return generation
+}
+
+// TestCheckDomain walks a tenant's domain through verification, losing its TXT record and
+// getting it back, against a real database.
+func TestCheckDomain(t *testing.T) {
+	tx := testTx(t)
+	tenant, _ := createTestTenant(t, tx)
+
+	// The well-known file is never there, so only the TXT record decides
+	server := httptest.NewServer(http.NotFoundHandler())
+	t.Cleanup(server.Close)
+	tenant.Domain = strings.TrimPrefix(server.URL, "http://")
+	tenant.RestartDomainVerification("test-domain-token", time.Now().UTC())
+	if err := tx.Save(tenant).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	resolver := domains.StaticResolver{}
+	verifier := domains.NewVerifier(domains.Config{HTTPScheme: "http", Timeout: 2 * time.Second, AllowPrivate: true}, resolver)
+	checker := NewDomainChecker(tx, verifier, &Config{Domains: testDomainConfig})
+	hostKey := "tenant:host:" + strings.ToLower(tenant.Domain)
+
+	steps := []struct {
+		name       string
+		record     string // TXT record published for the domain; empty for none
+		wantStatus models.DomainStatus
+		wantBump   bool // Whether host resolution and CORS should drop the domain's cached state
+	}{
+		{name: "no record yet", wantStatus: models.DomainStatusPending},
+		{name: "record with another token", record: domains.RecordValue("another-token"), wantStatus: models.DomainStatusPending},
+		{name: "record published", record: domains.RecordValue(tenant.DomainToken), wantStatus: models.DomainStatusVerified, wantBump: true},
+		{name: "record still there", record: domains.RecordValue(tenant.DomainToken), wantStatus: models.DomainStatusVerified},
+		{name: "record removed", wantStatus: models.DomainStatusVerified},
+		{name: "record still missing", wantStatus: models.DomainStatusFailed, wantBump: true},
+		{name: "record restored", record: domains.RecordValue(tenant.DomainToken), wantStatus: models.DomainStatusVerified, wantBump: true},
+	}
+
+	for _, step := range steps {
+		delete(resolver, domains.RecordName(tenant.Domain))
+		if step.record != "" {
+			resolver[domains.RecordName(tenant.Domain)] = []string{step.record}
+		}
+		if err := utils.RedisClient.Set(context.Background(), hostKey, tenant.ID.String(), 0).Err(); err != nil {
+			t.Fatal(err)
+		}
+		generation := tenantDomainsGeneration(t)
+
+		if err := checker.check(context.Background(), testActor, tenant); err != nil {
+			t.Fatalf("%s: check() error = %v", step.name, err)
+		}
+
+		var stored models.Tenant
+		if err := tx.Where("id = ?", tenant.ID).First(&stored).Error; err != nil {
+			t.Fatal(err)
+		}
+		if stored.DomainStatus != step.wantStatus {
+			t.Errorf("%s: domain status = %q, want %q", step.name, stored.DomainStatus, step.wantStatus)
+		}
+
+		bumped := tenantDomainsGeneration(t) != generation
+		if bumped != step.wantBump {
+			t.Errorf("%s: generation bumped = %v, want %v", step.name, bumped, step.wantBump)
+		}
+		cached, err := utils.RedisClient.Exists(context.Background(), hostKey).Result()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (cached == 0) != step.wantBump {
+			t.Errorf("%s: host cache dropped = %v, want %v", step.name, cached == 0, step.wantBump)
+		}
+	}
+}
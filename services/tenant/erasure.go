@@ -0,0 +1,614 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/pavitra93/go-multi-tenant-system/shared/audit"
+	"github.com/pavitra93/go-multi-tenant-system/shared/config"
+	"github.com/pavitra93/go-multi-tenant-system/shared/logger"
+	"github.com/pavitra93/go-multi-tenant-system/shared/metering"
+	"github.com/pavitra93/go-multi-tenant-system/shared/models"
+	"github.com/pavitra93/go-multi-tenant-system/shared/pagination"
+	"github.com/pavitra93/go-multi-tenant-system/shared/quota"
+	"github.com/pavitra93/go-multi-tenant-system/shared/utils"
+	"github.com/pavitra93/go-multi-tenant-system/shared/validation"
+)
+
+const (
+	// erasureBatch is how many outstanding erasures one run works through
+	erasureBatch = 50
+	// maxErasureAttempts is how many times an erasure is tried before it is marked failed
+	maxErasureAttempts = 5
+)
+
+var (
+	// errErasureInProgress is returned when the user already has an outstanding erasure
+	errErasureInProgress = errors.New("an erasure of this user is already in progress")
+	// errExportInProgress is returned when an export of the tenant is already waiting or being
+	// built. It postpones erasures, since the archive could copy the data being erased.
+	errExportInProgress = errors.New("an export of the tenant is in progress")
+)
+
+// outstandingErasure are the statuses of erasures still to be carried out
+var outstandingErasure = []models.ErasureStatus{models.ErasureStatusPending, models.ErasureStatusHeld, models.ErasureStatusBlocked}
+
+// userErasurePages orders a tenant's erasures, newest first by default
+var userErasurePages = &pagination.Spec[models.UserErasure]{
+	Sorts: map[string]pagination.Sort[models.UserErasure]{
+		"created_at": pagination.ByTime("created_at", func(e models.UserErasure) time.Time { return e.RequestedAt }),
+	},
+	DefaultSort:  "created_at",
+	DefaultOrder: pagination.Desc,
+	ID:           pagination.ByUUID("id", func(e models.UserErasure) uuid.UUID { return e.ID }),
+}
+
+// erasureSubjectHash identifies an erased user without keeping their Cognito ID
+func erasureSubjectHash(cognitoID string) string {
+	sum := sha256.Sum256([]byte(cognitoID))
+	return hex.EncodeToString(sum[:])
+}
+
+// erasurePseudonym is what replaces an erased user's identifiers in the audit log
+func erasurePseudonym(erasureID uuid.UUID) string {
+	return "erased-user:" + erasureID.String()
+}
+
+// hasUserData reports whether a former member of the tenant left anything behind that
+// names them. Their locations and sessions went with their user row.
+func hasUserData(db *gorm.DB, tenantID uuid.UUID, cognitoID string) (bool, error) {
+	var found bool
+	err := db.Raw(`SELECT EXISTS (SELECT 1 FROM failed_location_updates WHERE tenant_id = @tenant AND user_id = @user)
+		OR EXISTS (SELECT 1 FROM invitations WHERE tenant_id = @tenant AND accepted_by = @user)
+		OR EXISTS (SELECT 1 FROM audit_events WHERE tenant_id = @tenant AND (actor_id = @user OR target_id = @user))`,
+		map[string]interface{}{"tenant": tenantID, "user": cognitoID}).
+		Scan(&found).Error
+	if err != nil {
+		return false, fmt.Errorf("failed to look for user data: %w", err)
+	}
+	return found, nil
+}
+
+// lockErasable takes the locks an erasure needs and checks it may go ahead: the tenant has
+// no legal hold or export in progress, and the user isn't its last owner. It returns the
+// locked user, or nil for a former member.
+func lockErasable(tx *gorm.DB, tenantID uuid.UUID, cognitoID string) (*models.User, error) {
+	held, err := lockLegalHolds(tx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	if held {
+		return nil, errLegalHoldActive
+	}
+
+	var exporting bool
+	err = tx.Raw("SELECT EXISTS (SELECT 1 FROM tenant_exports WHERE tenant_id = ? AND status IN ?)",
+		tenantID, []models.ExportStatus{models.ExportStatusPending, models.ExportStatusRunning}).
+		Scan(&exporting).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to check tenant exports: %w", err)
+	}
+	if exporting {
+		return nil, errExportInProgress
+	}
+
+	owners, err := lockOwners(tx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	user, err := lockMember(tx, tenantID, cognitoID)
+	if errors.Is(err, errUserNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if user.Role == models.RoleTenantOwner && len(owners) <= 1 {
+		return nil, errLastOwner
+	}
+	return user, nil
+}
+
+// handleRequestUserErasure requests the erasure of a member's or former member's personal
+// data. The erasure is carried out in the background, once the tenant has no legal hold.
+func handleRequestUserErasure(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// The body is optional
+		var req models.RequestUserErasureRequest
+		if c.Request.ContentLength != 0 && !validation.BindJSON(c, &req) {
+			return
+		}
+
+		tenant, ok := loadTenant(c, db)
+		if !ok {
+			return
+		}
+		if tenant.Status == models.TenantStatusDeleted {
+			utils.CodedErrorResponse(c, utils.CodeTenantDeleted, "Deleted tenants' data has already been purged", map[string]interface{}{
+				"current_status": tenant.Status,
+			})
+			return
+		}
+
+		cognitoID := c.Param("cognito_id")
+		actor := audit.FromContext(c)
+		log := logger.FromContext(c).WithField("tenant_id", tenant.ID)
+
+		erasure := models.UserErasure{
+			ID:          uuid.New(),
+			TenantID:    tenant.ID,
+			CognitoID:   cognitoID,
+			SubjectHash: erasureSubjectHash(cognitoID),
+			RequestedBy: actor.ID,
+			Status:      models.ErasureStatusPending,
+		}
+		erasure.Pseudonym = erasurePseudonym(erasure.ID)
+		if req.Reason != "" {
+			erasure.Reason = &req.Reason
+		}
+
+		var outstanding models.UserErasure
+		err := db.Transaction(func(tx *gorm.DB) error {
+			held, err := lockLegalHolds(tx, tenant.ID)
+			if err != nil {
+				return err
+			}
+			owners, err := lockOwners(tx, tenant.ID)
+			if err != nil {
+				return err
+			}
+			user, err := lockMember(tx, tenant.ID, cognitoID)
+			switch {
+			case errors.Is(err, errUserNotFound):
+				found, err := hasUserData(tx, tenant.ID, cognitoID)
+				if err != nil {
+					return err
+				}
+				if !found {
+					return errUserNotFound
+				}
+			case err != nil:
+				return err
+			case user.Role == models.RoleTenantOwner && len(owners) <= 1:
+				return errLastOwner
+			}
+
+			err = tx.Where("tenant_id = ? AND subject_hash = ? AND status IN ?", tenant.ID, erasure.SubjectHash, outstandingErasure).
+				First(&outstanding).Error
+			if err == nil {
+				return errErasureInProgress
+			}
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("failed to check outstanding erasures: %w", err)
+			}
+
+			if held {
+				erasure.Status = models.ErasureStatusHeld
+			}
+			if err := tx.Create(&erasure).Error; err != nil {
+				return err
+			}
+
+			// The Cognito ID is pseudonymised with the rest of the user's events
+			event := actor.Event(audit.UserErasureRequested, tenant.ID, audit.TargetUserErasure, erasure.ID.String())
+			event.Metadata["cognito_id"] = cognitoID
+			event.Metadata["status"] = erasure.Status
+			return audit.Record(tx, event)
+		})
+		if errors.Is(err, errErasureInProgress) {
+			utils.CodedErrorResponse(c, utils.CodeErasureInProgress, "An erasure of this user is already in progress", map[string]interface{}{
+				"erasure_id": outstanding.ID,
+			})
+			return
+		}
+		if err != nil {
+			userChangeErrorResponse(c, log, err, "request erasure")
+			return
+		}
+
+		log.WithFields(logrus.Fields{"erasure_id": erasure.ID, "status": erasure.Status}).Info("User erasure requested")
+		message := "Erasure requested; it will be carried out in the background"
+		if erasure.Status == models.ErasureStatusHeld {
+			message = "Erasure requested; it will be carried out once the tenant's legal holds are released"
+		}
+		utils.SuccessResponse(c, http.StatusAccepted, message, erasure)
+	}
+}
+
+// handleGetUserErasures lists the tenant's user erasures a page at a time
+func handleGetUserErasures(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var filter models.UserErasureListQuery
+		if !validation.BindQuery(c, &filter) {
+			return
+		}
+		page, ok := pagination.Parse(c, userErasurePages)
+		if !ok {
+			return
+		}
+
+		query := db.Where("tenant_id = ?", c.Param("id"))
+		if filter.Status != "" {
+			query = query.Where("status = ?", filter.Status)
+		}
+
+		var erasures []models.UserErasure
+		if err := page.Apply(query).Find(&erasures).Error; err != nil {
+			logger.FromContext(c).WithError(err).Error("Failed to fetch user erasures")
+			utils.InternalServerErrorResponse(c, "Failed to fetch erasures")
+			return
+		}
+
+		erasures, info := page.Result(erasures)
+		utils.PaginatedResponse(c, "Erasures retrieved successfully", erasures, info)
+	}
+}
+
+// handleGetUserErasure returns an erasure's status and, once completed, its signed record
+func handleGetUserErasure(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		erasureID, err := uuid.Parse(c.Param("erasure_id"))
+		if err != nil {
+			utils.NotFoundResponse(c, "Erasure not found")
+			return
+		}
+
+		var erasure models.UserErasure
+		if err := db.Where("id = ? AND tenant_id = ?", erasureID, c.Param("id")).First(&erasure).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				utils.NotFoundResponse(c, "Erasure not found")
+				return
+			}
+			logger.FromContext(c).WithError(err).Error("Failed to fetch user erasure")
+			utils.InternalServerErrorResponse(c, "Failed to fetch erasure")
+			return
+		}
+
+		utils.OKResponse(c, "Erasure retrieved successfully", erasure)
+	}
+}
+
+// UserEraser carries out requested user erasures, waiting while the tenant is under legal hold
+type UserEraser struct {
+	db         *gorm.DB
+	directory  userDirectory
+	quotas     *quota.Enforcer
+	signingKey *config.Secret
+	interval   time.Duration
+
+	// cancel stops the erasure loop; done is closed once it has returned
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewUserEraser creates an eraser that looks for outstanding erasures every cfg.Erasures.Interval.
+// Completion records are signed with the deletion report signing key.
+func NewUserEraser(db *gorm.DB, directory userDirectory, quotas *quota.Enforcer, cfg *Config, secrets *config.SecretManager) *UserEraser {
+	return &UserEraser{
+		db:         db,
+		directory:  directory,
+		quotas:     quotas,
+		signingKey: secrets.Secret(ReportSigningKey),
+		interval:   cfg.Erasures.Interval,
+	}
+}
+
+// Start carries out erasures in the background until ctx is cancelled or Stop is called
+func (e *UserEraser) Start(ctx context.Context) {
+	ctx, e.cancel = context.WithCancel(ctx)
+	e.done = make(chan struct{})
+
+	go func() {
+		defer close(e.done)
+		e.run(ctx)
+	}()
+}
+
+// Stop cancels the erasure loop and waits for the erasure in progress to finish
+func (e *UserEraser) Stop(ctx context.Context) error {
+	if e.cancel == nil {
+		return nil
+	}
+
+	e.cancel()
+	select {
+	case <-e.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("user eraser did not stop: %w", ctx.Err())
+	}
+}
+
+// run carries out outstanding erasures until ctx is cancelled
+func (e *UserEraser) run(ctx context.Context) {
+	logrus.Info("Starting user eraser")
+	defer logrus.Info("User eraser stopped")
+
+	for {
+		e.eraseOutstanding(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(e.interval):
+		}
+	}
+}
+
+// eraseOutstanding works through pending and held erasures, oldest first
+func (e *UserEraser) eraseOutstanding(ctx context.Context) {
+	var erasures []models.UserErasure
+	err := e.db.WithContext(ctx).
+		Where("status IN ?", outstandingErasure).
+		Order("created_at").
+		Limit(erasureBatch).
+		Find(&erasures).Error
+	if err != nil {
+		if ctx.Err() == nil {
+			logrus.WithError(err).Error("Error fetching outstanding user erasures")
+		}
+		return
+	}
+
+	for i := range erasures {
+		// Finish the erasure in flight, but don't start new ones once shutdown begins
+		if ctx.Err() != nil {
+			return
+		}
+
+		erasure := &erasures[i]
+		log := logrus.WithFields(logrus.Fields{"erasure_id": erasure.ID, "tenant_id": erasure.TenantID})
+		err := e.erase(ctx, log, erasure)
+		switch {
+		case err == nil:
+		case errors.Is(err, errLegalHoldActive):
+			e.setStatus(ctx, log, erasure, models.ErasureStatusHeld)
+		case errors.Is(err, errLastOwner):
+			// Retrying won't help until the tenant has another owner, so no attempt is used up
+			e.setStatus(ctx, log, erasure, models.ErasureStatusBlocked)
+		case errors.Is(err, errExportInProgress):
+			log.Info("Waiting for the tenant's export to finish before erasing user")
+		case errors.Is(err, errSigningKeyMissing):
+			log.WithError(err).Error("User erasure waits until the report signing key is configured")
+		default:
+			e.fail(ctx, log, erasure, err)
+		}
+	}
+}
+
+// erase checks the erasure may go ahead and, in the same transaction, deletes the user's
+// Cognito user, token sessions and rows, pseudonymises their audit events and completes
+// the erasure with a signed record. Cognito goes before the rows so the user can't sign
+// in and leave new data behind.
+func (e *UserEraser) erase(ctx context.Context, log *logrus.Entry, erasure *models.UserErasure) error {
+	signingKey := e.signingKey.Value()
+	if signingKey == "" {
+		return errSigningKeyMissing
+	}
+
+	db := e.db.WithContext(ctx)
+	cognitoDeleted := false
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// Another instance may have completed it meanwhile
+		var locked models.UserErasure
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND status IN ?", erasure.ID, outstandingErasure).
+			First(&locked).Error
+		if err != nil {
+			return err
+		}
+
+		// The Cognito user is deleted under the locks the checks took, so a legal hold
+		// placed meanwhile waits for the erasure to commit rather than finding the user
+		// gone from Cognito but not from the database
+		user, err := lockErasable(tx, locked.TenantID, locked.CognitoID)
+		if err != nil {
+			return err
+		}
+		if locked.Status != models.ErasureStatusPending {
+			// A held or blocked erasure whose cause is gone; pseudonymise_audit_subject
+			// only accepts pending ones
+			if err := tx.Model(&locked).Update("status", models.ErasureStatusPending).Error; err != nil {
+				return fmt.Errorf("failed to resume user erasure: %w", err)
+			}
+		}
+
+		deleted, err := e.directory.DeleteUser(ctx, locked.CognitoID)
+		if err != nil {
+			return err
+		}
+		if deleted {
+			locked.CognitoUserDeleted = true
+			cognitoDeleted = true
+		}
+		if err := utils.RevokeAllUserSessions(locked.CognitoID); err != nil {
+			return err
+		}
+
+		if err := eraseUserData(tx, &locked, user); err != nil {
+			return err
+		}
+
+		completedAt := time.Now().UTC().Truncate(time.Microsecond)
+		locked.Status = models.ErasureStatusCompleted
+		locked.CognitoID = ""
+		locked.LastError = nil
+		locked.DataErasedAt = &completedAt
+		locked.CompletedAt = &completedAt
+		locked.SignatureAlgorithm = reportSignatureAlgorithm
+		if locked.Signature, err = signRecord(&locked, signingKey); err != nil {
+			return err
+		}
+		if err := tx.Save(&locked).Error; err != nil {
+			return fmt.Errorf("failed to complete erasure: %w", err)
+		}
+
+		event := audit.System(ctx).Event(audit.UserErased, locked.TenantID, audit.TargetUserErasure, locked.ID.String())
+		event.Metadata["pseudonym"] = locked.Pseudonym
+		event.Metadata["locations_deleted"] = locked.LocationsDeleted
+		event.Metadata["audit_events_pseudonymised"] = locked.AuditEventsPseudonymised
+		if err := audit.Record(tx, event); err != nil {
+			return err
+		}
+
+		*erasure = locked
+		return nil
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		if cognitoDeleted && !erasure.CognitoUserDeleted {
+			// Kept despite the rollback, since a retry finds the Cognito user already gone
+			erasure.CognitoUserDeleted = true
+			if err := db.Model(erasure).Update("cognito_user_deleted", true).Error; err != nil {
+				log.WithError(err).Error("Failed to record Cognito user deletion")
+			}
+		}
+		return err
+	}
+
+	if erasure.UserDeleted {
+		e.quotas.ReleaseUser(ctx, erasure.TenantID)
+	}
+	log.WithFields(logrus.Fields{
+		"locations_deleted":          erasure.LocationsDeleted,
+		"audit_events_pseudonymised": erasure.AuditEventsPseudonymised,
+		"cognito_user_deleted":       erasure.CognitoUserDeleted,
+	}).Info("User erased")
+	return nil
+}
+
+// eraseUserData deletes what names the erasure's user within its tenant, counting it on
+// the erasure: tracking history, failed updates, invitations, the active-user ledger and
+// the user row. Their audit events are pseudonymised and completed export archives,
+// which copy the erased data, are expired for the exporter to delete.
+func eraseUserData(tx *gorm.DB, erasure *models.UserErasure, user *models.User) error {
+	tenantID, cognitoID := erasure.TenantID, erasure.CognitoID
+
+	// Invitations name the user by email; collect them before they are deleted
+	var emails []string
+	err := tx.Model(&models.Invitation{}).Where("tenant_id = ? AND accepted_by = ?", tenantID, cognitoID).
+		Distinct().Pluck("email", &emails).Error
+	if err != nil {
+		return fmt.Errorf("failed to list user invitations: %w", err)
+	}
+
+	result := tx.Unscoped().Where("tenant_id = ? AND cognito_user_id = ?", tenantID, cognitoID).Delete(&models.Location{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete locations: %w", result.Error)
+	}
+	erasure.LocationsDeleted = result.RowsAffected
+
+	result = tx.Unscoped().Where("tenant_id = ? AND cognito_user_id = ?", tenantID, cognitoID).Delete(&models.LocationSession{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete location sessions: %w", result.Error)
+	}
+	erasure.LocationSessionsDeleted = result.RowsAffected
+
+	result = tx.Exec("DELETE FROM failed_location_updates WHERE tenant_id = ? AND user_id = ?", tenantID, cognitoID)
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete failed location updates: %w", result.Error)
+	}
+	erasure.FailedUpdatesDeleted = result.RowsAffected
+
+	invitations := tx.Where("tenant_id = ?", tenantID)
+	if len(emails) > 0 {
+		invitations = invitations.Where("accepted_by = ? OR email IN ?", cognitoID, emails)
+	} else {
+		invitations = invitations.Where("accepted_by = ?", cognitoID)
+	}
+	result = invitations.Delete(&models.Invitation{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete invitations: %w", result.Error)
+	}
+	erasure.InvitationsDeleted = result.RowsAffected
+
+	// Hourly totals are anonymous and stay for billing
+	result = tx.Exec("DELETE FROM usage_events WHERE tenant_id = ? AND metric = ? AND starts_with(event_key, ?)",
+		tenantID, metering.ActiveUsers, cognitoID+"@")
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete usage events: %w", result.Error)
+	}
+	erasure.UsageEventsDeleted = result.RowsAffected
+
+	if user != nil {
+		if err := tx.Delete(user).Error; err != nil {
+			return fmt.Errorf("failed to delete user: %w", err)
+		}
+		erasure.UserDeleted = true
+	}
+
+	for _, subject := range append([]string{cognitoID}, emails...) {
+		var pseudonymised int64
+		err := tx.Raw("SELECT pseudonymise_audit_subject(?, ?, ?)", tenantID, subject, erasure.Pseudonym).
+			Scan(&pseudonymised).Error
+		if err != nil {
+			return fmt.Errorf("failed to pseudonymise audit events: %w", err)
+		}
+		erasure.AuditEventsPseudonymised += pseudonymised
+	}
+
+	now := time.Now()
+	result = tx.Model(&models.TenantExport{}).
+		Where("tenant_id = ? AND status = ? AND expires_at > ?", tenantID, models.ExportStatusCompleted, now).
+		Update("expires_at", now)
+	if result.Error != nil {
+		return fmt.Errorf("failed to expire tenant exports: %w", result.Error)
+	}
+	erasure.ExportsExpired = result.RowsAffected
+	return nil
+}
+
+// setStatus moves an outstanding erasure between pending, held and blocked
+func (e *UserEraser) setStatus(ctx context.Context, log *logrus.Entry, erasure *models.UserErasure, status models.ErasureStatus) {
+	if erasure.Status == status {
+		return
+	}
+	err := e.db.WithContext(ctx).Model(erasure).
+		Where("status IN ?", outstandingErasure).
+		Update("status", status).Error
+	if err != nil {
+		log.WithError(err).Error("Failed to update user erasure status")
+		return
+	}
+	switch status {
+	case models.ErasureStatusHeld:
+		log.Info("User erasure held until the tenant's legal holds are released")
+	case models.ErasureStatusBlocked:
+		log.Info("User erasure blocked until the tenant has another owner")
+	}
+}
+
+// fail records a failed attempt, giving up after maxErasureAttempts
+func (e *UserEraser) fail(ctx context.Context, log *logrus.Entry, erasure *models.UserErasure, cause error) {
+	message := cause.Error()
+	updates := map[string]interface{}{
+		"attempts":   erasure.Attempts + 1,
+		"last_error": message,
+	}
+	if erasure.Attempts+1 >= maxErasureAttempts {
+		updates["status"] = models.ErasureStatusFailed
+		log.WithError(cause).Error("User erasure failed; request it again once the cause is fixed")
+	} else {
+		log.WithError(cause).Warn("User erasure failed; will retry")
+	}
+
+	err := e.db.WithContext(ctx).Model(erasure).
+		Where("status IN ?", outstandingErasure).
+		Updates(updates).Error
+	if err != nil {
+		log.WithError(err).Error("Failed to record user erasure failure")
+	}
+}
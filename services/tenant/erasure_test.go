@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/pavitra93/go-multi-tenant-system/shared/blob"
+	"github.com/pavitra93/go-multi-tenant-system/shared/models"
+)
+
+// TestEraseUserDataRefusesEarlierDownloadLinks erases a user while a download link to an
+// archive holding their data is still valid, against a real database.
+func TestEraseUserDataRefusesEarlierDownloadLinks(t *testing.T) {
+	tx := testTx(t)
+	tenant, _ := createTestTenant(t, tx)
+	member := &models.User{CognitoID: "member-" + uuid.NewString(), TenantID: tenant.ID, Role: models.RoleUser}
+	if err := tx.Create(member).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	store := &blob.LocalStore{Dir: t.TempDir()}
+	expiresAt := time.Now().Add(7 * 24 * time.Hour)
+	export := createTestExport(t, tx, store, tenant.ID, &expiresAt)
+
+	links := newTestLinks()
+	links.attach(testLog(), export)
+	if export.DownloadURL == "" {
+		t.Fatal("no download link issued")
+	}
+	if recorder := downloadExport(t, tx, store, links, export.DownloadURL); recorder.Code != http.StatusOK {
+		t.Fatalf("download before erasure: status = %d, want %d: %s", recorder.Code, http.StatusOK, recorder.Body)
+	}
+
+	erasureID := uuid.New()
+	erasure := &models.UserErasure{
+		ID:          erasureID,
+		TenantID:    tenant.ID,
+		CognitoID:   member.CognitoID,
+		SubjectHash: erasureSubjectHash(member.CognitoID),
+		Pseudonym:   erasurePseudonym(erasureID),
+		RequestedBy: testActor.ID,
+		Status:      models.ErasureStatusPending,
+	}
+	if err := tx.Create(erasure).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := eraseUserData(tx, erasure, member); err != nil {
+		t.Fatalf("eraseUserData() error = %v", err)
+	}
+	if erasure.ExportsExpired != 1 {
+		t.Errorf("exports expired = %d, want 1", erasure.ExportsExpired)
+	}
+
+	if recorder := downloadExport(t, tx, store, links, export.DownloadURL); recorder.Code != http.StatusGone {
+		t.Errorf("download after erasure: status = %d, want %d: %s", recorder.Code, http.StatusGone, recorder.Body)
+	}
+}
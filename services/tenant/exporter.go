@@ -0,0 +1,551 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/pavitra93/go-multi-tenant-system/shared/blob"
+	"github.com/pavitra93/go-multi-tenant-system/shared/models"
+)
+
+const (
+	// maxExportAttempts is how many times an export is started before it is given up on
+	maxExportAttempts = 3
+
+	// exportProgressInterval is how many records are written between progress updates
+	exportProgressInterval = 5000
+
+	// exportExpiryBatch is how many expired archives are deleted per run
+	exportExpiryBatch = 100
+)
+
+// errExportSuperseded stops an export that was purged or taken over by another instance
+var errExportSuperseded = errors.New("export is no longer running here")
+
+// exportTable is a file of an export archive, holding the tenant's rows of a table
+type exportTable struct {
+	name  string // File name without extension
+	query string // Selects the tenant's rows given its ID
+}
+
+// exportTables are the files of an export archive, in the order they are written.
+// Every column is exported, so the archive follows the schema as it evolves.
+var exportTables = []exportTable{
+	{"tenant", "SELECT * FROM tenants WHERE id = ?"},
+	{"users", "SELECT * FROM users WHERE tenant_id = ? ORDER BY created_at, cognito_id"},
+	{"location_sessions", "SELECT * FROM location_sessions WHERE tenant_id = ? ORDER BY created_at, id"},
+	{"locations", "SELECT * FROM locations WHERE tenant_id = ? ORDER BY created_at, id"},
+	{"failed_location_updates", "SELECT * FROM failed_location_updates WHERE tenant_id = ? ORDER BY created_at, id"},
+}
+
+// exportManifest is manifest.json, written last in every archive
+type exportManifest struct {
+	ExportID    uuid.UUID             `json:"export_id"`
+	TenantID    uuid.UUID             `json:"tenant_id"`
+	Format      models.ExportFormat   `json:"format"`
+	GeneratedAt time.Time             `json:"generated_at"`
+	Files       []exportManifestEntry `json:"files"`
+}
+
+// exportManifestEntry names a file of the archive and how many records it holds
+type exportManifestEntry struct {
+	Name    string `json:"name"`
+	Table   string `json:"table"`
+	Records int64  `json:"records"`
+}
+
+// TenantExporter builds requested tenant export archives and deletes them once they expire
+type TenantExporter struct {
+	db         *gorm.DB
+	store      blob.Store
+	interval   time.Duration
+	staleAfter time.Duration
+	archiveTTL time.Duration
+
+	// cancel stops the export loop; done is closed once it has returned
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewTenantExporter creates an exporter that checks for requested exports every cfg.PollInterval
+func NewTenantExporter(db *gorm.DB, store blob.Store, cfg ExportConfig) *TenantExporter {
+	return &TenantExporter{
+		db:         db,
+		store:      store,
+		interval:   cfg.PollInterval,
+		staleAfter: cfg.StaleAfter,
+		archiveTTL: cfg.ArchiveTTL,
+	}
+}
+
+// Start builds exports in the background until ctx is cancelled or Stop is called
+func (e *TenantExporter) Start(ctx context.Context) {
+	ctx, e.cancel = context.WithCancel(ctx)
+	e.done = make(chan struct{})
+
+	go func() {
+		defer close(e.done)
+		e.run(ctx)
+	}()
+}
+
+// Stop cancels the export loop and waits for it to return; an export in flight is
+// handed back to be started again
+func (e *TenantExporter) Stop(ctx context.Context) error {
+	if e.cancel == nil {
+		return nil
+	}
+
+	e.cancel()
+	select {
+	case <-e.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("tenant exporter did not stop: %w", ctx.Err())
+	}
+}
+
+// run builds waiting exports and expires old archives until ctx is cancelled
+func (e *TenantExporter) run(ctx context.Context) {
+	logrus.WithField("store", e.store.Name()).Info("Starting tenant exporter")
+	defer logrus.Info("Tenant exporter stopped")
+
+	for {
+		e.expireArchives(ctx)
+		for ctx.Err() == nil && e.exportNext(ctx) {
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(e.interval):
+		}
+	}
+}
+
+// exportNext builds the oldest waiting export and reports whether there was one
+func (e *TenantExporter) exportNext(ctx context.Context) bool {
+	export, err := e.claim(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			logrus.WithError(err).Error("Error claiming tenant export")
+		}
+		return false
+	}
+	if export == nil {
+		return false
+	}
+
+	log := logrus.WithFields(logrus.Fields{
+		"export_id": export.ID,
+		"tenant_id": export.TenantID,
+		"attempt":   export.Attempts,
+	})
+	if export.Attempts > maxExportAttempts {
+		e.finish(ctx, log, export, fmt.Errorf("gave up after %d attempts", maxExportAttempts))
+		return true
+	}
+
+	log.Info("Exporting tenant data")
+	e.finish(ctx, log, export, e.build(ctx, export))
+	return true
+}
+
+// claim marks the oldest pending export, or a running one that stopped making progress,
+// as running here. It returns nil when there is none.
+func (e *TenantExporter) claim(ctx context.Context) (*models.TenantExport, error) {
+	var export models.TenantExport
+	err := e.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? OR (status = ? AND updated_at < ?)",
+				models.ExportStatusPending, models.ExportStatusRunning, time.Now().Add(-e.staleAfter)).
+			Order("created_at").
+			First(&export).Error
+		if err != nil {
+			return err
+		}
+
+		now := time.Now().UTC()
+		export.Status = models.ExportStatusRunning
+		export.Attempts++
+		export.StartedAt = &now
+		return tx.Model(&export).Updates(map[string]interface{}{
+			"status":           export.Status,
+			"attempts":         export.Attempts,
+			"started_at":       now,
+			"files_done":       0,
+			"records_exported": 0,
+			"current_file":     "",
+		}).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &export, nil
+}
+
+// running narrows query to the export while this attempt still owns it
+func (e *TenantExporter) running(query *gorm.DB, export *models.TenantExport) *gorm.DB {
+	return query.Model(&models.TenantExport{}).
+		Where("id = ? AND status = ? AND attempts = ?", export.ID, models.ExportStatusRunning, export.Attempts)
+}
+
+// progress records the export's progress, which also shows other instances it is alive
+func (e *TenantExporter) progress(ctx context.Context, export *models.TenantExport) error {
+	result := e.running(e.db.WithContext(ctx), export).Updates(map[string]interface{}{
+		"files_total":      export.FilesTotal,
+		"files_done":       export.FilesDone,
+		"current_file":     export.CurrentFile,
+		"records_total":    export.RecordsTotal,
+		"records_exported": export.RecordsExported,
+	})
+	if result.Error != nil {
+		return fmt.Errorf("failed to record export progress: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return errExportSuperseded
+	}
+	return nil
+}
+
+// build writes the tenant's tables to a zip archive in a temporary file, then stores it
+func (e *TenantExporter) build(ctx context.Context, export *models.TenantExport) error {
+	export.FilesTotal = len(exportTables)
+	export.FilesDone, export.RecordsTotal, export.RecordsExported = 0, 0, 0
+	for _, table := range exportTables {
+		var count int64
+		if err := e.db.WithContext(ctx).Raw("SELECT COUNT(*) FROM ("+table.query+") AS tenant_rows", export.TenantID).Scan(&count).Error; err != nil {
+			return fmt.Errorf("failed to count %s: %w", table.name, err)
+		}
+		export.RecordsTotal += count
+	}
+	if err := e.progress(ctx, export); err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp("", "tenant-export-*.zip")
+	if err != nil {
+		return fmt.Errorf("failed to create archive: %w", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	hash := sha256.New()
+	archive := zip.NewWriter(io.MultiWriter(file, hash))
+
+	manifest := exportManifest{
+		ExportID: export.ID,
+		TenantID: export.TenantID,
+		Format:   export.Format,
+	}
+	for _, table := range exportTables {
+		name := table.name + "." + string(export.Format)
+		export.CurrentFile = name
+		if err := e.progress(ctx, export); err != nil {
+			return err
+		}
+
+		records, err := e.writeTable(ctx, archive, name, table, export)
+		if err != nil {
+			return err
+		}
+		manifest.Files = append(manifest.Files, exportManifestEntry{Name: name, Table: table.name, Records: records})
+		export.FilesDone++
+	}
+
+	manifest.GeneratedAt = time.Now().UTC()
+	w, err := archive.Create("manifest.json")
+	if err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(manifest); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	if err := archive.Close(); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+
+	size, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return fmt.Errorf("failed to size archive: %w", err)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to rewind archive: %w", err)
+	}
+
+	// Each attempt has its own key, so an attempt taken over can't remove its successor's archive
+	key := fmt.Sprintf("tenant-exports/%s/%s-%d.zip", export.TenantID, export.ID, export.Attempts)
+	if err := e.store.Put(ctx, key, file); err != nil {
+		return err
+	}
+
+	completedAt := time.Now().UTC()
+	expiresAt := completedAt.Add(e.archiveTTL)
+	result := e.running(e.db.WithContext(ctx), export).Updates(map[string]interface{}{
+		"status":           models.ExportStatusCompleted,
+		"files_done":       export.FilesDone,
+		"current_file":     "",
+		"records_exported": export.RecordsExported,
+		"blob_key":         key,
+		"size_bytes":       size,
+		"sha256":           hex.EncodeToString(hash.Sum(nil)),
+		"completed_at":     completedAt,
+		"expires_at":       expiresAt,
+	})
+	if result.Error == nil && result.RowsAffected > 0 {
+		return nil
+	}
+
+	// The archive isn't referenced by any export; don't leave the tenant's data behind
+	if err := e.store.Delete(context.Background(), key); err != nil {
+		logrus.WithError(err).WithField("blob_key", key).Warn("Failed to delete unreferenced export archive")
+	}
+	if result.Error != nil {
+		return fmt.Errorf("failed to complete export: %w", result.Error)
+	}
+	return errExportSuperseded
+}
+
+// writeTable streams the tenant's rows of table into the archive as name and returns how many it wrote
+func (e *TenantExporter) writeTable(ctx context.Context, archive *zip.Writer, name string, table exportTable, export *models.TenantExport) (int64, error) {
+	w, err := archive.Create(name)
+	if err != nil {
+		return 0, fmt.Errorf("failed to write %s: %w", name, err)
+	}
+
+	rows, err := e.db.WithContext(ctx).Raw(table.query, export.TenantID).Rows()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read %s: %w", table.name, err)
+	}
+	defer rows.Close()
+
+	writer, err := newRecordWriter(w, export.Format, rows)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read %s: %w", table.name, err)
+	}
+
+	var records int64
+	for rows.Next() {
+		if err := writer.write(rows); err != nil {
+			return records, fmt.Errorf("failed to export %s: %w", table.name, err)
+		}
+		records++
+		export.RecordsExported++
+
+		if records%exportProgressInterval == 0 {
+			if err := e.progress(ctx, export); err != nil {
+				return records, err
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return records, fmt.Errorf("failed to read %s: %w", table.name, err)
+	}
+	if err := writer.flush(); err != nil {
+		return records, fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	return records, nil
+}
+
+// finish records the outcome of an export attempt. A failed attempt is handed back to
+// be started again, unless it was the last or the export has moved on; one interrupted
+// by shutdown doesn't count as an attempt.
+func (e *TenantExporter) finish(ctx context.Context, log *logrus.Entry, export *models.TenantExport, err error) {
+	if err == nil {
+		log.WithField("records", export.RecordsExported).Info("Tenant export completed")
+		return
+	}
+	if errors.Is(err, errExportSuperseded) {
+		log.Warn("Tenant export was purged or taken over; abandoning it")
+		return
+	}
+
+	updates := map[string]interface{}{"status": models.ExportStatusPending, "current_file": ""}
+	switch {
+	case ctx.Err() != nil:
+		updates["attempts"] = export.Attempts - 1
+		log.Info("Tenant export interrupted by shutdown; handing it back")
+	case export.Attempts >= maxExportAttempts:
+		updates["status"] = models.ExportStatusFailed
+		updates["error"] = "Export failed; request a new export"
+		log.WithError(err).Error("Tenant export failed")
+	default:
+		log.WithError(err).Warn("Tenant export attempt failed; will retry")
+	}
+
+	// Recorded even while shutting down, so the export is picked up again straight away
+	if err := e.running(e.db, export).Updates(updates).Error; err != nil {
+		log.WithError(err).Error("Failed to record tenant export failure")
+	}
+}
+
+// expireArchives deletes the archives of exports past their expiry
+func (e *TenantExporter) expireArchives(ctx context.Context) {
+	var exports []models.TenantExport
+	err := e.db.WithContext(ctx).
+		Where("status = ? AND expires_at <= ?", models.ExportStatusCompleted, time.Now()).
+		Order("expires_at").
+		Limit(exportExpiryBatch).
+		Find(&exports).Error
+	if err != nil {
+		if ctx.Err() == nil {
+			logrus.WithError(err).Error("Error fetching expired tenant exports")
+		}
+		return
+	}
+
+	for i := range exports {
+		log := logrus.WithFields(logrus.Fields{"export_id": exports[i].ID, "tenant_id": exports[i].TenantID})
+		if err := e.store.Delete(ctx, exports[i].BlobKey); err != nil {
+			log.WithError(err).Error("Failed to delete expired export archive; will retry")
+			continue
+		}
+		err := e.db.WithContext(ctx).Model(&exports[i]).
+			Where("status = ?", models.ExportStatusCompleted).
+			Updates(map[string]interface{}{"status": models.ExportStatusExpired, "blob_key": ""}).Error
+		if err != nil {
+			log.WithError(err).Error("Failed to mark tenant export expired")
+			continue
+		}
+		log.Info("Tenant export archive expired")
+	}
+}
+
+// recordWriter writes scanned rows in an export format
+type recordWriter interface {
+	write(rows *sql.Rows) error
+	flush() error
+}
+
+// newRecordWriter creates a writer of rows' records to w in format
+func newRecordWriter(w io.Writer, format models.ExportFormat, rows *sql.Rows) (recordWriter, error) {
+	columns, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+	scanned := &scannedRow{
+		columns: columns,
+		values:  make([]interface{}, len(columns)),
+		targets: make([]interface{}, len(columns)),
+	}
+	for i := range scanned.values {
+		scanned.targets[i] = &scanned.values[i]
+	}
+
+	if format == models.ExportFormatCSV {
+		writer := &csvRecordWriter{scannedRow: scanned, csv: csv.NewWriter(w)}
+		header := make([]string, len(columns))
+		for i, column := range columns {
+			header[i] = column.Name()
+		}
+		return writer, writer.csv.Write(header)
+	}
+	return &ndjsonRecordWriter{scannedRow: scanned, encoder: json.NewEncoder(w)}, nil
+}
+
+// scannedRow holds the values of the current row
+type scannedRow struct {
+	columns []*sql.ColumnType
+	values  []interface{}
+	targets []interface{}
+}
+
+// isJSON reports whether column i holds JSON documents
+func (r *scannedRow) isJSON(i int) bool {
+	switch r.columns[i].DatabaseTypeName() {
+	case "JSON", "JSONB":
+		return true
+	}
+	return false
+}
+
+// ndjsonRecordWriter writes each record as a JSON object on its own line
+type ndjsonRecordWriter struct {
+	*scannedRow
+	encoder *json.Encoder
+}
+
+func (w *ndjsonRecordWriter) write(rows *sql.Rows) error {
+	if err := rows.Scan(w.targets...); err != nil {
+		return err
+	}
+	record := make(map[string]interface{}, len(w.columns))
+	for i, column := range w.columns {
+		switch value := w.values[i].(type) {
+		case []byte:
+			if w.isJSON(i) {
+				record[column.Name()] = json.RawMessage(value)
+			} else {
+				record[column.Name()] = string(value)
+			}
+		case string:
+			if w.isJSON(i) {
+				record[column.Name()] = json.RawMessage(value)
+			} else {
+				record[column.Name()] = value
+			}
+		case time.Time:
+			record[column.Name()] = value.UTC()
+		default:
+			record[column.Name()] = value
+		}
+	}
+	return w.encoder.Encode(record)
+}
+
+func (w *ndjsonRecordWriter) flush() error {
+	return nil
+}
+
+// csvRecordWriter writes a header row, then one row per record; JSON columns hold the document
+type csvRecordWriter struct {
+	*scannedRow
+	csv *csv.Writer
+}
+
+func (w *csvRecordWriter) write(rows *sql.Rows) error {
+	if err := rows.Scan(w.targets...); err != nil {
+		return err
+	}
+	record := make([]string, len(w.values))
+	for i, value := range w.values {
+		switch value := value.(type) {
+		case nil:
+		case []byte:
+			record[i] = string(value)
+		case time.Time:
+			record[i] = value.UTC().Format(time.RFC3339Nano)
+		case float64:
+			record[i] = strconv.FormatFloat(value, 'f', -1, 64)
+		default:
+			record[i] = fmt.Sprint(value)
+		}
+	}
+	return w.csv.Write(record)
+}
+
+func (w *csvRecordWriter) flush() error {
+	w.csv.Flush()
+	return w.csv.Error()
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/pavitra93/go-multi-tenant-system/shared/audit"
+	"github.com/pavitra93/go-multi-tenant-system/shared/blob"
+	"github.com/pavitra93/go-multi-tenant-system/shared/config"
+	"github.com/pavitra93/go-multi-tenant-system/shared/logger"
+	"github.com/pavitra93/go-multi-tenant-system/shared/models"
+	"github.com/pavitra93/go-multi-tenant-system/shared/pagination"
+	"github.com/pavitra93/go-multi-tenant-system/shared/utils"
+	"github.com/pavitra93/go-multi-tenant-system/shared/validation"
+)
+
+// tenantExportPages orders a tenant's exports, newest first by default
+var tenantExportPages = &pagination.Spec[models.TenantExport]{
+	Sorts: map[string]pagination.Sort[models.TenantExport]{
+		"created_at": pagination.ByTime("created_at", func(e models.TenantExport) time.Time { return e.CreatedAt }),
+	},
+	DefaultSort:  "created_at",
+	DefaultOrder: pagination.Desc,
+	ID:           pagination.ByUUID("id", func(e models.TenantExport) uuid.UUID { return e.ID }),
+}
+
+// exportLinks signs and verifies the download links of export archives. A link names
+// the export and its expiry, and carries the hex HMAC-SHA256 of both.
+type exportLinks struct {
+	baseURL    string
+	ttl        time.Duration
+	signingKey *config.Secret
+}
+
+// newExportLinks creates links under cfg.DownloadURL that work for cfg.LinkTTL
+func newExportLinks(cfg ExportConfig, secrets *config.SecretManager) *exportLinks {
+	return &exportLinks{
+		baseURL:    strings.TrimSuffix(cfg.DownloadURL, "/"),
+		ttl:        cfg.LinkTTL,
+		signingKey: secrets.Secret(ExportSigningKey),
+	}
+}
+
+// attach sets a fresh download link on a completed export. The link expires with the
+// archive if that comes first; without a signing key there is no link.
+func (l *exportLinks) attach(log *logrus.Entry, export *models.TenantExport) {
+	if export.Status != models.ExportStatusCompleted || export.ExpiresAt == nil {
+		return
+	}
+	key := l.signingKey.Value()
+	if key == "" {
+		log.WithField("export_id", export.ID).Warn("Export signing key is not configured; no download link")
+		return
+	}
+
+	expiresAt := time.Now().Add(l.ttl).Truncate(time.Second)
+	if export.ExpiresAt.Before(expiresAt) {
+		expiresAt = export.ExpiresAt.Truncate(time.Second)
+	}
+	export.DownloadURL = fmt.Sprintf("%s/%s/download?expires=%d&signature=%s",
+		l.baseURL, export.ID, expiresAt.Unix(), exportSignature(key, export.ID.String(), expiresAt.Unix()))
+	export.DownloadExpiresAt = &expiresAt
+}
+
+// verify reports whether signature is valid for the export and expiry and the link hasn't expired
+func (l *exportLinks) verify(exportID string, expires int64, signature string) bool {
+	key := l.signingKey.Value()
+	if key == "" || time.Now().Unix() >= expires {
+		return false
+	}
+	expected := exportSignature(key, exportID, expires)
+	return hmac.Equal([]byte(expected), []byte(strings.ToLower(signature)))
+}
+
+// exportSignature returns the hex HMAC-SHA256 of a download link's export ID and expiry
+func exportSignature(key, exportID string, expires int64) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	fmt.Fprintf(mac, "%s:%d", exportID, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// loadTenantExport fetches the tenant's export named by :export_id, writing a 404 if there is none
+func loadTenantExport(c *gin.Context, db *gorm.DB) (*models.TenantExport, bool) {
+	var export models.TenantExport
+	err := db.Where("id = ? AND tenant_id = ?", c.Param("export_id"), c.Param("id")).First(&export).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		utils.NotFoundResponse(c, "Export not found")
+		return nil, false
+	}
+	if err != nil {
+		logger.FromContext(c).WithError(err).Error("Failed to fetch tenant export")
+		utils.InternalServerErrorResponse(c, "Failed to fetch export")
+		return nil, false
+	}
+	return &export, true
+}
+
+// handleCreateTenantExport requests an archive of all of the tenant's data. The archive
+// is built in the background; poll the export for progress and its download link.
+func handleCreateTenantExport(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// The body is optional
+		var req models.CreateTenantExportRequest
+		if c.Request.ContentLength != 0 && !validation.BindJSON(c, &req) {
+			return
+		}
+
+		tenant, ok := loadTenant(c, db)
+		if !ok {
+			return
+		}
+		if tenant.Status == models.TenantStatusDeleted {
+			utils.CodedErrorResponse(c, utils.CodeTenantDeleted, "Deleted tenants have no data to export", map[string]interface{}{
+				"current_status": tenant.Status,
+			})
+			return
+		}
+
+		log := logger.FromContext(c).WithField("tenant_id", tenant.ID)
+
+		format := models.ExportFormatNDJSON
+		if req.Format != "" {
+			format = models.ExportFormat(req.Format)
+		}
+		actor := audit.FromContext(c)
+		export := models.TenantExport{
+			ID:          uuid.New(),
+			TenantID:    tenant.ID,
+			RequestedBy: actor.ID,
+			Format:      format,
+			Status:      models.ExportStatusPending,
+			FilesTotal:  len(exportTables),
+		}
+
+		var active models.TenantExport
+		err := db.Transaction(func(tx *gorm.DB) error {
+			// One export per tenant at a time: requests take turns on the tenant's lock, so each
+			// sees the export the one before created
+			var locked models.Tenant
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").Where("id = ?", tenant.ID).First(&locked).Error; err != nil {
+				return fmt.Errorf("failed to lock tenant: %w", err)
+			}
+			err := tx.Where("tenant_id = ? AND status IN ?", tenant.ID, []models.ExportStatus{models.ExportStatusPending, models.ExportStatusRunning}).
+				First(&active).Error
+			if err == nil {
+				return errExportInProgress
+			}
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("failed to check active exports: %w", err)
+			}
+
+			if err := tx.Create(&export).Error; err != nil {
+				return err
+			}
+			event := actor.Event(audit.TenantExportRequested, tenant.ID, audit.TargetTenantExport, export.ID.String())
+			event.Metadata["format"] = export.Format
+			return audit.Record(tx, event)
+		})
+		if errors.Is(err, errExportInProgress) {
+			utils.CodedErrorResponse(c, utils.CodeExportInProgress, "An export of this tenant is already in progress", map[string]interface{}{
+				"export_id": active.ID,
+			})
+			return
+		}
+		if err != nil {
+			log.WithError(err).Error("Failed to create tenant export")
+			utils.InternalServerErrorResponse(c, "Failed to create export")
+			return
+		}
+
+		log.WithField("export_id", export.ID).Info("Tenant export requested")
+		utils.SuccessResponse(c, http.StatusAccepted, "Export requested; it will be built in the background", export)
+	}
+}
+
+// handleGetTenantExports lists the tenant's exports a page at a time, with download links
+// for completed ones
+func handleGetTenantExports(db *gorm.DB, links *exportLinks) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var filter models.TenantExportListQuery
+		if !validation.BindQuery(c, &filter) {
+			return
+		}
+		page, ok := pagination.Parse(c, tenantExportPages)
+		if !ok {
+			return
+		}
+
+		log := logger.FromContext(c)
+		query := db.Where("tenant_id = ?", c.Param("id"))
+		if filter.Status != "" {
+			query = query.Where("status = ?", filter.Status)
+		}
+
+		var exports []models.TenantExport
+		if err := page.Apply(query).Find(&exports).Error; err != nil {
+			log.WithError(err).Error("Failed to fetch tenant exports")
+			utils.InternalServerErrorResponse(c, "Failed to fetch exports")
+			return
+		}
+
+		exports, info := page.Result(exports)
+		for i := range exports {
+			links.attach(log, &exports[i])
+		}
+		utils.PaginatedResponse(c, "Exports retrieved successfully", exports, info)
+	}
+}
+
+// handleGetTenantExport reports an export's progress and, once completed, a fresh download link
+func handleGetTenantExport(db *gorm.DB, links *exportLinks) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		export, ok := loadTenantExport(c, db)
+		if !ok {
+			return
+		}
+
+		links.attach(logger.FromContext(c), export)
+		utils.OKResponse(c, "Export retrieved successfully", export)
+	}
+}
+
+// handleDownloadExport streams an export archive to the holder of a valid download link.
+// The link's signature is its authorization, so the route is unauthenticated.
+func handleDownloadExport(db *gorm.DB, store blob.Store, links *exportLinks) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var query models.ExportDownloadQuery
+		if !validation.BindQuery(c, &query) {
+			return
+		}
+
+		exportID := c.Param("export_id")
+		if _, err := uuid.Parse(exportID); err != nil || !links.verify(exportID, query.Expires, query.Signature) {
+			utils.CodedErrorResponse(c, utils.CodeInvalidDownloadLink, "Download link is invalid or has expired; get a new one from the export", nil)
+			return
+		}
+
+		log := logger.FromContext(c).WithField("export_id", exportID)
+
+		var export models.TenantExport
+		if err := db.Where("id = ?", exportID).First(&export).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				utils.NotFoundResponse(c, "Export not found")
+				return
+			}
+			log.WithError(err).Error("Failed to fetch tenant export")
+			utils.InternalServerErrorResponse(c, "Failed to fetch export")
+			return
+		}
+		if export.Status != models.ExportStatusCompleted {
+			utils.CodedErrorResponse(c, utils.CodeExportNotAvailable, "Export archive is no longer available", map[string]interface{}{
+				"status": export.Status,
+			})
+			return
+		}
+		// Links are only capped at the archive's expiry when issued; it may have been brought
+		// forward since, as when a user is erased, and the exporter deletes archives in batches
+		if export.ExpiresAt == nil || !export.ExpiresAt.After(time.Now()) {
+			utils.CodedErrorResponse(c, utils.CodeExportNotAvailable, "Export archive has expired", map[string]interface{}{
+				"expires_at": export.ExpiresAt,
+			})
+			return
+		}
+
+		archive, err := store.Open(c.Request.Context(), export.BlobKey)
+		if errors.Is(err, blob.ErrNotFound) {
+			log.Error("Export archive is missing from the blob store")
+			utils.CodedErrorResponse(c, utils.CodeExportNotAvailable, "Export archive is no longer available", nil)
+			return
+		}
+		if err != nil {
+			log.WithError(err).Error("Failed to open export archive")
+			utils.InternalServerErrorResponse(c, "Failed to download export")
+			return
+		}
+		defer archive.Close()
+
+		log.WithField("tenant_id", export.TenantID).Info("Tenant export downloaded")
+		filename := fmt.Sprintf("tenant-%s-export-%s.zip", export.TenantID, export.CompletedAt.UTC().Format("20060102T1504"))
+		c.DataFromReader(http.StatusOK, export.SizeBytes, "application/zip", archive, map[string]string{
+			"Content-Disposition": fmt.Sprintf("attachment; filename=%q", filename),
+			"X-Content-SHA256":    export.SHA256,
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/pavitra93/go-multi-tenant-system/shared/blob"
+	"github.com/pavitra93/go-multi-tenant-system/shared/config"
+	"github.com/pavitra93/go-multi-tenant-system/shared/models"
+)
+
+const testExportSigningKey = "test-export-signing-key"
+
+// newTestLinks returns download links signed with the test key
+func newTestLinks() *exportLinks {
+	return &exportLinks{
+		baseURL:    "http://localhost:8080/v1/exports",
+		ttl:        15 * time.Minute,
+		signingKey: config.NewStaticSecret(ExportSigningKey, testExportSigningKey),
+	}
+}
+
+// createTestExport stores a completed export of tenant whose archive expires at expiresAt
+func createTestExport(t *testing.T, tx *gorm.DB, store blob.Store, tenantID uuid.UUID, expiresAt *time.Time) *models.TenantExport {
+	t.Helper()
+
+	completedAt := time.Now()
+	export := &models.TenantExport{
+		ID:          uuid.New(),
+		TenantID:    tenantID,
+		RequestedBy: testActor.ID,
+		Format:      models.ExportFormatNDJSON,
+		Status:      models.ExportStatusCompleted,
+		BlobKey:     "exports/" + uuid.NewString() + ".zip",
+		SizeBytes:   int64(len("archive")),
+		CompletedAt: &completedAt,
+		ExpiresAt:   expiresAt,
+	}
+	if err := store.Put(context.Background(), export.BlobKey, strings.NewReader("archive")); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Create(export).Error; err != nil {
+		t.Fatal(err)
+	}
+	return export
+}
+
+// signedDownloadURL returns a link to the export valid for the next few minutes, as one
+// issued before the archive's expiry was brought forward would be
+func signedDownloadURL(links *exportLinks, export *models.TenantExport) string {
+	expires := time.Now().Add(5 * time.Minute).Unix()
+	return fmt.Sprintf("%s/%s/download?expires=%d&signature=%s",
+		links.baseURL, export.ID, expires, exportSignature(testExportSigningKey, export.ID.String(), expires))
+}
+
+// downloadExport requests a download link from the download handler
+func downloadExport(t *testing.T, tx *gorm.DB, store blob.Store, links *exportLinks, link string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/exports/:export_id/download", handleDownloadExport(tx, store, links))
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/exports"+strings.TrimPrefix(link, links.baseURL), nil))
+	return recorder
+}
+
+// TestDownloadExportChecksArchiveExpiry downloads exports through links that are still
+// valid, against a real database.
+func TestDownloadExportChecksArchiveExpiry(t *testing.T) {
+	tests := []struct {
+		name       string
+		expiresIn  *time.Duration // Until the archive expires; nil for no expiry
+		wantStatus int
+	}{
+		{name: "archive kept", expiresIn: durationPtr(time.Hour), wantStatus: http.StatusOK},
+		{name: "archive expired", expiresIn: durationPtr(-time.Second), wantStatus: http.StatusGone},
+		{name: "archive expiring now", expiresIn: durationPtr(0), wantStatus: http.StatusGone},
+		{name: "no archive expiry", wantStatus: http.StatusGone},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx := testTx(t)
+			tenant, _ := createTestTenant(t, tx)
+			store := &blob.LocalStore{Dir: t.TempDir()}
+
+			var expiresAt *time.Time
+			if tt.expiresIn != nil {
+				at := time.Now().Add(*tt.expiresIn)
+				expiresAt = &at
+			}
+			export := createTestExport(t, tx, store, tenant.ID, expiresAt)
+
+			links := newTestLinks()
+			recorder := downloadExport(t, tx, store, links, signedDownloadURL(links, export))
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", recorder.Code, tt.wantStatus, recorder.Body)
+			}
+		})
+	}
+}
+
+// TestCreateTenantExportOneAtATime requests exports of tenants that may already have one
+// waiting or being built, against a real database.
+func TestCreateTenantExportOneAtATime(t *testing.T) {
+	tests := []struct {
+		name       string
+		existing   models.ExportStatus // Status of the tenant's existing export; empty for none
+		wantStatus int
+	}{
+		{name: "no export", wantStatus: http.StatusAccepted},
+		{name: "export pending", existing: models.ExportStatusPending, wantStatus: http.StatusConflict},
+		{name: "export running", existing: models.ExportStatusRunning, wantStatus: http.StatusConflict},
+		{name: "export completed", existing: models.ExportStatusCompleted, wantStatus: http.StatusAccepted},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx := testTx(t)
+			tenant, _ := createTestTenant(t, tx)
+			if tt.existing != "" {
+				existing := &models.TenantExport{TenantID: tenant.ID, RequestedBy: testActor.ID, Format: models.ExportFormatNDJSON, Status: tt.existing}
+				if err := tx.Create(existing).Error; err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.POST("/tenants/:id/exports", handleCreateTenantExport(tx))
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/tenants/"+tenant.ID.String()+"/exports", nil))
+
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", recorder.Code, tt.wantStatus, recorder.Body)
+			}
+		})
+	}
+}
+
+func durationPtr(d time.Duration) *time.Duration {
+	return &d
+}
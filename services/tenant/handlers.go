@@ -1,70 +1,162 @@
 package main
 
 import (
+	"regexp"
+	"strings"
+	"time"
+
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
+	"github.com/pavitra93/go-multi-tenant-system/shared/audit"
+	"github.com/pavitra93/go-multi-tenant-system/shared/domains"
+	"github.com/pavitra93/go-multi-tenant-system/shared/logger"
+	"github.com/pavitra93/go-multi-tenant-system/shared/middleware"
 	"github.com/pavitra93/go-multi-tenant-system/shared/models"
+	"github.com/pavitra93/go-multi-tenant-system/shared/pagination"
 	"github.com/pavitra93/go-multi-tenant-system/shared/utils"
+	"github.com/pavitra93/go-multi-tenant-system/shared/validation"
 )
 
-// CreateTenantRequest represents the create tenant request
-type CreateTenantRequest struct {
-	Name   string `json:"name" binding:"required"`
-	Domain string `json:"domain" binding:"required"`
+// slugPattern matches a single DNS label used as the tenant subdomain
+var slugPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// tenantPages orders the admin tenant listing, newest first by default
+var tenantPages = &pagination.Spec[models.Tenant]{
+	Sorts: map[string]pagination.Sort[models.Tenant]{
+		"created_at": pagination.ByTime("created_at", func(t models.Tenant) time.Time { return t.CreatedAt }),
+		"name":       pagination.ByString("name", func(t models.Tenant) string { return t.Name }),
+	},
+	DefaultSort:  "created_at",
+	DefaultOrder: pagination.Desc,
+	ID:           pagination.ByUUID("id", func(t models.Tenant) uuid.UUID { return t.ID }),
 }
 
-// UpdateTenantRequest represents the update tenant request
-type UpdateTenantRequest struct {
-	Name     *string `json:"name"`
-	Domain   *string `json:"domain"`
-	IsActive *bool   `json:"is_active"`
+// tenantUserPages orders a tenant's users, oldest first by default
+var tenantUserPages = &pagination.Spec[models.User]{
+	Sorts: map[string]pagination.Sort[models.User]{
+		"created_at": pagination.ByTime("created_at", func(u models.User) time.Time { return u.CreatedAt }),
+	},
+	DefaultSort:  "created_at",
+	DefaultOrder: pagination.Asc,
+	ID:           pagination.ByString("cognito_id", func(u models.User) string { return u.CognitoID }),
 }
 
 // handleCreateTenant handles tenant creation (admin only)
-func handleCreateTenant(db *gorm.DB) gin.HandlerFunc {
+func handleCreateTenant(db *gorm.DB, baseDomain string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var req CreateTenantRequest
-		if err := c.ShouldBindJSON(&req); err != nil {
-			utils.BadRequestResponse(c, "Invalid request format")
+		var req models.CreateTenantRequest
+		if !validation.BindJSON(c, &req) {
 			return
 		}
 
 		// Check if domain already exists
 		var existingTenant models.Tenant
-		if err := db.Where("domain = ?", req.Domain).First(&existingTenant).Error; err == nil {
-			utils.BadRequestResponse(c, "Domain already exists")
+		if err := db.Where("domain = ? AND status <> ?", req.Domain, models.TenantStatusDeleted).First(&existingTenant).Error; err == nil {
+			utils.CodedErrorResponse(c, utils.CodeDomainAlreadyExists, "Domain already exists", nil)
+			return
+		}
+
+		// Check slug format and uniqueness
+		if req.Slug != nil {
+			if !slugPattern.MatchString(*req.Slug) {
+				utils.BadRequestResponse(c, "Slug must be a lowercase DNS label")
+				return
+			}
+			if err := db.Where("slug = ? AND status <> ?", *req.Slug, models.TenantStatusDeleted).First(&existingTenant).Error; err == nil {
+				utils.CodedErrorResponse(c, utils.CodeSlugAlreadyExists, "Slug already exists", nil)
+				return
+			}
+		}
+
+		planID := req.PlanID
+		if planID == "" {
+			planID = models.DefaultPlanID
+		}
+		if _, ok := findPlan(c, db, planID); !ok {
 			return
 		}
 
 		// Create tenant
 		tenant := models.Tenant{
-			ID:       uuid.New(),
-			Name:     req.Name,
-			Domain:   req.Domain,
-			IsActive: true,
+			ID:     uuid.New(),
+			Name:   req.Name,
+			Domain: req.Domain,
+			Slug:   req.Slug,
+			PlanID: planID,
 		}
+		tenant.SetStatus(models.TenantStatusActive)
 
-		if err := db.Create(&tenant).Error; err != nil {
+		// The domain resolves to the tenant once the owner proves they control it
+		token, err := domains.NewToken()
+		if err != nil {
+			logger.FromContext(c).WithError(err).Error("Failed to create tenant")
 			utils.InternalServerErrorResponse(c, "Failed to create tenant")
 			return
 		}
+		tenant.RestartDomainVerification(token, time.Now().UTC())
+
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&tenant).Error; err != nil {
+				return err
+			}
+			event := audit.FromContext(c).Event(audit.TenantCreated, tenant.ID, audit.TargetTenant, tenant.ID.String())
+			event.Changes = audit.Diff(nil, tenant)
+			return audit.Record(tx, event)
+		})
+		if err != nil {
+			logger.FromContext(c).WithError(err).Error("Failed to create tenant")
+			utils.InternalServerErrorResponse(c, "Failed to create tenant")
+			return
+		}
+
+		// Drop any negative host resolution cached before the tenant existed
+		middleware.InvalidateTenantHostCache(&tenant, baseDomain)
 
 		utils.CreatedResponse(c, "Tenant created successfully", tenant)
 	}
 }
 
-// handleGetTenants handles getting all tenants (admin only)
+// handleGetTenants handles listing tenants a page at a time (admin only).
+// Users are only loaded with ?include=users.
 func handleGetTenants(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		var filter models.TenantListQuery
+		if !validation.BindQuery(c, &filter) {
+			return
+		}
+		page, ok := pagination.Parse(c, tenantPages)
+		if !ok {
+			return
+		}
+
+		query := db.Model(&models.Tenant{})
+		if filter.Status != "" {
+			query = query.Where("status = ?", filter.Status)
+		}
+		if filter.IsActive != nil {
+			query = query.Where("is_active = ?", *filter.IsActive)
+		}
+		if filter.CreatedAfter != nil {
+			query = query.Where("created_at >= ?", *filter.CreatedAfter)
+		}
+		if filter.CreatedBefore != nil {
+			query = query.Where("created_at < ?", *filter.CreatedBefore)
+		}
+		if filter.Include == "users" {
+			query = query.Preload("Users")
+		}
+
 		var tenants []models.Tenant
-		if err := db.Preload("Users").Find(&tenants).Error; err != nil {
+		if err := page.Apply(query).Find(&tenants).Error; err != nil {
 			utils.InternalServerErrorResponse(c, "Failed to fetch tenants")
 			return
 		}
 
-		utils.OKResponse(c, "Tenants retrieved successfully", tenants)
+		tenants, info := page.Result(tenants)
+		utils.PaginatedResponse(c, "Tenants retrieved successfully", tenants, info)
 	}
 }
 
@@ -76,7 +168,7 @@ func handleGetTenant(db *gorm.DB) gin.HandlerFunc {
 		var tenant models.Tenant
 		if err := db.Preload("Users").Where("id = ?", tenantID).First(&tenant).Error; err != nil {
 			if err == gorm.ErrRecordNotFound {
-				utils.NotFoundResponse(c, "Tenant not found")
+				utils.CodedErrorResponse(c, utils.CodeTenantNotFound, "Tenant not found", nil)
 			} else {
 				utils.InternalServerErrorResponse(c, "Failed to fetch tenant")
 			}
@@ -88,90 +180,165 @@ func handleGetTenant(db *gorm.DB) gin.HandlerFunc {
 }
 
 // handleUpdateTenant handles updating a tenant
-func handleUpdateTenant(db *gorm.DB) gin.HandlerFunc {
+func handleUpdateTenant(db *gorm.DB, lifecycle *tenantLifecycle) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		tenantID := c.Param("id")
 
 		var tenant models.Tenant
 		if err := db.Where("id = ?", tenantID).First(&tenant).Error; err != nil {
 			if err == gorm.ErrRecordNotFound {
-				utils.NotFoundResponse(c, "Tenant not found")
+				utils.CodedErrorResponse(c, utils.CodeTenantNotFound, "Tenant not found", nil)
 			} else {
 				utils.InternalServerErrorResponse(c, "Failed to fetch tenant")
 			}
 			return
 		}
 
-		var req UpdateTenantRequest
-		if err := c.ShouldBindJSON(&req); err != nil {
-			utils.BadRequestResponse(c, "Invalid request format")
+		if tenant.Status == models.TenantStatusDeleted {
+			utils.CodedErrorResponse(c, utils.CodeInvalidTenantTransition, "Deleted tenants cannot be modified", map[string]interface{}{
+				"current_status": tenant.Status,
+			})
+			return
+		}
+
+		var req models.UpdateTenantRequest
+		if !validation.BindJSON(c, &req) {
 			return
 		}
 
-		// Update tenant fields
+		// is_active is shorthand for suspend/reactivate, which only admins may do
+		var nextStatus models.TenantStatus
+		if req.IsActive != nil && *req.IsActive != tenant.IsActive {
+			if c.GetString("role") != "admin" {
+				utils.CodedErrorResponse(c, utils.CodeInsufficientRole, "Only admins can change tenant status", map[string]interface{}{
+					"required_role": "admin",
+					"user_role":     c.GetString("role"),
+				})
+				return
+			}
+			nextStatus = models.TenantStatusSuspended
+			if *req.IsActive {
+				nextStatus = models.TenantStatusActive
+			}
+		}
+
+		// Host resolution for the previous domain and slug must be invalidated after the update
+		previous := tenant
+
+		// Only the fields in the request are written, so concurrent changes to others are kept
+		edits := map[string]interface{}{}
 		if req.Name != nil {
-			tenant.Name = *req.Name
+			edits["name"] = *req.Name
 		}
 		if req.Domain != nil {
 			// Check if new domain already exists
 			var existingTenant models.Tenant
-			if err := db.Where("domain = ? AND id != ?", *req.Domain, tenantID).First(&existingTenant).Error; err == nil {
-				utils.BadRequestResponse(c, "Domain already exists")
+			if err := db.Where("domain = ? AND id != ? AND status <> ?", *req.Domain, tenantID, models.TenantStatusDeleted).First(&existingTenant).Error; err == nil {
+				utils.CodedErrorResponse(c, utils.CodeDomainAlreadyExists, "Domain already exists", nil)
 				return
 			}
-			tenant.Domain = *req.Domain
+			// A new domain has to be verified before it resolves to the tenant
+			if !strings.EqualFold(*req.Domain, tenant.Domain) {
+				token, err := domains.NewToken()
+				if err != nil {
+					logger.FromContext(c).WithError(err).WithField("tenant_id", tenant.ID).Error("Failed to update tenant")
+					utils.InternalServerErrorResponse(c, "Failed to update tenant")
+					return
+				}
+				restarted := tenant
+				restarted.RestartDomainVerification(token, time.Now().UTC())
+				for column, value := range domainVerificationColumns(&restarted) {
+					edits[column] = value
+				}
+			}
+			edits["domain"] = *req.Domain
 		}
-		if req.IsActive != nil {
-			tenant.IsActive = *req.IsActive
+		if req.Slug != nil {
+			if !slugPattern.MatchString(*req.Slug) {
+				utils.BadRequestResponse(c, "Slug must be a lowercase DNS label")
+				return
+			}
+			var existingTenant models.Tenant
+			if err := db.Where("slug = ? AND id != ? AND status <> ?", *req.Slug, tenantID, models.TenantStatusDeleted).First(&existingTenant).Error; err == nil {
+				utils.CodedErrorResponse(c, utils.CodeSlugAlreadyExists, "Slug already exists", nil)
+				return
+			}
+			edits["slug"] = *req.Slug
 		}
 
-		if err := db.Save(&tenant).Error; err != nil {
-			utils.InternalServerErrorResponse(c, "Failed to update tenant")
-			return
+		if nextStatus != "" {
+			// Writes the field changes along with the new status
+			if err := lifecycle.changeStatus(logger.FromContext(c), &tenant, nextStatus, nil, audit.FromContext(c), edits); err != nil {
+				statusChangeErrorResponse(c, tenant.ID, err)
+				return
+			}
+		} else if len(edits) > 0 {
+			err := db.Transaction(func(tx *gorm.DB) error {
+				var locked models.Tenant
+				if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", tenant.ID).First(&locked).Error; err != nil {
+					return err
+				}
+				if err := tx.Model(&models.Tenant{}).Where("id = ?", tenant.ID).Updates(edits).Error; err != nil {
+					return err
+				}
+				var updated models.Tenant
+				if err := tx.Where("id = ?", tenant.ID).First(&updated).Error; err != nil {
+					return err
+				}
+				tenant = updated
+
+				event := audit.FromContext(c).Event(audit.TenantUpdated, tenant.ID, audit.TargetTenant, tenant.ID.String())
+				if event.Changes = audit.Diff(locked, tenant); len(event.Changes) == 0 {
+					return nil
+				}
+				return audit.Record(tx, event)
+			})
+			if err != nil {
+				logger.FromContext(c).WithError(err).WithField("tenant_id", tenant.ID).Error("Failed to update tenant")
+				utils.InternalServerErrorResponse(c, "Failed to update tenant")
+				return
+			}
 		}
 
+		middleware.InvalidateTenantHostCache(&previous, lifecycle.baseDomain)
+		middleware.InvalidateTenantHostCache(&tenant, lifecycle.baseDomain)
+
 		utils.OKResponse(c, "Tenant updated successfully", tenant)
 	}
 }
 
-// handleInviteUserToTenant handles inviting a new user to the tenant
-// Tenant owners can use this to add users to their tenant
-func handleInviteUserToTenant(db *gorm.DB) gin.HandlerFunc {
+// handleGetTenantUsers handles listing a tenant's users a page at a time
+func handleGetTenantUsers(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		tenantID := c.Param("id")
 
-		var req struct {
-			Username string `json:"username" binding:"required,email"`
-			Role     string `json:"role" binding:"required,oneof=user tenant_owner"`
+		var filter models.TenantUserListQuery
+		if !validation.BindQuery(c, &filter) {
+			return
 		}
-
-		if err := c.ShouldBindJSON(&req); err != nil {
-			utils.BadRequestResponse(c, "Invalid request format. Role must be 'user' or 'tenant_owner'")
+		page, ok := pagination.Parse(c, tenantUserPages)
+		if !ok {
 			return
 		}
 
-		// Forward to auth service to create user
-		// Note: This would need to be implemented in auth service
-		utils.OKResponse(c, "User invitation sent", map[string]interface{}{
-			"tenant_id": tenantID,
-			"username":  req.Username,
-			"role":      req.Role,
-			"message":   "User will receive registration email",
-		})
-	}
-}
-
-// handleGetTenantUsers handles getting users for a specific tenant
-func handleGetTenantUsers(db *gorm.DB) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		tenantID := c.Param("id")
+		query := db.Where("tenant_id = ?", tenantID)
+		if filter.Role != "" {
+			query = query.Where("role = ?", filter.Role)
+		}
+		if filter.CreatedAfter != nil {
+			query = query.Where("created_at >= ?", *filter.CreatedAfter)
+		}
+		if filter.CreatedBefore != nil {
+			query = query.Where("created_at < ?", *filter.CreatedBefore)
+		}
 
 		var users []models.User
-		if err := db.Where("tenant_id = ?", tenantID).Find(&users).Error; err != nil {
+		if err := page.Apply(query).Find(&users).Error; err != nil {
 			utils.InternalServerErrorResponse(c, "Failed to fetch tenant users")
 			return
 		}
 
-		utils.OKResponse(c, "Tenant users retrieved successfully", users)
+		users, info := page.Result(users)
+		utils.PaginatedResponse(c, "Tenant users retrieved successfully", users, info)
 	}
 }
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/pavitra93/go-multi-tenant-system/shared/audit"
+	"github.com/pavitra93/go-multi-tenant-system/shared/logger"
+	"github.com/pavitra93/go-multi-tenant-system/shared/middleware"
+	"github.com/pavitra93/go-multi-tenant-system/shared/models"
+	"github.com/pavitra93/go-multi-tenant-system/shared/notify"
+	"github.com/pavitra93/go-multi-tenant-system/shared/utils"
+	"github.com/pavitra93/go-multi-tenant-system/shared/validation"
+)
+
+var (
+	// errInvitationNotSent rolls back an invitation whose delivery failed
+	errInvitationNotSent = errors.New("invitation could not be sent")
+	// errInvitationNotPending means the invitation was accepted or revoked while this request ran
+	errInvitationNotPending = errors.New("invitation is no longer pending")
+)
+
+// invitationMailer issues invitation tokens and delivers invite links
+type invitationMailer struct {
+	db        *gorm.DB
+	notifier  notify.Notifier
+	ttl       time.Duration
+	acceptURL string
+}
+
+// newInvitationMailer creates the mailer used by the invitation handlers
+func newInvitationMailer(db *gorm.DB, notifier notify.Notifier, cfg InvitationConfig) *invitationMailer {
+	return &invitationMailer{
+		db:        db,
+		notifier:  notifier,
+		ttl:       cfg.TTL,
+		acceptURL: cfg.AcceptURL,
+	}
+}
+
+// issue gives the invitation a fresh token and expiry and returns the token.
+// Any link sent earlier stops working.
+func (m *invitationMailer) issue(invitation *models.Invitation) (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("failed to generate invitation token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+
+	now := time.Now()
+	invitation.TokenHash = utils.HashToken(token)
+	invitation.ExpiresAt = now.Add(m.ttl)
+	invitation.LastSentAt = now
+	return token, nil
+}
+
+// send delivers the invite link for token
+func (m *invitationMailer) send(c *gin.Context, tenant *models.Tenant, invitation *models.Invitation, token string) error {
+	link, err := url.Parse(m.acceptURL)
+	if err != nil {
+		return fmt.Errorf("invalid INVITATION_ACCEPT_URL: %w", err)
+	}
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+
+	role := "a user"
+	if invitation.Role == models.RoleTenantOwner {
+		role = "an owner"
+	}
+
+	return m.notifier.Send(c.Request.Context(), notify.Message{
+		To:      invitation.Email,
+		Subject: fmt.Sprintf("You're invited to join %s", tenant.Name),
+		Body: fmt.Sprintf("You have been invited to join %s as %s.\n\n"+
+			"Accept the invitation and choose a password:\n%s\n\n"+
+			"The link expires on %s. If you weren't expecting this invitation, you can ignore this email.\n",
+			tenant.Name, role, link, invitation.ExpiresAt.UTC().Format(time.RFC1123)),
+	})
+}
+
+// handleInviteUserToTenant invites someone to the tenant by email.
+// Tenant owners use this to add users to their own tenant.
+func handleInviteUserToTenant(mailer *invitationMailer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req models.InviteUserRequest
+		if !validation.BindJSON(c, &req) {
+			return
+		}
+
+		tenant, ok := loadTenant(c, mailer.db)
+		if !ok {
+			return
+		}
+		if !tenant.Status.AllowsAccess() {
+			middleware.TenantUnavailableResponse(c, tenant.Status)
+			return
+		}
+
+		email := strings.ToLower(strings.TrimSpace(req.Username))
+		log := logger.FromContext(c).WithField("tenant_id", tenant.ID)
+
+		// One pending invitation per email; an expired one is replaced
+		var existing models.Invitation
+		err := mailer.db.Where("tenant_id = ? AND LOWER(email) = ? AND status = ?", tenant.ID, email, models.InvitationStatusPending).
+			First(&existing).Error
+		if err == nil && !existing.IsExpired() {
+			utils.CodedErrorResponse(c, utils.CodeInvitationAlreadyExists, "A pending invitation already exists for this email", map[string]interface{}{
+				"invitation_id": existing.ID,
+			})
+			return
+		}
+		if err != nil && err != gorm.ErrRecordNotFound {
+			utils.InternalServerErrorResponse(c, "Failed to check existing invitations")
+			return
+		}
+
+		invitation := models.Invitation{
+			ID:        uuid.New(),
+			TenantID:  tenant.ID,
+			Email:     email,
+			Role:      models.UserRole(req.Role),
+			Status:    models.InvitationStatusPending,
+			InvitedBy: c.GetString("user_id"),
+			SendCount: 1,
+		}
+		token, err := mailer.issue(&invitation)
+		if err != nil {
+			utils.InternalServerErrorResponse(c, "Failed to create invitation")
+			return
+		}
+
+		// The invitation is only kept if it could be delivered
+		err = mailer.db.Transaction(func(tx *gorm.DB) error {
+			if existing.ID != uuid.Nil {
+				now := time.Now()
+				if err := tx.Model(&existing).Updates(map[string]interface{}{"status": models.InvitationStatusRevoked, "revoked_at": now}).Error; err != nil {
+					return err
+				}
+			}
+			if err := tx.Create(&invitation).Error; err != nil {
+				return err
+			}
+
+			event := audit.FromContext(c).Event(audit.InvitationCreated, tenant.ID, audit.TargetInvitation, invitation.ID.String())
+			event.Metadata["email"] = invitation.Email
+			event.Metadata["role"] = invitation.Role
+			if existing.ID != uuid.Nil {
+				event.Metadata["replaced_invitation_id"] = existing.ID
+			}
+			if err := audit.Record(tx, event); err != nil {
+				return err
+			}
+
+			if err := mailer.send(c, tenant, &invitation, token); err != nil {
+				log.WithError(err).WithField("notifier", mailer.notifier.Name()).Error("Failed to send invitation")
+				return errInvitationNotSent
+			}
+			return nil
+		})
+		if errors.Is(err, errInvitationNotSent) {
+			utils.CodedErrorResponse(c, utils.CodeServiceUnavailable, "Failed to send invitation", nil)
+			return
+		}
+		if err != nil {
+			log.WithError(err).Error("Failed to create invitation")
+			utils.InternalServerErrorResponse(c, "Failed to create invitation")
+			return
+		}
+
+		utils.CreatedResponse(c, "Invitation sent", invitation)
+	}
+}
+
+// handleGetTenantInvitations lists a tenant's invitations, pending ones by default.
+// ?status= accepts pending, expired, accepted, revoked or all.
+func handleGetTenantInvitations(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		query := db.Where("tenant_id = ?", c.Param("id"))
+
+		now := time.Now()
+		switch status := models.InvitationStatus(c.DefaultQuery("status", string(models.InvitationStatusPending))); status {
+		case models.InvitationStatusPending:
+			query = query.Where("status = ? AND expires_at > ?", status, now)
+		case models.InvitationStatusExpired:
+			query = query.Where("status = ? AND expires_at <= ?", models.InvitationStatusPending, now)
+		case models.InvitationStatusAccepted, models.InvitationStatusRevoked:
+			query = query.Where("status = ?", status)
+		case "all":
+		default:
+			utils.BadRequestResponse(c, "status must be pending, expired, accepted, revoked or all")
+			return
+		}
+
+		invitations := []models.Invitation{}
+		if err := query.Order("created_at DESC").Find(&invitations).Error; err != nil {
+			utils.InternalServerErrorResponse(c, "Failed to fetch invitations")
+			return
+		}
+
+		utils.OKResponse(c, "Invitations retrieved successfully", invitations)
+	}
+}
+
+// loadInvitation fetches the invitation named by :invitation_id within the :id tenant,
+// writing the error response if it can't
+func loadInvitation(c *gin.Context, db *gorm.DB) (*models.Invitation, bool) {
+	invitationID, err := uuid.Parse(c.Param("invitation_id"))
+	if err != nil {
+		utils.CodedErrorResponse(c, utils.CodeInvitationNotFound, "Invitation not found", nil)
+		return nil, false
+	}
+
+	var invitation models.Invitation
+	if err := db.Where("id = ? AND tenant_id = ?", invitationID, c.Param("id")).First(&invitation).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.CodedErrorResponse(c, utils.CodeInvitationNotFound, "Invitation not found", nil)
+		} else {
+			utils.InternalServerErrorResponse(c, "Failed to fetch invitation")
+		}
+		return nil, false
+	}
+	return &invitation, true
+}
+
+// invitationNotPendingResponse writes the error for acting on an accepted or revoked invitation
+func invitationNotPendingResponse(c *gin.Context, invitation *models.Invitation) {
+	utils.CodedErrorResponse(c, utils.CodeInvitationNotPending, fmt.Sprintf("Invitation is %s", invitation.Status), map[string]interface{}{
+		"status": invitation.Status,
+	})
+}
+
+// handleResendInvitation sends a pending invitation again with a new link and expiry
+func handleResendInvitation(mailer *invitationMailer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		invitation, ok := loadInvitation(c, mailer.db)
+		if !ok {
+			return
+		}
+		if invitation.Status != models.InvitationStatusPending {
+			invitationNotPendingResponse(c, invitation)
+			return
+		}
+
+		tenant, ok := loadTenant(c, mailer.db)
+		if !ok {
+			return
+		}
+		if !tenant.Status.AllowsAccess() {
+			middleware.TenantUnavailableResponse(c, tenant.Status)
+			return
+		}
+
+		token, err := mailer.issue(invitation)
+		if err != nil {
+			utils.InternalServerErrorResponse(c, "Failed to reissue invitation")
+			return
+		}
+		invitation.SendCount++
+
+		log := logger.FromContext(c).WithField("invitation_id", invitation.ID)
+		err = mailer.db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Save(invitation).Error; err != nil {
+				return err
+			}
+
+			event := audit.FromContext(c).Event(audit.InvitationResent, tenant.ID, audit.TargetInvitation, invitation.ID.String())
+			event.Metadata["email"] = invitation.Email
+			event.Metadata["send_count"] = invitation.SendCount
+			if err := audit.Record(tx, event); err != nil {
+				return err
+			}
+
+			if err := mailer.send(c, tenant, invitation, token); err != nil {
+				log.WithError(err).WithField("notifier", mailer.notifier.Name()).Error("Failed to resend invitation")
+				return errInvitationNotSent
+			}
+			return nil
+		})
+		if errors.Is(err, errInvitationNotSent) {
+			utils.CodedErrorResponse(c, utils.CodeServiceUnavailable, "Failed to send invitation", nil)
+			return
+		}
+		if err != nil {
+			utils.InternalServerErrorResponse(c, "Failed to update invitation")
+			return
+		}
+
+		utils.OKResponse(c, "Invitation resent", invitation)
+	}
+}
+
+// handleRevokeInvitation revokes a pending invitation so its link can no longer be used
+func handleRevokeInvitation(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		invitation, ok := loadInvitation(c, db)
+		if !ok {
+			return
+		}
+		if invitation.Status != models.InvitationStatusPending {
+			invitationNotPendingResponse(c, invitation)
+			return
+		}
+
+		// Conditional so an invitation accepted meanwhile stays accepted
+		now := time.Now()
+		err := db.Transaction(func(tx *gorm.DB) error {
+			result := tx.Model(invitation).Where("status = ?", models.InvitationStatusPending).
+				Updates(map[string]interface{}{"status": models.InvitationStatusRevoked, "revoked_at": now})
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return errInvitationNotPending
+			}
+
+			event := audit.FromContext(c).Event(audit.InvitationRevoked, invitation.TenantID, audit.TargetInvitation, invitation.ID.String())
+			event.Metadata["email"] = invitation.Email
+			return audit.Record(tx, event)
+		})
+		if errors.Is(err, errInvitationNotPending) {
+			utils.CodedErrorResponse(c, utils.CodeInvitationNotPending, "Invitation is no longer pending", nil)
+			return
+		}
+		if err != nil {
+			utils.InternalServerErrorResponse(c, "Failed to revoke invitation")
+			return
+		}
+		invitation.Status = models.InvitationStatusRevoked
+		invitation.RevokedAt = &now
+
+		utils.OKResponse(c, "Invitation revoked", invitation)
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/pavitra93/go-multi-tenant-system/shared/audit"
+	"github.com/pavitra93/go-multi-tenant-system/shared/logger"
+	"github.com/pavitra93/go-multi-tenant-system/shared/models"
+	"github.com/pavitra93/go-multi-tenant-system/shared/utils"
+	"github.com/pavitra93/go-multi-tenant-system/shared/validation"
+)
+
+var (
+	// errLegalHoldActive is returned when deleting data the tenant's legal holds preserve
+	errLegalHoldActive = errors.New("tenant data is under legal hold")
+	// errLegalHoldReleased is returned when releasing a hold that is no longer in effect
+	errLegalHoldReleased = errors.New("legal hold has already been released")
+)
+
+// lockLegalHolds share-locks the tenant and reports whether a legal hold is in effect.
+// Placing a hold takes the tenant's update lock, so the answer holds until the
+// transaction ends; take it before locking any of the tenant's users.
+func lockLegalHolds(tx *gorm.DB, tenantID uuid.UUID) (bool, error) {
+	var tenant models.Tenant
+	err := tx.Clauses(clause.Locking{Strength: "SHARE"}).Select("id").Where("id = ?", tenantID).First(&tenant).Error
+	if err != nil {
+		return false, fmt.Errorf("failed to lock tenant: %w", err)
+	}
+	return hasLegalHold(tx, tenantID)
+}
+
+// hasLegalHold reports whether a legal hold on the tenant is in effect
+func hasLegalHold(db *gorm.DB, tenantID uuid.UUID) (bool, error) {
+	var held bool
+	err := db.Raw("SELECT EXISTS (SELECT 1 FROM legal_holds WHERE tenant_id = ? AND released_at IS NULL)", tenantID).
+		Scan(&held).Error
+	if err != nil {
+		return false, fmt.Errorf("failed to check legal holds: %w", err)
+	}
+	return held, nil
+}
+
+// handlePlaceLegalHold preserves the tenant's data until the hold is released: user
+// erasures wait, and neither location retention nor a scheduled purge deletes anything
+// (admin only)
+func handlePlaceLegalHold(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req models.PlaceLegalHoldRequest
+		if !validation.BindJSON(c, &req) {
+			return
+		}
+
+		tenant, ok := loadTenant(c, db)
+		if !ok {
+			return
+		}
+		if tenant.Status == models.TenantStatusDeleted {
+			utils.CodedErrorResponse(c, utils.CodeTenantDeleted, "Deleted tenants have no data to hold", map[string]interface{}{
+				"current_status": tenant.Status,
+			})
+			return
+		}
+
+		actor := audit.FromContext(c)
+		log := logger.FromContext(c).WithField("tenant_id", tenant.ID)
+		hold := models.LegalHold{
+			ID:       uuid.New(),
+			TenantID: tenant.ID,
+			Reason:   req.Reason,
+			PlacedBy: actor.ID,
+		}
+		if req.Reference != "" {
+			hold.Reference = &req.Reference
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			// Waits for erasures and purges already deleting the tenant's data to commit
+			var locked models.Tenant
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", tenant.ID).First(&locked).Error; err != nil {
+				return fmt.Errorf("failed to lock tenant: %w", err)
+			}
+			if err := tx.Create(&hold).Error; err != nil {
+				return err
+			}
+
+			event := actor.Event(audit.LegalHoldPlaced, tenant.ID, audit.TargetLegalHold, hold.ID.String())
+			event.Metadata["reason"] = hold.Reason
+			if hold.Reference != nil {
+				event.Metadata["reference"] = *hold.Reference
+			}
+			return audit.Record(tx, event)
+		})
+		if err != nil {
+			log.WithError(err).Error("Failed to place legal hold")
+			utils.InternalServerErrorResponse(c, "Failed to place legal hold")
+			return
+		}
+
+		log.WithField("hold_id", hold.ID).Info("Legal hold placed")
+		utils.CreatedResponse(c, "Legal hold placed", hold)
+	}
+}
+
+// handleGetLegalHolds lists the tenant's legal holds, newest first (admin only)
+func handleGetLegalHolds(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var holds []models.LegalHold
+		if err := db.Where("tenant_id = ?", c.Param("id")).Order("created_at DESC").Find(&holds).Error; err != nil {
+			logger.FromContext(c).WithError(err).Error("Failed to fetch legal holds")
+			utils.InternalServerErrorResponse(c, "Failed to fetch legal holds")
+			return
+		}
+
+		utils.OKResponse(c, "Legal holds retrieved successfully", holds)
+	}
+}
+
+// handleReleaseLegalHold ends a legal hold. Once the tenant has no hold in effect, held
+// erasures go ahead and retention and purges resume (admin only).
+func handleReleaseLegalHold(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		holdID, err := uuid.Parse(c.Param("hold_id"))
+		if err != nil {
+			utils.NotFoundResponse(c, "Legal hold not found")
+			return
+		}
+
+		actor := audit.FromContext(c)
+		log := logger.FromContext(c).WithField("tenant_id", c.Param("id"))
+
+		var hold models.LegalHold
+		err = db.Transaction(func(tx *gorm.DB) error {
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("id = ? AND tenant_id = ?", holdID, c.Param("id")).
+				First(&hold).Error
+			if err != nil {
+				return err
+			}
+			if !hold.IsActive() {
+				return errLegalHoldReleased
+			}
+
+			previous := hold
+			releasedAt := time.Now().UTC().Truncate(time.Microsecond)
+			hold.ReleasedAt = &releasedAt
+			hold.ReleasedBy = &actor.ID
+			if err := tx.Save(&hold).Error; err != nil {
+				return fmt.Errorf("failed to release legal hold: %w", err)
+			}
+
+			event := actor.Event(audit.LegalHoldReleased, hold.TenantID, audit.TargetLegalHold, hold.ID.String())
+			event.Changes = audit.Diff(previous, hold)
+			return audit.Record(tx, event)
+		})
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			utils.NotFoundResponse(c, "Legal hold not found")
+			return
+		case errors.Is(err, errLegalHoldReleased):
+			utils.CodedErrorResponse(c, utils.CodeConflict, "Legal hold has already been released", map[string]interface{}{
+				"released_at": hold.ReleasedAt,
+			})
+			return
+		case err != nil:
+			log.WithError(err).Error("Failed to release legal hold")
+			utils.InternalServerErrorResponse(c, "Failed to release legal hold")
+			return
+		}
+
+		log.WithField("hold_id", hold.ID).Info("Legal hold released")
+		utils.OKResponse(c, "Legal hold released", hold)
+	}
+}
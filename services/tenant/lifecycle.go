@@ -0,0 +1,296 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/pavitra93/go-multi-tenant-system/shared/audit"
+	"github.com/pavitra93/go-multi-tenant-system/shared/logger"
+	"github.com/pavitra93/go-multi-tenant-system/shared/metering"
+	"github.com/pavitra93/go-multi-tenant-system/shared/middleware"
+	"github.com/pavitra93/go-multi-tenant-system/shared/models"
+	"github.com/pavitra93/go-multi-tenant-system/shared/quota"
+	"github.com/pavitra93/go-multi-tenant-system/shared/utils"
+	"github.com/pavitra93/go-multi-tenant-system/shared/validation"
+)
+
+// transitionError is returned when a tenant cannot move from its current status to the requested one
+type transitionError struct {
+	current   models.TenantStatus
+	requested models.TenantStatus
+}
+
+func (e *transitionError) Error() string {
+	return fmt.Sprintf("tenant cannot move from %s to %s", e.current, e.requested)
+}
+
+// statusActions are the audit actions of moving a tenant to each status
+var statusActions = map[models.TenantStatus]audit.Action{
+	models.TenantStatusActive:          audit.TenantReactivated,
+	models.TenantStatusSuspended:       audit.TenantSuspended,
+	models.TenantStatusPendingDeletion: audit.TenantDeletionScheduled,
+}
+
+// tenantLifecycle applies tenant status changes and their side effects
+type tenantLifecycle struct {
+	db          *gorm.DB
+	quotas      *quota.Enforcer
+	baseDomain  string
+	gracePeriod time.Duration
+}
+
+// newTenantLifecycle creates the lifecycle used by the tenant handlers
+func newTenantLifecycle(db *gorm.DB, quotas *quota.Enforcer, baseDomain string, gracePeriod time.Duration) *tenantLifecycle {
+	return &tenantLifecycle{
+		db:          db,
+		quotas:      quotas,
+		baseDomain:  baseDomain,
+		gracePeriod: gracePeriod,
+	}
+}
+
+// changeStatus moves tenant to next, writing edits (column to value) along with the status.
+// The tenant row is locked while its current status is checked and only the lifecycle columns
+// and edits are written, so concurrent changes neither race the check nor overwrite each other;
+// tenant is reloaded afterwards. Leaving active ends the tenant's tracking sessions and revokes
+// its users' tokens.
+func (l *tenantLifecycle) changeStatus(log *logrus.Entry, tenant *models.Tenant, next models.TenantStatus, reason *string, actor audit.Actor, edits map[string]interface{}) error {
+	now := time.Now()
+	var wasActive bool
+	var cancelled []models.LocationSession
+	err := l.db.Transaction(func(tx *gorm.DB) error {
+		var previous models.Tenant
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", tenant.ID).First(&previous).Error; err != nil {
+			return fmt.Errorf("failed to lock tenant: %w", err)
+		}
+		if !previous.Status.CanTransitionTo(next) {
+			return &transitionError{current: previous.Status, requested: next}
+		}
+		wasActive = previous.Status == models.TenantStatusActive
+
+		columns := lifecycleColumns(next, reason, actor, now, l.gracePeriod)
+		for column, value := range edits {
+			columns[column] = value
+		}
+		if err := tx.Model(&models.Tenant{}).Where("id = ?", tenant.ID).Updates(columns).Error; err != nil {
+			return fmt.Errorf("failed to update tenant: %w", err)
+		}
+
+		var updated models.Tenant
+		if err := tx.Where("id = ?", tenant.ID).First(&updated).Error; err != nil {
+			return fmt.Errorf("failed to reload tenant: %w", err)
+		}
+		*tenant = updated
+
+		event := actor.Event(statusActions[next], tenant.ID, audit.TargetTenant, tenant.ID.String())
+		event.Changes = audit.Diff(previous, updated)
+		if err := audit.Record(tx, event); err != nil {
+			return err
+		}
+
+		if wasActive {
+			err := tx.Model(&cancelled).Clauses(clause.Returning{}).
+				Where("tenant_id = ? AND status = ?", tenant.ID, models.SessionStatusActive).
+				Updates(map[string]interface{}{"status": models.SessionStatusCancelled, "ended_at": now}).Error
+			if err != nil {
+				return fmt.Errorf("failed to end tracking sessions: %w", err)
+			}
+
+			// Cancelled sessions are billed up to now, like stopped ones
+			events := make([]metering.Event, 0, len(cancelled))
+			for i := range cancelled {
+				events = append(events, metering.SessionEnded(&cancelled[i], cancelled[i].Duration))
+			}
+			return metering.Record(tx, events...)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Every service re-reads the status on its next request
+	middleware.InvalidateTenantStatus(tenant.ID)
+	middleware.InvalidateTenantHostCache(tenant, l.baseDomain)
+	if wasActive {
+		// Cancelled tracking sessions stop counting against the concurrent session limit
+		l.quotas.Invalidate(context.Background(), tenant.ID)
+
+		// Location updates look active sessions up in Redis before the database
+		for _, session := range cancelled {
+			if err := utils.CacheDelete(fmt.Sprintf("session:active:%s", session.ID)); err != nil {
+				log.WithError(err).WithField("session_id", session.ID).Warn("Failed to invalidate cancelled session cache")
+			}
+		}
+
+		revoked, err := utils.RevokeTenantSessions(tenant.ID)
+		if err != nil {
+			// Remaining sessions are still rejected by the status check in AuthMiddleware
+			log.WithError(err).Warn("Failed to revoke tenant sessions")
+		}
+		log = log.WithField("sessions_revoked", revoked)
+
+		event := actor.Event(audit.SessionRevoked, tenant.ID, audit.TargetTenant, tenant.ID.String())
+		event.Metadata["sessions_revoked"] = revoked
+		event.Metadata["cause"] = statusActions[next]
+		if err := audit.Record(l.db, event); err != nil {
+			log.WithError(err).Warn("Failed to audit tenant session revocation")
+		}
+	}
+
+	log.WithFields(logrus.Fields{
+		"tenant_id": tenant.ID,
+		"status":    next,
+		"actor":     actor.ID,
+	}).Info("Tenant status changed")
+	return nil
+}
+
+// lifecycleColumns are the tenant columns moving to next at now sets
+func lifecycleColumns(next models.TenantStatus, reason *string, actor audit.Actor, now time.Time, gracePeriod time.Duration) map[string]interface{} {
+	columns := map[string]interface{}{
+		"status":        next,
+		"is_active":     next == models.TenantStatusActive, // Kept in step as by Tenant.SetStatus
+		"status_reason": reason,
+	}
+
+	switch next {
+	case models.TenantStatusActive:
+		// Reactivation also cancels a pending deletion
+		columns["suspended_at"] = nil
+		columns["deletion_requested_at"] = nil
+		columns["deletion_requested_by"] = nil
+		columns["purge_after"] = nil
+	case models.TenantStatusSuspended:
+		columns["suspended_at"] = now
+	case models.TenantStatusPendingDeletion:
+		columns["deletion_requested_at"] = now
+		columns["deletion_requested_by"] = actor.ID
+		columns["purge_after"] = now.Add(gracePeriod)
+	}
+	return columns
+}
+
+// statusChangeErrorResponse writes the error for a failed status change of tenantID
+func statusChangeErrorResponse(c *gin.Context, tenantID uuid.UUID, err error) {
+	var transition *transitionError
+	if errors.As(err, &transition) {
+		utils.CodedErrorResponse(c, utils.CodeInvalidTenantTransition, fmt.Sprintf("Tenant cannot move from %s to %s", transition.current, transition.requested), map[string]interface{}{
+			"current_status":   transition.current,
+			"requested_status": transition.requested,
+		})
+		return
+	}
+	logger.FromContext(c).WithError(err).WithField("tenant_id", tenantID).Error("Failed to change tenant status")
+	utils.InternalServerErrorResponse(c, "Failed to update tenant status")
+}
+
+// loadTenant fetches the tenant named by the :id parameter, writing the error response if it can't
+func loadTenant(c *gin.Context, db *gorm.DB) (*models.Tenant, bool) {
+	var tenant models.Tenant
+	if err := db.Where("id = ?", c.Param("id")).First(&tenant).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.CodedErrorResponse(c, utils.CodeTenantNotFound, "Tenant not found", nil)
+		} else {
+			utils.InternalServerErrorResponse(c, "Failed to fetch tenant")
+		}
+		return nil, false
+	}
+	return &tenant, true
+}
+
+// handleSuspendTenant suspends a tenant, signing out its users (admin only)
+func handleSuspendTenant(lifecycle *tenantLifecycle) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// The body is optional
+		var req models.SuspendTenantRequest
+		if c.Request.ContentLength != 0 && !validation.BindJSON(c, &req) {
+			return
+		}
+
+		tenant, ok := loadTenant(c, lifecycle.db)
+		if !ok {
+			return
+		}
+
+		var reason *string
+		if req.Reason != "" {
+			reason = &req.Reason
+		}
+
+		log := logger.FromContext(c)
+		if err := lifecycle.changeStatus(log, tenant, models.TenantStatusSuspended, reason, audit.FromContext(c), nil); err != nil {
+			statusChangeErrorResponse(c, tenant.ID, err)
+			return
+		}
+
+		utils.OKResponse(c, "Tenant suspended successfully", tenant)
+	}
+}
+
+// handleReactivateTenant reactivates a suspended tenant or cancels a pending deletion (admin only)
+func handleReactivateTenant(lifecycle *tenantLifecycle) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tenant, ok := loadTenant(c, lifecycle.db)
+		if !ok {
+			return
+		}
+
+		log := logger.FromContext(c)
+		if err := lifecycle.changeStatus(log, tenant, models.TenantStatusActive, nil, audit.FromContext(c), nil); err != nil {
+			statusChangeErrorResponse(c, tenant.ID, err)
+			return
+		}
+
+		utils.OKResponse(c, "Tenant reactivated successfully", tenant)
+	}
+}
+
+// handleDeleteTenant schedules a tenant for deletion after the grace period (admin only).
+// Access ends immediately; data is purged by the TenantPurger once the grace period ends.
+func handleDeleteTenant(lifecycle *tenantLifecycle) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tenant, ok := loadTenant(c, lifecycle.db)
+		if !ok {
+			return
+		}
+
+		log := logger.FromContext(c)
+		if err := lifecycle.changeStatus(log, tenant, models.TenantStatusPendingDeletion, nil, audit.FromContext(c), nil); err != nil {
+			statusChangeErrorResponse(c, tenant.ID, err)
+			return
+		}
+
+		utils.SuccessResponse(c, http.StatusAccepted, "Tenant scheduled for deletion", models.DeleteTenantResponse{
+			Tenant:     *tenant,
+			PurgeAfter: *tenant.PurgeAfter,
+			Message:    "Reactivate the tenant before purge_after to cancel the deletion",
+		})
+	}
+}
+
+// handleGetDeletionReport returns the signed completion report of a purged tenant (admin only)
+func handleGetDeletionReport(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var report models.TenantDeletionReport
+		if err := db.Where("tenant_id = ?", c.Param("id")).First(&report).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				utils.NotFoundResponse(c, "No deletion report for this tenant; it has not been purged")
+			} else {
+				utils.InternalServerErrorResponse(c, "Failed to fetch deletion report")
+			}
+			return
+		}
+
+		utils.OKResponse(c, "Deletion report retrieved successfully", report)
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"github.com/pavitra93/go-multi-tenant-system/shared/audit"
+	"github.com/pavitra93/go-multi-tenant-system/shared/models"
+	"github.com/pavitra93/go-multi-tenant-system/shared/quota"
+	"github.com/pavitra93/go-multi-tenant-system/shared/testdb"
+	"github.com/pavitra93/go-multi-tenant-system/shared/utils"
+)
+
+// testActor is the admin the tests change tenants as
+var testActor = audit.Actor{ID: "admin-1", Role: "admin"}
+
+// testTx returns a transaction on the test database that is rolled back when the test ends,
+// with the shared Redis client pointed at an in-memory server
+func testTx(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	tx := testdb.Tx(t)
+
+	server := miniredis.RunT(t)
+	previous := utils.RedisClient
+	utils.RedisClient = redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() {
+		utils.RedisClient.Close()
+		utils.RedisClient = previous
+	})
+	return tx
+}
+
+// createTestTenant stores an active tenant with an owner and returns both
+func createTestTenant(t *testing.T, tx *gorm.DB) (*models.Tenant, *models.User) {
+	t.Helper()
+
+	id := uuid.New()
+	tenant := &models.Tenant{ID: id, Name: "Test " + id.String()[:8], Domain: id.String() + ".example.com", Status: models.TenantStatusActive, IsActive: true, PlanID: "free"}
+	if err := tx.Create(tenant).Error; err != nil {
+		t.Fatal(err)
+	}
+	owner := &models.User{CognitoID: "owner-" + id.String(), TenantID: id, Role: models.RoleTenantOwner}
+	if err := tx.Create(owner).Error; err != nil {
+		t.Fatal(err)
+	}
+	return tenant, owner
+}
+
+// testLog is the log entry the tests pass to the code under test
+func testLog() *logrus.Entry {
+	return logrus.NewEntry(logrus.New())
+}
+
+// newTestLifecycle returns a lifecycle working in tx
+func newTestLifecycle(tx *gorm.DB) *tenantLifecycle {
+	return newTenantLifecycle(tx, quota.NewEnforcer(tx, utils.RedisClient), "", 30*24*time.Hour)
+}
+
+// TestChangeStatusCancelsActiveSessions takes tenants with a tracking session in progress
+// out of active against a real database.
+func TestChangeStatusCancelsActiveSessions(t *testing.T) {
+	tests := []struct {
+		name string
+		next models.TenantStatus
+	}{
+		{name: "suspend", next: models.TenantStatusSuspended},
+		{name: "schedule deletion", next: models.TenantStatusPendingDeletion},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx := testTx(t)
+			tenant, owner := createTestTenant(t, tx)
+			session := &models.LocationSession{TenantID: tenant.ID, CognitoUserID: owner.CognitoID, Status: models.SessionStatusActive, StartedAt: time.Now().Add(-time.Minute), Duration: 600}
+			if err := tx.Create(session).Error; err != nil {
+				t.Fatal(err)
+			}
+
+			lifecycle := newTestLifecycle(tx)
+			if err := lifecycle.changeStatus(testLog(), tenant, tt.next, nil, testActor, nil); err != nil {
+				t.Fatalf("changeStatus() error = %v", err)
+			}
+
+			var stored models.Tenant
+			if err := tx.Where("id = ?", tenant.ID).First(&stored).Error; err != nil {
+				t.Fatal(err)
+			}
+			if stored.Status != tt.next {
+				t.Errorf("tenant status = %q, want %q", stored.Status, tt.next)
+			}
+
+			var cancelled models.LocationSession
+			if err := tx.Where("id = ?", session.ID).First(&cancelled).Error; err != nil {
+				t.Fatal(err)
+			}
+			if cancelled.Status != models.SessionStatusCancelled {
+				t.Errorf("session status = %q, want %q", cancelled.Status, models.SessionStatusCancelled)
+			}
+			if cancelled.EndedAt == nil {
+				t.Error("session ended_at not set")
+			}
+		})
+	}
+}
+
+// TestChangeStatusChecksStoredStatus changes tenants through copies loaded before another
+// change was stored, and checks the stored status is the one checked and other columns are
+// kept.
+func TestChangeStatusChecksStoredStatus(t *testing.T) {
+	tests := []struct {
+		name        string
+		stored      models.TenantStatus // Status stored after the stale copy was loaded
+		next        models.TenantStatus
+		wantCurrent models.TenantStatus // Status the transition error reports; empty if allowed
+	}{
+		{name: "suspended meanwhile", stored: models.TenantStatusSuspended, next: models.TenantStatusSuspended, wantCurrent: models.TenantStatusSuspended},
+		{name: "reactivated meanwhile", stored: models.TenantStatusActive, next: models.TenantStatusActive, wantCurrent: models.TenantStatusActive},
+		{name: "deletion scheduled meanwhile", stored: models.TenantStatusPendingDeletion, next: models.TenantStatusSuspended, wantCurrent: models.TenantStatusPendingDeletion},
+		{name: "allowed from stored status", stored: models.TenantStatusSuspended, next: models.TenantStatusActive},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx := testTx(t)
+			tenant, _ := createTestTenant(t, tx)
+			if tt.stored == models.TenantStatusActive {
+				// The stale copy must look suspended for reactivating it to be attempted
+				tenant.SetStatus(models.TenantStatusSuspended)
+			}
+			stale := *tenant
+
+			err := tx.Model(&models.Tenant{}).Where("id = ?", tenant.ID).Updates(map[string]interface{}{
+				"name":      "Renamed",
+				"status":    tt.stored,
+				"is_active": tt.stored == models.TenantStatusActive,
+			}).Error
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = newTestLifecycle(tx).changeStatus(testLog(), &stale, tt.next, nil, testActor, nil)
+			if tt.wantCurrent != "" {
+				var transition *transitionError
+				if !errors.As(err, &transition) {
+					t.Fatalf("changeStatus() error = %v, want a transition error", err)
+				}
+				if transition.current != tt.wantCurrent {
+					t.Errorf("transition error current status = %q, want %q", transition.current, tt.wantCurrent)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("changeStatus() error = %v", err)
+			}
+			if stale.Status != tt.next {
+				t.Errorf("tenant status = %q, want %q", stale.Status, tt.next)
+			}
+			if stale.Name != "Renamed" {
+				t.Errorf("tenant name = %q, want the name stored meanwhile", stale.Name)
+			}
+		})
+	}
+}
@@ -1,77 +1,233 @@
 package main
 
 import (
-	"log"
-	"os"
+	"context"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
+	"github.com/pavitra93/go-multi-tenant-system/shared/blob"
 	"github.com/pavitra93/go-multi-tenant-system/shared/config"
+	"github.com/pavitra93/go-multi-tenant-system/shared/domains"
+	"github.com/pavitra93/go-multi-tenant-system/shared/logger"
+	"github.com/pavitra93/go-multi-tenant-system/shared/metrics"
 	"github.com/pavitra93/go-multi-tenant-system/shared/middleware"
+	"github.com/pavitra93/go-multi-tenant-system/shared/notify"
+	"github.com/pavitra93/go-multi-tenant-system/shared/quota"
+	"github.com/pavitra93/go-multi-tenant-system/shared/server"
+	"github.com/pavitra93/go-multi-tenant-system/shared/settings"
+	"github.com/pavitra93/go-multi-tenant-system/shared/tracing"
 	"github.com/pavitra93/go-multi-tenant-system/shared/utils"
 	"github.com/sirupsen/logrus"
 )
 
 func main() {
-	// Load environment variables
-	if err := godotenv.Load(); err != nil {
+	// Load environment variables before configuring the logger so LOG_LEVEL/LOG_FORMAT apply
+	envErr := godotenv.Load()
+	logger.Init("tenant-service")
+	if envErr != nil {
 		logrus.Warn("No .env file found, using environment variables")
 	}
 
+	// Initialize tracing (no-op exporter unless OTEL_TRACES_EXPORTER is set)
+	shutdownTracing, err := tracing.Init("tenant-service")
+	if err != nil {
+		logrus.WithError(err).Fatal("Failed to initialize tracing")
+	}
+	defer shutdownTracing(context.Background())
+
+	// Load and validate configuration; any problem stops startup
+	var cfg Config
+	if err := config.Load(&cfg); err != nil {
+		logrus.WithError(err).Fatal("Invalid configuration")
+	}
+	metrics.Configure(cfg.Metrics)
+
+	// Cancelled on SIGINT/SIGTERM to begin graceful shutdown
+	ctx, stop := server.SignalContext()
+	defer stop()
+
+	// Metrics are scraped on an internal listener, not the public port
+	metrics.Serve(ctx, cfg.Metrics, cfg.Server)
+
+	// Resolve credentials from the secret provider and refresh them in the background
+	secrets, err := config.NewSecretManager(ctx, cfg.Secrets, &cfg)
+	if err != nil {
+		logrus.WithError(err).Fatal("Failed to load secrets")
+	}
+	go secrets.Run(ctx)
+
 	// Initialize Redis for session management
-	if err := utils.InitRedis(); err != nil {
-		log.Fatal("Failed to connect to Redis:", err)
+	if err := utils.InitRedis(cfg.Redis.Options(secrets)); err != nil {
+		logrus.WithError(err).Fatal("Failed to connect to Redis")
 	}
 	defer utils.CloseRedis()
 
 	// Initialize database
-	db, err := config.ConnectDatabase()
+	db, err := cfg.Database.Connect(secrets)
 	if err != nil {
-		log.Fatal("Failed to connect to database:", err)
+		logrus.WithError(err).Fatal("Failed to connect to database")
 	}
 
-	// Initialize authentication middleware
-	authMiddleware, err := middleware.NewAuthMiddleware(
-		os.Getenv("AWS_REGION"),
-		os.Getenv("COGNITO_USER_POOL_ID"),
-	)
+	// Export connection pool statistics
+	if err := metrics.RegisterDBStats(db, cfg.Database.DBName); err != nil {
+		logrus.Warnf("Failed to register database metrics: %v", err)
+	}
+	if err := metrics.RegisterRedisStats(utils.GetRedisClient()); err != nil {
+		logrus.Warnf("Failed to register Redis metrics: %v", err)
+	}
+
+	// Cognito users are updated with role changes and deleted on removal or tenant purge
+	directory, err := newCognitoDirectory(cfg.Cognito, cfg.CognitoBreaker)
+	if err != nil {
+		logrus.WithError(err).Fatal("Failed to initialize Cognito")
+	}
+
+	// Export archives are kept in the blob store until they expire
+	store, err := blob.New(cfg.Blob)
+	if err != nil {
+		logrus.WithError(err).Fatal("Failed to initialize blob store")
+	}
+
+	// Purge tenants whose deletion grace period has ended
+	purger := NewTenantPurger(db, directory, store, &cfg, secrets)
+	purger.Start(ctx)
+
+	// Build requested tenant exports and delete expired archives
+	exporter := NewTenantExporter(db, store, cfg.Exports)
+	exporter.Start(ctx)
+	exportLinks := newExportLinks(cfg.Exports, secrets)
+
+	// Drop metering ledger rows once their events can no longer repeat
+	pruner := NewUsagePruner(db, cfg.Metering)
+	pruner.Start(ctx)
+
+	// Invitation emails go through the configured notifier
+	notifier, err := notify.New(cfg.Notifier, secrets)
 	if err != nil {
-		log.Fatal("Failed to initialize auth middleware:", err)
+		logrus.WithError(err).Fatal("Failed to initialize notifier")
 	}
+	mailer := newInvitationMailer(db, notifier, cfg.Invitations)
+
+	// Plan quotas are counted in Redis; usage reports read them back
+	quotas := quota.NewEnforcer(db, utils.GetRedisClient())
+
+	// Services read per-tenant overrides through this cache; changes invalidate it
+	tenantSettings := settings.NewStore(db, utils.GetRedisClient())
+
+	// Carry out requested user erasures once their tenant has no legal hold
+	eraser := NewUserEraser(db, directory, quotas, &cfg, secrets)
+	eraser.Start(ctx)
+
+	// Custom domains resolve to their tenant only while verified
+	verifier := domains.NewVerifier(cfg.Domains.Check, domains.NewResolver(cfg.Domains.Check))
+	domainChecker := NewDomainChecker(db, verifier, &cfg)
+	domainChecker.Start(ctx)
+
+	users := newTenantUsers(db, directory, quotas)
+	lifecycle := newTenantLifecycle(db, quotas, cfg.TenantBaseDomain, cfg.Deletion.GracePeriod)
+
+	// Initialize authentication middleware
+	authMiddleware := middleware.NewAuthMiddleware(db)
 
 	// Initialize Gin router
-	router := gin.Default()
+	router := gin.New()
+	router.Use(gin.Recovery(), logger.RequestLogger())
+	router.Use(middleware.RequestTracing("tenant-service"))
+	router.Use(metrics.HTTPMiddleware("tenant-service"))
 
 	// Health check endpoint
 	router.GET("/health", func(c *gin.Context) {
 		utils.OKResponse(c, "Tenant service is healthy", nil)
 	})
 
+	// Redacted configuration (admin only); exposed through the gateway's /admin/config/tenant-service
+	router.GET("/admin/config", authMiddleware.RequireAuth(), authMiddleware.RequireRole("admin"), config.DumpHandler("tenant-service", &cfg))
+
 	// Tenant management routes
 	tenants := router.Group("/tenants")
 	tenants.Use(authMiddleware.RequireAuth())
 	{
 		// Admin-only routes (platform management)
-		tenants.POST("/", authMiddleware.RequireRole("admin"), handleCreateTenant(db))
+		tenants.POST("/", authMiddleware.RequireRole("admin"), handleCreateTenant(db, cfg.TenantBaseDomain))
 		tenants.GET("/", authMiddleware.RequireRole("admin"), handleGetTenants(db))
+		tenants.GET("/stats", authMiddleware.RequireRole("admin"), handleListTenantStats(db))
+		tenants.GET("/audit", authMiddleware.RequireRole("admin"), handleListAuditEvents(db))
+		tenants.GET("/audit/export", authMiddleware.RequireRole("admin"), handleExportAuditEvents(db))
 
 		// Tenant-specific routes
 		tenants.GET("/:id", authMiddleware.RequireTenantAccess(), handleGetTenant(db))
-		tenants.PUT("/:id", authMiddleware.RequireTenantOwnerOrAdmin(), handleUpdateTenant(db))
+		tenants.PUT("/:id", authMiddleware.RequireTenantOwnerOrAdmin(), handleUpdateTenant(db, lifecycle))
+
+		// Lifecycle (admin only)
+		tenants.POST("/:id/suspend", authMiddleware.RequireRole("admin"), handleSuspendTenant(lifecycle))
+		tenants.POST("/:id/reactivate", authMiddleware.RequireRole("admin"), handleReactivateTenant(lifecycle))
+		tenants.DELETE("/:id", authMiddleware.RequireRole("admin"), handleDeleteTenant(lifecycle))
+		tenants.GET("/:id/deletion-report", authMiddleware.RequireRole("admin"), handleGetDeletionReport(db))
+
+		// Plans and quotas
+		tenants.PUT("/:id/plan", authMiddleware.RequireRole("admin"), handleChangePlan(db, quotas))
+		tenants.GET("/:id/usage", authMiddleware.RequireTenantOwnerOrAdmin(), handleGetTenantUsage(db, quotas))
+		tenants.GET("/:id/stats", authMiddleware.RequireTenantOwnerOrAdmin(), handleGetTenantStats(db))
+
+		// Settings (tenant owners read them, admins change them)
+		tenants.GET("/:id/settings", authMiddleware.RequireTenantOwnerOrAdmin(), handleGetTenantSettings(db))
+		tenants.PUT("/:id/settings", authMiddleware.RequireRole("admin"), handleUpdateTenantSettings(db, tenantSettings))
+		tenants.GET("/:id/settings/history", authMiddleware.RequireTenantOwnerOrAdmin(), handleGetTenantSettingsHistory(db))
+
+		// Audit log (tenant owners see their tenant's events)
+		tenants.GET("/:id/audit", authMiddleware.RequireTenantOwnerOrAdmin(), handleGetTenantAuditEvents(db))
+		tenants.GET("/:id/audit/export", authMiddleware.RequireTenantOwnerOrAdmin(), handleExportTenantAuditEvents(db))
+
+		// Data exports (tenant owners download their tenant's data)
+		tenants.POST("/:id/exports", authMiddleware.RequireTenantOwnerOrAdmin(), handleCreateTenantExport(db))
+		tenants.GET("/:id/exports", authMiddleware.RequireTenantOwnerOrAdmin(), handleGetTenantExports(db, exportLinks))
+		tenants.GET("/:id/exports/:export_id", authMiddleware.RequireTenantOwnerOrAdmin(), handleGetTenantExport(db, exportLinks))
+
+		// Custom domain verification (tenant owner or admin)
+		tenants.GET("/:id/domain", authMiddleware.RequireTenantOwnerOrAdmin(), handleGetTenantDomain(db, verifier))
+		tenants.POST("/:id/domain/verify", authMiddleware.RequireTenantOwnerOrAdmin(), handleVerifyTenantDomain(db, domainChecker))
+
+		// Legal holds (admin only)
+		tenants.POST("/:id/legal-holds", authMiddleware.RequireRole("admin"), handlePlaceLegalHold(db))
+		tenants.GET("/:id/legal-holds", authMiddleware.RequireRole("admin"), handleGetLegalHolds(db))
+		tenants.DELETE("/:id/legal-holds/:hold_id", authMiddleware.RequireRole("admin"), handleReleaseLegalHold(db))
 
 		// Tenant user management (tenant owner can manage their users)
 		tenants.GET("/:id/users", authMiddleware.RequireTenantOwnerOrAdmin(), handleGetTenantUsers(db))
-		tenants.POST("/:id/users", authMiddleware.RequireTenantOwnerOrAdmin(), handleInviteUserToTenant(db))
+		tenants.POST("/:id/users", authMiddleware.RequireTenantOwnerOrAdmin(), handleInviteUserToTenant(mailer))
+		tenants.PATCH("/:id/users/:cognito_id", authMiddleware.RequireTenantOwnerOrAdmin(), handleUpdateTenantUser(users))
+		tenants.DELETE("/:id/users/:cognito_id", authMiddleware.RequireTenantOwnerOrAdmin(), handleRemoveTenantUser(users))
+		tenants.POST("/:id/transfer-ownership", authMiddleware.RequireTenantOwnerOrAdmin(), handleTransferOwnership(users))
+
+		// User erasure (tenant owner or admin)
+		tenants.POST("/:id/users/:cognito_id/erasure", authMiddleware.RequireTenantOwnerOrAdmin(), handleRequestUserErasure(db))
+		tenants.GET("/:id/erasures", authMiddleware.RequireTenantOwnerOrAdmin(), handleGetUserErasures(db))
+		tenants.GET("/:id/erasures/:erasure_id", authMiddleware.RequireTenantOwnerOrAdmin(), handleGetUserErasure(db))
+
+		// Invitations (tenant owner or admin)
+		tenants.GET("/:id/invitations", authMiddleware.RequireTenantOwnerOrAdmin(), handleGetTenantInvitations(db))
+		tenants.POST("/:id/invitations/:invitation_id/resend", authMiddleware.RequireTenantOwnerOrAdmin(), handleResendInvitation(mailer))
+		tenants.DELETE("/:id/invitations/:invitation_id", authMiddleware.RequireTenantOwnerOrAdmin(), handleRevokeInvitation(db))
 	}
 
-	// Start server
-	port := os.Getenv("TENANT_SERVICE_PORT")
-	if port == "" {
-		port = "8002"
+	// Export downloads are authorized by the link's signature
+	router.GET("/exports/:export_id/download", handleDownloadExport(db, store, exportLinks))
+
+	// Billing exports (admin only)
+	billing := router.Group("/billing")
+	billing.Use(authMiddleware.RequireAuth(), authMiddleware.RequireRole("admin"))
+	{
+		billing.GET("/usage", handleExportUsage(db))
 	}
 
-	logrus.Infof("Tenant service starting on port %s", port)
-	if err := router.Run(":" + port); err != nil {
-		log.Fatal("Failed to start tenant service:", err)
+	// Serve until SIGINT/SIGTERM, then drain in-flight requests
+	runner := server.New("Tenant service", ":"+cfg.Port, router, cfg.Server)
+	runner.OnShutdown("tenant purger", purger.Stop)
+	runner.OnShutdown("usage pruner", pruner.Stop)
+	runner.OnShutdown("tenant exporter", exporter.Stop)
+	runner.OnShutdown("user eraser", eraser.Stop)
+	runner.OnShutdown("domain checker", domainChecker.Stop)
+	if err := runner.Run(ctx); err != nil {
+		logrus.WithError(err).Fatal("Tenant service did not shut down cleanly")
 	}
 }
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"github.com/pavitra93/go-multi-tenant-system/shared/audit"
+	"github.com/pavitra93/go-multi-tenant-system/shared/logger"
+	"github.com/pavitra93/go-multi-tenant-system/shared/models"
+	"github.com/pavitra93/go-multi-tenant-system/shared/quota"
+	"github.com/pavitra93/go-multi-tenant-system/shared/utils"
+	"github.com/pavitra93/go-multi-tenant-system/shared/validation"
+)
+
+// findPlan fetches the plan with id, writing the error response if it can't
+func findPlan(c *gin.Context, db *gorm.DB, id string) (*models.Plan, bool) {
+	var plan models.Plan
+	if err := db.Where("id = ?", id).First(&plan).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.CodedErrorResponse(c, utils.CodeUnknownPlan, "Unknown plan", map[string]interface{}{
+				"plan_id": id,
+			})
+		} else {
+			utils.InternalServerErrorResponse(c, "Failed to fetch plan")
+		}
+		return nil, false
+	}
+	return &plan, true
+}
+
+// handleChangePlan moves a tenant to another plan (admin only). The new limits apply to
+// the next request in every service; usage above a lowered limit is kept but can't grow.
+func handleChangePlan(db *gorm.DB, quotas *quota.Enforcer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req models.ChangePlanRequest
+		if !validation.BindJSON(c, &req) {
+			return
+		}
+
+		tenant, ok := loadTenant(c, db)
+		if !ok {
+			return
+		}
+		if tenant.Status == models.TenantStatusDeleted {
+			utils.CodedErrorResponse(c, utils.CodeInvalidTenantTransition, "Deleted tenants cannot be modified", map[string]interface{}{
+				"current_status": tenant.Status,
+			})
+			return
+		}
+
+		plan, ok := findPlan(c, db, req.PlanID)
+		if !ok {
+			return
+		}
+
+		previous := tenant.PlanID
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(tenant).Update("plan_id", plan.ID).Error; err != nil {
+				return err
+			}
+			event := audit.FromContext(c).Event(audit.TenantPlanChanged, tenant.ID, audit.TargetTenant, tenant.ID.String())
+			event.Changes = audit.Diff(map[string]string{"plan_id": previous}, map[string]string{"plan_id": plan.ID})
+			return audit.Record(tx, event)
+		})
+		if err != nil {
+			logger.FromContext(c).WithError(err).WithField("tenant_id", tenant.ID).Error("Failed to change plan")
+			utils.InternalServerErrorResponse(c, "Failed to change plan")
+			return
+		}
+		quotas.Invalidate(c.Request.Context(), tenant.ID)
+
+		logger.FromContext(c).WithFields(logrus.Fields{
+			"tenant_id":     tenant.ID,
+			"previous_plan": previous,
+			"plan":          plan.ID,
+		}).Info("Tenant plan changed")
+
+		tenant.PlanID = plan.ID
+		tenant.Plan = plan
+		utils.OKResponse(c, "Plan changed successfully", tenant)
+	}
+}
+
+// handleGetTenantUsage reports the tenant's plan and how much of each quota is used
+func handleGetTenantUsage(db *gorm.DB, quotas *quota.Enforcer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tenant, ok := loadTenant(c, db)
+		if !ok {
+			return
+		}
+
+		usage, err := quotas.Usage(c.Request.Context(), tenant.ID)
+		if err != nil {
+			logger.FromContext(c).WithError(err).WithField("tenant_id", tenant.ID).Error("Failed to compute tenant usage")
+			utils.InternalServerErrorResponse(c, "Failed to compute usage")
+			return
+		}
+
+		utils.OKResponse(c, "Usage retrieved successfully", usage)
+	}
+}
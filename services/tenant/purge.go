@@ -0,0 +1,367 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/pavitra93/go-multi-tenant-system/shared/audit"
+	"github.com/pavitra93/go-multi-tenant-system/shared/blob"
+	"github.com/pavitra93/go-multi-tenant-system/shared/config"
+	"github.com/pavitra93/go-multi-tenant-system/shared/middleware"
+	"github.com/pavitra93/go-multi-tenant-system/shared/models"
+	"github.com/pavitra93/go-multi-tenant-system/shared/utils"
+)
+
+// reportSignatureAlgorithm identifies how deletion reports and erasure records are signed
+const reportSignatureAlgorithm = "HMAC-SHA256"
+
+// errSigningKeyMissing stops a purge or erasure that could not produce a signed record
+var errSigningKeyMissing = errors.New("report signing key is not configured")
+
+// userDirectory keeps the identity provider in step with tenant users
+type userDirectory interface {
+	DeleteUser(ctx context.Context, cognitoID string) (bool, error)
+	SetRole(ctx context.Context, cognitoID string, role models.UserRole) error
+}
+
+// TenantPurger permanently deletes the data of tenants whose deletion grace period has ended
+type TenantPurger struct {
+	db         *gorm.DB
+	directory  userDirectory
+	store      blob.Store
+	signingKey *config.Secret
+	baseDomain string
+	interval   time.Duration
+
+	// cancel stops the purge loop; done is closed once it has returned
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewTenantPurger creates a purger that checks for due deletions every cfg.Deletion.PurgeInterval
+func NewTenantPurger(db *gorm.DB, directory userDirectory, store blob.Store, cfg *Config, secrets *config.SecretManager) *TenantPurger {
+	return &TenantPurger{
+		db:         db,
+		directory:  directory,
+		store:      store,
+		signingKey: secrets.Secret(ReportSigningKey),
+		baseDomain: cfg.TenantBaseDomain,
+		interval:   cfg.Deletion.PurgeInterval,
+	}
+}
+
+// Start purges due tenants in the background until ctx is cancelled or Stop is called
+func (p *TenantPurger) Start(ctx context.Context) {
+	ctx, p.cancel = context.WithCancel(ctx)
+	p.done = make(chan struct{})
+
+	go func() {
+		defer close(p.done)
+		p.run(ctx)
+	}()
+}
+
+// Stop cancels the purge loop and waits for the tenant being purged to finish
+func (p *TenantPurger) Stop(ctx context.Context) error {
+	if p.cancel == nil {
+		return nil
+	}
+
+	p.cancel()
+	select {
+	case <-p.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("tenant purger did not stop: %w", ctx.Err())
+	}
+}
+
+// run purges due tenants until ctx is cancelled
+func (p *TenantPurger) run(ctx context.Context) {
+	logrus.Info("Starting tenant purger")
+	defer logrus.Info("Tenant purger stopped")
+
+	for {
+		p.purgeDue(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(p.interval):
+		}
+	}
+}
+
+// purgeDue purges every tenant whose grace period has ended
+func (p *TenantPurger) purgeDue(ctx context.Context) {
+	var tenants []models.Tenant
+	err := p.db.WithContext(ctx).
+		// Purging tenants were claimed by a run that failed part way and are finished here
+		Where("(status = ? AND purge_after <= ?) OR status = ?", models.TenantStatusPendingDeletion, time.Now(), models.TenantStatusPurging).
+		// Purges of tenants under legal hold wait until every hold is released
+		Where("NOT EXISTS (SELECT 1 FROM legal_holds h WHERE h.tenant_id = tenants.id AND h.released_at IS NULL)").
+		Find(&tenants).Error
+	if err != nil {
+		if ctx.Err() == nil {
+			logrus.WithError(err).Error("Error fetching tenants due for purge")
+		}
+		return
+	}
+
+	for i := range tenants {
+		// Finish the tenant in flight, but don't start new ones once shutdown begins
+		if ctx.Err() != nil {
+			return
+		}
+
+		log := logrus.WithField("tenant_id", tenants[i].ID)
+		report, err := p.purgeTenant(ctx, &tenants[i])
+		if errors.Is(err, errLegalHoldActive) {
+			log.Info("Tenant was placed under legal hold; purge postponed")
+			continue
+		}
+		if err != nil {
+			log.WithError(err).Error("Failed to purge tenant; will retry")
+			continue
+		}
+		if report != nil {
+			log.WithFields(logrus.Fields{
+				"locations_deleted":     report.LocationsDeleted,
+				"users_deleted":         report.UsersDeleted,
+				"cognito_users_deleted": report.CognitoUsersDeleted,
+			}).Info("Tenant purged")
+		}
+	}
+}
+
+// purgeTenant claims the tenant by moving it to purging, deletes its Cognito users and export
+// archives, then its rows, and records a signed report. The claim comes first so a tenant
+// reactivated meanwhile keeps its users; Cognito and the blob store go before the rows, so if
+// they fail the next run can find the users and archives again.
+// A nil report means the tenant was reactivated or purged by another instance first;
+// errLegalHoldActive that a legal hold was placed since the tenant was found due.
+func (p *TenantPurger) purgeTenant(ctx context.Context, tenant *models.Tenant) (*models.TenantDeletionReport, error) {
+	signingKey := p.signingKey.Value()
+	if signingKey == "" {
+		return nil, errSigningKeyMissing
+	}
+
+	startedAt := time.Now().UTC().Truncate(time.Microsecond)
+
+	claimed, err := p.claim(ctx, tenant)
+	if err != nil || !claimed {
+		return nil, err
+	}
+
+	var cognitoIDs []string
+	if err := p.db.WithContext(ctx).Model(&models.User{}).Where("tenant_id = ?", tenant.ID).Pluck("cognito_id", &cognitoIDs).Error; err != nil {
+		return nil, fmt.Errorf("failed to list tenant users: %w", err)
+	}
+
+	var cognitoDeleted int64
+	for _, cognitoID := range cognitoIDs {
+		deleted, err := p.directory.DeleteUser(ctx, cognitoID)
+		if err != nil {
+			return nil, err
+		}
+		if deleted {
+			cognitoDeleted++
+		}
+	}
+
+	// Export archives hold a copy of everything being purged
+	var blobKeys []string
+	err = p.db.WithContext(ctx).Model(&models.TenantExport{}).
+		Where("tenant_id = ? AND blob_key IS NOT NULL AND blob_key <> ''", tenant.ID).
+		Pluck("blob_key", &blobKeys).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tenant exports: %w", err)
+	}
+	for _, key := range blobKeys {
+		if err := p.store.Delete(ctx, key); err != nil {
+			return nil, err
+		}
+	}
+
+	// Sessions were revoked when deletion was requested; sweep any created since
+	revoked, err := utils.RevokeTenantSessions(tenant.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &models.TenantDeletionReport{
+		ID:                   uuid.New(),
+		TenantID:             tenant.ID,
+		TenantName:           tenant.Name,
+		TenantDomain:         tenant.Domain,
+		DeletionRequestedAt:  tenant.DeletionRequestedAt,
+		DeletionRequestedBy:  tenant.DeletionRequestedBy,
+		StartedAt:            startedAt,
+		CognitoUsersDeleted:  cognitoDeleted,
+		TokenSessionsRevoked: revoked,
+		SignatureAlgorithm:   reportSignatureAlgorithm,
+	}
+
+	err = p.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Lock the tenant so concurrent instances purge it once
+		var locked models.Tenant
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND status = ?", tenant.ID, models.TenantStatusPurging).
+			First(&locked).Error
+		if err != nil {
+			return err
+		}
+		// Placing a hold locks the tenant too, so one placed before this point is seen here
+		held, err := hasLegalHold(tx, tenant.ID)
+		if err != nil {
+			return err
+		}
+		if held {
+			return errLegalHoldActive
+		}
+
+		result := tx.Unscoped().Where("tenant_id = ?", tenant.ID).Delete(&models.Location{})
+		if result.Error != nil {
+			return fmt.Errorf("failed to delete locations: %w", result.Error)
+		}
+		report.LocationsDeleted = result.RowsAffected
+
+		result = tx.Unscoped().Where("tenant_id = ?", tenant.ID).Delete(&models.LocationSession{})
+		if result.Error != nil {
+			return fmt.Errorf("failed to delete location sessions: %w", result.Error)
+		}
+		report.LocationSessionsDeleted = result.RowsAffected
+
+		result = tx.Exec("DELETE FROM failed_location_updates WHERE tenant_id = ?", tenant.ID)
+		if result.Error != nil {
+			return fmt.Errorf("failed to delete failed location updates: %w", result.Error)
+		}
+		report.FailedUpdatesDeleted = result.RowsAffected
+
+		// Deleting the exports also stops one being built; its archive is discarded
+		if err := tx.Where("tenant_id = ?", tenant.ID).Delete(&models.TenantExport{}).Error; err != nil {
+			return fmt.Errorf("failed to delete tenant exports: %w", err)
+		}
+
+		result = tx.Where("tenant_id = ?", tenant.ID).Delete(&models.Invitation{})
+		if result.Error != nil {
+			return fmt.Errorf("failed to delete invitations: %w", result.Error)
+		}
+		report.InvitationsDeleted = result.RowsAffected
+
+		result = tx.Where("tenant_id = ?", tenant.ID).Delete(&models.User{})
+		if result.Error != nil {
+			return fmt.Errorf("failed to delete users: %w", result.Error)
+		}
+		report.UsersDeleted = result.RowsAffected
+
+		// The tenant row stays as a tombstone; its domain and slug become free to reuse
+		completedAt := time.Now().UTC().Truncate(time.Microsecond)
+		previous := locked
+		locked.SetStatus(models.TenantStatusDeleted)
+		locked.PurgedAt = &completedAt
+		if err := tx.Save(&locked).Error; err != nil {
+			return fmt.Errorf("failed to mark tenant deleted: %w", err)
+		}
+
+		report.CompletedAt = completedAt
+		if report.Signature, err = signRecord(report, signingKey); err != nil {
+			return err
+		}
+		if err := tx.Create(report).Error; err != nil {
+			return fmt.Errorf("failed to store deletion report: %w", err)
+		}
+
+		// Audit events outlive the tenant; they are how the purge is traced afterwards
+		event := audit.System(ctx).Event(audit.TenantPurged, tenant.ID, audit.TargetTenant, tenant.ID.String())
+		event.Changes = audit.Diff(previous, locked)
+		event.Metadata["deletion_report_id"] = report.ID
+		event.Metadata["users_deleted"] = report.UsersDeleted
+		event.Metadata["locations_deleted"] = report.LocationsDeleted
+		return audit.Record(tx, event)
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	middleware.InvalidateTenantStatus(tenant.ID)
+	middleware.InvalidateTenantHostCache(tenant, p.baseDomain)
+	return report, nil
+}
+
+// claim moves a due tenant pending deletion to purging, after which it can't be reactivated.
+// A tenant already purging is claimed again, so a purge that failed part way is finished.
+// It reports false if the tenant was reactivated, or had its deletion rescheduled, meanwhile;
+// errLegalHoldActive if a legal hold was placed.
+func (p *TenantPurger) claim(ctx context.Context, tenant *models.Tenant) (bool, error) {
+	var claimed bool
+	err := p.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Status changes and placing a hold lock the tenant too, so neither can slip in before the claim
+		var locked models.Tenant
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ?", tenant.ID).
+			Where("(status = ? AND purge_after <= ?) OR status = ?", models.TenantStatusPendingDeletion, time.Now(), models.TenantStatusPurging).
+			First(&locked).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to lock tenant: %w", err)
+		}
+		held, err := hasLegalHold(tx, tenant.ID)
+		if err != nil {
+			return err
+		}
+		if held {
+			return errLegalHoldActive
+		}
+
+		claimed = true
+		if locked.Status == models.TenantStatusPurging {
+			return nil
+		}
+		err = tx.Model(&models.Tenant{}).Where("id = ?", tenant.ID).
+			Updates(map[string]interface{}{"status": models.TenantStatusPurging, "is_active": false}).Error
+		if err != nil {
+			return fmt.Errorf("failed to claim tenant for purge: %w", err)
+		}
+		tenant.SetStatus(models.TenantStatusPurging)
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	if claimed {
+		middleware.InvalidateTenantStatus(tenant.ID)
+	}
+	return claimed, nil
+}
+
+// signedRecord is a completion record signed with the report signing key
+type signedRecord interface {
+	SigningPayload() ([]byte, error)
+}
+
+// signRecord returns the hex HMAC-SHA256 of the record's signing payload
+func signRecord(record signedRecord, key string) (string, error) {
+	payload, err := record.SigningPayload()
+	if err != nil {
+		return "", fmt.Errorf("failed to encode signed record: %w", err)
+	}
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
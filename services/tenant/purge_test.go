@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/pavitra93/go-multi-tenant-system/shared/blob"
+	"github.com/pavitra93/go-multi-tenant-system/shared/config"
+	"github.com/pavitra93/go-multi-tenant-system/shared/models"
+)
+
+// fakeDirectory records the Cognito users deleted
+type fakeDirectory struct {
+	deleted []string
+}
+
+func (d *fakeDirectory) DeleteUser(_ context.Context, cognitoID string) (bool, error) {
+	d.deleted = append(d.deleted, cognitoID)
+	return true, nil
+}
+
+func (d *fakeDirectory) SetRole(context.Context, string, models.UserRole) error {
+	return nil
+}
+
+// newTestPurger returns a purger working in tx with a fake directory
+func newTestPurger(t *testing.T, tx *gorm.DB) (*TenantPurger, *fakeDirectory) {
+	directory := &fakeDirectory{}
+	return &TenantPurger{
+		db:         tx,
+		directory:  directory,
+		store:      &blob.LocalStore{Dir: t.TempDir()},
+		signingKey: config.NewStaticSecret(ReportSigningKey, "test-signing-key"),
+	}, directory
+}
+
+// TestPurgeTenantClaimsFirst purges tenants found due whose deletion may have been cancelled
+// since, against a real database.
+func TestPurgeTenantClaimsFirst(t *testing.T) {
+	tests := []struct {
+		name       string
+		reactivate bool // Reactivate the tenant after it was found due
+		wantPurged bool
+	}{
+		{name: "still pending deletion", wantPurged: true},
+		{name: "reactivated since", reactivate: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx := testTx(t)
+			tenant, owner := createTestTenant(t, tx)
+			lifecycle := newTestLifecycle(tx)
+			if err := lifecycle.changeStatus(testLog(), tenant, models.TenantStatusPendingDeletion, nil, testActor, nil); err != nil {
+				t.Fatal(err)
+			}
+			if err := tx.Model(&models.Tenant{}).Where("id = ?", tenant.ID).Update("purge_after", time.Now().Add(-time.Minute)).Error; err != nil {
+				t.Fatal(err)
+			}
+			due := *tenant
+
+			if tt.reactivate {
+				if err := lifecycle.changeStatus(testLog(), tenant, models.TenantStatusActive, nil, testActor, nil); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			purger, directory := newTestPurger(t, tx)
+			report, err := purger.purgeTenant(context.Background(), &due)
+			if err != nil {
+				t.Fatalf("purgeTenant() error = %v", err)
+			}
+
+			if purged := report != nil; purged != tt.wantPurged {
+				t.Errorf("purged = %v, want %v", purged, tt.wantPurged)
+			}
+			if tt.wantPurged && (len(directory.deleted) != 1 || directory.deleted[0] != owner.CognitoID) {
+				t.Errorf("Cognito users deleted = %v, want [%s]", directory.deleted, owner.CognitoID)
+			}
+			if !tt.wantPurged && len(directory.deleted) != 0 {
+				t.Errorf("Cognito users deleted = %v, want none", directory.deleted)
+			}
+		})
+	}
+}
+
+// TestPurgingTenantCannotBeReactivated checks a tenant the purger has claimed stays claimed.
+func TestPurgingTenantCannotBeReactivated(t *testing.T) {
+	tx := testTx(t)
+	tenant, _ := createTestTenant(t, tx)
+	lifecycle := newTestLifecycle(tx)
+	if err := lifecycle.changeStatus(testLog(), tenant, models.TenantStatusPendingDeletion, nil, testActor, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Model(&models.Tenant{}).Where("id = ?", tenant.ID).Update("purge_after", time.Now().Add(-time.Minute)).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	purger, _ := newTestPurger(t, tx)
+	claimed, err := purger.claim(context.Background(), tenant)
+	if err != nil || !claimed {
+		t.Fatalf("claim() = %v, %v, want true", claimed, err)
+	}
+
+	err = lifecycle.changeStatus(testLog(), tenant, models.TenantStatusActive, nil, testActor, nil)
+	var transition *transitionError
+	if !errors.As(err, &transition) || transition.current != models.TenantStatusPurging {
+		t.Errorf("changeStatus() error = %v, want a transition error from purging", err)
+	}
+}
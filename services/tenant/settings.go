@@ -0,0 +1,193 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/pavitra93/go-multi-tenant-system/shared/audit"
+	"github.com/pavitra93/go-multi-tenant-system/shared/logger"
+	"github.com/pavitra93/go-multi-tenant-system/shared/models"
+	"github.com/pavitra93/go-multi-tenant-system/shared/pagination"
+	"github.com/pavitra93/go-multi-tenant-system/shared/settings"
+	"github.com/pavitra93/go-multi-tenant-system/shared/utils"
+	"github.com/pavitra93/go-multi-tenant-system/shared/validation"
+)
+
+// errSettingsConflict is returned when the settings changed since the version a request replaces
+var errSettingsConflict = errors.New("tenant settings version conflict")
+
+// settingsChangePages orders a tenant's settings history, newest first by default
+var settingsChangePages = &pagination.Spec[models.TenantSettingsChange]{
+	Sorts: map[string]pagination.Sort[models.TenantSettingsChange]{
+		"created_at": pagination.ByTime("created_at", func(c models.TenantSettingsChange) time.Time { return c.CreatedAt }),
+	},
+	DefaultSort:  "created_at",
+	DefaultOrder: pagination.Desc,
+	ID:           pagination.ByUUID("id", func(c models.TenantSettingsChange) uuid.UUID { return c.ID }),
+}
+
+// handleGetTenantSettings returns the tenant's settings; version 0 means none have been set
+func handleGetTenantSettings(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tenant, ok := loadTenant(c, db)
+		if !ok {
+			return
+		}
+
+		record := models.TenantSettingsRecord{TenantID: tenant.ID}
+		err := db.Where("tenant_id = ?", tenant.ID).First(&record).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.InternalServerErrorResponse(c, "Failed to fetch tenant settings")
+			return
+		}
+
+		utils.OKResponse(c, "Tenant settings retrieved successfully", record)
+	}
+}
+
+// handleUpdateTenantSettings replaces the tenant's settings (admin only). The request names
+// the version it replaces, so two admins editing at once can't overwrite each other.
+func handleUpdateTenantSettings(db *gorm.DB, store *settings.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req models.UpdateTenantSettingsRequest
+		if !validation.BindStrictJSON(c, &req) {
+			return
+		}
+
+		tenant, ok := loadTenant(c, db)
+		if !ok {
+			return
+		}
+		if tenant.Status == models.TenantStatusDeleted {
+			utils.CodedErrorResponse(c, utils.CodeInvalidTenantTransition, "Deleted tenants cannot be modified", map[string]interface{}{
+				"current_status": tenant.Status,
+			})
+			return
+		}
+
+		// Retention can be shortened but not extended beyond the plan
+		if days := req.Settings.Retention.LocationDays; days != nil {
+			plan, ok := findPlan(c, db, tenant.PlanID)
+			if !ok {
+				return
+			}
+			if plan.RetentionDays != nil && *days > *plan.RetentionDays {
+				utils.ValidationErrorResponse(c, []utils.FieldError{{
+					Field:   "settings.retention.location_days",
+					Rule:    "max",
+					Message: fmt.Sprintf("must be at most %d, the retention of the %s plan", *plan.RetentionDays, plan.ID),
+				}})
+				return
+			}
+		}
+
+		actor := audit.FromContext(c)
+		log := logger.FromContext(c).WithField("tenant_id", tenant.ID)
+
+		record := models.TenantSettingsRecord{TenantID: tenant.ID}
+		var changed []string
+		err := db.Transaction(func(tx *gorm.DB) error {
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("tenant_id = ?", tenant.ID).First(&record).Error
+			if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("failed to lock tenant settings: %w", err)
+			}
+			if record.Version != *req.Version {
+				return errSettingsConflict
+			}
+
+			previous := record.Settings
+			changes := audit.Diff(previous, req.Settings)
+			if changed = audit.ChangedFields(changes); len(changed) == 0 {
+				return nil
+			}
+
+			record.Settings = req.Settings
+			record.Version++
+			record.UpdatedBy = actor.ID
+			if record.Version == 1 {
+				// Two first versions can race past the lock; the loser conflicts
+				result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&record)
+				if result.Error != nil {
+					return fmt.Errorf("failed to create tenant settings: %w", result.Error)
+				}
+				if result.RowsAffected == 0 {
+					return errSettingsConflict
+				}
+			} else if err := tx.Save(&record).Error; err != nil {
+				return fmt.Errorf("failed to update tenant settings: %w", err)
+			}
+
+			change := models.TenantSettingsChange{
+				TenantID:      tenant.ID,
+				Version:       record.Version,
+				Settings:      record.Settings,
+				Previous:      previous,
+				ChangedFields: changed,
+				ChangedBy:     actor.ID,
+			}
+			if err := tx.Create(&change).Error; err != nil {
+				return fmt.Errorf("failed to record settings change: %w", err)
+			}
+
+			event := actor.Event(audit.TenantSettingsUpdated, tenant.ID, audit.TargetTenant, tenant.ID.String())
+			event.Changes = changes
+			event.Metadata["version"] = record.Version
+			return audit.Record(tx, event)
+		})
+		if errors.Is(err, errSettingsConflict) {
+			utils.CodedErrorResponse(c, utils.CodeSettingsVersionConflict, "Settings were changed since the version given; fetch them and retry", map[string]interface{}{
+				"version":         *req.Version,
+				"current_version": record.Version,
+			})
+			return
+		}
+		if err != nil {
+			log.WithError(err).Error("Failed to update tenant settings")
+			utils.InternalServerErrorResponse(c, "Failed to update tenant settings")
+			return
+		}
+
+		if len(changed) > 0 {
+			// Every service re-reads the settings on its next use
+			store.Invalidate(c.Request.Context(), tenant.ID)
+			log.WithFields(logrus.Fields{
+				"version": record.Version,
+				"changed": changed,
+				"actor":   actor.ID,
+			}).Info("Tenant settings changed")
+		}
+
+		utils.OKResponse(c, "Tenant settings updated successfully", record)
+	}
+}
+
+// handleGetTenantSettingsHistory lists the versions of the tenant's settings a page at a time
+func handleGetTenantSettingsHistory(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		page, ok := pagination.Parse(c, settingsChangePages)
+		if !ok {
+			return
+		}
+
+		tenant, ok := loadTenant(c, db)
+		if !ok {
+			return
+		}
+
+		var changes []models.TenantSettingsChange
+		if err := page.Apply(db.Where("tenant_id = ?", tenant.ID)).Find(&changes).Error; err != nil {
+			utils.InternalServerErrorResponse(c, "Failed to fetch tenant settings history")
+			return
+		}
+
+		changes, info := page.Result(changes)
+		utils.PaginatedResponse(c, "Tenant settings history retrieved successfully", changes, info)
+	}
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/pavitra93/go-multi-tenant-system/shared/logger"
+	"github.com/pavitra93/go-multi-tenant-system/shared/metering"
+	"github.com/pavitra93/go-multi-tenant-system/shared/models"
+	"github.com/pavitra93/go-multi-tenant-system/shared/pagination"
+	"github.com/pavitra93/go-multi-tenant-system/shared/utils"
+	"github.com/pavitra93/go-multi-tenant-system/shared/validation"
+)
+
+// defaultStatsWindow is the window of a stats request without ?window=
+const defaultStatsWindow = "24h"
+
+// statsWindows are the windows a stats request may select
+var statsWindows = map[string]time.Duration{
+	"1h":  time.Hour,
+	"24h": 24 * time.Hour,
+	"7d":  7 * 24 * time.Hour,
+	"30d": 30 * 24 * time.Hour,
+}
+
+// tenantStatsRow is a row of the tenant_stats view
+type tenantStatsRow struct {
+	TenantID           uuid.UUID
+	TenantName         string
+	Status             models.TenantStatus
+	UserCount          int64
+	OwnerCount         int64
+	LastLoginAt        *time.Time
+	SessionCount       int64
+	ActiveSessions     int64
+	EndedSessions      int64
+	ExpiredSessions    int64
+	CancelledSessions  int64
+	LastSessionStart   *time.Time
+	LocationCount      int64
+	LastLocationUpdate *time.Time
+	DLQBacklog         int64 `gorm:"column:dlq_backlog"`
+	OldestBacklogAt    *time.Time
+	LastActivityAt     *time.Time
+}
+
+// tenantStatsPages orders the admin statistics of every tenant, by name by default
+var tenantStatsPages = &pagination.Spec[tenantStatsRow]{
+	Sorts: map[string]pagination.Sort[tenantStatsRow]{
+		"name": pagination.ByString("tenant_name", func(r tenantStatsRow) string { return r.TenantName }),
+	},
+	DefaultSort:  "name",
+	DefaultOrder: pagination.Asc,
+	ID:           pagination.ByUUID("tenant_id", func(r tenantStatsRow) uuid.UUID { return r.TenantID }),
+}
+
+// windowCounts are the counts of a stats window, keyed by tenant
+type windowCounts struct {
+	sessionsStarted   map[uuid.UUID]int64
+	locations         map[uuid.UUID]int64
+	delivered         map[uuid.UUID]int64
+	failed            map[uuid.UUID]int64
+	permanentlyFailed map[uuid.UUID]int64
+}
+
+// statsWindow resolves a validated ?window= to its name and start, defaulting to 24 hours
+func statsWindow(window string) (string, time.Time) {
+	if window == "" {
+		window = defaultStatsWindow
+	}
+	return window, time.Now().UTC().Add(-statsWindows[window])
+}
+
+// countByTenant counts the tenants' rows of table that match where, per tenant
+func countByTenant(db *gorm.DB, table string, tenantIDs []uuid.UUID, where string, args ...interface{}) (map[uuid.UUID]int64, error) {
+	var rows []struct {
+		TenantID uuid.UUID
+		Count    int64
+	}
+	err := db.Table(table).
+		Select("tenant_id, COUNT(*) AS count").
+		Where("tenant_id IN ?", tenantIDs).
+		Where(where, args...).
+		Group("tenant_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to count %s: %w", table, err)
+	}
+
+	counts := make(map[uuid.UUID]int64, len(rows))
+	for _, row := range rows {
+		counts[row.TenantID] = row.Count
+	}
+	return counts, nil
+}
+
+// countWindow counts the tenants' activity and deliveries since start. Deliveries are
+// metered by the hour, so they are counted from the start of start's hour.
+func countWindow(db *gorm.DB, tenantIDs []uuid.UUID, start time.Time) (*windowCounts, error) {
+	counts := &windowCounts{}
+	if len(tenantIDs) == 0 {
+		return counts, nil
+	}
+
+	var err error
+	if counts.sessionsStarted, err = countByTenant(db, "location_sessions", tenantIDs, "started_at >= ?", start); err != nil {
+		return nil, err
+	}
+	if counts.locations, err = countByTenant(db, "locations", tenantIDs, "created_at >= ?", start); err != nil {
+		return nil, err
+	}
+	if counts.failed, err = countByTenant(db, "failed_location_updates", tenantIDs, "created_at >= ?", start); err != nil {
+		return nil, err
+	}
+	if counts.permanentlyFailed, err = countByTenant(db, "failed_location_updates", tenantIDs,
+		"status = ? AND resolved_at >= ?", "permanently_failed", start); err != nil {
+		return nil, err
+	}
+
+	var rows []struct {
+		TenantID uuid.UUID
+		Count    int64
+	}
+	err = db.Table("usage_hourly").
+		Select("tenant_id, SUM(quantity) AS count").
+		Where("tenant_id IN ? AND metric = ? AND hour >= ?", tenantIDs, metering.ThirdPartyDeliveries, start.Truncate(time.Hour)).
+		Group("tenant_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to count deliveries: %w", err)
+	}
+	counts.delivered = make(map[uuid.UUID]int64, len(rows))
+	for _, row := range rows {
+		counts.delivered[row.TenantID] = row.Count
+	}
+	return counts, nil
+}
+
+// buildTenantStats combines a tenant's view row with its window counts
+func buildTenantStats(row tenantStatsRow, counts *windowCounts, window string, start time.Time) models.TenantStats {
+	stats := models.TenantStats{
+		TenantID:       row.TenantID,
+		TenantName:     row.TenantName,
+		Status:         row.Status,
+		Window:         window,
+		WindowStart:    start,
+		LastActivityAt: row.LastActivityAt,
+		Users: models.UserStats{
+			Total:       row.UserCount,
+			Owners:      row.OwnerCount,
+			LastLoginAt: row.LastLoginAt,
+		},
+		Sessions: models.SessionStats{
+			Total:           row.SessionCount,
+			Active:          row.ActiveSessions,
+			Ended:           row.EndedSessions,
+			Expired:         row.ExpiredSessions,
+			Cancelled:       row.CancelledSessions,
+			StartedInWindow: counts.sessionsStarted[row.TenantID],
+			LastStartedAt:   row.LastSessionStart,
+		},
+		Locations: models.LocationStats{
+			Total:            row.LocationCount,
+			ReceivedInWindow: counts.locations[row.TenantID],
+			LastReceivedAt:   row.LastLocationUpdate,
+		},
+		Delivery: models.DeliveryStats{
+			Backlog:           row.DLQBacklog,
+			OldestBacklogAt:   row.OldestBacklogAt,
+			Delivered:         counts.delivered[row.TenantID],
+			Failed:            counts.failed[row.TenantID],
+			PermanentlyFailed: counts.permanentlyFailed[row.TenantID],
+		},
+	}
+
+	if settled := stats.Delivery.Delivered + stats.Delivery.PermanentlyFailed; settled > 0 {
+		rate := float64(stats.Delivery.Delivered) / float64(settled)
+		stats.Delivery.SuccessRate = &rate
+	}
+	return stats
+}
+
+// handleGetTenantStats reports a tenant's users, tracking activity and delivery health
+func handleGetTenantStats(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var query models.TenantStatsQuery
+		if !validation.BindQuery(c, &query) {
+			return
+		}
+
+		tenant, ok := loadTenant(c, db)
+		if !ok {
+			return
+		}
+		if tenant.Status == models.TenantStatusDeleted {
+			utils.CodedErrorResponse(c, utils.CodeTenantDeleted, "Deleted tenants have no statistics; see the deletion report", map[string]interface{}{
+				"current_status": tenant.Status,
+			})
+			return
+		}
+
+		log := logger.FromContext(c).WithField("tenant_id", tenant.ID)
+		window, start := statsWindow(query.Window)
+
+		var row tenantStatsRow
+		if err := db.Table("tenant_stats").Where("tenant_id = ?", tenant.ID).Take(&row).Error; err != nil {
+			log.WithError(err).Error("Failed to read tenant stats")
+			utils.InternalServerErrorResponse(c, "Failed to fetch tenant statistics")
+			return
+		}
+
+		counts, err := countWindow(db, []uuid.UUID{tenant.ID}, start)
+		if err != nil {
+			log.WithError(err).Error("Failed to count tenant activity")
+			utils.InternalServerErrorResponse(c, "Failed to fetch tenant statistics")
+			return
+		}
+
+		utils.OKResponse(c, "Tenant statistics retrieved successfully", buildTenantStats(row, counts, window, start))
+	}
+}
+
+// handleListTenantStats reports every tenant's statistics a page at a time (admin only)
+func handleListTenantStats(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var query models.TenantStatsListQuery
+		if !validation.BindQuery(c, &query) {
+			return
+		}
+		page, ok := pagination.Parse(c, tenantStatsPages)
+		if !ok {
+			return
+		}
+
+		log := logger.FromContext(c)
+		window, start := statsWindow(query.Window)
+
+		rowsQuery := db.Table("tenant_stats")
+		if query.Status != "" {
+			rowsQuery = rowsQuery.Where("status = ?", query.Status)
+		}
+
+		var rows []tenantStatsRow
+		if err := page.Apply(rowsQuery).Find(&rows).Error; err != nil {
+			log.WithError(err).Error("Failed to read tenant stats")
+			utils.InternalServerErrorResponse(c, "Failed to fetch tenant statistics")
+			return
+		}
+		rows, info := page.Result(rows)
+
+		tenantIDs := make([]uuid.UUID, len(rows))
+		for i, row := range rows {
+			tenantIDs[i] = row.TenantID
+		}
+		counts, err := countWindow(db, tenantIDs, start)
+		if err != nil {
+			log.WithError(err).Error("Failed to count tenant activity")
+			utils.InternalServerErrorResponse(c, "Failed to fetch tenant statistics")
+			return
+		}
+
+		stats := make([]models.TenantStats, len(rows))
+		for i, row := range rows {
+			stats[i] = buildTenantStats(row, counts, window, start)
+		}
+		utils.PaginatedResponse(c, "Tenant statistics retrieved successfully", stats, info)
+	}
+}
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/pavitra93/go-multi-tenant-system/shared/audit"
+	"github.com/pavitra93/go-multi-tenant-system/shared/logger"
+	"github.com/pavitra93/go-multi-tenant-system/shared/models"
+	"github.com/pavitra93/go-multi-tenant-system/shared/quota"
+	"github.com/pavitra93/go-multi-tenant-system/shared/utils"
+	"github.com/pavitra93/go-multi-tenant-system/shared/validation"
+)
+
+var (
+	// errUserNotFound is returned when the user is not a member of the tenant
+	errUserNotFound = errors.New("user not found in tenant")
+	// errLastOwner is returned when a change would leave the tenant without an owner
+	errLastOwner = errors.New("tenant must keep at least one owner")
+)
+
+// tenantUsers changes tenant members' roles and membership, keeping Cognito in step
+type tenantUsers struct {
+	db        *gorm.DB
+	directory userDirectory
+	quotas    *quota.Enforcer
+}
+
+// newTenantUsers creates the member manager used by the tenant user handlers
+func newTenantUsers(db *gorm.DB, directory userDirectory, quotas *quota.Enforcer) *tenantUsers {
+	return &tenantUsers{
+		db:        db,
+		directory: directory,
+		quotas:    quotas,
+	}
+}
+
+// lockOwners locks the tenant's owners, serialising every change that could remove the last one.
+// Owners are always locked before the member being changed so concurrent changes can't deadlock.
+func lockOwners(tx *gorm.DB, tenantID uuid.UUID) ([]models.User, error) {
+	var owners []models.User
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("tenant_id = ? AND role = ?", tenantID, models.RoleTenantOwner).
+		Order("cognito_id").
+		Find(&owners).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock tenant owners: %w", err)
+	}
+	return owners, nil
+}
+
+// lockMember locks the tenant member whose Cognito ID is cognitoID
+func lockMember(tx *gorm.DB, tenantID uuid.UUID, cognitoID string) (*models.User, error) {
+	var user models.User
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("tenant_id = ? AND cognito_id = ?", tenantID, cognitoID).
+		First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch user: %w", err)
+	}
+	return &user, nil
+}
+
+// appliedRole is a Cognito role change made inside a transaction, with the role to
+// restore if the transaction rolls back
+type appliedRole struct {
+	cognitoID string
+	previous  models.UserRole
+}
+
+// setRole changes user's role in the database and in Cognito, appending the Cognito change
+// to applied. Cognito is updated inside the transaction so a Cognito failure leaves the
+// database role unchanged; if the transaction fails later, pass applied to undoRoles.
+func (u *tenantUsers) setRole(c *gin.Context, tx *gorm.DB, user *models.User, role models.UserRole, applied *[]appliedRole) error {
+	if err := tx.Model(user).Update("role", role).Error; err != nil {
+		return fmt.Errorf("failed to update role: %w", err)
+	}
+	if err := u.directory.SetRole(c.Request.Context(), user.CognitoID, role); err != nil {
+		return err
+	}
+	*applied = append(*applied, appliedRole{cognitoID: user.CognitoID, previous: user.Role})
+	user.Role = role
+	return nil
+}
+
+// undoRoles restores the Cognito roles changed by a transaction that rolled back, latest
+// first. The client may have gone, so it doesn't use the request's cancellation. A role
+// that can't be restored is logged for an operator, as Cognito then disagrees with the database.
+func (u *tenantUsers) undoRoles(c *gin.Context, log *logrus.Entry, applied []appliedRole) {
+	ctx := context.WithoutCancel(c.Request.Context())
+	for i := len(applied) - 1; i >= 0; i-- {
+		change := applied[i]
+		if err := u.directory.SetRole(ctx, change.cognitoID, change.previous); err != nil {
+			log.WithError(err).WithFields(logrus.Fields{
+				"cognito_id": change.cognitoID,
+				"role":       change.previous,
+			}).Error("Failed to restore Cognito role after rollback; Cognito and the database disagree")
+		}
+	}
+}
+
+// revokeSessions logs the user out everywhere so their next token carries the change,
+// auditing the revocation as caused by cause
+func (u *tenantUsers) revokeSessions(log *logrus.Entry, actor audit.Actor, user *models.User, cause audit.Action) {
+	log = log.WithField("cognito_id", user.CognitoID)
+	if err := utils.RevokeAllUserSessions(user.CognitoID); err != nil {
+		log.WithError(err).Warn("Failed to revoke user sessions")
+		return
+	}
+
+	event := actor.Event(audit.SessionRevoked, user.TenantID, audit.TargetUser, user.CognitoID)
+	event.Metadata["cause"] = cause
+	if err := audit.Record(u.db, event); err != nil {
+		log.WithError(err).Warn("Failed to audit session revocation")
+	}
+}
+
+// userChangeErrorResponse writes the response for a failed role or membership change
+func userChangeErrorResponse(c *gin.Context, log *logrus.Entry, err error, action string) {
+	switch {
+	case errors.Is(err, errUserNotFound):
+		utils.CodedErrorResponse(c, utils.CodeUserNotFound, "User not found in tenant", nil)
+	case errors.Is(err, errLastOwner):
+		utils.CodedErrorResponse(c, utils.CodeLastTenantOwner, "Tenant must keep at least one owner", nil)
+	case errors.Is(err, errLegalHoldActive):
+		utils.CodedErrorResponse(c, utils.CodeLegalHoldActive, "Tenant data is under legal hold; users can't be removed until it is released", nil)
+	default:
+		log.WithError(err).Errorf("Failed to %s", action)
+		utils.InternalServerErrorResponse(c, "Failed to "+action)
+	}
+}
+
+// handleUpdateTenantUser changes a tenant member's role
+func handleUpdateTenantUser(users *tenantUsers) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req models.UpdateTenantUserRequest
+		if !validation.BindJSON(c, &req) {
+			return
+		}
+
+		tenant, ok := loadTenant(c, users.db)
+		if !ok {
+			return
+		}
+
+		role := models.UserRole(req.Role)
+		actor := audit.FromContext(c)
+		log := logger.FromContext(c).WithField("tenant_id", tenant.ID)
+
+		var user *models.User
+		var applied []appliedRole
+		changed := false
+		err := users.db.Transaction(func(tx *gorm.DB) error {
+			owners, err := lockOwners(tx, tenant.ID)
+			if err != nil {
+				return err
+			}
+			if user, err = lockMember(tx, tenant.ID, c.Param("cognito_id")); err != nil {
+				return err
+			}
+			if user.Role == role {
+				return nil
+			}
+			if user.Role == models.RoleTenantOwner && len(owners) <= 1 {
+				return errLastOwner
+			}
+			changed = true
+
+			event := actor.Event(audit.UserRoleChanged, tenant.ID, audit.TargetUser, user.CognitoID)
+			event.Changes = audit.Diff(map[string]models.UserRole{"role": user.Role}, map[string]models.UserRole{"role": role})
+			if err := audit.Record(tx, event); err != nil {
+				return err
+			}
+			return users.setRole(c, tx, user, role, &applied)
+		})
+		if err != nil {
+			users.undoRoles(c, log, applied)
+			userChangeErrorResponse(c, log, err, "update user role")
+			return
+		}
+
+		if changed {
+			users.revokeSessions(log, actor, user, audit.UserRoleChanged)
+			log.WithFields(logrus.Fields{"cognito_id": user.CognitoID, "role": role}).Info("Tenant user role changed")
+		}
+
+		utils.OKResponse(c, "User role updated", user)
+	}
+}
+
+// handleRemoveTenantUser removes a member from the tenant. Their Cognito user is deleted
+// and their tracking history goes with the user row, so it is refused under legal hold.
+func handleRemoveTenantUser(users *tenantUsers) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tenant, ok := loadTenant(c, users.db)
+		if !ok {
+			return
+		}
+
+		actor := audit.FromContext(c)
+		log := logger.FromContext(c).WithField("tenant_id", tenant.ID)
+
+		var user *models.User
+		err := users.db.Transaction(func(tx *gorm.DB) error {
+			// The user's tracking history is deleted with them
+			held, err := lockLegalHolds(tx, tenant.ID)
+			if err != nil {
+				return err
+			}
+			if held {
+				return errLegalHoldActive
+			}
+			owners, err := lockOwners(tx, tenant.ID)
+			if err != nil {
+				return err
+			}
+			if user, err = lockMember(tx, tenant.ID, c.Param("cognito_id")); err != nil {
+				return err
+			}
+			if user.Role == models.RoleTenantOwner && len(owners) <= 1 {
+				return errLastOwner
+			}
+			if err := tx.Delete(user).Error; err != nil {
+				return fmt.Errorf("failed to delete user: %w", err)
+			}
+
+			event := actor.Event(audit.UserRemoved, tenant.ID, audit.TargetUser, user.CognitoID)
+			event.Changes = audit.Diff(user, nil)
+			if err := audit.Record(tx, event); err != nil {
+				return err
+			}
+			// Last, so a Cognito failure rolls the delete back and the user can try again
+			_, err = users.directory.DeleteUser(c.Request.Context(), user.CognitoID)
+			return err
+		})
+		if err != nil {
+			userChangeErrorResponse(c, log, err, "remove user")
+			return
+		}
+
+		users.revokeSessions(log, actor, user, audit.UserRemoved)
+		users.quotas.ReleaseUser(c.Request.Context(), tenant.ID)
+		log.WithField("cognito_id", user.CognitoID).Info("Tenant user removed")
+
+		utils.OKResponse(c, "User removed from tenant", nil)
+	}
+}
+
+// handleTransferOwnership makes another member the tenant's owner. A tenant owner hands over
+// their own ownership; an admin demotes every current owner.
+func handleTransferOwnership(users *tenantUsers) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req models.TransferOwnershipRequest
+		if !validation.BindJSON(c, &req) {
+			return
+		}
+
+		callerID := c.GetString("user_id")
+		if req.CognitoID == callerID {
+			utils.BadRequestResponse(c, "Ownership can't be transferred to yourself")
+			return
+		}
+
+		tenant, ok := loadTenant(c, users.db)
+		if !ok {
+			return
+		}
+
+		isAdmin := c.GetBool("is_admin")
+		actor := audit.FromContext(c)
+		log := logger.FromContext(c).WithField("tenant_id", tenant.ID)
+
+		response := models.TransferOwnershipResponse{Demoted: []models.User{}}
+		var applied []appliedRole
+		promoted := false
+		err := users.db.Transaction(func(tx *gorm.DB) error {
+			owners, err := lockOwners(tx, tenant.ID)
+			if err != nil {
+				return err
+			}
+			owner, err := lockMember(tx, tenant.ID, req.CognitoID)
+			if err != nil {
+				return err
+			}
+			member := *owner // The new owner as they were, which the audit event's diff is taken against
+			if owner.Role != models.RoleTenantOwner {
+				if err := users.setRole(c, tx, owner, models.RoleTenantOwner, &applied); err != nil {
+					return err
+				}
+				promoted = true
+			}
+			response.Owner = *owner
+
+			for i := range owners {
+				previous := &owners[i]
+				if previous.CognitoID == owner.CognitoID || (!isAdmin && previous.CognitoID != callerID) {
+					continue
+				}
+				if err := users.setRole(c, tx, previous, models.RoleUser, &applied); err != nil {
+					return err
+				}
+				response.Demoted = append(response.Demoted, *previous)
+			}
+
+			demoted := make([]string, len(response.Demoted))
+			for i, previous := range response.Demoted {
+				demoted[i] = previous.CognitoID
+			}
+			event := actor.Event(audit.UserOwnershipTransferred, tenant.ID, audit.TargetUser, owner.CognitoID)
+			event.Metadata["demoted"] = demoted
+			if promoted {
+				event.Changes = audit.Diff(member, *owner)
+			}
+			return audit.Record(tx, event)
+		})
+		if err != nil {
+			// Any owner demoted or promoted in Cognito before the failure gets their role back
+			users.undoRoles(c, log, applied)
+			userChangeErrorResponse(c, log, err, "transfer ownership")
+			return
+		}
+
+		if promoted {
+			users.revokeSessions(log, actor, &response.Owner, audit.UserOwnershipTransferred)
+		}
+		for i := range response.Demoted {
+			users.revokeSessions(log, actor, &response.Demoted[i], audit.UserOwnershipTransferred)
+		}
+		log.WithField("owner", response.Owner.CognitoID).Info("Tenant ownership transferred")
+
+		utils.OKResponse(c, "Ownership transferred", response)
+	}
+}
@@ -0,0 +1,223 @@
+// Package audit records administrative actions in the append-only audit_events table.
+//
+// Each event names its actor, the tenant it belongs to, what was done to which target,
+// the fields it changed and the request it came from. Record an event with the same
+// transaction as the change it describes, so an action is audited exactly when it
+// commits. Actions taken after a commit, such as revoking token sessions, are recorded
+// on their own.
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/pavitra93/go-multi-tenant-system/shared/middleware"
+	"github.com/pavitra93/go-multi-tenant-system/shared/models"
+	"github.com/pavitra93/go-multi-tenant-system/shared/tracing"
+)
+
+// Action names what was done, as <target>.<verb>
+type Action string
+
+const (
+	TenantCreated           Action = "tenant.created"
+	TenantUpdated           Action = "tenant.updated"
+	TenantSuspended         Action = "tenant.suspended"
+	TenantReactivated       Action = "tenant.reactivated"
+	TenantDeletionScheduled Action = "tenant.deletion_scheduled"
+	TenantPurged            Action = "tenant.purged"
+	TenantPlanChanged       Action = "tenant.plan_changed"
+	TenantSettingsUpdated   Action = "tenant.settings_updated"
+	TenantExportRequested   Action = "tenant.export_requested"
+	TenantDomainVerified    Action = "tenant.domain_verified"
+	// TenantDomainFailed covers new domains not verified in time and verified ones that
+	// stopped verifying
+	TenantDomainFailed Action = "tenant.domain_verification_failed"
+
+	UserRegistered           Action = "user.registered"
+	UserInvitationAccepted   Action = "user.invitation_accepted"
+	UserEmailConfirmed       Action = "user.email_confirmed"
+	UserRoleChanged          Action = "user.role_changed"
+	UserRemoved              Action = "user.removed"
+	UserOwnershipTransferred Action = "user.ownership_transferred"
+	UserErasureRequested     Action = "user.erasure_requested"
+	UserErased               Action = "user.erased"
+
+	InvitationCreated Action = "invitation.created"
+	InvitationResent  Action = "invitation.resent"
+	InvitationRevoked Action = "invitation.revoked"
+
+	LegalHoldPlaced   Action = "legal_hold.placed"
+	LegalHoldReleased Action = "legal_hold.released"
+
+	// SessionRevoked covers logouts and the sign-outs forced by role, membership and
+	// tenant status changes
+	SessionRevoked Action = "session.revoked"
+
+	DLQPermanentlyFailed Action = "dlq.permanently_failed"
+)
+
+// Target types
+const (
+	TargetTenant       = "tenant"
+	TargetUser         = "user"
+	TargetInvitation   = "invitation"
+	TargetFailedUpdate = "failed_location_update"
+	TargetTenantExport = "tenant_export"
+	TargetUserErasure  = "user_erasure"
+	TargetLegalHold    = "legal_hold"
+)
+
+// SystemActorID is the actor of actions taken by background jobs
+const SystemActorID = "system"
+
+// ignoredFields are bookkeeping fields left out of diffs
+var ignoredFields = map[string]bool{
+	"updated_at": true,
+}
+
+// Actor is who performed an action and where the request came from
+type Actor struct {
+	ID        string
+	Role      string
+	RequestID string
+	IPAddress string
+}
+
+// FromContext returns the authenticated caller of a request. Unauthenticated requests,
+// such as registrations, leave ID and Role for the caller to fill in.
+func FromContext(c *gin.Context) Actor {
+	return Actor{
+		ID:        c.GetString("user_id"),
+		Role:      c.GetString("role"),
+		RequestID: middleware.GetRequestIDFromContext(c),
+		IPAddress: c.ClientIP(),
+	}
+}
+
+// System returns the actor of a background job, carrying the request ID in ctx if any
+func System(ctx context.Context) Actor {
+	return Actor{
+		ID:        SystemActorID,
+		Role:      SystemActorID,
+		RequestID: tracing.RequestIDFromContext(ctx),
+	}
+}
+
+// Event starts an event of the actor's action on a target. uuid.Nil as tenantID makes
+// the event platform-wide.
+func (a Actor) Event(action Action, tenantID uuid.UUID, targetType, targetID string) models.AuditEvent {
+	event := models.AuditEvent{
+		ID:         uuid.New(),
+		ActorID:    a.ID,
+		ActorRole:  a.Role,
+		Action:     string(action),
+		TargetType: targetType,
+		TargetID:   targetID,
+		Changes:    map[string]models.AuditChange{},
+		Metadata:   map[string]interface{}{},
+		RequestID:  a.RequestID,
+		IPAddress:  a.IPAddress,
+	}
+	if tenantID != uuid.Nil {
+		event.TenantID = &tenantID
+	}
+	return event
+}
+
+// Record appends events to the audit log. Pass the transaction of the change the
+// events describe.
+func Record(db *gorm.DB, events ...models.AuditEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	for i := range events {
+		if events[i].Changes == nil {
+			events[i].Changes = map[string]models.AuditChange{}
+		}
+		if events[i].Metadata == nil {
+			events[i].Metadata = map[string]interface{}{}
+		}
+	}
+
+	if err := db.Create(&events).Error; err != nil {
+		return fmt.Errorf("failed to record audit events: %w", err)
+	}
+	return nil
+}
+
+// Diff returns the fields whose JSON values differ between before and after, keyed by
+// dotted path. Objects are compared field by field; arrays and scalars as a whole.
+func Diff(before, after interface{}) map[string]models.AuditChange {
+	old, updated := flatten(before), flatten(after)
+
+	changes := map[string]models.AuditChange{}
+	for path, value := range updated {
+		if previous, ok := old[path]; !ok || string(previous) != string(value) {
+			changes[path] = models.AuditChange{Before: orNull(old[path]), After: value}
+		}
+	}
+	for path, value := range old {
+		if _, ok := updated[path]; !ok {
+			changes[path] = models.AuditChange{Before: value, After: orNull(nil)}
+		}
+	}
+	return changes
+}
+
+// ChangedFields returns the sorted paths of changes
+func ChangedFields(changes map[string]models.AuditChange) []string {
+	fields := make([]string, 0, len(changes))
+	for path := range changes {
+		fields = append(fields, path)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// flatten maps each leaf of document's JSON form to its dotted path
+func flatten(document interface{}) map[string]json.RawMessage {
+	fields := map[string]json.RawMessage{}
+	if document == nil {
+		return fields
+	}
+
+	var tree interface{}
+	data, err := json.Marshal(document)
+	if err != nil || json.Unmarshal(data, &tree) != nil {
+		return fields
+	}
+
+	var walk func(prefix string, value interface{})
+	walk = func(prefix string, value interface{}) {
+		if object, ok := value.(map[string]interface{}); ok {
+			for key, child := range object {
+				if prefix != "" {
+					key = prefix + "." + key
+				} else if ignoredFields[key] {
+					continue
+				}
+				walk(key, child)
+			}
+			return
+		}
+		raw, _ := json.Marshal(value)
+		fields[prefix] = raw
+	}
+	walk("", tree)
+	return fields
+}
+
+// orNull returns value, or JSON null if it is unset
+func orNull(value json.RawMessage) json.RawMessage {
+	if value == nil {
+		return json.RawMessage("null")
+	}
+	return value
+}
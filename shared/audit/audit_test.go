@@ -0,0 +1,152 @@
+package audit
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/pavitra93/go-multi-tenant-system/shared/models"
+)
+
+type testSettings struct {
+	Duration int    `json:"duration"`
+	Endpoint string `json:"endpoint,omitempty"`
+}
+
+type testDocument struct {
+	Name      string        `json:"name"`
+	Tags      []string      `json:"tags"`
+	Settings  *testSettings `json:"settings,omitempty"`
+	UpdatedAt string        `json:"updated_at"`
+}
+
+func TestFlatten(t *testing.T) {
+	tests := []struct {
+		name     string
+		document interface{}
+		want     map[string]string
+	}{
+		{name: "nil", document: nil, want: map[string]string{}},
+		{
+			name:     "nested objects become dotted paths",
+			document: testDocument{Name: "acme", Tags: []string{"a", "b"}, Settings: &testSettings{Duration: 60}, UpdatedAt: "now"},
+			want:     map[string]string{"name": `"acme"`, "tags": `["a","b"]`, "settings.duration": "60"},
+		},
+		{
+			name:     "nil pointer and nil slice are leaves",
+			document: testDocument{Name: "acme"},
+			want:     map[string]string{"name": `"acme"`, "tags": "null"},
+		},
+		{
+			name:     "updated_at is only ignored at the top level",
+			document: map[string]interface{}{"updated_at": "now", "settings": map[string]interface{}{"updated_at": "then"}},
+			want:     map[string]string{"settings.updated_at": `"then"`},
+		},
+		{name: "scalar document", document: 42, want: map[string]string{"": "42"}},
+		{name: "unmarshalable document", document: func() {}, want: map[string]string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := map[string]string{}
+			for path, value := range flatten(tt.document) {
+				got[path] = string(value)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("flatten = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiff(t *testing.T) {
+	base := testDocument{Name: "acme", Tags: []string{"a"}, Settings: &testSettings{Duration: 60}, UpdatedAt: "then"}
+
+	tests := []struct {
+		name   string
+		before interface{}
+		after  interface{}
+		// want maps each changed path to its before and after JSON
+		want map[string][2]string
+	}{
+		{
+			name:   "unchanged",
+			before: base,
+			after:  base,
+			want:   map[string][2]string{},
+		},
+		{
+			name:   "only updated_at changed",
+			before: base,
+			after:  testDocument{Name: "acme", Tags: []string{"a"}, Settings: &testSettings{Duration: 60}, UpdatedAt: "now"},
+			want:   map[string][2]string{},
+		},
+		{
+			name:   "scalar and nested field changed",
+			before: base,
+			after:  testDocument{Name: "acme corp", Tags: []string{"a"}, Settings: &testSettings{Duration: 90}},
+			want: map[string][2]string{
+				"name":              {`"acme"`, `"acme corp"`},
+				"settings.duration": {"60", "90"},
+			},
+		},
+		{
+			name:   "arrays compare whole",
+			before: base,
+			after:  testDocument{Name: "acme", Tags: []string{"a", "b"}, Settings: &testSettings{Duration: 60}},
+			want:   map[string][2]string{"tags": {`["a"]`, `["a","b"]`}},
+		},
+		{
+			name:   "field added",
+			before: base,
+			after:  testDocument{Name: "acme", Tags: []string{"a"}, Settings: &testSettings{Duration: 60, Endpoint: "https://x"}},
+			want:   map[string][2]string{"settings.endpoint": {"null", `"https://x"`}},
+		},
+		{
+			name:   "object removed",
+			before: base,
+			after:  testDocument{Name: "acme", Tags: []string{"a"}},
+			want: map[string][2]string{
+				"settings.duration": {"60", "null"},
+			},
+		},
+		{
+			name:   "created",
+			before: nil,
+			after:  testSettings{Duration: 60},
+			want:   map[string][2]string{"duration": {"null", "60"}},
+		},
+		{
+			name:   "deleted",
+			before: testSettings{Duration: 60},
+			after:  nil,
+			want:   map[string][2]string{"duration": {"60", "null"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := map[string][2]string{}
+			for path, change := range Diff(tt.before, tt.after) {
+				got[path] = [2]string{string(change.Before), string(change.After)}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Diff = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChangedFields(t *testing.T) {
+	null := json.RawMessage("null")
+	changes := map[string]models.AuditChange{
+		"status":            {Before: null, After: null},
+		"name":              {Before: null, After: null},
+		"settings.duration": {Before: null, After: null},
+	}
+
+	want := []string{"name", "settings.duration", "status"}
+	if got := ChangedFields(changes); !reflect.DeepEqual(got, want) {
+		t.Errorf("ChangedFields = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,49 @@
+// Package blob stores files such as tenant export archives in a configurable
+// backend: the local filesystem by default, or an S3 bucket.
+package blob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrNotFound is returned when no blob is stored under a key
+var ErrNotFound = errors.New("blob not found")
+
+// Store keeps blobs under slash-separated keys
+type Store interface {
+	// Name identifies the store in logs
+	Name() string
+	// Put stores the contents of r under key, replacing any existing blob
+	Put(ctx context.Context, key string, r io.Reader) error
+	// Open returns the blob stored under key, or ErrNotFound
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the blob stored under key; deleting a missing blob is not an error
+	Delete(ctx context.Context, key string) error
+}
+
+// Config selects and configures the blob store
+type Config struct {
+	Provider string `env:"BLOB_STORE" default:"local" validate:"oneof=local s3"`
+
+	// LocalDir holds the blobs of the local store, one file per key
+	LocalDir string `env:"BLOB_LOCAL_DIR" default:"./data/blobs" validate:"required_if=Provider local"`
+
+	S3Bucket string `env:"BLOB_S3_BUCKET" validate:"required_if=Provider s3"`
+	S3Region string `env:"BLOB_S3_REGION" validate:"required_if=Provider s3"`
+	S3Prefix string `env:"BLOB_S3_PREFIX"` // Prepended to every key
+}
+
+// New creates the store selected by cfg.Provider
+func New(cfg Config) (Store, error) {
+	switch cfg.Provider {
+	case "local":
+		return &LocalStore{Dir: cfg.LocalDir}, nil
+	case "s3":
+		return NewS3Store(cfg.S3Region, cfg.S3Bucket, cfg.S3Prefix)
+	default:
+		return nil, fmt.Errorf("unknown blob store %q", cfg.Provider)
+	}
+}
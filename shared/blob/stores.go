@@ -0,0 +1,164 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// LocalStore keeps each blob as a file under Dir, for local development and single-host deployments
+type LocalStore struct {
+	Dir string
+}
+
+// Name identifies the store in logs
+func (*LocalStore) Name() string {
+	return "local"
+}
+
+// path returns the file of key, rejecting keys that would escape Dir
+func (s *LocalStore) path(key string) (string, error) {
+	cleaned := path.Clean(key)
+	if key == "" || cleaned != key || path.IsAbs(cleaned) || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", fmt.Errorf("invalid blob key %q", key)
+	}
+	return filepath.Join(s.Dir, filepath.FromSlash(cleaned)), nil
+}
+
+// Put writes r to a temporary file and renames it into place, so readers never see a partial blob
+func (s *LocalStore) Put(_ context.Context, key string, r io.Reader) error {
+	name, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0o750); err != nil {
+		return fmt.Errorf("failed to create blob directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(name), ".upload-*")
+	if err != nil {
+		return fmt.Errorf("failed to create blob: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write blob: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write blob: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), name); err != nil {
+		return fmt.Errorf("failed to store blob: %w", err)
+	}
+	return nil
+}
+
+// Open opens the file of key
+func (s *LocalStore) Open(_ context.Context, key string) (io.ReadCloser, error) {
+	name, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open blob: %w", err)
+	}
+	return file, nil
+}
+
+// Delete removes the file of key
+func (s *LocalStore) Delete(_ context.Context, key string) error {
+	name, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(name); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to delete blob: %w", err)
+	}
+	return nil
+}
+
+// S3Store keeps blobs as objects in an S3 bucket, under an optional key prefix
+type S3Store struct {
+	client   *s3.S3
+	uploader *s3manager.Uploader
+	bucket   string
+	prefix   string
+}
+
+// NewS3Store creates a store for bucket in region. Credentials come from the
+// default AWS chain (environment, shared config or instance role).
+func NewS3Store(region, bucket, prefix string) (*S3Store, error) {
+	sess, err := session.NewSession(&aws.Config{
+		Region: aws.String(region),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AWS session: %w", err)
+	}
+	return &S3Store{
+		client:   s3.New(sess),
+		uploader: s3manager.NewUploader(sess),
+		bucket:   bucket,
+		prefix:   prefix,
+	}, nil
+}
+
+// Name identifies the store in logs
+func (*S3Store) Name() string {
+	return "s3"
+}
+
+// Put uploads r in parts, so large blobs are not held in memory
+func (s *S3Store) Put(ctx context.Context, key string, r io.Reader) error {
+	_, err := s.uploader.UploadWithContext(ctx, &s3manager.UploadInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.prefix + key),
+		Body:   r,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload blob: %w", err)
+	}
+	return nil
+}
+
+// Open streams the object of key
+func (s *S3Store) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	out, err := s.client.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.prefix + key),
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeNoSuchKey {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open blob: %w", err)
+	}
+	return out.Body, nil
+}
+
+// Delete removes the object of key; S3 deletes of missing objects succeed
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	_, err := s.client.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.prefix + key),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete blob: %w", err)
+	}
+	return nil
+}
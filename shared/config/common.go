@@ -0,0 +1,60 @@
+package config
+
+import "time"
+
+// ServerConfig holds HTTP server settings shared by every service
+type ServerConfig struct {
+	ShutdownTimeout   time.Duration `env:"SHUTDOWN_TIMEOUT" default:"15s" validate:"gt=0"`
+	ReadHeaderTimeout time.Duration `env:"SERVER_READ_HEADER_TIMEOUT" default:"10s" validate:"gt=0"`
+
+	// TrustedProxies are the IPs or CIDR ranges of proxies in front of the server; only their
+	// X-Forwarded-For and X-Forwarded-Host headers are believed
+	TrustedProxies []string `env:"TRUSTED_PROXIES" validate:"dive,cidr|ip"`
+}
+
+// MetricsConfig controls the Prometheus metrics every service exports
+type MetricsConfig struct {
+	// TenantLabels uses tenant IDs as label values; false collapses all tenants into one
+	// series to bound cardinality
+	TenantLabels bool `env:"METRICS_TENANT_LABELS" default:"true"`
+
+	// Addr is the internal listener serving /metrics. It is kept off the public port, as
+	// the metrics name tenants and their traffic.
+	Addr string `env:"METRICS_ADDR" default:":9090" validate:"required"`
+}
+
+// CognitoConfig holds the AWS Cognito user pool settings
+type CognitoConfig struct {
+	Region       string `env:"AWS_REGION" validate:"required"`
+	UserPoolID   string `env:"COGNITO_USER_POOL_ID" validate:"required"`
+	ClientID     string `env:"COGNITO_CLIENT_ID"`
+	ClientSecret string `env:"COGNITO_CLIENT_SECRET" secret:"true"`
+}
+
+// KafkaConfig holds the broker and topic for location events
+type KafkaConfig struct {
+	Broker        string `env:"KAFKA_BROKER" validate:"required"`
+	LocationTopic string `env:"KAFKA_LOCATION_TOPIC" default:"location-updates" validate:"required"`
+}
+
+// ThirdPartyConfig holds the endpoint location updates are delivered to
+type ThirdPartyConfig struct {
+	Endpoint string        `env:"THIRD_PARTY_ENDPOINT" validate:"required,url"`
+	Timeout  time.Duration `env:"THIRD_PARTY_TIMEOUT" default:"30s" validate:"gt=0"`
+
+	// APIKey, when set, is sent as a bearer token
+	APIKey string `env:"THIRD_PARTY_API_KEY" secret:"true"`
+}
+
+// Secret names of credentials read at the point of use
+const (
+	CognitoClientSecret = "COGNITO_CLIENT_SECRET"
+	ThirdPartyAPIKey    = "THIRD_PARTY_API_KEY"
+)
+
+// CircuitBreakerConfig holds circuit breaker thresholds. Embed it with an envPrefix
+// so each breaker is tuned independently, e.g. COGNITO_CIRCUIT_BREAKER_MAX_FAILURES.
+type CircuitBreakerConfig struct {
+	MaxFailures  int           `env:"CIRCUIT_BREAKER_MAX_FAILURES" default:"5" validate:"min=1"`
+	ResetTimeout time.Duration `env:"CIRCUIT_BREAKER_RESET_TIMEOUT" default:"30s" validate:"gt=0"`
+}
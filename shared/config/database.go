@@ -1,35 +1,44 @@
 package config
 
 import (
+	"context"
 	"fmt"
-	"os"
 	"time"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 )
 
+// DatabasePasswordSecret names the database password in the secret provider
+const DatabasePasswordSecret = "DB_PASSWORD"
+
 // DatabaseConfig holds database configuration
 type DatabaseConfig struct {
-	Host     string
-	Port     string
-	User     string
-	Password string
-	DBName   string
-	SSLMode  string
+	Host     string `env:"DB_HOST" default:"localhost" validate:"required"`
+	Port     string `env:"DB_PORT" default:"5432" validate:"required"`
+	User     string `env:"DB_USER" default:"postgres" validate:"required"`
+	Password string `env:"DB_PASSWORD" default:"password" secret:"true"`
+	DBName   string `env:"DB_NAME" default:"multi_tenant_db" validate:"required"`
+	SSLMode  string `env:"DB_SSL_MODE" default:"disable" validate:"oneof=disable allow prefer require verify-ca verify-full"`
+
+	// Connection pool (per service). With 4 services × 25 = 100 max connections (PostgreSQL default limit)
+	MaxOpenConns    int           `env:"DB_MAX_OPEN_CONNS" default:"25" validate:"min=1"`
+	MaxIdleConns    int           `env:"DB_MAX_IDLE_CONNS" default:"10" validate:"min=0,ltefield=MaxOpenConns"`
+	ConnMaxLifetime time.Duration `env:"DB_CONN_MAX_LIFETIME" default:"30m" validate:"gt=0"`
+	ConnMaxIdleTime time.Duration `env:"DB_CONN_MAX_IDLE_TIME" default:"10m" validate:"gt=0"`
 }
 
-// GetDatabaseConfig returns database configuration from environment variables
-func GetDatabaseConfig() *DatabaseConfig {
-	return &DatabaseConfig{
-		Host:     getEnv("DB_HOST", "localhost"),
-		Port:     getEnv("DB_PORT", "5432"),
-		User:     getEnv("DB_USER", "postgres"),
-		Password: getEnv("DB_PASSWORD", "password"),
-		DBName:   getEnv("DB_NAME", "multi_tenant_db"),
-		SSLMode:  getEnv("DB_SSL_MODE", "disable"),
+// GetDatabaseConfig returns database configuration from the environment, config file and .env.
+// Services load it as part of their own Config; prefer that, which also validates it at startup.
+func GetDatabaseConfig() (*DatabaseConfig, error) {
+	var config DatabaseConfig
+	if err := Load(&config); err != nil {
+		return nil, err
 	}
+	return &config, nil
 }
 
 // GetDSN returns the database connection string
@@ -38,11 +47,25 @@ func (c *DatabaseConfig) GetDSN() string {
 		c.Host, c.Port, c.User, c.Password, c.DBName, c.SSLMode)
 }
 
-// ConnectDatabase establishes a connection to the database with optimized pool configuration
-func ConnectDatabase() (*gorm.DB, error) {
-	config := GetDatabaseConfig()
+// Connect establishes a connection to the database with the configured pool.
+// With secrets, every new connection authenticates with the current DB_PASSWORD,
+// so a rotated password is used as soon as pooled connections are recycled.
+func (c *DatabaseConfig) Connect(secrets *SecretManager) (*gorm.DB, error) {
+	connConfig, err := pgx.ParseConfig(c.GetDSN())
+	if err != nil {
+		return nil, fmt.Errorf("invalid database configuration: %w", err)
+	}
 
-	db, err := gorm.Open(postgres.Open(config.GetDSN()), &gorm.Config{
+	var options []stdlib.OptionOpenDB
+	if secrets != nil {
+		password := secrets.Secret(DatabasePasswordSecret)
+		options = append(options, stdlib.OptionBeforeConnect(func(_ context.Context, config *pgx.ConnConfig) error {
+			config.Password = password.Value()
+			return nil
+		}))
+	}
+
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: stdlib.OpenDB(*connConfig, options...)}), &gorm.Config{
 		PrepareStmt: true,                                 // Enable prepared statement cache for better performance
 		Logger:      logger.Default.LogMode(logger.Error), // Reduce logging overhead in production
 	})
@@ -56,12 +79,10 @@ func ConnectDatabase() (*gorm.DB, error) {
 		return nil, fmt.Errorf("failed to get underlying SQL DB: %w", err)
 	}
 
-	// Connection pool configuration (per service)
-	// With 4 services × 25 = 100 max connections (PostgreSQL default limit)
-	sqlDB.SetMaxOpenConns(25)                  // Maximum open connections per service
-	sqlDB.SetMaxIdleConns(10)                  // Keep 10 idle connections for fast reuse
-	sqlDB.SetConnMaxLifetime(30 * time.Minute) // Recycle connections every 30 minutes
-	sqlDB.SetConnMaxIdleTime(10 * time.Minute) // Close idle connections after 10 minutes
+	sqlDB.SetMaxOpenConns(c.MaxOpenConns)       // Maximum open connections per service
+	sqlDB.SetMaxIdleConns(c.MaxIdleConns)       // Idle connections kept for fast reuse
+	sqlDB.SetConnMaxLifetime(c.ConnMaxLifetime) // Recycle connections periodically
+	sqlDB.SetConnMaxIdleTime(c.ConnMaxIdleTime) // Close connections idle for too long
 
 	// Verify connection
 	if err := sqlDB.Ping(); err != nil {
@@ -71,10 +92,11 @@ func ConnectDatabase() (*gorm.DB, error) {
 	return db, nil
 }
 
-// getEnv gets an environment variable with a default value
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+// ConnectDatabase loads the database configuration and connects
+func ConnectDatabase() (*gorm.DB, error) {
+	config, err := GetDatabaseConfig()
+	if err != nil {
+		return nil, err
 	}
-	return defaultValue
+	return config.Connect(nil)
 }
@@ -0,0 +1,67 @@
+package config
+
+import (
+	"reflect"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pavitra93/go-multi-tenant-system/shared/utils"
+)
+
+// RedactedValue replaces set secret values in a dump
+const RedactedValue = "[REDACTED]"
+
+// Redact returns the loaded settings of cfg keyed by env variable. Secret
+// values are masked; an empty secret stays empty so a missing one is visible.
+func Redact(cfg interface{}) map[string]interface{} {
+	values := make(map[string]interface{})
+	value := reflect.Indirect(reflect.ValueOf(cfg))
+	if value.Kind() == reflect.Struct {
+		redact(value, "", values)
+	}
+	return values
+}
+
+// redact adds the fields of v to values
+func redact(v reflect.Value, prefix string, values map[string]interface{}) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		key, hasKey := field.Tag.Lookup(envTag)
+		if !hasKey {
+			if field.Type.Kind() == reflect.Struct {
+				redact(v.Field(i), prefix+field.Tag.Get(envPrefixTag), values)
+			}
+			continue
+		}
+
+		fieldValue := v.Field(i)
+		switch {
+		case field.Tag.Get(secretTag) == "true":
+			if fieldValue.IsZero() {
+				values[prefix+key] = ""
+			} else {
+				values[prefix+key] = RedactedValue
+			}
+		case field.Type == durationType:
+			values[prefix+key] = time.Duration(fieldValue.Int()).String()
+		default:
+			values[prefix+key] = fieldValue.Interface()
+		}
+	}
+}
+
+// DumpHandler serves the redacted configuration of a service. Services mount it
+// on their internal router; the gateway exposes it to platform admins only.
+func DumpHandler(service string, cfg interface{}) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		utils.OKResponse(c, "Configuration retrieved successfully", gin.H{
+			"service": service,
+			"config":  Redact(cfg),
+		})
+	}
+}
@@ -0,0 +1,351 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/joho/godotenv"
+)
+
+// ConfigFileEnv names an optional KEY=VALUE (.env style) or flat JSON file of settings
+const ConfigFileEnv = "CONFIG_FILE"
+
+// Struct tags understood by Load:
+//
+//	env:"DB_HOST"        variable the field is read from
+//	default:"localhost"  value used when the variable is unset or empty
+//	secret:"true"        masked by Redact
+//	validate:"required"  go-playground/validator rules checked after loading
+//	envPrefix:"COGNITO_" on a nested struct, prefixes the env names of its fields
+//
+// Nested and embedded structs without an env tag are loaded recursively.
+const (
+	envTag       = "env"
+	defaultTag   = "default"
+	secretTag    = "secret"
+	envPrefixTag = "envPrefix"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// Load populates target, a pointer to a struct, from the environment, then
+// CONFIG_FILE, then .env, falling back to each field's default tag. The loaded
+// struct is validated and every problem is reported in a single error, so a
+// misconfigured service fails at startup rather than on first use.
+//
+// Durations accept Go syntax ("30s", "5m"); a bare integer is taken as seconds,
+// so values written as plain seconds keep working.
+func Load(target interface{}) error {
+	value := reflect.ValueOf(target)
+	if value.Kind() != reflect.Ptr || value.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("config target must be a pointer to a struct, got %T", target)
+	}
+
+	sources, err := loadSources()
+	if err != nil {
+		return err
+	}
+
+	loader := &loader{sources: sources, keys: make(map[string]string)}
+	loader.load(value.Elem(), "", "")
+	loader.validate(target)
+
+	if len(loader.problems) > 0 {
+		return fmt.Errorf("invalid configuration: %s", strings.Join(loader.problems, "; "))
+	}
+	return nil
+}
+
+// loader walks a config struct, recording problems instead of stopping at the first one
+type loader struct {
+	sources  []map[string]string
+	keys     map[string]string // Go field path (e.g. Database.Host) -> env name, for validation messages
+	problems []string
+}
+
+// load sets the fields of v, whose Go path is path, from the sources
+func (l *loader) load(v reflect.Value, path, prefix string) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		fieldPath := joinPath(path, field.Name)
+
+		key, hasKey := field.Tag.Lookup(envTag)
+		if !hasKey {
+			if field.Type.Kind() == reflect.Struct {
+				l.load(v.Field(i), fieldPath, prefix+field.Tag.Get(envPrefixTag))
+			}
+			continue
+		}
+
+		key = prefix + key
+		l.keys[fieldPath] = key
+
+		raw, ok := l.lookup(key)
+		if !ok {
+			raw = field.Tag.Get(defaultTag)
+		}
+		if raw == "" {
+			continue
+		}
+		if err := setValue(v.Field(i), raw); err != nil {
+			l.problems = append(l.problems, fmt.Sprintf("%s: %v", key, err))
+		}
+	}
+}
+
+// lookup returns the first non-empty value for key across the sources
+func (l *loader) lookup(key string) (string, bool) {
+	if value := os.Getenv(key); value != "" {
+		return value, true
+	}
+	for _, source := range l.sources {
+		if value := source[key]; value != "" {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// validate checks the validate tags, naming fields by their env variable
+func (l *loader) validate(target interface{}) {
+	err := newValidator().Struct(target)
+	if err == nil {
+		return
+	}
+
+	var validationErrors validator.ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		l.problems = append(l.problems, err.Error())
+		return
+	}
+
+	for _, fieldErr := range validationErrors {
+		// StructNamespace is "<Type>.<Field>..."; drop the root type name
+		path := fieldErr.StructNamespace()
+		if dot := strings.Index(path, "."); dot >= 0 {
+			path = path[dot+1:]
+		}
+		l.problems = append(l.problems, fmt.Sprintf("%s %s", l.keyFor(path), l.ruleMessage(fieldErr, path)))
+	}
+}
+
+// keyFor returns the env name of the field at path, or the path itself. An element of a
+// list, e.g. Server.TrustedProxies[1], is named by the list's variable and its index.
+func (l *loader) keyFor(path string) string {
+	if key, ok := l.keys[path]; ok {
+		return key
+	}
+	if bracket := strings.Index(path, "["); bracket >= 0 {
+		if key, ok := l.keys[path[:bracket]]; ok {
+			return key + path[bracket:]
+		}
+	}
+	return path
+}
+
+// newValidator returns a validator reading rules from the validate tag
+func newValidator() *validator.Validate {
+	validate := validator.New()
+	validate.SetTagName("validate")
+	// excluded_with_wildcard=Field: the field must be unset while the sibling list Field holds "*"
+	_ = validate.RegisterValidation("excluded_with_wildcard", func(fl validator.FieldLevel) bool {
+		list := fl.Parent().FieldByName(fl.Param())
+		if fl.Field().IsZero() || !list.IsValid() || list.Kind() != reflect.Slice {
+			return true
+		}
+		for i := 0; i < list.Len(); i++ {
+			if list.Index(i).Kind() == reflect.String && list.Index(i).String() == "*" {
+				return false
+			}
+		}
+		return true
+	})
+	return validate
+}
+
+// ruleMessage describes a failed validation rule on the field at path
+func (l *loader) ruleMessage(fieldErr validator.FieldError, path string) string {
+	switch fieldErr.Tag() {
+	case "required":
+		return "is required"
+	case "min", "gte":
+		return "must be at least " + fieldErr.Param()
+	case "max", "lte":
+		return "must be at most " + fieldErr.Param()
+	case "gt":
+		return "must be greater than " + fieldErr.Param()
+	case "url":
+		return "must be a valid URL"
+	case "cidr|ip":
+		return "must be an IP address or CIDR range"
+	case "required_if":
+		// The parameter is "<SiblingField> <value>"
+		condition := strings.Fields(fieldErr.Param())
+		if len(condition) == 2 {
+			return fmt.Sprintf("is required when %s is %s", l.keyFor(siblingPath(path, condition[0])), condition[1])
+		}
+		return "is required"
+	case "oneof":
+		return "must be one of: " + strings.ReplaceAll(fieldErr.Param(), " ", ", ")
+	case "excluded_with_wildcard":
+		return "must be false when " + l.keyFor(siblingPath(path, fieldErr.Param())) + " contains *"
+	case "ltefield", "gtefield":
+		// The parameter is a sibling field; name it by its env variable
+		sibling := siblingPath(path, fieldErr.Param())
+		if fieldErr.Tag() == "ltefield" {
+			return "must not exceed " + l.keyFor(sibling)
+		}
+		return "must be at least " + l.keyFor(sibling)
+	default:
+		return fmt.Sprintf("failed the %q rule", fieldErr.Tag())
+	}
+}
+
+// siblingPath returns the path of field name next to the field at path
+func siblingPath(path, name string) string {
+	if dot := strings.LastIndex(path, "."); dot >= 0 {
+		return path[:dot+1] + name
+	}
+	return name
+}
+
+// setValue parses raw into field according to its type
+func setValue(field reflect.Value, raw string) error {
+	if field.Type() == durationType {
+		duration, err := parseDuration(raw)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(duration))
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(raw)
+	case reflect.Bool:
+		parsed, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", raw)
+		}
+		field.SetBool(parsed)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		parsed, err := strconv.ParseInt(raw, 10, field.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", raw)
+		}
+		field.SetInt(parsed)
+	case reflect.Float32, reflect.Float64:
+		parsed, err := strconv.ParseFloat(raw, field.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid number %q", raw)
+		}
+		field.SetFloat(parsed)
+	case reflect.Slice:
+		if field.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported list type %s", field.Type())
+		}
+		field.Set(reflect.ValueOf(splitList(raw)))
+	default:
+		return fmt.Errorf("unsupported type %s", field.Type())
+	}
+	return nil
+}
+
+// parseDuration parses a Go duration, treating a bare integer as seconds
+func parseDuration(raw string) (time.Duration, error) {
+	if seconds, err := strconv.ParseInt(raw, 10, 64); err == nil {
+		return time.Duration(seconds) * time.Second, nil
+	}
+	duration, err := time.ParseDuration(raw)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q", raw)
+	}
+	return duration, nil
+}
+
+// splitList parses a comma-separated list, dropping empty entries
+func splitList(raw string) []string {
+	var values []string
+	for _, value := range strings.Split(raw, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// loadSources reads CONFIG_FILE (when set) and .env (when present), in precedence order
+func loadSources() ([]map[string]string, error) {
+	var sources []map[string]string
+
+	if path := os.Getenv(ConfigFileEnv); path != "" {
+		values, err := readConfigFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s %s: %w", ConfigFileEnv, path, err)
+		}
+		sources = append(sources, values)
+	}
+
+	if values, err := godotenv.Read(); err == nil {
+		sources = append(sources, values)
+	}
+
+	return sources, nil
+}
+
+// readConfigFile reads a flat JSON object or a KEY=VALUE file
+func readConfigFile(path string) (map[string]string, error) {
+	if !strings.EqualFold(filepath.Ext(path), ".json") {
+		return godotenv.Read(path)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]string, len(raw))
+	for key, value := range raw {
+		switch typed := value.(type) {
+		case string:
+			values[key] = typed
+		case []interface{}:
+			items := make([]string, 0, len(typed))
+			for _, item := range typed {
+				items = append(items, fmt.Sprint(item))
+			}
+			values[key] = strings.Join(items, ",")
+		case nil:
+		default:
+			// Numbers and booleans; json.Number formatting keeps integers integral
+			encoded, _ := json.Marshal(typed)
+			values[key] = string(encoded)
+		}
+	}
+	return values, nil
+}
+
+// joinPath joins Go field names with dots
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
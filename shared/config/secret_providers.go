@@ -0,0 +1,151 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// EnvSecretProvider reads secrets from environment variables
+type EnvSecretProvider struct{}
+
+// Name identifies the provider in logs
+func (EnvSecretProvider) Name() string {
+	return "env"
+}
+
+// GetSecrets returns the non-empty variables among names
+func (EnvSecretProvider) GetSecrets(_ context.Context, names []string) (map[string]string, error) {
+	values := make(map[string]string)
+	for _, name := range names {
+		if value := os.Getenv(name); value != "" {
+			values[name] = value
+		}
+	}
+	return values, nil
+}
+
+// FileSecretProvider reads one secret per file from a directory, as mounted by
+// Docker secrets (/run/secrets/db_password) or Kubernetes secret volumes
+type FileSecretProvider struct {
+	Dir string
+}
+
+// Name identifies the provider in logs
+func (FileSecretProvider) Name() string {
+	return "file"
+}
+
+// GetSecrets reads <Dir>/<NAME> or <Dir>/<name>; surrounding whitespace is trimmed
+func (p FileSecretProvider) GetSecrets(_ context.Context, names []string) (map[string]string, error) {
+	values := make(map[string]string)
+	for _, name := range names {
+		value, err := p.read(name)
+		if errors.Is(err, ErrSecretNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		values[name] = value
+	}
+	return values, nil
+}
+
+// read returns the content of the first file found for name
+func (p FileSecretProvider) read(name string) (string, error) {
+	for _, fileName := range []string{name, strings.ToLower(name)} {
+		data, err := os.ReadFile(filepath.Join(p.Dir, fileName))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to read secret %s: %w", name, err)
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+	return "", ErrSecretNotFound
+}
+
+// VaultSecretProvider reads secrets from a HashiCorp Vault KV v2 engine, or any
+// server speaking the same HTTP API (see cmd/vault-stub for local development)
+type VaultSecretProvider struct {
+	address    string
+	token      string
+	namespace  string
+	mount      string
+	path       string
+	httpClient *http.Client
+}
+
+// NewVaultSecretProvider creates a Vault provider from cfg
+func NewVaultSecretProvider(cfg SecretsConfig) *VaultSecretProvider {
+	return &VaultSecretProvider{
+		address:    strings.TrimSuffix(cfg.VaultAddr, "/"),
+		token:      cfg.VaultToken,
+		namespace:  cfg.VaultNamespace,
+		mount:      strings.Trim(cfg.VaultMount, "/"),
+		path:       strings.Trim(cfg.VaultPath, "/"),
+		httpClient: &http.Client{Timeout: cfg.VaultTimeout},
+	}
+}
+
+// Name identifies the provider in logs
+func (*VaultSecretProvider) Name() string {
+	return "vault"
+}
+
+// vaultKVResponse is the body of a KV v2 read
+type vaultKVResponse struct {
+	Data struct {
+		Data map[string]interface{} `json:"data"`
+	} `json:"data"`
+}
+
+// GetSecrets reads the configured secret once and returns the requested keys
+func (p *VaultSecretProvider) GetSecrets(ctx context.Context, names []string) (map[string]string, error) {
+	url := fmt.Sprintf("%s/v1/%s/data/%s", p.address, p.mount, p.path)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Vault request: %w", err)
+	}
+	req.Header.Set("X-Vault-Token", p.token)
+	if p.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", p.namespace)
+	}
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("vault request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// A missing secret path means nothing is stored there yet
+	if resp.StatusCode == http.StatusNotFound {
+		return map[string]string{}, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("vault returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var body vaultKVResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("failed to decode Vault response: %w", err)
+	}
+
+	values := make(map[string]string)
+	for _, name := range names {
+		if value, ok := body.Data.Data[name]; ok && value != nil {
+			values[name] = fmt.Sprint(value)
+		}
+	}
+	return values, nil
+}
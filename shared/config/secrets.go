@@ -0,0 +1,247 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ErrSecretNotFound is returned by providers that don't hold a secret
+var ErrSecretNotFound = errors.New("secret not found")
+
+// SecretProvider resolves credentials by name. Names are the env variables of
+// the secret-tagged config fields, e.g. DB_PASSWORD or COGNITO_CLIENT_SECRET.
+type SecretProvider interface {
+	// Name identifies the provider in logs
+	Name() string
+	// GetSecrets returns the values it holds for names; missing names are omitted
+	GetSecrets(ctx context.Context, names []string) (map[string]string, error)
+}
+
+// SecretsConfig selects and configures the secret provider
+type SecretsConfig struct {
+	Provider        string        `env:"SECRET_PROVIDER" default:"env" validate:"oneof=env file vault"`
+	RefreshInterval time.Duration `env:"SECRET_REFRESH_INTERVAL" default:"5m" validate:"gt=0"`
+
+	// file: one file per secret, named after the variable or its lowercase form (Docker/K8s mounts)
+	Dir string `env:"SECRETS_DIR" default:"/run/secrets"`
+
+	// vault: KV v2 secret whose keys are the variable names
+	VaultAddr      string        `env:"VAULT_ADDR" validate:"required_if=Provider vault,omitempty,url"`
+	VaultToken     string        `env:"VAULT_TOKEN" secret:"true" validate:"required_if=Provider vault"`
+	VaultNamespace string        `env:"VAULT_NAMESPACE"`
+	VaultMount     string        `env:"VAULT_KV_MOUNT" default:"secret"`
+	VaultPath      string        `env:"VAULT_SECRET_PATH" default:"multi-tenant-system"`
+	VaultTimeout   time.Duration `env:"VAULT_TIMEOUT" default:"5s" validate:"gt=0"`
+}
+
+var secretsConfigType = reflect.TypeOf(SecretsConfig{})
+
+// NewSecretProvider creates the provider selected by cfg
+func NewSecretProvider(cfg SecretsConfig) (SecretProvider, error) {
+	switch cfg.Provider {
+	case "", "env":
+		return EnvSecretProvider{}, nil
+	case "file":
+		return FileSecretProvider{Dir: cfg.Dir}, nil
+	case "vault":
+		return NewVaultSecretProvider(cfg), nil
+	default:
+		return nil, fmt.Errorf("unknown secret provider %q", cfg.Provider)
+	}
+}
+
+// Secret is a credential that may be rotated while the service runs.
+// Read Value at the point of use rather than copying it.
+type Secret struct {
+	name  string
+	mutex sync.RWMutex
+	value string
+}
+
+// NewStaticSecret returns a secret that never changes
+func NewStaticSecret(name, value string) *Secret {
+	return &Secret{name: name, value: value}
+}
+
+// Name returns the variable the secret is known by
+func (s *Secret) Name() string {
+	return s.name
+}
+
+// Value returns the current value
+func (s *Secret) Value() string {
+	if s == nil {
+		return ""
+	}
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.value
+}
+
+// set stores value and reports whether it changed
+func (s *Secret) set(value string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.value == value {
+		return false
+	}
+	s.value = value
+	return true
+}
+
+// SecretManager resolves a config's secret fields from a provider and refreshes them periodically
+type SecretManager struct {
+	provider        SecretProvider
+	refreshInterval time.Duration
+
+	mutex   sync.RWMutex
+	secrets map[string]*Secret
+}
+
+// NewSecretManager creates the configured provider and resolves every secret-tagged
+// field of target (a pointer to a loaded config struct). Fields the provider doesn't
+// hold keep the value loaded from the environment, so secrets can move one at a time.
+func NewSecretManager(ctx context.Context, cfg SecretsConfig, target interface{}) (*SecretManager, error) {
+	provider, err := NewSecretProvider(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	manager := &SecretManager{
+		provider:        provider,
+		refreshInterval: cfg.RefreshInterval,
+		secrets:         make(map[string]*Secret),
+	}
+	if err := manager.bind(ctx, target); err != nil {
+		return nil, err
+	}
+	return manager, nil
+}
+
+// bind resolves the secret fields of target and registers them for refresh
+func (m *SecretManager) bind(ctx context.Context, target interface{}) error {
+	value := reflect.ValueOf(target)
+	if value.Kind() != reflect.Ptr || value.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("config target must be a pointer to a struct, got %T", target)
+	}
+
+	fields := make(map[string]reflect.Value)
+	collectSecretFields(value.Elem(), "", fields)
+	if len(fields) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	resolved, err := m.provider.GetSecrets(ctx, names)
+	if err != nil {
+		return fmt.Errorf("failed to resolve secrets from %s provider: %w", m.provider.Name(), err)
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for name, field := range fields {
+		if secretValue, ok := resolved[name]; ok {
+			field.SetString(secretValue)
+		}
+		m.secrets[name] = NewStaticSecret(name, field.String())
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"provider": m.provider.Name(),
+		"resolved": len(resolved),
+		"secrets":  len(fields),
+	}).Info("Secrets resolved")
+	return nil
+}
+
+// collectSecretFields finds secret-tagged string fields by env name. The
+// provider's own settings are skipped; they bootstrap it.
+func collectSecretFields(v reflect.Value, prefix string, fields map[string]reflect.Value) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() || field.Type == secretsConfigType {
+			continue
+		}
+
+		key, hasKey := field.Tag.Lookup(envTag)
+		if !hasKey {
+			if field.Type.Kind() == reflect.Struct {
+				collectSecretFields(v.Field(i), prefix+field.Tag.Get(envPrefixTag), fields)
+			}
+			continue
+		}
+		if field.Tag.Get(secretTag) == "true" && field.Type.Kind() == reflect.String {
+			fields[prefix+key] = v.Field(i)
+		}
+	}
+}
+
+// Secret returns the live secret for name. Unknown names, including a nil
+// manager, yield an empty static secret.
+func (m *SecretManager) Secret(name string) *Secret {
+	if m == nil {
+		return NewStaticSecret(name, "")
+	}
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	if secret, ok := m.secrets[name]; ok {
+		return secret
+	}
+	return NewStaticSecret(name, "")
+}
+
+// Refresh fetches every secret again and applies changed values
+func (m *SecretManager) Refresh(ctx context.Context) error {
+	m.mutex.RLock()
+	names := make([]string, 0, len(m.secrets))
+	for name := range m.secrets {
+		names = append(names, name)
+	}
+	m.mutex.RUnlock()
+	if len(names) == 0 {
+		return nil
+	}
+
+	resolved, err := m.provider.GetSecrets(ctx, names)
+	if err != nil {
+		return fmt.Errorf("failed to refresh secrets from %s provider: %w", m.provider.Name(), err)
+	}
+
+	for name, value := range resolved {
+		if m.Secret(name).set(value) {
+			logrus.WithFields(logrus.Fields{
+				"secret":   name,
+				"provider": m.provider.Name(),
+			}).Info("Secret rotated")
+		}
+	}
+	return nil
+}
+
+// Run refreshes secrets every SECRET_REFRESH_INTERVAL until ctx is cancelled.
+// A failed refresh keeps the current values.
+func (m *SecretManager) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.refreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := m.Refresh(ctx); err != nil && ctx.Err() == nil {
+				logrus.WithError(err).Warn("Failed to refresh secrets, keeping current values")
+			}
+		}
+	}
+}
@@ -0,0 +1,107 @@
+// Package domains verifies that a tenant controls its custom domain. The tenant proves it
+// with a DNS TXT record at _tenant-verification.<domain> or with a file served at
+// /.well-known/tenant-verification.txt on the domain, either carrying a token it was given.
+package domains
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	// RecordPrefix is the label under the domain holding the TXT record
+	RecordPrefix = "_tenant-verification"
+	// recordValuePrefix precedes the token in the TXT record
+	recordValuePrefix = "tenant-verification="
+	// WellKnownPath is where the domain serves the token over HTTP(S)
+	WellKnownPath = "/.well-known/tenant-verification.txt"
+)
+
+// ErrNotVerified is returned when neither the TXT record nor the file carries the token
+var ErrNotVerified = errors.New("domain ownership could not be verified")
+
+// Method is how a domain was verified
+type Method string
+
+const (
+	MethodDNS  Method = "dns"
+	MethodHTTP Method = "http"
+)
+
+// Resolver looks up TXT records. *net.Resolver satisfies it; tests and local development
+// can use a StaticResolver.
+type Resolver interface {
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+}
+
+// StaticResolver answers TXT lookups from a fixed set of records keyed by name
+type StaticResolver map[string][]string
+
+// LookupTXT returns the records held for name
+func (r StaticResolver) LookupTXT(_ context.Context, name string) ([]string, error) {
+	records, ok := r[strings.ToLower(strings.TrimSuffix(name, "."))]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+	return records, nil
+}
+
+// Config controls how domains are checked
+type Config struct {
+	// DNSServer is the host:port of the DNS server to ask; empty uses the system resolver
+	DNSServer string `env:"DOMAIN_DNS_SERVER" validate:"omitempty,hostname_port"`
+
+	// HTTPScheme is the scheme the well-known file is fetched with
+	HTTPScheme string `env:"DOMAIN_HTTP_SCHEME" default:"https" validate:"oneof=http https"`
+
+	// Timeout bounds each lookup and fetch
+	Timeout time.Duration `env:"DOMAIN_CHECK_TIMEOUT" default:"10s" validate:"gt=0"`
+
+	// AllowPrivate lets the file be fetched from loopback and private addresses, for local
+	// development only; otherwise a domain can't point the service at internal hosts
+	AllowPrivate bool `env:"DOMAIN_ALLOW_PRIVATE" default:"false"`
+}
+
+// NewResolver returns the resolver cfg selects
+func NewResolver(cfg Config) Resolver {
+	if cfg.DNSServer == "" {
+		return net.DefaultResolver
+	}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, network, cfg.DNSServer)
+		},
+	}
+}
+
+// NewToken returns a random token for a domain to publish
+func NewToken() (string, error) {
+	raw := make([]byte, 20)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("failed to generate domain verification token: %w", err)
+	}
+	return hex.EncodeToString(raw), nil
+}
+
+// RecordName is the name of the TXT record that verifies domain
+func RecordName(domain string) string {
+	return RecordPrefix + "." + normalize(domain)
+}
+
+// RecordValue is the TXT record value that verifies a domain with token
+func RecordValue(token string) string {
+	return recordValuePrefix + token
+}
+
+// normalize lowercases domain and drops a trailing dot
+func normalize(domain string) string {
+	return strings.ToLower(strings.TrimSuffix(domain, "."))
+}
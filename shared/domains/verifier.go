@@ -0,0 +1,145 @@
+package domains
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// maxWellKnownSize is how much of the well-known file is read
+const maxWellKnownSize = 1024
+
+// errPrivateAddress rejects well-known fetches that would reach an internal address
+var errPrivateAddress = errors.New("domain resolves to a private address")
+
+// Verifier checks a domain's TXT record and well-known file for its token
+type Verifier struct {
+	resolver Resolver
+	client   *http.Client
+	scheme   string
+	timeout  time.Duration
+}
+
+// NewVerifier creates a verifier looking up TXT records through resolver
+func NewVerifier(cfg Config, resolver Resolver) *Verifier {
+	dialer := &net.Dialer{Timeout: cfg.Timeout}
+	if !cfg.AllowPrivate {
+		dialer.Control = publicOnly
+	}
+
+	return &Verifier{
+		resolver: resolver,
+		client: &http.Client{
+			Timeout: cfg.Timeout,
+			Transport: &http.Transport{
+				// No proxy, so the dialer's address check sees the real destination
+				Proxy:               nil,
+				DialContext:         dialer.DialContext,
+				TLSHandshakeTimeout: cfg.Timeout,
+			},
+			// Follow redirects within the domain only, e.g. from http to https or to www-less paths
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				if len(via) >= 3 {
+					return errors.New("too many redirects")
+				}
+				if !strings.EqualFold(req.URL.Hostname(), via[0].URL.Hostname()) {
+					return fmt.Errorf("redirected to another host %q", req.URL.Hostname())
+				}
+				return nil
+			},
+		},
+		scheme:  cfg.HTTPScheme,
+		timeout: cfg.Timeout,
+	}
+}
+
+// WellKnownURL is where the file verifying domain is fetched from
+func (v *Verifier) WellKnownURL(domain string) string {
+	return v.scheme + "://" + normalize(domain) + WellKnownPath
+}
+
+// Verify reports how domain proved it carries token: by TXT record, tried first, or by
+// the well-known file. When neither does the error wraps ErrNotVerified and says why
+// each failed.
+func (v *Verifier) Verify(ctx context.Context, domain, token string) (Method, error) {
+	dnsErr := v.verifyDNS(ctx, domain, token)
+	if dnsErr == nil {
+		return MethodDNS, nil
+	}
+	httpErr := v.verifyHTTP(ctx, domain, token)
+	if httpErr == nil {
+		return MethodHTTP, nil
+	}
+	return "", fmt.Errorf("%w: dns: %v; http: %v", ErrNotVerified, dnsErr, httpErr)
+}
+
+// verifyDNS looks for the token's TXT record
+func (v *Verifier) verifyDNS(ctx context.Context, domain, token string) error {
+	ctx, cancel := context.WithTimeout(ctx, v.timeout)
+	defer cancel()
+
+	name := RecordName(domain)
+	records, err := v.resolver.LookupTXT(ctx, name)
+	if err != nil {
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			return fmt.Errorf("no TXT record at %s", name)
+		}
+		return fmt.Errorf("failed to look up %s: %w", name, err)
+	}
+
+	expected := RecordValue(token)
+	for _, record := range records {
+		if strings.TrimSpace(record) == expected {
+			return nil
+		}
+	}
+	return fmt.Errorf("no TXT record at %s matches the token", name)
+}
+
+// verifyHTTP fetches the well-known file and compares it with the token
+func (v *Verifier) verifyHTTP(ctx context.Context, domain, token string) error {
+	url := v.WellKnownURL(domain)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("invalid verification URL: %w", err)
+	}
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to fetch %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %d", url, resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxWellKnownSize))
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", url, err)
+	}
+	if strings.TrimSpace(string(body)) != token {
+		return fmt.Errorf("%s does not contain the token", url)
+	}
+	return nil
+}
+
+// publicOnly refuses connections to loopback, private, link-local and unspecified addresses
+func publicOnly(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return fmt.Errorf("%w: %s", errPrivateAddress, host)
+	}
+	return nil
+}
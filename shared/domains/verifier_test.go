@@ -0,0 +1,173 @@
+package domains
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testToken = "0123456789abcdef0123456789abcdef01234567"
+
+// serveWellKnown starts a server answering the well-known path with body, or 404 if body
+// is empty, and returns its host:port
+func serveWellKnown(t *testing.T, body string) string {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != WellKnownPath || body == "" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	return strings.TrimPrefix(server.URL, "http://")
+}
+
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		name         string
+		txt          map[string][]string // TXT records, with "{domain}" standing for the domain checked
+		file         string              // Body of the well-known file; empty for none
+		allowPrivate bool
+		wantMethod   Method
+		wantErr      string // Part of the error; empty if verified
+	}{
+		{
+			name:       "TXT record matches",
+			txt:        map[string][]string{"_tenant-verification.{domain}": {RecordValue(testToken)}},
+			wantMethod: MethodDNS,
+		},
+		{
+			name:       "matching TXT record among others",
+			txt:        map[string][]string{"_tenant-verification.{domain}": {"v=spf1 -all", "  " + RecordValue(testToken) + " "}},
+			wantMethod: MethodDNS,
+		},
+		{
+			name:    "TXT record with another token",
+			txt:     map[string][]string{"_tenant-verification.{domain}": {RecordValue("another-token")}},
+			wantErr: "no TXT record at _tenant-verification.{domain} matches the token",
+		},
+		{
+			name:    "TXT record with the bare token",
+			txt:     map[string][]string{"_tenant-verification.{domain}": {testToken}},
+			wantErr: "matches the token",
+		},
+		{
+			name:    "TXT record on the domain itself",
+			txt:     map[string][]string{"{domain}": {RecordValue(testToken)}},
+			wantErr: "no TXT record at _tenant-verification.{domain}",
+		},
+		{
+			name:         "well-known file matches",
+			file:         testToken + "\n",
+			allowPrivate: true,
+			wantMethod:   MethodHTTP,
+		},
+		{
+			name:         "TXT record wins over the file",
+			txt:          map[string][]string{"_tenant-verification.{domain}": {RecordValue(testToken)}},
+			file:         testToken,
+			allowPrivate: true,
+			wantMethod:   MethodDNS,
+		},
+		{
+			name:         "well-known file with another token",
+			file:         "another-token",
+			allowPrivate: true,
+			wantErr:      "does not contain the token",
+		},
+		{
+			name:         "no TXT record or file",
+			allowPrivate: true,
+			wantErr:      "returned 404",
+		},
+		{
+			name:    "well-known file on a private address",
+			file:    testToken,
+			wantErr: errPrivateAddress.Error(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			domain := serveWellKnown(t, tt.file)
+			expand := func(name string) string { return strings.ReplaceAll(name, "{domain}", domain) }
+
+			resolver := StaticResolver{}
+			for name, records := range tt.txt {
+				resolver[expand(name)] = records
+			}
+
+			verifier := NewVerifier(Config{HTTPScheme: "http", Timeout: 2 * time.Second, AllowPrivate: tt.allowPrivate}, resolver)
+			method, err := verifier.Verify(context.Background(), domain, testToken)
+
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Verify() error = %v", err)
+				}
+				if method != tt.wantMethod {
+					t.Errorf("Verify() method = %q, want %q", method, tt.wantMethod)
+				}
+				return
+			}
+			if !errors.Is(err, ErrNotVerified) {
+				t.Fatalf("Verify() error = %v, want ErrNotVerified", err)
+			}
+			if want := expand(tt.wantErr); !strings.Contains(err.Error(), want) {
+				t.Errorf("Verify() error = %q, want it to contain %q", err, want)
+			}
+		})
+	}
+}
+
+func TestPublicOnly(t *testing.T) {
+	tests := []struct {
+		name    string
+		address string
+		allowed bool
+	}{
+		{name: "public IPv4", address: "93.184.216.34:443", allowed: true},
+		{name: "public IPv6", address: "[2606:2800:220:1:248:1893:25c8:1946]:443", allowed: true},
+		{name: "IPv4 loopback", address: "127.0.0.1:80"},
+		{name: "other IPv4 loopback", address: "127.8.8.8:80"},
+		{name: "IPv6 loopback", address: "[::1]:80"},
+		{name: "10/8", address: "10.1.2.3:443"},
+		{name: "172.16/12", address: "172.20.0.1:443"},
+		{name: "192.168/16", address: "192.168.1.1:443"},
+		{name: "IPv6 unique local", address: "[fd00::1]:443"},
+		{name: "link-local metadata address", address: "169.254.169.254:80"},
+		{name: "IPv6 link-local", address: "[fe80::1]:80"},
+		{name: "unspecified IPv4", address: "0.0.0.0:80"},
+		{name: "unspecified IPv6", address: "[::]:80"},
+		{name: "multicast", address: "224.0.0.1:80"},
+		{name: "IPv4-mapped loopback", address: "[::ffff:127.0.0.1]:80"},
+		{name: "hostname", address: "localhost:80"},
+		{name: "no port", address: "93.184.216.34"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := publicOnly("tcp", tt.address, nil)
+			if tt.allowed && err != nil {
+				t.Errorf("publicOnly(%q) error = %v, want allowed", tt.address, err)
+			}
+			if !tt.allowed && err == nil {
+				t.Errorf("publicOnly(%q) allowed, want refused", tt.address)
+			}
+		})
+	}
+}
+
+func TestStaticResolverNotFound(t *testing.T) {
+	_, err := StaticResolver{}.LookupTXT(context.Background(), "_tenant-verification.example.com")
+	var dnsErr *net.DNSError
+	if !errors.As(err, &dnsErr) || !dnsErr.IsNotFound {
+		t.Errorf("LookupTXT() error = %v, want a not found DNS error", err)
+	}
+}
@@ -0,0 +1,50 @@
+package logger
+
+import (
+	"sync"
+	"time"
+)
+
+// Sampler limits how often a noisy log line is emitted.
+// The first `burst` calls in each interval are allowed; the rest are counted
+// and reported through Suppressed on the next allowed call.
+type Sampler struct {
+	interval time.Duration
+	burst    int
+
+	mutex       sync.Mutex
+	windowStart time.Time
+	count       int
+	suppressed  int
+}
+
+// NewSampler creates a sampler allowing burst log lines per interval
+func NewSampler(interval time.Duration, burst int) *Sampler {
+	return &Sampler{
+		interval: interval,
+		burst:    burst,
+	}
+}
+
+// Allow reports whether the caller should log now, and how many lines were
+// suppressed since the last allowed one
+func (s *Sampler) Allow() (bool, int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.windowStart) >= s.interval {
+		s.windowStart = now
+		s.count = 0
+	}
+
+	if s.count >= s.burst {
+		s.suppressed++
+		return false, 0
+	}
+
+	s.count++
+	suppressed := s.suppressed
+	s.suppressed = 0
+	return true, suppressed
+}
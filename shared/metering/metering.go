@@ -0,0 +1,177 @@
+// Package metering records billable usage per tenant per hour.
+//
+// Every billable event is written to the usage_events ledger under a key that is
+// unique for the event (a location ID, a session ID, ...). The same statement adds the
+// event's quantity to its tenant's usage_hourly row only if the ledger insert happened,
+// so a retried request, a redelivered Kafka message or a second delivery attempt never
+// counts twice. Ledger rows only need to outlive the retries that could repeat them and
+// are pruned after that; usage_hourly is the billing record.
+package metering
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/pavitra93/go-multi-tenant-system/shared/models"
+)
+
+// Metric names a billable quantity
+type Metric string
+
+const (
+	LocationsStored      Metric = "locations_stored"
+	SessionsStarted      Metric = "sessions_started"
+	SessionSeconds       Metric = "session_seconds"
+	ThirdPartyDeliveries Metric = "third_party_deliveries"
+	// ActiveUsers counts each user once per UTC month, in the hour of their first activity,
+	// so its sum over a calendar month is the month's active users
+	ActiveUsers Metric = "active_users"
+)
+
+// Metrics lists every metric in export column order
+var Metrics = []Metric{LocationsStored, SessionsStarted, SessionSeconds, ThirdPartyDeliveries, ActiveUsers}
+
+// Event is one billable occurrence
+type Event struct {
+	TenantID uuid.UUID
+	Metric   Metric
+	// Key identifies the event within its tenant and metric; an event recorded again
+	// under the same key is ignored
+	Key      string
+	Quantity int64
+	// At places the event in an hour; the zero value means now
+	At time.Time
+}
+
+// batchSize keeps a statement's parameters well under PostgreSQL's limit of 65535
+const batchSize = 1000
+
+// recordSQL inserts ledger rows and adds the ones that were new to the hourly totals.
+// %s is the VALUES list of the ledger insert.
+const recordSQL = `
+WITH recorded AS (
+	INSERT INTO usage_events (tenant_id, metric, event_key, quantity, hour)
+	VALUES %s
+	ON CONFLICT (tenant_id, metric, event_key) DO NOTHING
+	RETURNING tenant_id, metric, quantity, hour
+)
+INSERT INTO usage_hourly (tenant_id, metric, hour, quantity)
+SELECT tenant_id, metric, hour, SUM(quantity) FROM recorded GROUP BY tenant_id, metric, hour
+ON CONFLICT (tenant_id, metric, hour)
+DO UPDATE SET quantity = usage_hourly.quantity + EXCLUDED.quantity, updated_at = CURRENT_TIMESTAMP`
+
+// Record adds events to their tenants' hourly usage. Pass a transaction to count the
+// events only if the change they bill for commits.
+func Record(db *gorm.DB, events ...Event) error {
+	for len(events) > batchSize {
+		if err := record(db, events[:batchSize]); err != nil {
+			return err
+		}
+		events = events[batchSize:]
+	}
+	if len(events) == 0 {
+		return nil
+	}
+	return record(db, events)
+}
+
+// record writes one batch of events
+func record(db *gorm.DB, events []Event) error {
+	now := time.Now()
+	placeholders := make([]string, 0, len(events))
+	args := make([]interface{}, 0, len(events)*5)
+	for _, event := range events {
+		at := event.At
+		if at.IsZero() {
+			at = now
+		}
+		placeholders = append(placeholders, "(?, ?, ?, ?, ?)")
+		args = append(args, event.TenantID, string(event.Metric), event.Key, event.Quantity, at.UTC().Truncate(time.Hour))
+	}
+
+	if err := db.Exec(fmt.Sprintf(recordSQL, strings.Join(placeholders, ", ")), args...).Error; err != nil {
+		return fmt.Errorf("failed to record usage: %w", err)
+	}
+	return nil
+}
+
+// LocationStored bills a stored location
+func LocationStored(location *models.Location) Event {
+	return Event{
+		TenantID: location.TenantID,
+		Metric:   LocationsStored,
+		Key:      location.ID.String(),
+		Quantity: 1,
+		At:       location.CreatedAt,
+	}
+}
+
+// SessionStarted bills a started tracking session
+func SessionStarted(session *models.LocationSession) Event {
+	return Event{
+		TenantID: session.TenantID,
+		Metric:   SessionsStarted,
+		Key:      session.ID.String(),
+		Quantity: 1,
+		At:       session.StartedAt,
+	}
+}
+
+// SessionEnded bills the seconds an ended session tracked, capped at planned, the duration
+// it was started with; a session ended after it lapsed is billed up to its expiry
+func SessionEnded(session *models.LocationSession, planned int) Event {
+	end := time.Now()
+	if session.EndedAt != nil {
+		end = *session.EndedAt
+	}
+	seconds := int64(end.Sub(session.StartedAt).Seconds())
+	if seconds > int64(planned) {
+		seconds = int64(planned)
+	}
+	if seconds < 0 {
+		seconds = 0
+	}
+
+	return Event{
+		TenantID: session.TenantID,
+		Metric:   SessionSeconds,
+		Key:      session.ID.String(),
+		Quantity: seconds,
+		At:       end,
+	}
+}
+
+// Delivered bills a location event delivered to the third party. The key is the
+// location's ID, so a delivery retried after it succeeded is counted once.
+func Delivered(tenantID uuid.UUID, eventID string) Event {
+	return Event{
+		TenantID: tenantID,
+		Metric:   ThirdPartyDeliveries,
+		Key:      eventID,
+		Quantity: 1,
+	}
+}
+
+// UserActive marks a user as active this month
+func UserActive(tenantID uuid.UUID, cognitoID string) Event {
+	return Event{
+		TenantID: tenantID,
+		Metric:   ActiveUsers,
+		Key:      cognitoID + "@" + time.Now().UTC().Format("2006-01"),
+		Quantity: 1,
+	}
+}
+
+// Prune deletes ledger rows recorded before cutoff and returns how many it removed.
+// Hourly totals are kept.
+func Prune(db *gorm.DB, cutoff time.Time) (int64, error) {
+	result := db.Exec("DELETE FROM usage_events WHERE recorded_at < ?", cutoff)
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to prune usage events: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
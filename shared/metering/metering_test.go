@@ -0,0 +1,267 @@
+package metering
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/pavitra93/go-multi-tenant-system/shared/models"
+	"github.com/pavitra93/go-multi-tenant-system/shared/testdb"
+)
+
+// dryRunDB returns a database that builds statements without a server and the list the
+// raw statements it builds are appended to
+func dryRunDB(t *testing.T) (*gorm.DB, *[]*gorm.Statement) {
+	t.Helper()
+
+	db, err := gorm.Open(postgres.Open("host=localhost"), &gorm.Config{DryRun: true, DisableAutomaticPing: true, Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var statements []*gorm.Statement
+	err = db.Callback().Raw().After("gorm:raw").Register("test:capture", func(tx *gorm.DB) {
+		statements = append(statements, tx.Statement)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, &statements
+}
+
+// testEvents returns n distinct events for one tenant
+func testEvents(n int) []Event {
+	tenantID := uuid.New()
+	events := make([]Event, n)
+	for i := range events {
+		events[i] = Event{TenantID: tenantID, Metric: LocationsStored, Key: uuid.NewString(), Quantity: 1}
+	}
+	return events
+}
+
+func TestRecordStatements(t *testing.T) {
+	tests := []struct {
+		name      string
+		events    int
+		wantBatch []int
+	}{
+		{name: "nothing to record", events: 0},
+		{name: "one event", events: 1, wantBatch: []int{1}},
+		{name: "one full batch", events: batchSize, wantBatch: []int{batchSize}},
+		{name: "spills into a second batch", events: batchSize + 1, wantBatch: []int{batchSize, 1}},
+		{name: "several batches", events: 2*batchSize + 500, wantBatch: []int{batchSize, batchSize, 500}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, statements := dryRunDB(t)
+
+			if err := Record(db, testEvents(tt.events)...); err != nil {
+				t.Fatal(err)
+			}
+
+			if len(*statements) != len(tt.wantBatch) {
+				t.Fatalf("%d statements, want %d", len(*statements), len(tt.wantBatch))
+			}
+			for i, statement := range *statements {
+				sql := statement.SQL.String()
+				if !strings.Contains(sql, "ON CONFLICT (tenant_id, metric, event_key) DO NOTHING") {
+					t.Errorf("statement %d doesn't skip recorded events:\n%s", i, sql)
+				}
+				if !strings.Contains(sql, "FROM recorded") {
+					t.Errorf("statement %d doesn't total only the newly recorded events:\n%s", i, sql)
+				}
+				if rows := len(statement.Vars) / 5; rows != tt.wantBatch[i] {
+					t.Errorf("statement %d records %d events, want %d", i, rows, tt.wantBatch[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRecordPlacesEventsInHours(t *testing.T) {
+	at := time.Date(2024, 5, 6, 14, 37, 12, 0, time.FixedZone("CEST", 2*60*60))
+	db, statements := dryRunDB(t)
+
+	if err := Record(db, Event{TenantID: uuid.New(), Metric: SessionsStarted, Key: "s", Quantity: 1, At: at}); err != nil {
+		t.Fatal(err)
+	}
+
+	hour, ok := (*statements)[0].Vars[4].(time.Time)
+	if want := time.Date(2024, 5, 6, 12, 0, 0, 0, time.UTC); !ok || !hour.Equal(want) || hour.Location() != time.UTC {
+		t.Errorf("hour = %v, want %v", (*statements)[0].Vars[4], want)
+	}
+}
+
+func TestEventKeys(t *testing.T) {
+	tenantID := uuid.New()
+	location := &models.Location{ID: uuid.New(), TenantID: tenantID, CreatedAt: time.Now()}
+	other := &models.Location{ID: uuid.New(), TenantID: tenantID, CreatedAt: time.Now()}
+	ended := time.Now()
+	session := &models.LocationSession{ID: uuid.New(), TenantID: tenantID, StartedAt: ended.Add(-time.Minute), EndedAt: &ended}
+
+	tests := []struct {
+		name string
+		// retry builds the event again, as a retried request or redelivered message would
+		retry func() Event
+		// distinct is a different occurrence of the same metric, which must not share the key
+		distinct Event
+	}{
+		{
+			name:     "location stored",
+			retry:    func() Event { return LocationStored(location) },
+			distinct: LocationStored(other),
+		},
+		{
+			name:     "session started",
+			retry:    func() Event { return SessionStarted(session) },
+			distinct: SessionStarted(&models.LocationSession{ID: uuid.New(), TenantID: tenantID}),
+		},
+		{
+			name:     "session ended",
+			retry:    func() Event { return SessionEnded(session, 3600) },
+			distinct: SessionEnded(&models.LocationSession{ID: uuid.New(), TenantID: tenantID, EndedAt: &ended}, 3600),
+		},
+		{
+			name:     "delivered",
+			retry:    func() Event { return Delivered(tenantID, location.ID.String()) },
+			distinct: Delivered(tenantID, other.ID.String()),
+		},
+		{
+			name:     "user active",
+			retry:    func() Event { return UserActive(tenantID, "cognito-1") },
+			distinct: UserActive(tenantID, "cognito-2"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			first, again := tt.retry(), tt.retry()
+			if first.Key == "" || first.Key != again.Key || first.Metric != again.Metric || first.TenantID != again.TenantID {
+				t.Errorf("retried event %+v doesn't match %+v", again, first)
+			}
+			if tt.distinct.Metric != first.Metric {
+				t.Errorf("metric = %s, want %s", tt.distinct.Metric, first.Metric)
+			}
+			if tt.distinct.Key == first.Key {
+				t.Errorf("distinct events share the key %q", first.Key)
+			}
+		})
+	}
+}
+
+func TestSessionEndedSeconds(t *testing.T) {
+	started := time.Now().Add(-time.Hour)
+
+	tests := []struct {
+		name    string
+		tracked time.Duration
+		planned int
+		want    int64
+	}{
+		{name: "ended early", tracked: 10 * time.Minute, planned: 3600, want: 600},
+		{name: "ended on time", tracked: time.Hour, planned: 3600, want: 3600},
+		{name: "ended after it lapsed", tracked: 3 * time.Hour, planned: 3600, want: 3600},
+		{name: "clock went backwards", tracked: -time.Minute, planned: 3600, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ended := started.Add(tt.tracked)
+			event := SessionEnded(&models.LocationSession{ID: uuid.New(), StartedAt: started, EndedAt: &ended}, tt.planned)
+			if event.Quantity != tt.want {
+				t.Errorf("quantity = %d, want %d", event.Quantity, tt.want)
+			}
+		})
+	}
+}
+
+// TestRecordDeduplicates records repeated events against a real database and checks each
+// is counted once.
+func TestRecordDeduplicates(t *testing.T) {
+	db := testdb.Open(t)
+
+	tenantID := uuid.New()
+	hour := time.Now().UTC().Truncate(time.Hour)
+	event := func(metric Metric, key string, quantity int64) Event {
+		return Event{TenantID: tenantID, Metric: metric, Key: key, Quantity: quantity, At: hour}
+	}
+
+	tests := []struct {
+		name    string
+		batches [][]Event
+		want    map[Metric]int64
+	}{
+		{
+			name:    "retried in a later statement",
+			batches: [][]Event{{event(LocationsStored, "a", 1)}, {event(LocationsStored, "a", 1)}},
+			want:    map[Metric]int64{LocationsStored: 1},
+		},
+		{
+			name: "new and repeated events together",
+			batches: [][]Event{
+				{event(LocationsStored, "a", 1), event(LocationsStored, "b", 1)},
+				{event(LocationsStored, "b", 1), event(LocationsStored, "c", 1)},
+			},
+			want: map[Metric]int64{LocationsStored: 3},
+		},
+		{
+			name:    "same key under another metric",
+			batches: [][]Event{{event(SessionsStarted, "s", 1)}, {event(SessionSeconds, "s", 90), event(SessionSeconds, "s", 90)}},
+			want:    map[Metric]int64{SessionsStarted: 1, SessionSeconds: 90},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Temporary tables shadow the real ones for this transaction, which is rolled back
+			tx := db.Begin()
+			t.Cleanup(func() { tx.Rollback() })
+			for _, ddl := range []string{
+				`CREATE TEMP TABLE usage_events (
+					tenant_id UUID NOT NULL, metric VARCHAR(50) NOT NULL, event_key VARCHAR(255) NOT NULL,
+					quantity BIGINT NOT NULL, hour TIMESTAMPTZ NOT NULL, recorded_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+					PRIMARY KEY (tenant_id, metric, event_key)) ON COMMIT DROP`,
+				`CREATE TEMP TABLE usage_hourly (
+					tenant_id UUID NOT NULL, metric VARCHAR(50) NOT NULL, hour TIMESTAMPTZ NOT NULL,
+					quantity BIGINT NOT NULL DEFAULT 0, updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+					PRIMARY KEY (tenant_id, metric, hour)) ON COMMIT DROP`,
+			} {
+				if err := tx.Exec(ddl).Error; err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			for _, batch := range tt.batches {
+				if err := Record(tx, batch...); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var rows []struct {
+				Metric   Metric
+				Quantity int64
+			}
+			if err := tx.Raw("SELECT metric, quantity FROM usage_hourly WHERE tenant_id = ? AND hour = ?", tenantID, hour).Scan(&rows).Error; err != nil {
+				t.Fatal(err)
+			}
+			got := make(map[Metric]int64, len(rows))
+			for _, row := range rows {
+				got[row.Metric] = row.Quantity
+			}
+			if len(got) != len(tt.want) {
+				t.Errorf("totals = %v, want %v", got, tt.want)
+			}
+			for metric, want := range tt.want {
+				if got[metric] != want {
+					t.Errorf("%s = %d, want %d", metric, got[metric], want)
+				}
+			}
+		})
+	}
+}
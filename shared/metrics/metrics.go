@@ -0,0 +1,148 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/sirupsen/logrus"
+
+	"github.com/pavitra93/go-multi-tenant-system/shared/config"
+	"github.com/pavitra93/go-multi-tenant-system/shared/server"
+	"github.com/pavitra93/go-multi-tenant-system/shared/utils"
+)
+
+var (
+	// tenantLabelsEnabled controls whether tenant IDs are used as label values; set by Configure
+	tenantLabelsEnabled = true
+
+	// HTTPRequestDuration tracks request latency by route, status and tenant
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "HTTP request latency by service, route, status and tenant",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"service", "method", "route", "status", "tenant"})
+
+	// KafkaProducerQueueDepth is the number of location events waiting for a producer worker
+	KafkaProducerQueueDepth = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "kafka_producer_queue_depth",
+		Help: "Location events buffered in the Kafka producer queue",
+	})
+
+	// KafkaProducerEvents counts produced events by result (sent, failed, dropped)
+	KafkaProducerEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "kafka_producer_events_total",
+		Help: "Location events handled by the Kafka producer by result",
+	}, []string{"result"})
+
+	// KafkaConsumerLag is the consumer group lag reported by the reader
+	KafkaConsumerLag = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kafka_consumer_lag",
+		Help: "Messages behind the end of the partition for a consumer",
+	}, []string{"topic", "group"})
+
+	// ThirdPartyRequestDuration tracks latency of third-party deliveries
+	ThirdPartyRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "third_party_request_duration_seconds",
+		Help:    "Third-party delivery latency by service and result",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"service", "result"})
+
+	// DLQUpdates is the number of failed location updates by status
+	DLQUpdates = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "dlq_failed_location_updates",
+		Help: "Failed location updates in the DLQ by status",
+	}, []string{"status"})
+
+	// CircuitBreakerState is the current breaker state (0 closed, 1 half-open, 2 open)
+	CircuitBreakerState = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "circuit_breaker_state",
+		Help: "Circuit breaker state: 0 closed, 1 half-open, 2 open",
+	}, []string{"name"})
+
+	// CircuitBreakerTransitions counts breaker state transitions
+	CircuitBreakerTransitions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "circuit_breaker_transitions_total",
+		Help: "Circuit breaker state transitions",
+	}, []string{"name", "from", "to"})
+)
+
+// Configure applies the service's metrics configuration; call it before serving requests
+func Configure(cfg config.MetricsConfig) {
+	tenantLabelsEnabled = cfg.TenantLabels
+}
+
+// Serve exposes the Prometheus scrape endpoint at /metrics on its own listener at cfg.Addr,
+// apart from the service's public routes, until ctx is cancelled
+func Serve(ctx context.Context, cfg config.MetricsConfig, serverCfg config.ServerConfig) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+
+	runner := server.New("Metrics listener", cfg.Addr, mux, serverCfg)
+	go func() {
+		if err := runner.Run(ctx); err != nil {
+			logrus.WithError(err).Error("Metrics listener failed")
+		}
+	}()
+}
+
+// HTTPMiddleware records request duration for every request handled by the router
+func HTTPMiddleware(service string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		c.Next()
+
+		// Unmatched routes share one label value to keep cardinality bounded
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+
+		HTTPRequestDuration.WithLabelValues(
+			service,
+			c.Request.Method,
+			route,
+			strconv.Itoa(c.Writer.Status()),
+			TenantLabel(c.GetString("tenant_id")),
+		).Observe(time.Since(start).Seconds())
+	}
+}
+
+// TenantLabel returns the label value to use for a tenant ID
+func TenantLabel(tenantID string) string {
+	if !tenantLabelsEnabled {
+		return "all"
+	}
+	if tenantID == "" {
+		return "none"
+	}
+	return tenantID
+}
+
+// ObserveCircuitBreaker exports state and transitions of a named circuit breaker
+func ObserveCircuitBreaker(name string, cb *utils.CircuitBreaker) {
+	CircuitBreakerState.WithLabelValues(name).Set(circuitStateValue(cb.GetState()))
+
+	cb.OnStateChange(func(from, to utils.CircuitState) {
+		CircuitBreakerState.WithLabelValues(name).Set(circuitStateValue(to))
+		CircuitBreakerTransitions.WithLabelValues(name, string(from), string(to)).Inc()
+	})
+}
+
+// circuitStateValue maps a breaker state to its gauge value
+func circuitStateValue(state utils.CircuitState) float64 {
+	switch state {
+	case utils.StateHalfOpen:
+		return 1
+	case utils.StateOpen:
+		return 2
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,64 @@
+package metrics
+
+import (
+	"fmt"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"gorm.io/gorm"
+)
+
+// RegisterDBStats exports connection pool statistics for the database
+func RegisterDBStats(db *gorm.DB, dbName string) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return fmt.Errorf("failed to get underlying SQL DB: %w", err)
+	}
+
+	return prometheus.Register(collectors.NewDBStatsCollector(sqlDB, dbName))
+}
+
+// RegisterRedisStats exports connection pool statistics for the Redis client
+func RegisterRedisStats(client *redis.Client) error {
+	if client == nil {
+		return fmt.Errorf("Redis client not initialized")
+	}
+
+	return prometheus.Register(&redisPoolCollector{client: client})
+}
+
+// redisPoolCollector reads pool statistics from the Redis client at scrape time
+type redisPoolCollector struct {
+	client *redis.Client
+}
+
+var (
+	redisPoolHits       = prometheus.NewDesc("redis_pool_hits_total", "Times a free connection was found in the pool", nil, nil)
+	redisPoolMisses     = prometheus.NewDesc("redis_pool_misses_total", "Times a free connection was not found in the pool", nil, nil)
+	redisPoolTimeouts   = prometheus.NewDesc("redis_pool_timeouts_total", "Times a wait for a connection timed out", nil, nil)
+	redisPoolTotalConns = prometheus.NewDesc("redis_pool_total_connections", "Total connections in the pool", nil, nil)
+	redisPoolIdleConns  = prometheus.NewDesc("redis_pool_idle_connections", "Idle connections in the pool", nil, nil)
+	redisPoolStaleConns = prometheus.NewDesc("redis_pool_stale_connections_total", "Stale connections removed from the pool", nil, nil)
+)
+
+// Describe implements prometheus.Collector
+func (rc *redisPoolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- redisPoolHits
+	ch <- redisPoolMisses
+	ch <- redisPoolTimeouts
+	ch <- redisPoolTotalConns
+	ch <- redisPoolIdleConns
+	ch <- redisPoolStaleConns
+}
+
+// Collect implements prometheus.Collector
+func (rc *redisPoolCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := rc.client.PoolStats()
+	ch <- prometheus.MustNewConstMetric(redisPoolHits, prometheus.CounterValue, float64(stats.Hits))
+	ch <- prometheus.MustNewConstMetric(redisPoolMisses, prometheus.CounterValue, float64(stats.Misses))
+	ch <- prometheus.MustNewConstMetric(redisPoolTimeouts, prometheus.CounterValue, float64(stats.Timeouts))
+	ch <- prometheus.MustNewConstMetric(redisPoolTotalConns, prometheus.GaugeValue, float64(stats.TotalConns))
+	ch <- prometheus.MustNewConstMetric(redisPoolIdleConns, prometheus.GaugeValue, float64(stats.IdleConns))
+	ch <- prometheus.MustNewConstMetric(redisPoolStaleConns, prometheus.CounterValue, float64(stats.StaleConns))
+}
@@ -2,14 +2,13 @@ package middleware
 
 import (
 	"fmt"
-	"net/http"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
-	"github.com/pavitra93/go-multi-tenant-system/shared/config"
 	"github.com/pavitra93/go-multi-tenant-system/shared/models"
 	"github.com/pavitra93/go-multi-tenant-system/shared/utils"
+	"github.com/sirupsen/logrus"
 	"gorm.io/gorm"
 )
 
@@ -18,17 +17,11 @@ type AuthMiddleware struct {
 	db *gorm.DB
 }
 
-// NewAuthMiddleware creates a new authentication middleware
-func NewAuthMiddleware(region, userPoolID string) (*AuthMiddleware, error) {
-	// Initialize database connection using shared config
-	db, err := config.ConnectDatabase()
-	if err != nil {
-		return nil, fmt.Errorf("failed to initialize database: %w", err)
-	}
-
+// NewAuthMiddleware creates a new authentication middleware using the service's database
+func NewAuthMiddleware(db *gorm.DB) *AuthMiddleware {
 	return &AuthMiddleware{
 		db: db,
-	}, nil
+	}
 }
 
 // RequireAuth middleware validates access token via Redis lookup
@@ -36,7 +29,7 @@ func (am *AuthMiddleware) RequireAuth() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		accessToken := extractToken(c)
 		if accessToken == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization token required"})
+			utils.CodedErrorResponse(c, utils.CodeUnauthorized, "Authorization token required", nil)
 			c.Abort()
 			return
 		}
@@ -44,14 +37,32 @@ func (am *AuthMiddleware) RequireAuth() gin.HandlerFunc {
 		// Look up session in Redis
 		session, err := utils.GetTokenSession(accessToken)
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+			utils.CodedErrorResponse(c, utils.CodeInvalidToken, "Invalid or expired token", nil)
 			c.Abort()
 			return
 		}
 
+		// Users of a suspended or deleted tenant lose access even with a live session
+		if !session.UserProfile.IsAdmin && session.UserProfile.TenantID != nil {
+			status, err := GetTenantStatus(am.db, *session.UserProfile.TenantID)
+			if err != nil {
+				logrus.WithError(err).WithField("tenant_id", session.UserProfile.TenantID).Error("Failed to check tenant status")
+				utils.InternalServerErrorResponse(c, "Failed to verify tenant status")
+				c.Abort()
+				return
+			}
+			if !status.AllowsAccess() {
+				TenantUnavailableResponse(c, status)
+				c.Abort()
+				return
+			}
+		}
+
 		// Update last used timestamp (non-blocking)
 		go func() {
-			_ = utils.UpdateTokenSessionLastUsed(accessToken)
+			if err := utils.UpdateTokenSessionLastUsed(accessToken); err != nil {
+				logrus.WithError(err).WithField("session_id", session.SessionID).Debug("Failed to update session last used timestamp")
+			}
 		}()
 
 		// Set user context from session
@@ -69,8 +80,12 @@ func (am *AuthMiddleware) RequireAuth() gin.HandlerFunc {
 
 		// Set tenant context for RLS (non-admin users only)
 		if !session.UserProfile.IsAdmin && session.UserProfile.TenantID != nil {
-			am.db.Exec("SELECT set_tenant_context(?)", *session.UserProfile.TenantID)
-			am.db.Exec("SELECT set_user_role(?)", session.UserProfile.Role)
+			if err := am.db.Exec("SELECT set_tenant_context(?)", *session.UserProfile.TenantID).Error; err != nil {
+				logrus.WithError(err).WithField("tenant_id", session.UserProfile.TenantID).Warn("Failed to set tenant context")
+			}
+			if err := am.db.Exec("SELECT set_user_role(?)", session.UserProfile.Role).Error; err != nil {
+				logrus.WithError(err).WithField("role", session.UserProfile.Role).Warn("Failed to set user role context")
+			}
 		}
 
 		c.Next()
@@ -83,14 +98,13 @@ func (am *AuthMiddleware) RequireRole(requiredRole string) gin.HandlerFunc {
 		role, exists := c.Get("role")
 
 		if !exists {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "User role not found in context"})
+			utils.CodedErrorResponse(c, utils.CodeUnauthorized, "User role not found in context", nil)
 			c.Abort()
 			return
 		}
 
 		if role != requiredRole {
-			c.JSON(http.StatusForbidden, gin.H{
-				"error":         "Insufficient permissions",
+			utils.CodedErrorResponse(c, utils.CodeInsufficientRole, "Insufficient permissions", map[string]interface{}{
 				"required_role": requiredRole,
 				"user_role":     role,
 			})
@@ -121,15 +135,12 @@ func (am *AuthMiddleware) RequireTenantOwnerOrAdmin() gin.HandlerFunc {
 				return
 			}
 
-			c.JSON(http.StatusForbidden, gin.H{
-				"error": "Tenant owners can only manage their own tenant",
-			})
+			utils.CodedErrorResponse(c, utils.CodeTenantAccessDenied, "Tenant owners can only manage their own tenant", nil)
 			c.Abort()
 			return
 		}
 
-		c.JSON(http.StatusForbidden, gin.H{
-			"error":         "Insufficient permissions",
+		utils.CodedErrorResponse(c, utils.CodeInsufficientRole, "Insufficient permissions", map[string]interface{}{
 			"required_role": "tenant_owner or admin",
 			"user_role":     role,
 		})
@@ -148,7 +159,7 @@ func (am *AuthMiddleware) RequireTenantAccess() gin.HandlerFunc {
 
 		userTenantID, exists := c.Get("tenant_id")
 		if !exists {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Tenant information not found"})
+			utils.CodedErrorResponse(c, utils.CodeUnauthorized, "Tenant information not found", nil)
 			c.Abort()
 			return
 		}
@@ -159,7 +170,7 @@ func (am *AuthMiddleware) RequireTenantAccess() gin.HandlerFunc {
 		}
 
 		if requestedTenantID != "" && requestedTenantID != userTenantID {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Access denied to this tenant"})
+			utils.CodedErrorResponse(c, utils.CodeTenantAccessDenied, "Access denied to this tenant", nil)
 			c.Abort()
 			return
 		}
@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pavitra93/go-multi-tenant-system/shared/utils"
+)
+
+// BodyLimit rejects request bodies larger than maxBytes with 413.
+// Declared lengths are rejected up front; chunked bodies fail when read past the limit.
+// When stacked, the smallest limit wins.
+func BodyLimit(maxBytes int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.ContentLength > maxBytes {
+			utils.ErrorResponse(c, http.StatusRequestEntityTooLarge, fmt.Sprintf("Request body exceeds %d bytes", maxBytes))
+			c.Abort()
+			return
+		}
+
+		if c.Request.Body != nil {
+			c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes)
+		}
+		c.Next()
+	}
+}
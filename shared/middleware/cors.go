@@ -0,0 +1,245 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pavitra93/go-multi-tenant-system/shared/models"
+	"github.com/pavitra93/go-multi-tenant-system/shared/utils"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const (
+	// tenantDomainsGenerationKey is bumped whenever a tenant's domain, status or domain
+	// verification changes, so gateways reload the tenant domains they allow
+	tenantDomainsGenerationKey = "cors:tenant_domains:generation"
+	// tenantDomainsGenerationCheck is how often a gateway looks at the generation
+	tenantDomainsGenerationCheck = 5 * time.Second
+)
+
+// CORSConfig holds the cross-origin policy. Tagged fields are loaded by the config package;
+// methods and headers default to what the API uses.
+type CORSConfig struct {
+	AllowedOrigins []string `env:"CORS_ALLOWED_ORIGINS"`
+	AllowedMethods []string
+	AllowedHeaders []string
+	ExposedHeaders []string
+
+	// AllowCredentials can't be combined with a "*" origin, which would hand any site the
+	// user's credentials
+	AllowCredentials bool          `env:"CORS_ALLOW_CREDENTIALS" default:"true" validate:"excluded_with_wildcard=AllowedOrigins"`
+	MaxAge           time.Duration `env:"CORS_MAX_AGE" default:"600s" validate:"gt=0"`
+	RefreshInterval  time.Duration `env:"CORS_REFRESH_INTERVAL" default:"5m" validate:"gt=0"`
+}
+
+// withDefaults fills in the methods and headers the API uses when none are set
+func (c CORSConfig) withDefaults() CORSConfig {
+	if len(c.AllowedMethods) == 0 {
+		c.AllowedMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
+	}
+	if len(c.AllowedHeaders) == 0 {
+		c.AllowedHeaders = []string{"Origin", "Content-Type", "Accept", "Authorization", "X-Request-ID", "X-API-Key", "traceparent", IdempotencyKeyHeader}
+	}
+	if len(c.ExposedHeaders) == 0 {
+		c.ExposedHeaders = []string{"X-Request-ID", IdempotentReplayHeader}
+	}
+	return c
+}
+
+// CORSMiddleware allows configured origins plus the verified domains of active tenants
+type CORSMiddleware struct {
+	db     *gorm.DB
+	config CORSConfig
+
+	mutex             sync.RWMutex
+	tenantDomains     map[string]bool
+	lastRefresh       time.Time
+	generation        string
+	generationChecked time.Time
+	refreshing        bool // A request is reloading the domains outside the lock
+}
+
+// NewCORSMiddleware creates a CORS middleware backed by the tenants table
+func NewCORSMiddleware(db *gorm.DB, config CORSConfig) *CORSMiddleware {
+	return &CORSMiddleware{
+		db:            db,
+		config:        config.withDefaults(),
+		tenantDomains: make(map[string]bool),
+	}
+}
+
+// Handler returns the gin middleware enforcing the CORS policy
+func (cm *CORSMiddleware) Handler() gin.HandlerFunc {
+	allowedMethods := strings.Join(cm.config.AllowedMethods, ", ")
+	allowedHeaders := strings.Join(cm.config.AllowedHeaders, ", ")
+	exposedHeaders := strings.Join(cm.config.ExposedHeaders, ", ")
+	maxAge := strconv.Itoa(int(cm.config.MaxAge.Seconds()))
+
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if origin == "" {
+			// Not a cross-origin request
+			c.Next()
+			return
+		}
+
+		c.Writer.Header().Add("Vary", "Origin")
+		preflight := c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != ""
+
+		if !cm.isAllowedOrigin(origin) {
+			if preflight {
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+			// Let the request through without CORS headers; the browser will block the response
+			c.Next()
+			return
+		}
+
+		c.Header("Access-Control-Allow-Origin", origin)
+		if cm.config.AllowCredentials {
+			c.Header("Access-Control-Allow-Credentials", "true")
+		}
+		if exposedHeaders != "" {
+			c.Header("Access-Control-Expose-Headers", exposedHeaders)
+		}
+
+		if preflight {
+			c.Header("Access-Control-Allow-Methods", allowedMethods)
+			c.Header("Access-Control-Allow-Headers", allowedHeaders)
+			c.Header("Access-Control-Max-Age", maxAge)
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// isAllowedOrigin checks the origin against configured origins and tenant domains. A "*"
+// origin is only accepted by config validation when credentials are not allowed.
+func (cm *CORSMiddleware) isAllowedOrigin(origin string) bool {
+	for _, allowed := range cm.config.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+
+	parsed, err := url.Parse(origin)
+	if err != nil || parsed.Hostname() == "" {
+		return false
+	}
+	// Credentials are allowed, so a plain http page on the domain, which anyone on the network
+	// can tamper with, must not be trusted; localhost is for local development
+	if !strings.EqualFold(parsed.Scheme, "https") && !isLocalhost(parsed.Hostname()) {
+		return false
+	}
+
+	// Only the tenant domain itself; its subdomains may be controlled by someone else
+	return cm.getTenantDomains()[strings.ToLower(parsed.Hostname())]
+}
+
+// isLocalhost reports whether host names the local machine
+func isLocalhost(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// getTenantDomains returns the cached set of verified domains of active tenants, refreshing
+// it when stale or when a tenant service has invalidated it. Redis and the database are
+// queried outside the lock, so requests keep using the cached set meanwhile.
+func (cm *CORSMiddleware) getTenantDomains() map[string]bool {
+	cm.mutex.RLock()
+	domains := cm.tenantDomains
+	stale := time.Since(cm.lastRefresh) > cm.config.RefreshInterval ||
+		time.Since(cm.generationChecked) > tenantDomainsGenerationCheck
+	cm.mutex.RUnlock()
+
+	if !stale || cm.db == nil {
+		return domains
+	}
+
+	cm.mutex.Lock()
+	// Another request may be refreshing already, or have refreshed while we waited for the lock
+	checkGeneration := time.Since(cm.generationChecked) > tenantDomainsGenerationCheck
+	reload := time.Since(cm.lastRefresh) > cm.config.RefreshInterval
+	if cm.refreshing || (!checkGeneration && !reload) {
+		domains = cm.tenantDomains
+		cm.mutex.Unlock()
+		return domains
+	}
+	cm.refreshing = true
+	if checkGeneration {
+		cm.generationChecked = time.Now()
+	}
+	generation := cm.generation
+	cm.mutex.Unlock()
+
+	if checkGeneration {
+		// Without Redis or the key the list is only refreshed every RefreshInterval
+		if latest, err := utils.CacheGet(tenantDomainsGenerationKey); err == nil && latest != generation {
+			generation = latest
+			reload = true
+		}
+	}
+
+	var refreshed map[string]bool
+	var err error
+	if reload {
+		refreshed, err = cm.loadTenantDomains()
+	}
+
+	cm.mutex.Lock()
+	defer cm.mutex.Unlock()
+
+	cm.refreshing = false
+	cm.generation = generation
+	if reload {
+		cm.lastRefresh = time.Now()
+		if err != nil {
+			logrus.WithError(err).Warn("Failed to refresh tenant domains for CORS, using cached list")
+		} else {
+			cm.tenantDomains = refreshed
+		}
+	}
+	return cm.tenantDomains
+}
+
+// loadTenantDomains reads the verified domains of active tenants
+func (cm *CORSMiddleware) loadTenantDomains() (map[string]bool, error) {
+	var tenantDomains []string
+	err := cm.db.Model(&models.Tenant{}).
+		Where("is_active = ? AND domain_status = ?", true, models.DomainStatusVerified).
+		Pluck("domain", &tenantDomains).Error
+	if err != nil {
+		return nil, err
+	}
+
+	refreshed := make(map[string]bool, len(tenantDomains))
+	for _, domain := range tenantDomains {
+		if domain != "" {
+			refreshed[strings.ToLower(domain)] = true
+		}
+	}
+	return refreshed, nil
+}
+
+// invalidateTenantDomains makes gateways reload the tenant domains they allow as origins
+func invalidateTenantDomains() {
+	if utils.RedisClient == nil {
+		return
+	}
+	if err := utils.RedisClient.Incr(utils.GetRedisContext(), tenantDomainsGenerationKey).Err(); err != nil {
+		logrus.WithError(err).Debug("Failed to invalidate CORS tenant domains")
+	}
+}
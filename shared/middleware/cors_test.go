@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"testing"
+	"time"
+)
+
+// newTestCORS returns a CORS middleware whose tenant domains are fixed to domains
+func newTestCORS(config CORSConfig, domains ...string) *CORSMiddleware {
+	cm := NewCORSMiddleware(nil, config)
+	for _, domain := range domains {
+		cm.tenantDomains[domain] = true
+	}
+	cm.lastRefresh = time.Now()
+	cm.generationChecked = time.Now()
+	return cm
+}
+
+func TestIsAllowedOrigin(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   CORSConfig
+		domains  []string
+		origin   string
+		expected bool
+	}{
+		{name: "https tenant domain", domains: []string{"app.example.com"}, origin: "https://app.example.com", expected: true},
+		{name: "https tenant domain with port", domains: []string{"app.example.com"}, origin: "https://app.example.com:8443", expected: true},
+		{name: "tenant domain in another case", domains: []string{"app.example.com"}, origin: "HTTPS://App.Example.com", expected: true},
+		{name: "http tenant domain", domains: []string{"app.example.com"}, origin: "http://app.example.com", expected: false},
+		{name: "other scheme", domains: []string{"app.example.com"}, origin: "ws://app.example.com", expected: false},
+		{name: "tenant subdomain", domains: []string{"example.com"}, origin: "https://evil.example.com", expected: false},
+		{name: "unknown domain", domains: []string{"app.example.com"}, origin: "https://other.example.com", expected: false},
+		{name: "http localhost", domains: []string{"localhost"}, origin: "http://localhost:3000", expected: true},
+		{name: "http loopback address", domains: []string{"127.0.0.1"}, origin: "http://127.0.0.1:3000", expected: true},
+		{name: "malformed origin", domains: []string{"app.example.com"}, origin: "://app.example.com", expected: false},
+		{name: "configured http origin", config: CORSConfig{AllowedOrigins: []string{"http://intranet.example.com"}}, origin: "http://intranet.example.com", expected: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cm := newTestCORS(tt.config, tt.domains...)
+			if got := cm.isAllowedOrigin(tt.origin); got != tt.expected {
+				t.Errorf("isAllowedOrigin(%q) = %v, want %v", tt.origin, got, tt.expected)
+			}
+		})
+	}
+}
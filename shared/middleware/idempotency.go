@@ -0,0 +1,188 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pavitra93/go-multi-tenant-system/shared/utils"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// IdempotencyKeyHeader is the client-supplied key identifying a logical request
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayHeader marks a response replayed from the idempotency store
+	IdempotentReplayHeader = "Idempotent-Replayed"
+
+	// maxIdempotencyKeyLength bounds the Redis key size
+	maxIdempotencyKeyLength = 255
+)
+
+// idempotencyRecord is the stored state of a keyed request
+type idempotencyRecord struct {
+	Fingerprint string `json:"fingerprint"`
+	Completed   bool   `json:"completed"`
+	StatusCode  int    `json:"status_code,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+	Body        []byte `json:"body,omitempty"`
+}
+
+// IdempotencyConfig holds how long keyed responses and in-flight locks are kept
+type IdempotencyConfig struct {
+	TTL     time.Duration `env:"IDEMPOTENCY_TTL" default:"24h" validate:"gt=0"`
+	LockTTL time.Duration `env:"IDEMPOTENCY_LOCK_TTL" default:"30s" validate:"gt=0"`
+}
+
+// IdempotencyMiddleware replays responses for requests retried with the same Idempotency-Key
+type IdempotencyMiddleware struct {
+	ttl     time.Duration
+	lockTTL time.Duration
+}
+
+// NewIdempotencyMiddleware creates an idempotency middleware
+func NewIdempotencyMiddleware(config IdempotencyConfig) *IdempotencyMiddleware {
+	return &IdempotencyMiddleware{
+		ttl:     config.TTL,
+		lockTTL: config.LockTTL,
+	}
+}
+
+// Handler returns the gin middleware. Keys are scoped per tenant and user, so it must run after RequireAuth.
+// Requests without an Idempotency-Key header are passed through unchanged.
+func (im *IdempotencyMiddleware) Handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			utils.BadRequestResponse(c, "Idempotency-Key is too long")
+			c.Abort()
+			return
+		}
+
+		redisClient := utils.GetRedisClient()
+		if redisClient == nil {
+			// Without Redis we cannot deduplicate; process the request normally
+			c.Next()
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			utils.BadRequestResponse(c, "Failed to read request body")
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		storeKey := fmt.Sprintf("idempotency:%s:%s:%s", c.GetString("tenant_id"), c.GetString("user_id"), key)
+		fingerprint := requestFingerprint(c, body)
+
+		// Claim the key; only one request per key may run at a time
+		pending, _ := json.Marshal(idempotencyRecord{Fingerprint: fingerprint})
+		claimed, err := redisClient.SetNX(utils.GetRedisContext(), storeKey, pending, im.lockTTL).Result()
+		if err != nil {
+			logrus.WithError(err).Warn("Idempotency store unavailable, processing request without deduplication")
+			c.Next()
+			return
+		}
+
+		if !claimed {
+			im.replay(c, storeKey, fingerprint)
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+
+		c.Next()
+
+		// Server errors are not cached so the client can retry with the same key
+		if recorder.Status() >= http.StatusInternalServerError {
+			if err := utils.CacheDelete(storeKey); err != nil {
+				logrus.WithError(err).Warn("Failed to release idempotency key")
+			}
+			return
+		}
+
+		completed, _ := json.Marshal(idempotencyRecord{
+			Fingerprint: fingerprint,
+			Completed:   true,
+			StatusCode:  recorder.Status(),
+			ContentType: recorder.Header().Get("Content-Type"),
+			Body:        recorder.body.Bytes(),
+		})
+		if err := redisClient.Set(utils.GetRedisContext(), storeKey, completed, im.ttl).Err(); err != nil {
+			logrus.WithError(err).Warn("Failed to store idempotent response")
+		}
+	}
+}
+
+// replay answers a request whose key is already claimed
+func (im *IdempotencyMiddleware) replay(c *gin.Context, storeKey, fingerprint string) {
+	defer c.Abort()
+
+	stored, err := utils.CacheGet(storeKey)
+	if err != nil {
+		// The claim expired between SETNX and GET; ask the client to retry
+		utils.CodedErrorResponse(c, utils.CodeIdempotencyInProgress, "Request with this Idempotency-Key is being processed", nil)
+		return
+	}
+
+	var record idempotencyRecord
+	if err := json.Unmarshal([]byte(stored), &record); err != nil {
+		utils.InternalServerErrorResponse(c, "Failed to read idempotent response")
+		return
+	}
+
+	if record.Fingerprint != fingerprint {
+		utils.CodedErrorResponse(c, utils.CodeIdempotencyKeyReused, "Idempotency-Key was already used with a different request", nil)
+		return
+	}
+
+	if !record.Completed {
+		utils.CodedErrorResponse(c, utils.CodeIdempotencyInProgress, "Request with this Idempotency-Key is being processed", nil)
+		return
+	}
+
+	c.Header(IdempotentReplayHeader, "true")
+	c.Data(record.StatusCode, record.ContentType, record.Body)
+}
+
+// requestFingerprint hashes the parts of a request that must match for a replay
+func requestFingerprint(c *gin.Context, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(c.Request.Method))
+	hash.Write([]byte{0})
+	hash.Write([]byte(c.Request.URL.Path))
+	hash.Write([]byte{0})
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// responseRecorder captures the response body while writing it through
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+// Write implements io.Writer
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	r.body.Write(data)
+	return r.ResponseWriter.Write(data)
+}
+
+// WriteString implements io.StringWriter
+func (r *responseRecorder) WriteString(data string) (int, error) {
+	r.body.WriteString(data)
+	return r.ResponseWriter.WriteString(data)
+}
@@ -0,0 +1,216 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+
+	"github.com/pavitra93/go-multi-tenant-system/shared/utils"
+)
+
+const (
+	testIdempotencyKey = "retry-1"
+	testStoreKey       = "idempotency:tenant-1:user-1:" + testIdempotencyKey
+	testRequestBody    = `{"name":"first"}`
+)
+
+// useMiniredis points the shared Redis client at an in-memory server for the test
+func useMiniredis(t *testing.T) *miniredis.Miniredis {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	previous := utils.RedisClient
+	utils.RedisClient = redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() {
+		utils.RedisClient.Close()
+		utils.RedisClient = previous
+	})
+	return server
+}
+
+// storeIdempotencyRecord seeds the idempotency store with record under the test key
+func storeIdempotencyRecord(t *testing.T, server *miniredis.Miniredis, record idempotencyRecord) {
+	t.Helper()
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := server.Set(testStoreKey, string(data)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// testFingerprint is the fingerprint of a POST /items with body
+func testFingerprint(body string) string {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/items", strings.NewReader(body))
+	return requestFingerprint(c, []byte(body))
+}
+
+func TestIdempotencyMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name    string
+		key     string
+		body    string
+		stored  *idempotencyRecord
+		handler int
+
+		wantStatus   int
+		wantCode     utils.ErrorCode
+		wantBody     string
+		wantCalls    int
+		wantReplayed bool
+		// wantStored is whether a completed response is stored under the key afterwards
+		wantStored bool
+	}{
+		{
+			name:       "no key passes through",
+			body:       testRequestBody,
+			handler:    http.StatusCreated,
+			wantStatus: http.StatusCreated,
+			wantCalls:  1,
+		},
+		{
+			name:       "oversized key is rejected",
+			key:        strings.Repeat("k", maxIdempotencyKeyLength+1),
+			body:       testRequestBody,
+			handler:    http.StatusCreated,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "first request runs and is stored",
+			key:        testIdempotencyKey,
+			body:       testRequestBody,
+			handler:    http.StatusCreated,
+			wantStatus: http.StatusCreated,
+			wantCalls:  1,
+			wantStored: true,
+		},
+		{
+			name: "retry replays the stored response",
+			key:  testIdempotencyKey,
+			body: testRequestBody,
+			stored: &idempotencyRecord{
+				Fingerprint: testFingerprint(testRequestBody),
+				Completed:   true,
+				StatusCode:  http.StatusCreated,
+				ContentType: "application/json",
+				Body:        []byte(`{"id":"stored"}`),
+			},
+			handler:      http.StatusCreated,
+			wantStatus:   http.StatusCreated,
+			wantBody:     `{"id":"stored"}`,
+			wantReplayed: true,
+			wantStored:   true,
+		},
+		{
+			name: "key reused with a different body conflicts",
+			key:  testIdempotencyKey,
+			body: `{"name":"second"}`,
+			stored: &idempotencyRecord{
+				Fingerprint: testFingerprint(testRequestBody),
+				Completed:   true,
+				StatusCode:  http.StatusCreated,
+				Body:        []byte(`{"id":"stored"}`),
+			},
+			handler:    http.StatusCreated,
+			wantStatus: http.StatusConflict,
+			wantCode:   utils.CodeIdempotencyKeyReused,
+			wantStored: true,
+		},
+		{
+			name:       "retry while the first is running conflicts",
+			key:        testIdempotencyKey,
+			body:       testRequestBody,
+			stored:     &idempotencyRecord{Fingerprint: testFingerprint(testRequestBody)},
+			handler:    http.StatusCreated,
+			wantStatus: http.StatusConflict,
+			wantCode:   utils.CodeIdempotencyInProgress,
+		},
+		{
+			name:       "server error releases the key",
+			key:        testIdempotencyKey,
+			body:       testRequestBody,
+			handler:    http.StatusInternalServerError,
+			wantStatus: http.StatusInternalServerError,
+			wantCalls:  1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := useMiniredis(t)
+			if tt.stored != nil {
+				storeIdempotencyRecord(t, server, *tt.stored)
+			}
+
+			calls := 0
+			idempotency := NewIdempotencyMiddleware(IdempotencyConfig{TTL: time.Hour, LockTTL: time.Minute})
+			router := gin.New()
+			router.POST("/items", func(c *gin.Context) {
+				c.Set("tenant_id", "tenant-1")
+				c.Set("user_id", "user-1")
+			}, idempotency.Handler(), func(c *gin.Context) {
+				calls++
+				c.JSON(tt.handler, gin.H{"id": "created"})
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/items", strings.NewReader(tt.body))
+			if tt.key != "" {
+				req.Header.Set(IdempotencyKeyHeader, tt.key)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("handler ran %d times, want %d", calls, tt.wantCalls)
+			}
+			if replayed := w.Header().Get(IdempotentReplayHeader) == "true"; replayed != tt.wantReplayed {
+				t.Errorf("replayed = %v, want %v", replayed, tt.wantReplayed)
+			}
+			if tt.wantBody != "" && w.Body.String() != tt.wantBody {
+				t.Errorf("body = %s, want %s", w.Body.String(), tt.wantBody)
+			}
+			if tt.wantCode != "" {
+				var response utils.APIResponse
+				if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+					t.Fatalf("decoding error response: %v", err)
+				}
+				if response.Code != tt.wantCode {
+					t.Errorf("code = %s, want %s", response.Code, tt.wantCode)
+				}
+			}
+
+			stored, err := server.Get(testStoreKey)
+			if !tt.wantStored {
+				if err == nil && tt.stored == nil {
+					t.Errorf("key left in the store: %s", stored)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("no response stored: %v", err)
+			}
+			var record idempotencyRecord
+			if err := json.Unmarshal([]byte(stored), &record); err != nil {
+				t.Fatal(err)
+			}
+			if !record.Completed || record.Fingerprint != testFingerprint(testRequestBody) {
+				t.Errorf("stored record = %+v, want completed with the first request's fingerprint", record)
+			}
+		})
+	}
+}
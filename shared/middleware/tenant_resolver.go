@@ -0,0 +1,226 @@
+package middleware
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pavitra93/go-multi-tenant-system/shared/models"
+	"github.com/pavitra93/go-multi-tenant-system/shared/utils"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const (
+	// ResolvedTenantHeader carries the host-resolved tenant from the gateway to services
+	ResolvedTenantHeader = "X-Resolved-Tenant-ID"
+	// ResolvedTenantKey is the gin context key for the host-resolved tenant
+	ResolvedTenantKey = "resolved_tenant_id"
+
+	// noTenantMarker is cached for hosts that don't map to a tenant
+	noTenantMarker = "none"
+)
+
+// TenantResolverConfig holds host resolution settings.
+// BaseDomain is the platform domain whose subdomains are tenant slugs (e.g. "app.example.com").
+type TenantResolverConfig struct {
+	BaseDomain string        `env:"TENANT_BASE_DOMAIN"`
+	CacheTTL   time.Duration `env:"TENANT_HOST_CACHE_TTL" default:"5m" validate:"gt=0"`
+}
+
+// TenantResolver maps request hosts to tenants by verified custom domain or subdomain
+type TenantResolver struct {
+	db             *gorm.DB
+	baseDomain     string
+	cacheTTL       time.Duration
+	trustedProxies []*net.IPNet
+}
+
+// NewTenantResolver creates a tenant resolver. X-Forwarded-Host is only honoured on requests
+// from trustedProxies, IPs or CIDR ranges; anyone else could pick the tenant with it.
+func NewTenantResolver(db *gorm.DB, config TenantResolverConfig, trustedProxies []string) *TenantResolver {
+	return &TenantResolver{
+		db:             db,
+		baseDomain:     strings.ToLower(strings.TrimPrefix(config.BaseDomain, ".")),
+		cacheTTL:       config.CacheTTL,
+		trustedProxies: parseProxies(trustedProxies),
+	}
+}
+
+// ResolveTenant resolves the tenant from the request host and stores it in the context.
+// Requests whose host doesn't map to a tenant pass through unchanged.
+func (tr *TenantResolver) ResolveTenant() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Never trust a client-supplied resolution
+		c.Request.Header.Del(ResolvedTenantHeader)
+
+		host := tr.requestHost(c)
+		tenantID, err := tr.lookup(host)
+		if err != nil {
+			logrus.WithError(err).WithField("host", host).Warn("Failed to resolve tenant from host")
+		}
+
+		if tenantID != "" {
+			c.Set(ResolvedTenantKey, tenantID)
+		}
+
+		c.Next()
+	}
+}
+
+// RequireTenantMatch rejects authenticated requests whose tenant differs from the host-resolved tenant.
+// Must run after RequireAuth. Platform admins are not tenant-scoped and are exempt.
+func (tr *TenantResolver) RequireTenantMatch() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		resolvedTenantID := c.GetString(ResolvedTenantKey)
+		if resolvedTenantID == "" || c.GetBool("is_admin") {
+			c.Next()
+			return
+		}
+
+		if c.GetString("tenant_id") != resolvedTenantID {
+			utils.CodedErrorResponse(c, utils.CodeTenantAccessDenied, "Token does not belong to this tenant", nil)
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// lookup returns the tenant ID for a host, using Redis as a cache when available
+func (tr *TenantResolver) lookup(host string) (string, error) {
+	if host == "" {
+		return "", nil
+	}
+
+	cacheKey := fmt.Sprintf("tenant:host:%s", host)
+	if cached, err := utils.CacheGet(cacheKey); err == nil {
+		if cached == noTenantMarker {
+			return "", nil
+		}
+		return cached, nil
+	}
+
+	query := tr.db.Model(&models.Tenant{}).Where("is_active = ?", true)
+	if slug := tr.subdomain(host); slug != "" {
+		query = query.Where("slug = ?", slug)
+	} else {
+		// A custom domain only counts once the tenant has proved it controls it
+		query = query.Where("LOWER(domain) = ? AND domain_status = ?", host, models.DomainStatusVerified)
+	}
+
+	var tenantIDs []string
+	if err := query.Limit(1).Pluck("id", &tenantIDs).Error; err != nil {
+		return "", fmt.Errorf("failed to look up tenant: %w", err)
+	}
+
+	tenantID := ""
+	cached := noTenantMarker
+	if len(tenantIDs) > 0 {
+		tenantID = tenantIDs[0]
+		cached = tenantID
+	}
+
+	// Cache failures are non-critical
+	if err := utils.CacheSet(cacheKey, cached, tr.cacheTTL); err != nil {
+		logrus.WithError(err).WithField("host", host).Debug("Failed to cache tenant host resolution")
+	}
+
+	return tenantID, nil
+}
+
+// subdomain returns the tenant slug when host is a direct subdomain of the base domain
+func (tr *TenantResolver) subdomain(host string) string {
+	if tr.baseDomain == "" || !strings.HasSuffix(host, "."+tr.baseDomain) {
+		return ""
+	}
+
+	slug := strings.TrimSuffix(host, "."+tr.baseDomain)
+	if strings.Contains(slug, ".") {
+		return ""
+	}
+	return slug
+}
+
+// InvalidateTenantHostCache removes cached host resolutions for a tenant's domain and subdomain,
+// and has gateways reload the tenant domains CORS allows. Call it with the tenant's previous
+// values whenever its domain, slug, status or domain verification changes.
+func InvalidateTenantHostCache(tenant *models.Tenant, baseDomain string) {
+	hosts := []string{strings.ToLower(tenant.Domain)}
+	if baseDomain != "" && tenant.Slug != nil {
+		hosts = append(hosts, strings.ToLower(*tenant.Slug+"."+strings.TrimPrefix(baseDomain, ".")))
+	}
+
+	for _, host := range hosts {
+		if err := utils.CacheDelete(fmt.Sprintf("tenant:host:%s", host)); err != nil {
+			logrus.WithError(err).WithField("host", host).Debug("Failed to invalidate tenant host cache")
+		}
+	}
+	invalidateTenantDomains()
+}
+
+// requestHost returns the lowercased request host without port, honouring X-Forwarded-Host
+// from trusted proxies
+func (tr *TenantResolver) requestHost(c *gin.Context) string {
+	host := c.Request.Host
+	if forwarded := c.GetHeader("X-Forwarded-Host"); forwarded != "" && tr.fromTrustedProxy(c) {
+		host = forwarded
+	}
+	// X-Forwarded-Host may hold a list when chained through proxies
+	if comma := strings.Index(host, ","); comma >= 0 {
+		host = host[:comma]
+	}
+	host = strings.TrimSpace(host)
+
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
+
+// fromTrustedProxy reports whether the request's direct peer is a trusted proxy
+func (tr *TenantResolver) fromTrustedProxy(c *gin.Context) bool {
+	ip := net.ParseIP(c.RemoteIP())
+	if ip == nil {
+		return false
+	}
+	for _, proxy := range tr.trustedProxies {
+		if proxy.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseProxies turns IPs and CIDR ranges into networks, skipping any that don't parse
+func parseProxies(proxies []string) []*net.IPNet {
+	var networks []*net.IPNet
+	for _, proxy := range proxies {
+		if !strings.Contains(proxy, "/") {
+			if ip := net.ParseIP(proxy); ip != nil {
+				bits := 8 * net.IPv6len
+				if ip.To4() != nil {
+					ip, bits = ip.To4(), 8*net.IPv4len
+				}
+				networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			}
+			continue
+		}
+		if _, network, err := net.ParseCIDR(proxy); err == nil {
+			networks = append(networks, network)
+		}
+	}
+	return networks
+}
+
+// GetResolvedTenantID returns the tenant resolved from the host by the gateway.
+// Services read it from the forwarded header; the gateway reads it from the context.
+func GetResolvedTenantID(c *gin.Context) string {
+	if tenantID := c.GetString(ResolvedTenantKey); tenantID != "" {
+		return tenantID
+	}
+	return c.GetHeader(ResolvedTenantHeader)
+}
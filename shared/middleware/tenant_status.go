@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/pavitra93/go-multi-tenant-system/shared/models"
+	"github.com/pavitra93/go-multi-tenant-system/shared/utils"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// tenantStatusCacheTTL bounds how long a status change takes to reach every service
+// when the cache could not be invalidated
+const tenantStatusCacheTTL = 30 * time.Second
+
+// tenantStatusKey is the Redis key caching a tenant's lifecycle status
+func tenantStatusKey(tenantID uuid.UUID) string {
+	return fmt.Sprintf("tenant:status:%s", tenantID)
+}
+
+// GetTenantStatus returns a tenant's lifecycle status, cached briefly in Redis.
+// A tenant that no longer exists is reported as deleted.
+func GetTenantStatus(db *gorm.DB, tenantID uuid.UUID) (models.TenantStatus, error) {
+	key := tenantStatusKey(tenantID)
+	if cached, err := utils.CacheGet(key); err == nil {
+		return models.TenantStatus(cached), nil
+	}
+
+	var tenant models.Tenant
+	status := models.TenantStatusDeleted
+	err := db.Select("status").Where("id = ?", tenantID).First(&tenant).Error
+	switch {
+	case err == nil:
+		status = tenant.Status
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return "", fmt.Errorf("failed to look up tenant status: %w", err)
+	}
+
+	// Cache failures are non-critical
+	if err := utils.CacheSet(key, string(status), tenantStatusCacheTTL); err != nil {
+		logrus.WithError(err).WithField("tenant_id", tenantID).Debug("Failed to cache tenant status")
+	}
+
+	return status, nil
+}
+
+// InvalidateTenantStatus drops the cached status so a change applies on the next request
+func InvalidateTenantStatus(tenantID uuid.UUID) {
+	if err := utils.CacheDelete(tenantStatusKey(tenantID)); err != nil {
+		logrus.WithError(err).WithField("tenant_id", tenantID).Warn("Failed to invalidate tenant status cache")
+	}
+}
+
+// TenantUnavailableResponse writes the error for a tenant whose status denies access
+func TenantUnavailableResponse(c *gin.Context, status models.TenantStatus) {
+	details := map[string]interface{}{"tenant_status": status}
+	if status == models.TenantStatusSuspended {
+		utils.CodedErrorResponse(c, utils.CodeTenantSuspended, "Tenant is suspended", details)
+		return
+	}
+	utils.CodedErrorResponse(c, utils.CodeTenantDeleted, "Tenant has been deleted or is scheduled for deletion", details)
+}
@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/pavitra93/go-multi-tenant-system/shared/tracing"
+)
+
+// RequestTracing assigns a request ID and starts a server span for every request.
+// An incoming X-Request-ID and W3C traceparent are honoured so the gateway's
+// identifiers follow the request through every service; a request ID that is too long
+// or has characters other than letters, digits, '.', '_' and '-' is replaced.
+func RequestTracing(serviceName string) gin.HandlerFunc {
+	tracer := tracing.Tracer(serviceName)
+
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(tracing.RequestIDHeader)
+		if !tracing.ValidRequestID(requestID) {
+			requestID = uuid.New().String()
+		}
+
+		ctx := tracing.Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+		ctx = tracing.WithRequestID(ctx, requestID)
+
+		spanName := c.FullPath()
+		if spanName == "" {
+			spanName = c.Request.URL.Path
+		}
+
+		ctx, span := tracer.Start(ctx, fmt.Sprintf("%s %s", c.Request.Method, spanName),
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				tracing.RequestIDAttribute(requestID),
+				attribute.String("http.method", c.Request.Method),
+				attribute.String("http.route", spanName),
+			),
+		)
+		defer span.End()
+
+		c.Request = c.Request.WithContext(ctx)
+		c.Set(tracing.RequestIDKey, requestID)
+		c.Header(tracing.RequestIDHeader, requestID)
+
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttributes(attribute.Int("http.status_code", status))
+		if tenantID := c.GetString("tenant_id"); tenantID != "" {
+			span.SetAttributes(attribute.String("tenant.id", tenantID))
+		}
+		if status >= 500 {
+			span.SetStatus(codes.Error, fmt.Sprintf("HTTP %d", status))
+		}
+	}
+}
+
+// GetRequestIDFromContext returns the request ID assigned by RequestTracing
+func GetRequestIDFromContext(c *gin.Context) string {
+	return c.GetString(tracing.RequestIDKey)
+}
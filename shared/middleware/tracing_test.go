@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/pavitra93/go-multi-tenant-system/shared/tracing"
+)
+
+func TestRequestTracingWithoutExporter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	const incomingTraceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+
+	tests := []struct {
+		name        string
+		exporter    string
+		traceParent string // Incoming traceparent header
+		wantTraceID string // Empty if a new trace is expected
+	}{
+		{name: "exporter unset", exporter: ""},
+		{name: "exporter none", exporter: "none"},
+		{name: "continues incoming trace", exporter: "none", traceParent: "00-" + incomingTraceID + "-00f067aa0ba902b7-01", wantTraceID: incomingTraceID},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("OTEL_TRACES_EXPORTER", tt.exporter)
+			previous := otel.GetTracerProvider()
+			shutdown, err := tracing.Init("test-service")
+			if err != nil {
+				t.Fatalf("Init() error = %v", err)
+			}
+			t.Cleanup(func() {
+				shutdown(context.Background())
+				otel.SetTracerProvider(previous)
+			})
+
+			var traceParent string
+			var spanContext trace.SpanContext
+			router := gin.New()
+			router.Use(RequestTracing("test-service"))
+			router.GET("/items", func(c *gin.Context) {
+				traceParent = tracing.TraceParent(c.Request.Context())
+				spanContext = trace.SpanContextFromContext(c.Request.Context())
+				c.Status(http.StatusNoContent)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/items", nil)
+			if tt.traceParent != "" {
+				req.Header.Set(tracing.TraceParentHeader, tt.traceParent)
+			}
+			router.ServeHTTP(httptest.NewRecorder(), req)
+
+			if !spanContext.IsValid() {
+				t.Fatalf("span context is not valid; traceparent = %q", traceParent)
+			}
+			if traceParent == "" {
+				t.Fatal("traceparent is empty")
+			}
+			if !spanContext.IsSampled() {
+				t.Error("span is not sampled")
+			}
+			if tt.wantTraceID != "" && spanContext.TraceID().String() != tt.wantTraceID {
+				t.Errorf("trace ID = %s, want %s", spanContext.TraceID(), tt.wantTraceID)
+			}
+		})
+	}
+}
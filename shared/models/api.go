@@ -0,0 +1,384 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Public API request and response bodies. These types are bound by the service
+// handlers and reflected into the OpenAPI document, so changing them changes the
+// published contract (run `make openapi` afterwards).
+
+// LoginRequest represents the login request
+type LoginRequest struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// LoginResponse represents the login response
+type LoginResponse struct {
+	AccessToken string      `json:"access_token"`
+	ExpiresIn   int64       `json:"expires_in"`
+	TokenType   string      `json:"token_type"`
+	UserInfo    UserProfile `json:"user_info"`
+	SessionID   string      `json:"session_id"`
+}
+
+// RegisterRequest represents the registration request
+type RegisterRequest struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required,min=8"`
+	TenantID string `json:"tenant_id,omitempty" binding:"omitempty,uuid"` // Optional when the tenant is resolved from the request host
+}
+
+// RegisterResponse represents the registration response
+type RegisterResponse struct {
+	CognitoID string    `json:"cognito_id"`
+	Username  string    `json:"username"`
+	Role      string    `json:"role"`
+	TenantID  uuid.UUID `json:"tenant_id"`
+	Message   string    `json:"message"`
+}
+
+// RefreshTokenRequest represents the token refresh request
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// RefreshTokenResponse represents the token refresh response
+type RefreshTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int64  `json:"expires_in"`
+	TokenType   string `json:"token_type"`
+}
+
+// LogoutResponse represents the logout response
+type LogoutResponse struct {
+	Message string `json:"message"`
+}
+
+// ConfirmEmailRequest represents an admin confirming a user's email on their behalf
+type ConfirmEmailRequest struct {
+	Username string `json:"username" binding:"required,max=255"`
+}
+
+// ConfirmEmailResponse represents the result of a manual email confirmation
+type ConfirmEmailResponse struct {
+	Username string `json:"username"`
+	Message  string `json:"message"`
+}
+
+// CreateTenantRequest represents the create tenant request
+type CreateTenantRequest struct {
+	Name   string  `json:"name" binding:"required,max=255"`
+	Domain string  `json:"domain" binding:"required,fqdn,max=255"`
+	Slug   *string `json:"slug"`
+	PlanID string  `json:"plan_id" binding:"omitempty,max=50"` // Defaults to the free plan
+}
+
+// UpdateTenantRequest represents the update tenant request
+type UpdateTenantRequest struct {
+	Name     *string `json:"name" binding:"omitempty,min=1,max=255"`
+	Domain   *string `json:"domain" binding:"omitempty,fqdn,max=255"`
+	Slug     *string `json:"slug"`
+	IsActive *bool   `json:"is_active"` // Admin only; false suspends the tenant, true reactivates it
+}
+
+// SuspendTenantRequest represents the suspend tenant request
+type SuspendTenantRequest struct {
+	Reason string `json:"reason" binding:"omitempty,max=500"`
+}
+
+// ChangePlanRequest represents moving a tenant to another plan
+type ChangePlanRequest struct {
+	PlanID string `json:"plan_id" binding:"required,max=50"`
+}
+
+// QuotaUsage reports one quota's limit and consumption. A nil limit means unlimited.
+type QuotaUsage struct {
+	Limit     *int       `json:"limit"`
+	Used      int64      `json:"used"`
+	Remaining *int64     `json:"remaining"`
+	ResetsAt  *time.Time `json:"resets_at,omitempty"` // Daily quotas reset at midnight UTC
+}
+
+// TenantUsageResponse represents a tenant's plan and how much of each quota it has used
+type TenantUsageResponse struct {
+	Plan                 Plan       `json:"plan"`
+	Users                QuotaUsage `json:"users"`
+	ConcurrentSessions   QuotaUsage `json:"concurrent_sessions"`
+	LocationUpdatesToday QuotaUsage `json:"location_updates_today"`
+	WebhookEndpoints     QuotaUsage `json:"webhook_endpoints"`
+	RetentionDays        *int       `json:"retention_days"`
+}
+
+// TenantStatsQuery selects the window of a tenant statistics report
+type TenantStatsQuery struct {
+	Window string `form:"window" json:"window" binding:"omitempty,oneof=1h 24h 7d 30d"` // Default 24h
+}
+
+// TenantStatsListQuery filters the admin statistics of every tenant
+type TenantStatsListQuery struct {
+	Window string `form:"window" json:"window" binding:"omitempty,oneof=1h 24h 7d 30d"` // Default 24h
+	Status string `form:"status" json:"status" binding:"omitempty,oneof=active suspended pending_deletion purging"`
+}
+
+// UserStats counts a tenant's users
+type UserStats struct {
+	Total       int64      `json:"total"`
+	Owners      int64      `json:"owners"`
+	LastLoginAt *time.Time `json:"last_login_at"`
+}
+
+// SessionStats counts a tenant's tracking sessions by status, and those started in the window
+type SessionStats struct {
+	Total           int64      `json:"total"`
+	Active          int64      `json:"active"`
+	Ended           int64      `json:"ended"`
+	Expired         int64      `json:"expired"`
+	Cancelled       int64      `json:"cancelled"`
+	StartedInWindow int64      `json:"started_in_window"`
+	LastStartedAt   *time.Time `json:"last_started_at"`
+}
+
+// LocationStats counts a tenant's stored locations, and those received in the window
+type LocationStats struct {
+	Total            int64      `json:"total"`
+	ReceivedInWindow int64      `json:"received_in_window"`
+	LastReceivedAt   *time.Time `json:"last_received_at"`
+}
+
+// DeliveryStats reports third-party delivery of a tenant's location events. The backlog
+// is current; the other counts cover the window, deliveries to the hour.
+type DeliveryStats struct {
+	Backlog           int64      `json:"backlog"` // Failed deliveries waiting to be retried
+	OldestBacklogAt   *time.Time `json:"oldest_backlog_at"`
+	Delivered         int64      `json:"delivered"`
+	Failed            int64      `json:"failed"`             // First attempts that failed and were queued for retry
+	PermanentlyFailed int64      `json:"permanently_failed"` // Events given up on
+	SuccessRate       *float64   `json:"success_rate"`       // delivered / (delivered + permanently_failed); nil without either
+}
+
+// TenantStats summarises a tenant's users, tracking activity and delivery health
+type TenantStats struct {
+	TenantID       uuid.UUID     `json:"tenant_id"`
+	TenantName     string        `json:"tenant_name"`
+	Status         TenantStatus  `json:"status"`
+	Window         string        `json:"window"`
+	WindowStart    time.Time     `json:"window_start"`
+	LastActivityAt *time.Time    `json:"last_activity_at"` // Latest login, session start or location
+	Users          UserStats     `json:"users"`
+	Sessions       SessionStats  `json:"sessions"`
+	Locations      LocationStats `json:"locations"`
+	Delivery       DeliveryStats `json:"delivery"`
+}
+
+// AuditEventListQuery filters audit events. From and to bound created_at.
+type AuditEventListQuery struct {
+	Action     string     `form:"action" json:"action" binding:"omitempty,max=100"` // e.g. tenant.updated
+	ActorID    string     `form:"actor_id" json:"actor_id" binding:"omitempty,max=255"`
+	TargetType string     `form:"target_type" json:"target_type" binding:"omitempty,oneof=tenant user invitation failed_location_update tenant_export user_erasure legal_hold"`
+	TargetID   string     `form:"target_id" json:"target_id" binding:"omitempty,max=255"`
+	From       *time.Time `form:"from" json:"from"`
+	To         *time.Time `form:"to" json:"to"`
+}
+
+// AuditTenantQuery narrows the admin audit log to one tenant
+type AuditTenantQuery struct {
+	TenantID string `form:"tenant_id" json:"tenant_id" binding:"omitempty,uuid"`
+}
+
+// AuditExportQuery selects the layout of an audit log export
+type AuditExportQuery struct {
+	Format string `form:"format" json:"format" binding:"omitempty,oneof=json csv"`
+}
+
+// AuditExport is the audit events of a period, oldest first
+type AuditExport struct {
+	From        time.Time    `json:"from"`
+	To          time.Time    `json:"to"`
+	GeneratedAt time.Time    `json:"generated_at"`
+	Events      []AuditEvent `json:"events"`
+}
+
+// CreateTenantExportRequest starts an export of a tenant's data
+type CreateTenantExportRequest struct {
+	Format string `json:"format" binding:"omitempty,oneof=ndjson csv"` // Default ndjson
+}
+
+// TenantExportListQuery filters a tenant's exports
+type TenantExportListQuery struct {
+	Status string `form:"status" json:"status" binding:"omitempty,oneof=pending running completed failed expired"`
+}
+
+// ExportDownloadQuery carries the signature of an export download link
+type ExportDownloadQuery struct {
+	Expires   int64  `form:"expires" json:"expires" binding:"required,min=1"` // Unix seconds
+	Signature string `form:"signature" json:"signature" binding:"required,hexadecimal,len=64"`
+}
+
+// RequestUserErasureRequest asks for a user's personal data to be erased
+type RequestUserErasureRequest struct {
+	Reason string `json:"reason" binding:"omitempty,max=2000"`
+}
+
+// UserErasureListQuery filters a tenant's user erasures
+type UserErasureListQuery struct {
+	Status string `form:"status" json:"status" binding:"omitempty,oneof=pending held blocked completed failed"`
+}
+
+// PlaceLegalHoldRequest places a legal hold on a tenant's data
+type PlaceLegalHoldRequest struct {
+	Reason    string `json:"reason" binding:"required,max=2000"`
+	Reference string `json:"reference" binding:"omitempty,max=255"` // e.g. a case or ticket number
+}
+
+// DomainVerificationResponse is a tenant's custom domain, its verification state and the
+// two ways to verify it: publishing the DNS record or serving the file
+type DomainVerificationResponse struct {
+	Domain      string              `json:"domain"`
+	Status      DomainStatus        `json:"status"`
+	VerifiedAt  *time.Time          `json:"verified_at,omitempty"`
+	VerifiedVia *string             `json:"verified_via,omitempty"` // dns or http
+	CheckedAt   *time.Time          `json:"checked_at,omitempty"`
+	NextCheckAt *time.Time          `json:"next_check_at,omitempty"`
+	Error       *string             `json:"error,omitempty"`
+	DNS         DomainDNSChallenge  `json:"dns"`
+	HTTP        DomainHTTPChallenge `json:"http"`
+}
+
+// DomainDNSChallenge is the TXT record that verifies a domain
+type DomainDNSChallenge struct {
+	Type  string `json:"type"`
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// DomainHTTPChallenge is the file that verifies a domain: Body served as text at URL
+type DomainHTTPChallenge struct {
+	URL  string `json:"url"`
+	Body string `json:"body"`
+}
+
+// UpdateTenantSettingsRequest replaces a tenant's settings. Version is the version being
+// replaced, 0 for a tenant without settings; a stale version is rejected.
+type UpdateTenantSettingsRequest struct {
+	Version  *int           `json:"version" binding:"required,min=0"`
+	Settings TenantSettings `json:"settings"`
+}
+
+// DeleteTenantResponse represents a scheduled tenant deletion
+type DeleteTenantResponse struct {
+	Tenant     Tenant    `json:"tenant"`
+	PurgeAfter time.Time `json:"purge_after"`
+	Message    string    `json:"message"`
+}
+
+// TenantListQuery filters the admin tenant listing
+type TenantListQuery struct {
+	Status        string     `form:"status" json:"status" binding:"omitempty,oneof=active suspended pending_deletion purging deleted"`
+	IsActive      *bool      `form:"is_active" json:"is_active"`
+	CreatedAfter  *time.Time `form:"created_after" json:"created_after"`
+	CreatedBefore *time.Time `form:"created_before" json:"created_before"`
+	Include       string     `form:"include" json:"include" binding:"omitempty,oneof=users"` // users: embed each tenant's users
+}
+
+// TenantUserListQuery filters a tenant's users
+type TenantUserListQuery struct {
+	Role          string     `form:"role" json:"role" binding:"omitempty,oneof=user tenant_owner"`
+	CreatedAfter  *time.Time `form:"created_after" json:"created_after"`
+	CreatedBefore *time.Time `form:"created_before" json:"created_before"`
+}
+
+// InviteUserRequest represents a tenant owner inviting a user to their tenant
+type InviteUserRequest struct {
+	Username string `json:"username" binding:"required,email,max=255"` // Email the invitation is sent to
+	Role     string `json:"role" binding:"required,oneof=user tenant_owner"`
+}
+
+// UpdateTenantUserRequest represents changing a tenant user's role
+type UpdateTenantUserRequest struct {
+	Role string `json:"role" binding:"required,oneof=user tenant_owner"`
+}
+
+// TransferOwnershipRequest represents handing tenant ownership to another user
+type TransferOwnershipRequest struct {
+	CognitoID string `json:"cognito_id" binding:"required"`
+}
+
+// TransferOwnershipResponse represents the result of an ownership transfer
+type TransferOwnershipResponse struct {
+	Owner   User   `json:"owner"`
+	Demoted []User `json:"demoted"` // Previous owners, now users; they must log in again
+}
+
+// AcceptInvitationRequest represents accepting an invitation by choosing a password
+type AcceptInvitationRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required,min=8"`
+}
+
+// StartSessionRequest represents the start session request
+type StartSessionRequest struct {
+	Duration int `json:"duration" binding:"omitempty,min=60,max=86400"` // in seconds; defaults to the tenant's session.default_duration setting
+}
+
+// LocationUpdateRequest represents the location update request.
+// Coordinates are pointers so that a legitimate 0.0 passes `required`.
+type LocationUpdateRequest struct {
+	SessionID uuid.UUID  `json:"session_id" binding:"required"`
+	Latitude  *float64   `json:"latitude" binding:"required,latitude"`
+	Longitude *float64   `json:"longitude" binding:"required,longitude"`
+	Timestamp *time.Time `json:"timestamp" binding:"omitempty,notfuture"`
+}
+
+// SessionListQuery filters the caller's tracking sessions
+type SessionListQuery struct {
+	Status        string     `form:"status" json:"status" binding:"omitempty,oneof=active ended expired cancelled"`
+	StartedAfter  *time.Time `form:"started_after" json:"started_after"`
+	StartedBefore *time.Time `form:"started_before" json:"started_before"`
+}
+
+// LocationListQuery filters a session's locations by their client timestamp
+type LocationListQuery struct {
+	From *time.Time `form:"from" json:"from"`
+	To   *time.Time `form:"to" json:"to"`
+}
+
+// UsageExportQuery selects the billing period and layout of a usage export. The period
+// is a UTC month, or from and to on the hour; neither means the current month.
+type UsageExportQuery struct {
+	Period      string     `form:"period" json:"period" binding:"omitempty,datetime=2006-01"`
+	From        *time.Time `form:"from" json:"from"`
+	To          *time.Time `form:"to" json:"to"`
+	TenantID    string     `form:"tenant_id" json:"tenant_id" binding:"omitempty,uuid"`
+	Format      string     `form:"format" json:"format" binding:"omitempty,oneof=json csv"`
+	Granularity string     `form:"granularity" json:"granularity" binding:"omitempty,oneof=total hour"`
+}
+
+// UsageCounts holds one value per billable metric
+type UsageCounts struct {
+	LocationsStored      int64 `json:"locations_stored"`
+	SessionsStarted      int64 `json:"sessions_started"`
+	SessionSeconds       int64 `json:"session_seconds"`
+	ThirdPartyDeliveries int64 `json:"third_party_deliveries"`
+	ActiveUsers          int64 `json:"active_users"` // Users first active in the month during this row's hours
+}
+
+// UsageExportRow is a tenant's usage for the whole period, or for one hour of it
+type UsageExportRow struct {
+	TenantID   uuid.UUID  `json:"tenant_id"`
+	TenantName string     `json:"tenant_name"`
+	Hour       *time.Time `json:"hour,omitempty"` // Only with granularity=hour
+	UsageCounts
+}
+
+// UsageExport is a billing period's metered usage
+type UsageExport struct {
+	PeriodStart time.Time        `json:"period_start"`
+	PeriodEnd   time.Time        `json:"period_end"`
+	Granularity string           `json:"granularity"`
+	GeneratedAt time.Time        `json:"generated_at"`
+	Rows        []UsageExportRow `json:"rows"`
+}
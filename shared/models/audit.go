@@ -0,0 +1,36 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// AuditEvent records one administrative action: who did what to which target, from
+// where, and how it changed. The audit_events table is append-only.
+type AuditEvent struct {
+	ID         uuid.UUID              `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	TenantID   *uuid.UUID             `json:"tenant_id" gorm:"type:uuid;index"`           // Nil for platform-wide actions
+	ActorID    string                 `json:"actor_id" gorm:"type:varchar(255);not null"` // Cognito ID, or "system" for background jobs
+	ActorRole  string                 `json:"actor_role" gorm:"type:varchar(50);not null"`
+	Action     string                 `json:"action" gorm:"type:varchar(100);not null"` // e.g. tenant.updated, user.role_changed
+	TargetType string                 `json:"target_type" gorm:"type:varchar(50);not null"`
+	TargetID   string                 `json:"target_id" gorm:"type:varchar(255);not null"`
+	Changes    map[string]AuditChange `json:"changes" gorm:"type:jsonb;serializer:json;not null"` // Keyed by dotted field path
+	Metadata   map[string]interface{} `json:"metadata" gorm:"type:jsonb;serializer:json;not null"`
+	RequestID  string                 `json:"request_id" gorm:"type:varchar(255)"`
+	IPAddress  string                 `json:"ip_address" gorm:"type:varchar(64)"`
+	CreatedAt  time.Time              `json:"created_at"`
+}
+
+// TableName returns the table name for the AuditEvent model
+func (AuditEvent) TableName() string {
+	return "audit_events"
+}
+
+// AuditChange is a field's value before and after an action; null where it was unset
+type AuditChange struct {
+	Before json.RawMessage `json:"before"`
+	After  json.RawMessage `json:"after"`
+}
@@ -0,0 +1,103 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// LegalHold preserves a tenant's data while it is in effect: user erasures wait, and
+// neither location retention nor the tenant's purge deletes anything
+type LegalHold struct {
+	ID         uuid.UUID  `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	TenantID   uuid.UUID  `json:"tenant_id" gorm:"type:uuid;not null;index"`
+	Reason     string     `json:"reason" gorm:"not null"`
+	Reference  *string    `json:"reference,omitempty"` // e.g. a case or ticket number
+	PlacedBy   string     `json:"placed_by" gorm:"type:varchar(255);not null"`
+	ReleasedBy *string    `json:"released_by,omitempty"`
+	ReleasedAt *time.Time `json:"released_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// TableName returns the table name for the LegalHold model
+func (LegalHold) TableName() string {
+	return "legal_holds"
+}
+
+// IsActive reports whether the hold is still in effect
+func (h *LegalHold) IsActive() bool {
+	return h.ReleasedAt == nil
+}
+
+// UserErasure is a request to erase a user's personal data, and once completed the
+// record of what was erased. The user's Cognito ID is cleared on completion; SubjectHash
+// still identifies them to anyone who knows it, and Pseudonym replaces it in the audit log.
+// Signature is an HMAC-SHA256 of the completed record's JSON with Signature left empty.
+type UserErasure struct {
+	ID          uuid.UUID     `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	TenantID    uuid.UUID     `json:"tenant_id" gorm:"type:uuid;not null;index"`
+	CognitoID   string        `json:"cognito_id,omitempty"`
+	SubjectHash string        `json:"subject_hash" gorm:"type:varchar(64);not null"` // Hex SHA256 of the Cognito ID
+	Pseudonym   string        `json:"pseudonym" gorm:"type:varchar(100);not null"`
+	Reason      *string       `json:"reason,omitempty"`
+	RequestedBy string        `json:"requested_by" gorm:"type:varchar(255);not null"`
+	Status      ErasureStatus `json:"status" gorm:"type:varchar(20);not null;default:'pending'"`
+	Attempts    int           `json:"attempts" gorm:"not null;default:0"`
+	LastError   *string       `json:"last_error,omitempty"`
+
+	// Erased records
+	LocationsDeleted         int64 `json:"locations_deleted"`
+	LocationSessionsDeleted  int64 `json:"location_sessions_deleted"`
+	FailedUpdatesDeleted     int64 `json:"failed_updates_deleted"`
+	InvitationsDeleted       int64 `json:"invitations_deleted"`
+	UsageEventsDeleted       int64 `json:"usage_events_deleted"`
+	AuditEventsPseudonymised int64 `json:"audit_events_pseudonymised"`
+	ExportsExpired           int64 `json:"exports_expired"` // Archives taken before the erasure, deleted early
+	UserDeleted              bool  `json:"user_deleted"`
+	CognitoUserDeleted       bool  `json:"cognito_user_deleted"`
+
+	RequestedAt  time.Time  `json:"requested_at" gorm:"column:created_at;autoCreateTime"`
+	DataErasedAt *time.Time `json:"data_erased_at,omitempty"`
+	CompletedAt  *time.Time `json:"completed_at,omitempty"`
+	UpdatedAt    time.Time  `json:"-"`
+
+	SignatureAlgorithm string `json:"signature_algorithm,omitempty"`
+	Signature          string `json:"signature,omitempty"`
+}
+
+// TableName returns the table name for the UserErasure model
+func (UserErasure) TableName() string {
+	return "user_erasures"
+}
+
+// SigningPayload returns the bytes the signature covers: the record as JSON with
+// Signature empty, the bookkeeping fields cleared and timestamps in UTC, so a record
+// read back from the database verifies the same as when it was written
+func (e UserErasure) SigningPayload() ([]byte, error) {
+	e.Signature = ""
+	e.Attempts = 0
+	e.LastError = nil
+	e.RequestedAt = e.RequestedAt.UTC()
+	if e.DataErasedAt != nil {
+		erasedAt := e.DataErasedAt.UTC()
+		e.DataErasedAt = &erasedAt
+	}
+	if e.CompletedAt != nil {
+		completedAt := e.CompletedAt.UTC()
+		e.CompletedAt = &completedAt
+	}
+	return json.Marshal(e)
+}
+
+// ErasureStatus is the state of a user erasure
+type ErasureStatus string
+
+const (
+	ErasureStatusPending   ErasureStatus = "pending"
+	ErasureStatusHeld      ErasureStatus = "held"    // Waiting for the tenant's legal holds to be released
+	ErasureStatusBlocked   ErasureStatus = "blocked" // Waiting for the tenant to have another owner
+	ErasureStatusCompleted ErasureStatus = "completed"
+	ErasureStatusFailed    ErasureStatus = "failed"
+)
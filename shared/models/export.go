@@ -0,0 +1,70 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TenantExport is a request for a zip archive of all of a tenant's data. The tenant
+// service builds the archive in the background and keeps it until ExpiresAt.
+type TenantExport struct {
+	ID          uuid.UUID    `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	TenantID    uuid.UUID    `json:"tenant_id" gorm:"type:uuid;not null;index"`
+	RequestedBy string       `json:"requested_by" gorm:"type:varchar(255);not null"`
+	Format      ExportFormat `json:"format" gorm:"type:varchar(10);not null"`
+	Status      ExportStatus `json:"status" gorm:"type:varchar(20);not null;default:'pending'"`
+	Attempts    int          `json:"attempts" gorm:"not null;default:0"`
+
+	// Progress
+	FilesTotal      int    `json:"files_total" gorm:"not null;default:0"`
+	FilesDone       int    `json:"files_done" gorm:"not null;default:0"`
+	CurrentFile     string `json:"current_file,omitempty"`
+	RecordsTotal    int64  `json:"records_total" gorm:"not null;default:0"`
+	RecordsExported int64  `json:"records_exported" gorm:"not null;default:0"`
+
+	// Archive
+	BlobKey   string  `json:"-"`
+	SizeBytes int64   `json:"size_bytes" gorm:"not null;default:0"`
+	SHA256    string  `json:"sha256,omitempty" gorm:"column:sha256"`
+	Error     *string `json:"error,omitempty"`
+
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"` // When the archive is deleted
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"` // Bumped with progress; a running export that stops updating is retried
+
+	// Signed link to the archive, set on completed exports when they are read
+	DownloadURL       string     `json:"download_url,omitempty" gorm:"-"`
+	DownloadExpiresAt *time.Time `json:"download_expires_at,omitempty" gorm:"-"`
+}
+
+// TableName returns the table name for the TenantExport model
+func (TenantExport) TableName() string {
+	return "tenant_exports"
+}
+
+// ExportFormat is the file format of the tables in an export archive
+type ExportFormat string
+
+const (
+	ExportFormatNDJSON ExportFormat = "ndjson"
+	ExportFormatCSV    ExportFormat = "csv"
+)
+
+// ExportStatus is the state of a tenant export
+type ExportStatus string
+
+const (
+	ExportStatusPending   ExportStatus = "pending"
+	ExportStatusRunning   ExportStatus = "running"
+	ExportStatusCompleted ExportStatus = "completed"
+	ExportStatusFailed    ExportStatus = "failed"
+	ExportStatusExpired   ExportStatus = "expired" // The archive was deleted
+)
+
+// IsActive reports whether the export is waiting for or being built by the exporter
+func (s ExportStatus) IsActive() bool {
+	return s == ExportStatusPending || s == ExportStatusRunning
+}
@@ -0,0 +1,65 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Invitation is a pending offer for someone to join a tenant with a role.
+// Only the SHA256 of the token is stored; the token itself is only ever in the invite link.
+type Invitation struct {
+	ID         uuid.UUID        `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	TenantID   uuid.UUID        `json:"tenant_id" gorm:"type:uuid;not null;index"`
+	Email      string           `json:"email" gorm:"not null"`
+	Role       UserRole         `json:"role" gorm:"type:user_role;not null"`
+	TokenHash  string           `json:"-" gorm:"not null;uniqueIndex"`
+	Status     InvitationStatus `json:"status" gorm:"type:varchar(20);not null;default:'pending'"`
+	InvitedBy  string           `json:"invited_by" gorm:"not null"`
+	ExpiresAt  time.Time        `json:"expires_at" gorm:"not null"`
+	SendCount  int              `json:"send_count" gorm:"not null;default:1"`
+	LastSentAt time.Time        `json:"last_sent_at"`
+	AcceptedAt *time.Time       `json:"accepted_at,omitempty"`
+	AcceptedBy *string          `json:"accepted_by,omitempty"` // Cognito ID of the created user
+	RevokedAt  *time.Time       `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time        `json:"created_at"`
+	UpdatedAt  time.Time        `json:"updated_at"`
+}
+
+// TableName returns the table name for the Invitation model
+func (Invitation) TableName() string {
+	return "invitations"
+}
+
+// InvitationStatus is the state of an invitation. Expired is never stored:
+// a pending invitation past ExpiresAt reports it.
+type InvitationStatus string
+
+const (
+	InvitationStatusPending  InvitationStatus = "pending"
+	InvitationStatusAccepted InvitationStatus = "accepted"
+	InvitationStatusRevoked  InvitationStatus = "revoked"
+	InvitationStatusExpired  InvitationStatus = "expired"
+)
+
+// IsExpired reports whether a pending invitation can no longer be accepted
+func (i *Invitation) IsExpired() bool {
+	return i.Status == InvitationStatusPending && time.Now().After(i.ExpiresAt)
+}
+
+// ReportedStatus returns the status shown to clients, deriving expired from ExpiresAt
+func (i *Invitation) ReportedStatus() InvitationStatus {
+	if i.IsExpired() {
+		return InvitationStatusExpired
+	}
+	return i.Status
+}
+
+// MarshalJSON reports the derived status, so clients see expired invitations as such
+func (i Invitation) MarshalJSON() ([]byte, error) {
+	type invitation Invitation
+	reported := invitation(i)
+	reported.Status = i.ReportedStatus()
+	return json.Marshal(reported)
+}
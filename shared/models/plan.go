@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// DefaultPlanID is the plan given to tenants created without one
+const DefaultPlanID = "free"
+
+// Plan is a subscription tier and the quotas it grants. A nil limit means unlimited.
+type Plan struct {
+	ID                       string    `json:"id" gorm:"type:varchar(50);primaryKey"`
+	Name                     string    `json:"name" gorm:"not null"`
+	MaxUsers                 *int      `json:"max_users"`
+	MaxConcurrentSessions    *int      `json:"max_concurrent_sessions"`
+	MaxLocationUpdatesPerDay *int      `json:"max_location_updates_per_day"`
+	RetentionDays            *int      `json:"retention_days"`
+	MaxWebhookEndpoints      *int      `json:"max_webhook_endpoints"`
+	CreatedAt                time.Time `json:"created_at"`
+	UpdatedAt                time.Time `json:"updated_at"`
+}
+
+// TableName returns the table name for the Plan model
+func (Plan) TableName() string {
+	return "plans"
+}
@@ -0,0 +1,115 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TenantSettings is a tenant's overrides of platform behaviour. A nil field uses the
+// platform default; the getters below resolve a field against its default.
+type TenantSettings struct {
+	Session   SessionSettings   `json:"session"`
+	Streaming StreamingSettings `json:"streaming"`
+	Retry     RetrySettings     `json:"retry"`
+	Retention RetentionSettings `json:"retention"`
+}
+
+// SessionSettings tunes tracking sessions
+type SessionSettings struct {
+	DefaultDuration *int `json:"default_duration,omitempty" binding:"omitempty,min=60,max=86400"` // Seconds, for sessions started without a duration
+}
+
+// StreamingSettings tunes delivery of location events to the third party
+type StreamingSettings struct {
+	// Endpoint receives the tenant's location events instead of THIRD_PARTY_ENDPOINT.
+	// The platform's third-party API key is only sent to the default endpoint.
+	Endpoint *string `json:"endpoint,omitempty" binding:"omitempty,url,startswith=https://,max=2048"`
+}
+
+// RetrySettings tunes retries of failed deliveries
+type RetrySettings struct {
+	MaxAttempts        *int `json:"max_attempts,omitempty" binding:"omitempty,min=1,max=20"`
+	BackoffBaseSeconds *int `json:"backoff_base_seconds,omitempty" binding:"omitempty,min=1,max=3600"` // Delay before the second attempt; doubles after each failure
+}
+
+// RetentionSettings tunes how long tracking data is kept
+type RetentionSettings struct {
+	LocationDays *int `json:"location_days,omitempty" binding:"omitempty,min=1,max=3650"` // At most the plan's retention_days
+}
+
+// SessionDuration returns the default session duration in seconds, or fallback
+func (s *TenantSettings) SessionDuration(fallback int) int {
+	if s == nil || s.Session.DefaultDuration == nil {
+		return fallback
+	}
+	return *s.Session.DefaultDuration
+}
+
+// StreamingEndpoint returns the tenant's third-party endpoint, or fallback
+func (s *TenantSettings) StreamingEndpoint(fallback string) string {
+	if s == nil || s.Streaming.Endpoint == nil {
+		return fallback
+	}
+	return *s.Streaming.Endpoint
+}
+
+// RetryMaxAttempts returns how many times a failed delivery is retried, or fallback
+func (s *TenantSettings) RetryMaxAttempts(fallback int) int {
+	if s == nil || s.Retry.MaxAttempts == nil {
+		return fallback
+	}
+	return *s.Retry.MaxAttempts
+}
+
+// RetryBackoffBase returns the delay before a failed delivery's second attempt, or fallback
+func (s *TenantSettings) RetryBackoffBase(fallback time.Duration) time.Duration {
+	if s == nil || s.Retry.BackoffBaseSeconds == nil {
+		return fallback
+	}
+	return time.Duration(*s.Retry.BackoffBaseSeconds) * time.Second
+}
+
+// LocationRetentionDays returns how many days locations are kept: the shorter of the
+// override and planDays. Nil means kept indefinitely.
+func (s *TenantSettings) LocationRetentionDays(planDays *int) *int {
+	if s == nil || s.Retention.LocationDays == nil {
+		return planDays
+	}
+	if planDays != nil && *planDays < *s.Retention.LocationDays {
+		return planDays
+	}
+	return s.Retention.LocationDays
+}
+
+// TenantSettingsRecord is the current version of a tenant's settings
+type TenantSettingsRecord struct {
+	TenantID  uuid.UUID      `json:"tenant_id" gorm:"type:uuid;primaryKey"`
+	Version   int            `json:"version" gorm:"not null"`
+	Settings  TenantSettings `json:"settings" gorm:"type:jsonb;serializer:json;not null"`
+	UpdatedBy string         `json:"updated_by" gorm:"type:varchar(255);not null"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+}
+
+// TableName returns the table name for the TenantSettingsRecord model
+func (TenantSettingsRecord) TableName() string {
+	return "tenant_settings"
+}
+
+// TenantSettingsChange records one version of a tenant's settings and who made it
+type TenantSettingsChange struct {
+	ID            uuid.UUID      `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	TenantID      uuid.UUID      `json:"tenant_id" gorm:"type:uuid;not null;index"`
+	Version       int            `json:"version" gorm:"not null"`
+	Settings      TenantSettings `json:"settings" gorm:"type:jsonb;serializer:json;not null"`
+	Previous      TenantSettings `json:"previous" gorm:"type:jsonb;serializer:json;not null"`
+	ChangedFields []string       `json:"changed_fields" gorm:"type:jsonb;serializer:json;not null"` // Dotted paths, e.g. retry.max_attempts
+	ChangedBy     string         `json:"changed_by" gorm:"type:varchar(255);not null"`
+	CreatedAt     time.Time      `json:"created_at"`
+}
+
+// TableName returns the table name for the TenantSettingsChange model
+func (TenantSettingsChange) TableName() string {
+	return "tenant_settings_changes"
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
@@ -9,15 +10,39 @@ import (
 
 // Tenant represents a tenant in the multi-tenant system
 type Tenant struct {
-	ID        uuid.UUID      `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
-	Name      string         `json:"name" gorm:"not null"`
-	Domain    string         `json:"domain" gorm:"uniqueIndex"`
-	IsActive  bool           `json:"is_active" gorm:"default:true"`
+	ID       uuid.UUID    `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	Name     string       `json:"name" gorm:"not null"`
+	Domain   string       `json:"domain" gorm:"uniqueIndex"`
+	Slug     *string      `json:"slug,omitempty" gorm:"uniqueIndex"` // Subdomain under TENANT_BASE_DOMAIN
+	Status   TenantStatus `json:"status" gorm:"type:varchar(20);not null;default:'active'"`
+	IsActive bool         `json:"is_active" gorm:"default:true"` // Mirrors Status == active for existing readers
+	PlanID   string       `json:"plan_id" gorm:"type:varchar(50);not null;default:'free'"`
+
+	// Lifecycle
+	StatusReason        *string    `json:"status_reason,omitempty"`
+	SuspendedAt         *time.Time `json:"suspended_at,omitempty"`
+	DeletionRequestedAt *time.Time `json:"deletion_requested_at,omitempty"`
+	DeletionRequestedBy *string    `json:"deletion_requested_by,omitempty"`
+	PurgeAfter          *time.Time `json:"purge_after,omitempty"` // End of the deletion grace period
+	PurgedAt            *time.Time `json:"purged_at,omitempty"`
+
+	// Custom domain verification; only a verified domain resolves to the tenant
+	DomainStatus        DomainStatus `json:"domain_status" gorm:"type:varchar(20);not null;default:'pending'"`
+	DomainToken         string       `json:"-" gorm:"column:domain_verification_token;type:varchar(64)"`
+	DomainTokenIssuedAt *time.Time   `json:"-"`                             // Pending domains fail some time after
+	DomainVerifiedAt    *time.Time   `json:"domain_verified_at,omitempty"`  // Last successful check
+	DomainVerifiedVia   *string      `json:"domain_verified_via,omitempty"` // dns or http
+	DomainCheckedAt     *time.Time   `json:"domain_checked_at,omitempty"`
+	DomainCheckDue      *time.Time   `json:"-"` // Next background check; nil once failed
+	DomainCheckFailures int          `json:"-" gorm:"not null;default:0"`
+	DomainError         *string      `json:"domain_error,omitempty"` // Why the last check failed
+
 	CreatedAt time.Time      `json:"created_at"`
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `json:"deleted_at" gorm:"index"`
 
 	// Relationships
+	Plan  *Plan  `json:"plan,omitempty" gorm:"foreignKey:PlanID"`
 	Users []User `json:"users,omitempty" gorm:"foreignKey:TenantID"`
 }
 
@@ -25,3 +50,112 @@ type Tenant struct {
 func (Tenant) TableName() string {
 	return "tenants"
 }
+
+// SetStatus changes the lifecycle status and keeps IsActive in step
+func (t *Tenant) SetStatus(status TenantStatus) {
+	t.Status = status
+	t.IsActive = status == TenantStatusActive
+}
+
+// RestartDomainVerification starts verifying the tenant's domain afresh with token;
+// the domain stops resolving to the tenant until it is verified
+func (t *Tenant) RestartDomainVerification(token string, now time.Time) {
+	issuedAt, due := now, now
+	t.DomainStatus = DomainStatusPending
+	t.DomainToken = token
+	t.DomainTokenIssuedAt = &issuedAt
+	t.DomainCheckDue = &due
+	t.DomainVerifiedAt = nil
+	t.DomainVerifiedVia = nil
+	t.DomainCheckedAt = nil
+	t.DomainCheckFailures = 0
+	t.DomainError = nil
+}
+
+// DomainStatus is the verification state of a tenant's custom domain
+type DomainStatus string
+
+const (
+	DomainStatusPending  DomainStatus = "pending"
+	DomainStatusVerified DomainStatus = "verified"
+	DomainStatusFailed   DomainStatus = "failed" // Not verified in time, or no longer verifiable; checked again on request
+)
+
+// TenantStatus is the lifecycle state of a tenant
+type TenantStatus string
+
+const (
+	TenantStatusActive          TenantStatus = "active"
+	TenantStatusSuspended       TenantStatus = "suspended"
+	TenantStatusPendingDeletion TenantStatus = "pending_deletion"
+	TenantStatusPurging         TenantStatus = "purging" // Claimed by the purger; can no longer be reactivated
+	TenantStatusDeleted         TenantStatus = "deleted"
+)
+
+// tenantTransitions lists the statuses each status may move to.
+// Deleted is terminal; a pending deletion can be cancelled by reactivating until the purge starts.
+var tenantTransitions = map[TenantStatus][]TenantStatus{
+	TenantStatusActive:          {TenantStatusSuspended, TenantStatusPendingDeletion},
+	TenantStatusSuspended:       {TenantStatusActive, TenantStatusPendingDeletion},
+	TenantStatusPendingDeletion: {TenantStatusActive, TenantStatusPurging},
+	TenantStatusPurging:         {TenantStatusDeleted},
+}
+
+// CanTransitionTo reports whether a tenant in status s may move to next
+func (s TenantStatus) CanTransitionTo(next TenantStatus) bool {
+	for _, allowed := range tenantTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsAccess reports whether users of a tenant in status s may sign in and call the API
+func (s TenantStatus) AllowsAccess() bool {
+	return s == TenantStatusActive
+}
+
+// TenantDeletionReport records what was purged when a tenant was deleted.
+// Signature is an HMAC-SHA256 of the report's JSON with Signature left empty.
+type TenantDeletionReport struct {
+	ID                  uuid.UUID  `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	TenantID            uuid.UUID  `json:"tenant_id" gorm:"type:uuid;not null;uniqueIndex"`
+	TenantName          string     `json:"tenant_name"`
+	TenantDomain        string     `json:"tenant_domain"`
+	DeletionRequestedAt *time.Time `json:"deletion_requested_at,omitempty"`
+	DeletionRequestedBy *string    `json:"deletion_requested_by,omitempty"`
+	StartedAt           time.Time  `json:"started_at"`
+	CompletedAt         time.Time  `json:"completed_at"`
+
+	// Purged records
+	LocationsDeleted        int64 `json:"locations_deleted"`
+	LocationSessionsDeleted int64 `json:"location_sessions_deleted"`
+	FailedUpdatesDeleted    int64 `json:"failed_updates_deleted"`
+	InvitationsDeleted      int64 `json:"invitations_deleted"`
+	UsersDeleted            int64 `json:"users_deleted"`
+	CognitoUsersDeleted     int64 `json:"cognito_users_deleted"`
+	TokenSessionsRevoked    int64 `json:"token_sessions_revoked"`
+
+	SignatureAlgorithm string `json:"signature_algorithm"`
+	Signature          string `json:"signature"`
+}
+
+// TableName returns the table name for the TenantDeletionReport model
+func (TenantDeletionReport) TableName() string {
+	return "tenant_deletion_reports"
+}
+
+// SigningPayload returns the bytes the signature covers: the report as JSON with
+// Signature empty and timestamps in UTC, so a report read back from the database
+// verifies the same as when it was written
+func (r TenantDeletionReport) SigningPayload() ([]byte, error) {
+	r.Signature = ""
+	r.StartedAt = r.StartedAt.UTC()
+	r.CompletedAt = r.CompletedAt.UTC()
+	if r.DeletionRequestedAt != nil {
+		requestedAt := r.DeletionRequestedAt.UTC()
+		r.DeletionRequestedAt = &requestedAt
+	}
+	return json.Marshal(r)
+}
@@ -0,0 +1,58 @@
+// Package notify delivers messages such as invitation emails through a
+// configurable channel: SMTP in production, a file or log sink for development.
+package notify
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pavitra93/go-multi-tenant-system/shared/config"
+)
+
+// SMTPPasswordSecret names the SMTP password in the secret provider
+const SMTPPasswordSecret = "SMTP_PASSWORD"
+
+// Message is a plain-text notification to a single recipient
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Notifier delivers messages
+type Notifier interface {
+	// Name identifies the notifier in logs
+	Name() string
+	Send(ctx context.Context, msg Message) error
+}
+
+// Config selects and configures the notifier
+type Config struct {
+	Provider string `env:"NOTIFIER" default:"log" validate:"oneof=smtp file log"`
+
+	// FileDir receives one .eml file per message with the file notifier
+	FileDir string `env:"NOTIFIER_FILE_DIR" default:"./outbox" validate:"required_if=Provider file"`
+
+	SMTPHost     string        `env:"SMTP_HOST" validate:"required_if=Provider smtp"`
+	SMTPPort     int           `env:"SMTP_PORT" default:"587" validate:"min=1,max=65535"`
+	SMTPUsername string        `env:"SMTP_USERNAME"`
+	SMTPPassword string        `env:"SMTP_PASSWORD" secret:"true"`
+	SMTPFrom     string        `env:"SMTP_FROM" default:"no-reply@localhost" validate:"required"`
+	SMTPTimeout  time.Duration `env:"SMTP_TIMEOUT" default:"10s" validate:"gt=0"`
+}
+
+// New creates the notifier selected by cfg.Provider. The SMTP password is read
+// from secrets on every send so a rotated password applies immediately.
+func New(cfg Config, secrets *config.SecretManager) (Notifier, error) {
+	switch cfg.Provider {
+	case "smtp":
+		return NewSMTPNotifier(cfg, secrets.Secret(SMTPPasswordSecret)), nil
+	case "file":
+		return &FileNotifier{Dir: cfg.FileDir, From: cfg.SMTPFrom}, nil
+	case "log":
+		return LogNotifier{}, nil
+	default:
+		return nil, fmt.Errorf("unknown notifier %q", cfg.Provider)
+	}
+}
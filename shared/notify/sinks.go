@@ -0,0 +1,153 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/pavitra93/go-multi-tenant-system/shared/config"
+)
+
+// SMTPNotifier sends messages through an SMTP server, upgrading to TLS when offered
+type SMTPNotifier struct {
+	addr     string
+	host     string
+	username string
+	password *config.Secret
+	from     string
+	timeout  time.Duration
+}
+
+// NewSMTPNotifier creates an SMTP notifier from cfg
+func NewSMTPNotifier(cfg Config, password *config.Secret) *SMTPNotifier {
+	return &SMTPNotifier{
+		addr:     net.JoinHostPort(cfg.SMTPHost, fmt.Sprint(cfg.SMTPPort)),
+		host:     cfg.SMTPHost,
+		username: cfg.SMTPUsername,
+		password: password,
+		from:     cfg.SMTPFrom,
+		timeout:  cfg.SMTPTimeout,
+	}
+}
+
+// Name identifies the notifier in logs
+func (*SMTPNotifier) Name() string {
+	return "smtp"
+}
+
+// Send delivers msg, giving up after the configured timeout
+func (n *SMTPNotifier) Send(ctx context.Context, msg Message) error {
+	ctx, cancel := context.WithTimeout(ctx, n.timeout)
+	defer cancel()
+
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", n.addr)
+	if err != nil {
+		return fmt.Errorf("failed to connect to SMTP server: %w", err)
+	}
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+
+	client, err := smtp.NewClient(conn, n.host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to start SMTP session: %w", err)
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: n.host}); err != nil {
+			return fmt.Errorf("failed to start TLS: %w", err)
+		}
+	}
+	if n.username != "" {
+		if err := client.Auth(smtp.PlainAuth("", n.username, n.password.Value(), n.host)); err != nil {
+			return fmt.Errorf("SMTP authentication failed: %w", err)
+		}
+	}
+
+	if err := client.Mail(n.from); err != nil {
+		return fmt.Errorf("SMTP MAIL FROM rejected: %w", err)
+	}
+	if err := client.Rcpt(msg.To); err != nil {
+		return fmt.Errorf("SMTP recipient rejected: %w", err)
+	}
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("SMTP DATA rejected: %w", err)
+	}
+	if _, err := w.Write(formatMessage(n.from, msg)); err != nil {
+		return fmt.Errorf("failed to write message: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("SMTP server rejected message: %w", err)
+	}
+	return client.Quit()
+}
+
+// FileNotifier writes each message to Dir as an .eml file, for local development
+type FileNotifier struct {
+	Dir  string
+	From string
+}
+
+// Name identifies the notifier in logs
+func (*FileNotifier) Name() string {
+	return "file"
+}
+
+// unsafeFileChars are replaced in the recipient part of file names
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9@._-]`)
+
+// Send writes msg to <Dir>/<timestamp>-<recipient>.eml
+func (n *FileNotifier) Send(_ context.Context, msg Message) error {
+	if err := os.MkdirAll(n.Dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create outbox: %w", err)
+	}
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405.000000000"), unsafeFileChars.ReplaceAllString(msg.To, "_"))
+	if err := os.WriteFile(filepath.Join(n.Dir, name), formatMessage(n.From, msg), 0o600); err != nil {
+		return fmt.Errorf("failed to write message: %w", err)
+	}
+	return nil
+}
+
+// LogNotifier logs messages instead of sending them, for local development
+type LogNotifier struct{}
+
+// Name identifies the notifier in logs
+func (LogNotifier) Name() string {
+	return "log"
+}
+
+// Send logs msg, including its body
+func (LogNotifier) Send(_ context.Context, msg Message) error {
+	logrus.WithFields(logrus.Fields{
+		"to":      msg.To,
+		"subject": msg.Subject,
+		"body":    msg.Body,
+	}).Info("Notification (log notifier)")
+	return nil
+}
+
+// formatMessage renders msg as a plain-text RFC 5322 message
+func formatMessage(from string, msg Message) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	buf.WriteString("\r\n")
+	buf.WriteString(msg.Body)
+	return buf.Bytes()
+}
@@ -0,0 +1,123 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Diff compares a published document with one generated from the handlers' types
+// and returns a sorted description of every operation or schema that drifted
+func Diff(published, generated *Document) []string {
+	var drift []string
+
+	for _, path := range unionKeys(published.Paths, generated.Paths) {
+		publishedItem, generatedItem := published.Paths[path], generated.Paths[path]
+		for _, method := range unionOperationKeys(publishedItem, generatedItem) {
+			publishedOp, generatedOp := operation(publishedItem, method), operation(generatedItem, method)
+			name := strings.ToUpper(method) + " " + path
+			switch {
+			case publishedOp == nil:
+				drift = append(drift, name+": missing from published spec")
+			case generatedOp == nil:
+				drift = append(drift, name+": published but no longer served")
+			case !sameJSON(publishedOp, generatedOp):
+				drift = append(drift, name+": operation differs from handler types")
+			}
+		}
+	}
+
+	for _, name := range unionKeys(published.Components.Schemas, generated.Components.Schemas) {
+		publishedSchema, generatedSchema := published.Components.Schemas[name], generated.Components.Schemas[name]
+		switch {
+		case publishedSchema == nil:
+			drift = append(drift, "schema "+name+": missing from published spec")
+		case generatedSchema == nil:
+			drift = append(drift, "schema "+name+": published but no longer used")
+		case !sameJSON(publishedSchema, generatedSchema):
+			drift = append(drift, "schema "+name+": differs from Go type")
+		}
+	}
+
+	return drift
+}
+
+// UndocumentedRoutes returns routes registered under basePath that the document doesn't
+// describe, and documented operations with no registered route
+func UndocumentedRoutes(document *Document, routes gin.RoutesInfo, basePath string) []string {
+	registered := make(map[string]bool)
+	var problems []string
+
+	for _, route := range routes {
+		if !strings.HasPrefix(route.Path, basePath+"/") {
+			continue
+		}
+		path, _ := convertPath(strings.TrimPrefix(route.Path, basePath))
+		method := strings.ToLower(route.Method)
+		registered[method+" "+path] = true
+
+		if operation(document.Paths[path], method) == nil {
+			problems = append(problems, fmt.Sprintf("%s %s: route is not documented", route.Method, route.Path))
+		}
+	}
+
+	for path, item := range document.Paths {
+		for method := range *item {
+			if !registered[method+" "+path] {
+				problems = append(problems, fmt.Sprintf("%s %s%s: documented but not routed", strings.ToUpper(method), basePath, path))
+			}
+		}
+	}
+
+	sort.Strings(problems)
+	return problems
+}
+
+// operation returns the operation for method on item, or nil
+func operation(item *PathItem, method string) *Operation {
+	if item == nil {
+		return nil
+	}
+	return (*item)[method]
+}
+
+// sameJSON reports whether two values encode to the same JSON
+func sameJSON(a, b interface{}) bool {
+	encodedA, errA := json.Marshal(a)
+	encodedB, errB := json.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(encodedA, encodedB)
+}
+
+// unionKeys returns the sorted union of two maps' keys
+func unionKeys[V any](a, b map[string]V) []string {
+	seen := make(map[string]bool, len(a)+len(b))
+	for key := range a {
+		seen[key] = true
+	}
+	for key := range b {
+		seen[key] = true
+	}
+
+	keys := make([]string, 0, len(seen))
+	for key := range seen {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// unionOperationKeys returns the sorted union of the methods on two path items
+func unionOperationKeys(a, b *PathItem) []string {
+	var itemA, itemB PathItem
+	if a != nil {
+		itemA = *a
+	}
+	if b != nil {
+		itemB = *b
+	}
+	return unionKeys(itemA, itemB)
+}
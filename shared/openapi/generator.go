@@ -0,0 +1,192 @@
+package openapi
+
+import (
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Route documents one API operation together with the Go types its handler binds and returns
+type Route struct {
+	Method  string
+	Path    string // Gin-style path, e.g. /tenants/:id
+	Summary string
+	Tag     string
+	Auth    bool // Requires a bearer token
+
+	Query    []interface{} // Zero values of the structs bound from the query string
+	Request  interface{}   // Zero value of the JSON body bound by the handler, nil if none
+	Response interface{}   // Zero value of the response data payload, nil if none
+	Status   int           // Success status, defaults to 200
+
+	Headers []Parameter // Optional request headers, e.g. Idempotency-Key
+}
+
+// problemContentType is the RFC 7807 media type offered for error responses
+const problemContentType = "application/problem+json"
+
+// Generator builds an OpenAPI document from route definitions
+type Generator struct {
+	document *Document
+	registry *schemaRegistry
+	envelope *Schema
+	problem  *Schema
+}
+
+// NewGenerator creates a generator for an API served under the given base path (e.g. /v1)
+func NewGenerator(info Info, basePath string) *Generator {
+	return &Generator{
+		document: &Document{
+			OpenAPI: Version,
+			Info:    info,
+			Servers: []Server{{URL: basePath}},
+			Paths:   make(map[string]*PathItem),
+			Components: Components{
+				SecuritySchemes: map[string]*SecurityScheme{
+					"bearerAuth": {Type: "http", Scheme: "bearer", BearerFormat: "JWT"},
+				},
+			},
+		},
+		registry: newSchemaRegistry(),
+	}
+}
+
+// SetEnvelope sets the type every response is wrapped in. Its "data" property is
+// narrowed to each route's response type.
+func (g *Generator) SetEnvelope(envelope interface{}) {
+	g.envelope = g.registry.schemaFor(envelope)
+}
+
+// SetProblem documents an RFC 7807 problem+json alternative for error responses
+func (g *Generator) SetProblem(problem interface{}) {
+	g.problem = g.registry.schemaFor(problem)
+}
+
+// Add adds routes to the document
+func (g *Generator) Add(routes ...Route) {
+	for _, route := range routes {
+		path, params := convertPath(route.Path)
+
+		item, ok := g.document.Paths[path]
+		if !ok {
+			item = &PathItem{}
+			g.document.Paths[path] = item
+		}
+
+		operation := &Operation{
+			OperationID: operationID(route.Method, route.Path),
+			Summary:     route.Summary,
+			Parameters:  params,
+			Responses:   make(map[string]*Response),
+		}
+		for _, query := range route.Query {
+			operation.Parameters = append(operation.Parameters, g.registry.queryParameters(reflect.TypeOf(query))...)
+		}
+		operation.Parameters = append(operation.Parameters, route.Headers...)
+		if route.Tag != "" {
+			operation.Tags = []string{route.Tag}
+		}
+		if route.Auth {
+			operation.Security = []map[string][]string{{"bearerAuth": {}}}
+		}
+
+		if body := g.registry.schemaFor(route.Request); body != nil {
+			operation.RequestBody = &RequestBody{
+				Required: true,
+				Content:  jsonContent(body),
+			}
+		}
+
+		status := route.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		operation.Responses[strconv.Itoa(status)] = &Response{
+			Description: http.StatusText(status),
+			Content:     jsonContent(g.responseSchema(g.registry.schemaFor(route.Response))),
+		}
+		errorResponse := &Response{
+			Description: "Error",
+			Content:     jsonContent(g.responseSchema(nil)),
+		}
+		if g.problem != nil {
+			errorResponse.Content[problemContentType] = &MediaType{Schema: g.problem}
+		}
+		operation.Responses["default"] = errorResponse
+
+		(*item)[strings.ToLower(route.Method)] = operation
+	}
+}
+
+// Document returns the generated document
+func (g *Generator) Document() *Document {
+	g.document.Components.Schemas = g.registry.schemas
+	return g.document
+}
+
+// responseSchema wraps a data schema in the envelope, if one is set
+func (g *Generator) responseSchema(data *Schema) *Schema {
+	if g.envelope == nil {
+		if data == nil {
+			return &Schema{}
+		}
+		return data
+	}
+	if data == nil {
+		return g.envelope
+	}
+	return &Schema{
+		AllOf: []*Schema{
+			g.envelope,
+			{Type: "object", Properties: map[string]*Schema{"data": data}},
+		},
+	}
+}
+
+// jsonContent returns an application/json content map for schema
+func jsonContent(schema *Schema) map[string]*MediaType {
+	return map[string]*MediaType{"application/json": {Schema: schema}}
+}
+
+// convertPath turns a Gin path into an OpenAPI path and its path parameters
+func convertPath(ginPath string) (string, []Parameter) {
+	var params []Parameter
+	segments := strings.Split(ginPath, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			name := segment[1:]
+			segments[i] = "{" + name + "}"
+			params = append(params, Parameter{
+				Name:     name,
+				In:       "path",
+				Required: true,
+				Schema:   &Schema{Type: "string"},
+			})
+		}
+	}
+	return strings.Join(segments, "/"), params
+}
+
+// operationID derives a stable camelCase operation ID from method and path,
+// e.g. GET /tenants/:id/users -> getTenantsByIdUsers
+func operationID(method, ginPath string) string {
+	var builder strings.Builder
+	builder.WriteString(strings.ToLower(method))
+	for _, segment := range strings.Split(ginPath, "/") {
+		if segment == "" {
+			continue
+		}
+		if strings.HasPrefix(segment, ":") {
+			builder.WriteString("By")
+			segment = segment[1:]
+		}
+		for _, part := range strings.FieldsFunc(segment, func(r rune) bool { return r == '_' || r == '-' }) {
+			runes := []rune(part)
+			runes[0] = unicode.ToUpper(runes[0])
+			builder.WriteString(string(runes))
+		}
+	}
+	return builder.String()
+}
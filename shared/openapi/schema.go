@@ -0,0 +1,256 @@
+package openapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// wellKnownSchemas maps types with custom JSON encodings to their wire schema
+var wellKnownSchemas = map[reflect.Type]func() *Schema{
+	reflect.TypeOf(time.Time{}):       func() *Schema { return &Schema{Type: "string", Format: "date-time"} },
+	reflect.TypeOf(uuid.UUID{}):       func() *Schema { return &Schema{Type: "string", Format: "uuid"} },
+	reflect.TypeOf(gorm.DeletedAt{}):  func() *Schema { return &Schema{Type: "string", Format: "date-time", Nullable: true} },
+	reflect.TypeOf(json.RawMessage{}): func() *Schema { return &Schema{} },
+	reflect.TypeOf([]byte{}):          func() *Schema { return &Schema{Type: "string", Format: "byte"} },
+}
+
+// enumerator is implemented by named types with a closed set of values, e.g. utils.ErrorCode
+type enumerator interface {
+	EnumValues() []string
+}
+
+var enumeratorType = reflect.TypeOf((*enumerator)(nil)).Elem()
+
+// schemaRegistry builds schemas for Go types, registering named structs as components
+type schemaRegistry struct {
+	schemas map[string]*Schema
+	types   map[string]reflect.Type
+}
+
+func newSchemaRegistry() *schemaRegistry {
+	return &schemaRegistry{
+		schemas: make(map[string]*Schema),
+		types:   make(map[string]reflect.Type),
+	}
+}
+
+// schemaFor returns the schema for a value's type, or nil for a nil value
+func (r *schemaRegistry) schemaFor(value interface{}) *Schema {
+	if value == nil {
+		return nil
+	}
+	return r.schemaForType(reflect.TypeOf(value))
+}
+
+// schemaForType returns an inline schema or a $ref to a component schema
+func (r *schemaRegistry) schemaForType(t reflect.Type) *Schema {
+	if build, ok := wellKnownSchemas[t]; ok {
+		return build()
+	}
+	if t.Kind() == reflect.String && t.Implements(enumeratorType) {
+		values := reflect.Zero(t).Interface().(enumerator).EnumValues()
+		return &Schema{Type: "string", Enum: values}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		schema := r.schemaForType(t.Elem())
+		if schema.Ref != "" {
+			// Siblings of $ref are ignored in OpenAPI 3.0, so wrap it to mark it nullable
+			return &Schema{AllOf: []*Schema{schema}, Nullable: true}
+		}
+		schema.Nullable = true
+		return schema
+	case reflect.Interface:
+		return &Schema{}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: r.schemaForType(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: r.schemaForType(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return r.structSchema(t)
+		}
+		return r.componentRef(t)
+	default:
+		return &Schema{}
+	}
+}
+
+// componentRef registers a named struct under components/schemas and returns a reference to it
+func (r *schemaRegistry) componentRef(t reflect.Type) *Schema {
+	name := t.Name()
+	ref := &Schema{Ref: "#/components/schemas/" + name}
+
+	if existing, ok := r.types[name]; ok {
+		if existing != t {
+			panic("openapi: schema name " + name + " used by both " + existing.String() + " and " + t.String())
+		}
+		return ref
+	}
+
+	// Register before recursing so self-referencing types terminate
+	r.types[name] = t
+	r.schemas[name] = &Schema{}
+	*r.schemas[name] = *r.structSchema(t)
+	return ref
+}
+
+// structSchema builds an object schema from a struct's JSON and binding tags
+func (r *schemaRegistry) structSchema(t reflect.Type) *Schema {
+	schema := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	r.addFields(schema, t)
+	return schema
+}
+
+// addFields adds a struct's exported fields to schema, flattening embedded structs like encoding/json
+func (r *schemaRegistry) addFields(schema *Schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() && !field.Anonymous {
+			continue
+		}
+
+		name, skip := jsonFieldName(field)
+		if skip {
+			continue
+		}
+
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				r.addFields(schema, embedded)
+				continue
+			}
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		property := r.schemaForType(field.Type)
+		if applyBinding(property, field.Tag.Get("binding")) {
+			schema.Required = append(schema.Required, name)
+		}
+		schema.Properties[name] = property
+	}
+}
+
+// queryParameters describes a query struct's fields, named by their form tags, as query parameters
+func (r *schemaRegistry) queryParameters(t reflect.Type) []Parameter {
+	var params []Parameter
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("form"), ",")
+		if !field.IsExported() || name == "" || name == "-" {
+			continue
+		}
+
+		// Absent parameters are simply omitted, so pointers aren't nullable here
+		fieldType := field.Type
+		if fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+		schema := r.schemaForType(fieldType)
+		params = append(params, Parameter{
+			Name:     name,
+			In:       "query",
+			Required: applyBinding(schema, field.Tag.Get("binding")),
+			Schema:   schema,
+		})
+	}
+	return params
+}
+
+// jsonFieldName returns the JSON name from the field's tag and whether the field is skipped
+func jsonFieldName(field reflect.StructField) (string, bool) {
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return "", true
+	}
+	name, _, _ := strings.Cut(tag, ",")
+	return name, false
+}
+
+// applyBinding maps gin validator rules onto schema constraints and reports whether the field is required
+func applyBinding(schema *Schema, binding string) bool {
+	if binding == "" {
+		return false
+	}
+
+	required := false
+	for _, rule := range strings.Split(binding, ",") {
+		name, param, _ := strings.Cut(rule, "=")
+		switch name {
+		case "required":
+			required = true
+		case "email":
+			schema.Format = "email"
+		case "uuid", "uuid4":
+			schema.Format = "uuid"
+		case "url":
+			schema.Format = "uri"
+		case "fqdn":
+			schema.Format = "hostname"
+		case "latitude":
+			applyBound(schema, "-90", true)
+			applyBound(schema, "90", false)
+		case "longitude":
+			applyBound(schema, "-180", true)
+			applyBound(schema, "180", false)
+		case "notfuture":
+			schema.Description = "Must not be in the future beyond a small clock skew"
+		case "oneof":
+			schema.Enum = strings.Fields(param)
+		case "min", "gte":
+			applyBound(schema, param, true)
+		case "max", "lte":
+			applyBound(schema, param, false)
+		}
+	}
+	return required
+}
+
+// applyBound sets a length bound on strings and a value bound on numbers
+func applyBound(schema *Schema, param string, lower bool) {
+	value, err := strconv.ParseFloat(param, 64)
+	if err != nil {
+		return
+	}
+
+	switch schema.Type {
+	case "string":
+		length := int(value)
+		if lower {
+			schema.MinLength = &length
+		} else {
+			schema.MaxLength = &length
+		}
+	case "integer", "number":
+		if lower {
+			schema.Minimum = &value
+		} else {
+			schema.Maximum = &value
+		}
+	}
+}
@@ -0,0 +1,241 @@
+// Package pagination implements cursor (keyset) pagination for list endpoints.
+//
+// A page is requested with ?limit=, ?sort=, ?order= and, for every page after the
+// first, the ?cursor= returned with the previous page. Cursors are opaque to clients;
+// they record the sort key and ID of the last row served, so pages stay stable while
+// rows are inserted and each page costs an index range scan rather than an OFFSET.
+package pagination
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/pavitra93/go-multi-tenant-system/shared/utils"
+	"github.com/pavitra93/go-multi-tenant-system/shared/validation"
+)
+
+const (
+	// DefaultLimit is the page size when ?limit= is not given
+	DefaultLimit = 50
+	// MaxLimit is the largest page size a client may request
+	MaxLimit = 200
+)
+
+// errMalformedCursor is reported for a cursor this package didn't issue
+var errMalformedCursor = errors.New("cursor is malformed")
+
+// Order is a sort direction
+type Order string
+
+const (
+	Asc  Order = "asc"
+	Desc Order = "desc"
+)
+
+// Params are the query parameters shared by every paginated endpoint
+type Params struct {
+	Limit  int    `form:"limit" json:"limit" binding:"omitempty,min=1,max=200"`
+	Cursor string `form:"cursor" json:"cursor"`
+	Sort   string `form:"sort" json:"sort"`
+	Order  string `form:"order" json:"order" binding:"omitempty,oneof=asc desc"`
+}
+
+// Sort is a column a list can be ordered by, or the unique column breaking ties
+type Sort[T any] struct {
+	column string
+	encode func(T) string
+	decode func(string) (interface{}, error)
+}
+
+// ByTime sorts by a timestamp column; key reads the column's value from a row.
+// The column must not be nullable.
+func ByTime[T any](column string, key func(T) time.Time) Sort[T] {
+	return Sort[T]{
+		column: column,
+		encode: func(row T) string { return key(row).UTC().Format(time.RFC3339Nano) },
+		decode: func(value string) (interface{}, error) { return time.Parse(time.RFC3339Nano, value) },
+	}
+}
+
+// ByString sorts by a text column; key reads the column's value from a row.
+// The column must not be nullable.
+func ByString[T any](column string, key func(T) string) Sort[T] {
+	return Sort[T]{
+		column: column,
+		encode: key,
+		decode: func(value string) (interface{}, error) { return value, nil },
+	}
+}
+
+// ByUUID orders by a UUID column, typically the primary key used as Spec.ID
+func ByUUID[T any](column string, key func(T) uuid.UUID) Sort[T] {
+	return Sort[T]{
+		column: column,
+		encode: func(row T) string { return key(row).String() },
+		decode: func(value string) (interface{}, error) { return uuid.Parse(value) },
+	}
+}
+
+// Spec describes how an endpoint's rows can be ordered
+type Spec[T any] struct {
+	Sorts        map[string]Sort[T]
+	DefaultSort  string
+	DefaultOrder Order
+
+	// ID is a unique column that breaks ties between equal sort keys
+	ID Sort[T]
+}
+
+// cursor is the decoded form of a ?cursor= value
+type cursor struct {
+	Sort  string `json:"s"`
+	Order Order  `json:"o"`
+	Key   string `json:"k"`
+	ID    string `json:"i"`
+}
+
+// Page is a validated page request for one endpoint
+type Page[T any] struct {
+	spec  *Spec[T]
+	limit int
+	name  string
+	sort  Sort[T]
+	order Order
+	key   interface{} // Sort key of the last row served, nil on the first page
+	id    interface{}
+}
+
+// Parse reads the pagination parameters for spec from the query string. On failure it
+// writes a 400 response and returns false.
+func Parse[T any](c *gin.Context, spec *Spec[T]) (*Page[T], bool) {
+	var params Params
+	if !validation.BindQuery(c, &params) {
+		return nil, false
+	}
+
+	page := &Page[T]{
+		spec:  spec,
+		limit: params.Limit,
+		name:  params.Sort,
+		order: Order(params.Order),
+	}
+	if page.limit == 0 {
+		page.limit = DefaultLimit
+	}
+	if page.name == "" {
+		page.name = spec.DefaultSort
+	}
+	if page.order == "" {
+		page.order = spec.DefaultOrder
+	}
+
+	sortBy, ok := spec.Sorts[page.name]
+	if !ok {
+		utils.ValidationErrorResponse(c, []utils.FieldError{{
+			Field:   "sort",
+			Rule:    "oneof",
+			Message: "must be one of: " + strings.Join(spec.sortNames(), " "),
+		}})
+		return nil, false
+	}
+	page.sort = sortBy
+
+	if params.Cursor != "" {
+		key, id, err := page.decodeCursor(params.Cursor)
+		if err != nil {
+			utils.CodedErrorResponse(c, utils.CodeInvalidCursor, err.Error(), nil)
+			return nil, false
+		}
+		page.key, page.id = key, id
+	}
+
+	return page, true
+}
+
+// Apply orders query for this page, starts it after the cursor and fetches one row
+// beyond the limit so Result can tell whether another page follows
+func (p *Page[T]) Apply(query *gorm.DB) *gorm.DB {
+	column, idColumn := p.sort.column, p.spec.ID.column
+
+	if p.key != nil {
+		op := ">"
+		if p.order == Desc {
+			op = "<"
+		}
+		query = query.Where(fmt.Sprintf("(%s, %s) %s (?, ?)", column, idColumn, op), p.key, p.id)
+	}
+
+	return query.
+		Order(fmt.Sprintf("%s %s, %s %s", column, p.order, idColumn, p.order)).
+		Limit(p.limit + 1)
+}
+
+// Result trims the extra row fetched by Apply and describes the page for the response envelope
+func (p *Page[T]) Result(rows []T) ([]T, utils.Pagination) {
+	info := utils.Pagination{Limit: p.limit}
+	if len(rows) <= p.limit {
+		return rows, info
+	}
+
+	rows = rows[:p.limit]
+	last := rows[len(rows)-1]
+	info.HasMore = true
+	info.NextCursor = encodeCursor(cursor{
+		Sort:  p.name,
+		Order: p.order,
+		Key:   p.sort.encode(last),
+		ID:    p.spec.ID.encode(last),
+	})
+	return rows, info
+}
+
+// decodeCursor parses value, checks it was issued for this page's ordering and
+// returns the sort key and ID of the row the page starts after
+func (p *Page[T]) decodeCursor(value string) (interface{}, interface{}, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, nil, errMalformedCursor
+	}
+	var after cursor
+	if err := json.Unmarshal(raw, &after); err != nil {
+		return nil, nil, errMalformedCursor
+	}
+	if after.Sort != p.name || after.Order != p.order {
+		return nil, nil, fmt.Errorf("cursor was issued for sort=%s&order=%s", after.Sort, after.Order)
+	}
+
+	key, err := p.sort.decode(after.Key)
+	if err != nil {
+		return nil, nil, errMalformedCursor
+	}
+	id, err := p.spec.ID.decode(after.ID)
+	if err != nil || after.ID == "" {
+		return nil, nil, errMalformedCursor
+	}
+	return key, id, nil
+}
+
+// encodeCursor returns the opaque form of c
+func encodeCursor(c cursor) string {
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// sortNames lists the spec's sort parameters in a stable order for error messages
+func (s *Spec[T]) sortNames() []string {
+	names := make([]string, 0, len(s.Sorts))
+	for name := range s.Sorts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
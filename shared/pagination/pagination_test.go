@@ -0,0 +1,181 @@
+package pagination
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/pavitra93/go-multi-tenant-system/shared/utils"
+)
+
+type testRow struct {
+	ID        uuid.UUID
+	Name      string
+	CreatedAt time.Time
+}
+
+var testSpec = &Spec[testRow]{
+	Sorts: map[string]Sort[testRow]{
+		"created_at": ByTime("created_at", func(r testRow) time.Time { return r.CreatedAt }),
+		"name":       ByString("name", func(r testRow) string { return r.Name }),
+	},
+	DefaultSort:  "created_at",
+	DefaultOrder: Desc,
+	ID:           ByUUID("id", func(r testRow) uuid.UUID { return r.ID }),
+}
+
+// parseQuery runs Parse against a request with query, returning the recorded response
+func parseQuery(t *testing.T, query url.Values) (*Page[testRow], bool, *httptest.ResponseRecorder) {
+	t.Helper()
+
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/items?"+query.Encode(), nil)
+
+	page, ok := Parse(c, testSpec)
+	return page, ok, w
+}
+
+// rawCursor encodes v as a cursor without going through encodeCursor, for tampering
+func rawCursor(t *testing.T, v interface{}) string {
+	t.Helper()
+
+	raw, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	base := time.Date(2024, 3, 1, 12, 0, 0, 123456000, time.UTC)
+	rows := make([]testRow, 3)
+	for i := range rows {
+		rows[i] = testRow{ID: uuid.New(), Name: string(rune('a' + i)), CreatedAt: base.Add(-time.Duration(i) * time.Minute)}
+	}
+
+	tests := []struct {
+		name    string
+		sort    string
+		order   Order
+		wantKey interface{}
+	}{
+		{name: "time descending", sort: "created_at", order: Desc, wantKey: rows[1].CreatedAt},
+		{name: "string ascending", sort: "name", order: Asc, wantKey: rows[1].Name},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			first, ok, w := parseQuery(t, url.Values{"limit": {"2"}, "sort": {tt.sort}, "order": {string(tt.order)}})
+			if !ok {
+				t.Fatalf("Parse failed: %s", w.Body.String())
+			}
+
+			served, info := first.Result(rows)
+			if len(served) != 2 || !info.HasMore || info.NextCursor == "" {
+				t.Fatalf("Result = %d rows, %+v; want 2 rows and a next cursor", len(served), info)
+			}
+
+			next, ok, w := parseQuery(t, url.Values{
+				"limit":  {"2"},
+				"sort":   {tt.sort},
+				"order":  {string(tt.order)},
+				"cursor": {info.NextCursor},
+			})
+			if !ok {
+				t.Fatalf("Parse rejected its own cursor: %s", w.Body.String())
+			}
+			if next.key != tt.wantKey {
+				t.Errorf("cursor key = %v, want %v", next.key, tt.wantKey)
+			}
+			if next.id != rows[1].ID {
+				t.Errorf("cursor id = %v, want %v", next.id, rows[1].ID)
+			}
+		})
+	}
+}
+
+func TestResultLastPage(t *testing.T) {
+	page, ok, w := parseQuery(t, url.Values{"limit": {"2"}})
+	if !ok {
+		t.Fatalf("Parse failed: %s", w.Body.String())
+	}
+
+	served, info := page.Result([]testRow{{ID: uuid.New()}, {ID: uuid.New()}})
+	if len(served) != 2 || info.HasMore || info.NextCursor != "" {
+		t.Errorf("Result = %d rows, %+v; want 2 rows and no next cursor", len(served), info)
+	}
+}
+
+func TestParseRejectsTamperedCursors(t *testing.T) {
+	valid := encodeCursor(cursor{Sort: "created_at", Order: Desc, Key: time.Now().UTC().Format(time.RFC3339Nano), ID: uuid.NewString()})
+
+	tests := []struct {
+		name   string
+		query  url.Values
+		cursor string
+	}{
+		{name: "not base64", cursor: "!!not-a-cursor!!"},
+		{name: "padded base64", cursor: base64.URLEncoding.EncodeToString([]byte(`{"s":"created_at"}`))},
+		{name: "not json", cursor: base64.RawURLEncoding.EncodeToString([]byte("created_at|desc"))},
+		{name: "truncated", cursor: valid[:len(valid)-4]},
+		{
+			name:   "issued for another sort",
+			cursor: rawCursor(t, cursor{Sort: "name", Order: Desc, Key: "a", ID: uuid.NewString()}),
+		},
+		{
+			name:   "issued for another order",
+			cursor: rawCursor(t, cursor{Sort: "created_at", Order: Asc, Key: time.Now().UTC().Format(time.RFC3339Nano), ID: uuid.NewString()}),
+		},
+		{
+			name:   "sort key of the wrong type",
+			cursor: rawCursor(t, cursor{Sort: "created_at", Order: Desc, Key: "yesterday", ID: uuid.NewString()}),
+		},
+		{
+			name:   "id that isn't a uuid",
+			cursor: rawCursor(t, cursor{Sort: "created_at", Order: Desc, Key: time.Now().UTC().Format(time.RFC3339Nano), ID: "42"}),
+		},
+		{
+			name:   "missing id",
+			cursor: rawCursor(t, map[string]string{"s": "created_at", "o": "desc", "k": time.Now().UTC().Format(time.RFC3339Nano)}),
+		},
+		{
+			name:   "valid cursor with another ordering requested",
+			query:  url.Values{"order": {"asc"}},
+			cursor: valid,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := url.Values{"cursor": {tt.cursor}}
+			for name, values := range tt.query {
+				query[name] = values
+			}
+
+			_, ok, w := parseQuery(t, query)
+			if ok {
+				t.Fatal("Parse accepted the cursor")
+			}
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+			}
+
+			var response utils.APIResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("decoding error response: %v", err)
+			}
+			if response.Code != utils.CodeInvalidCursor {
+				t.Errorf("code = %s, want %s", response.Code, utils.CodeInvalidCursor)
+			}
+		})
+	}
+}
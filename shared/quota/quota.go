@@ -0,0 +1,496 @@
+// Package quota enforces the limits of a tenant's plan with Redis counters.
+//
+// Users and daily location updates are plain counters; concurrent sessions are a
+// sorted set of session IDs scored by expiry, so sessions that lapse without being
+// stopped stop counting on their own. Counters that mirror database rows are seeded
+// from the database when missing and expire after counterTTL, which bounds any drift.
+//
+// Enforcement fails open: if Redis or the plan lookup is unavailable the request is
+// allowed and a warning is logged, so a cache outage never blocks tracking.
+package quota
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"github.com/pavitra93/go-multi-tenant-system/shared/models"
+	"github.com/pavitra93/go-multi-tenant-system/shared/utils"
+)
+
+// Kind names a quota in errors and logs
+type Kind string
+
+const (
+	Users              Kind = "users"
+	ConcurrentSessions Kind = "concurrent_sessions"
+	LocationUpdates    Kind = "location_updates_per_day"
+)
+
+const (
+	// planCacheTTL bounds how long a plan change takes to apply when the cache could not be invalidated
+	planCacheTTL = time.Minute
+	// counterTTL bounds how long a database-backed counter can drift before it is recounted
+	counterTTL = 10 * time.Minute
+	// dailyCounterTTL keeps a day's counter readable for a while after the day ends
+	dailyCounterTTL = 48 * time.Hour
+)
+
+// unlimited is passed to the scripts for a nil limit
+const unlimited = -1
+
+const (
+	// limitReached and counterMissing are reserveCounter's refusals
+	limitReached   = -1
+	counterMissing = -2
+
+	// seedLockTTL bounds how long one request may spend counting rows to seed a counter;
+	// requests waiting on it give up and fail open after the same time
+	seedLockTTL = 5 * time.Second
+	// seedPollInterval is how often a waiting request looks for the seeded counter
+	seedPollInterval = 50 * time.Millisecond
+)
+
+// errSeedTimeout is returned when another request held the seed lock too long
+var errSeedTimeout = errors.New("timed out waiting for quota counter to be seeded")
+
+// releaseSeedLock deletes a seed lock only if it still holds the caller's token, so a lock
+// that expired and was taken by another request is left alone.
+// KEYS[1] lock; ARGV[1] token.
+var releaseSeedLock = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// reserveCounter increments a counter unless that would pass the limit. A missing counter is
+// created from ARGV[2] when one is given; otherwise the caller must seed it and try again.
+// KEYS[1] counter; ARGV[1] limit or -1; ARGV[2] seed or ""; ARGV[3] TTL in seconds.
+// Returns the new count, -1 if the limit is reached or -2 if the counter is missing.
+var reserveCounter = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	if ARGV[2] == '' then
+		return -2
+	end
+	redis.call('SET', KEYS[1], ARGV[2], 'EX', ARGV[3])
+end
+local used = redis.call('INCR', KEYS[1])
+local limit = tonumber(ARGV[1])
+if limit >= 0 and used > limit then
+	redis.call('DECR', KEYS[1])
+	return -1
+end
+return used
+`)
+
+// releaseCounter decrements a counter that still exists; a missing one is recounted on next use.
+// KEYS[1] counter.
+var releaseCounter = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 1 then
+	return redis.call('DECR', KEYS[1])
+end
+return 0
+`)
+
+// reserveSession drops expired sessions, then adds one unless the set is full.
+// KEYS[1] sorted set; ARGV[1] limit or -1; ARGV[2] now (unix ms); ARGV[3] session ID;
+// ARGV[4] session expiry (unix ms); ARGV[5] TTL in seconds.
+// Returns the number of sessions, or -1 if the limit is reached.
+var reserveSession = redis.NewScript(`
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', ARGV[2])
+local limit = tonumber(ARGV[1])
+if limit >= 0 and redis.call('ZCARD', KEYS[1]) >= limit then
+	return -1
+end
+redis.call('ZADD', KEYS[1], ARGV[4], ARGV[3])
+redis.call('EXPIRE', KEYS[1], ARGV[5])
+return redis.call('ZCARD', KEYS[1])
+`)
+
+// ExceededError reports a request refused because a plan quota is used up
+type ExceededError struct {
+	Quota    Kind
+	Plan     string
+	Limit    int
+	ResetsAt *time.Time // Set for daily quotas
+}
+
+func (e *ExceededError) Error() string {
+	return fmt.Sprintf("%s quota of %d on plan %q exhausted", e.Quota, e.Limit, e.Plan)
+}
+
+// Enforcer checks and records quota consumption
+type Enforcer struct {
+	db    *gorm.DB
+	redis *redis.Client
+}
+
+// NewEnforcer creates an enforcer reading plans from db and counting in client
+func NewEnforcer(db *gorm.DB, client *redis.Client) *Enforcer {
+	return &Enforcer{db: db, redis: client}
+}
+
+// planKey is the Redis key caching a tenant's plan
+func planKey(tenantID uuid.UUID) string {
+	return fmt.Sprintf("tenant:plan:%s", tenantID)
+}
+
+// usersKey counts a tenant's users
+func usersKey(tenantID uuid.UUID) string {
+	return fmt.Sprintf("quota:users:%s", tenantID)
+}
+
+// sessionsKey holds a tenant's active session IDs scored by expiry
+func sessionsKey(tenantID uuid.UUID) string {
+	return fmt.Sprintf("quota:sessions:%s", tenantID)
+}
+
+// updatesKey counts a tenant's location updates on day (UTC)
+func updatesKey(tenantID uuid.UUID, day time.Time) string {
+	return fmt.Sprintf("quota:location_updates:%s:%s", tenantID, day.Format("2006-01-02"))
+}
+
+// Plan returns the tenant's plan, cached briefly in Redis
+func (e *Enforcer) Plan(ctx context.Context, tenantID uuid.UUID) (*models.Plan, error) {
+	key := planKey(tenantID)
+	if cached, err := e.redis.Get(ctx, key).Result(); err == nil {
+		var plan models.Plan
+		if err := json.Unmarshal([]byte(cached), &plan); err == nil {
+			return &plan, nil
+		}
+	}
+
+	var plan models.Plan
+	err := e.db.WithContext(ctx).
+		Joins("JOIN tenants ON tenants.plan_id = plans.id").
+		Where("tenants.id = ?", tenantID).
+		First(&plan).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up tenant plan: %w", err)
+	}
+
+	// Cache failures are non-critical
+	if encoded, err := json.Marshal(plan); err == nil {
+		if err := e.redis.Set(ctx, key, encoded, planCacheTTL).Err(); err != nil {
+			logrus.WithError(err).WithField("tenant_id", tenantID).Debug("Failed to cache tenant plan")
+		}
+	}
+	return &plan, nil
+}
+
+// Invalidate drops the tenant's cached plan and database-backed counters so they are
+// reloaded on next use. Call it after changing the plan, the tenant's status or its users.
+func (e *Enforcer) Invalidate(ctx context.Context, tenantID uuid.UUID) {
+	if err := e.redis.Del(ctx, planKey(tenantID), usersKey(tenantID), sessionsKey(tenantID)).Err(); err != nil {
+		logrus.WithError(err).WithField("tenant_id", tenantID).Warn("Failed to invalidate tenant quota cache")
+	}
+}
+
+// ReserveUser counts a user about to be created. Call ReleaseUser if creating it fails.
+// The only error returned is *ExceededError.
+func (e *Enforcer) ReserveUser(ctx context.Context, tenantID uuid.UUID) error {
+	plan, ok := e.plan(ctx, tenantID, Users)
+	if !ok {
+		return nil
+	}
+
+	key := usersKey(tenantID)
+	used, err := e.reserve(ctx, key, limitArg(plan.MaxUsers), func() (int64, error) {
+		var count int64
+		err := e.db.WithContext(ctx).Model(&models.User{}).Where("tenant_id = ?", tenantID).Count(&count).Error
+		return count, err
+	})
+	if err != nil {
+		failOpen(err, tenantID, Users)
+		return nil
+	}
+	if used == limitReached {
+		return &ExceededError{Quota: Users, Plan: plan.ID, Limit: *plan.MaxUsers}
+	}
+	return nil
+}
+
+// ReleaseUser gives back a reservation made by ReserveUser
+func (e *Enforcer) ReleaseUser(ctx context.Context, tenantID uuid.UUID) {
+	if err := releaseCounter.Run(ctx, e.redis, []string{usersKey(tenantID)}).Err(); err != nil {
+		logrus.WithError(err).WithField("tenant_id", tenantID).Warn("Failed to release user quota")
+	}
+}
+
+// ReserveSession counts session as active until it expires or ReleaseSession is called.
+// The only error returned is *ExceededError.
+func (e *Enforcer) ReserveSession(ctx context.Context, session *models.LocationSession) error {
+	plan, ok := e.plan(ctx, session.TenantID, ConcurrentSessions)
+	if !ok {
+		return nil
+	}
+
+	key := sessionsKey(session.TenantID)
+	if err := e.seedSessions(ctx, key, session.TenantID); err != nil {
+		failOpen(err, session.TenantID, ConcurrentSessions)
+		return nil
+	}
+
+	expiresAt := session.StartedAt.Add(time.Duration(session.Duration) * time.Second)
+	used, err := reserveSession.Run(ctx, e.redis, []string{key},
+		limitArg(plan.MaxConcurrentSessions), time.Now().UnixMilli(), session.ID.String(), expiresAt.UnixMilli(), int(counterTTL.Seconds()),
+	).Int64()
+	if err != nil {
+		failOpen(err, session.TenantID, ConcurrentSessions)
+		return nil
+	}
+	if used < 0 {
+		return &ExceededError{Quota: ConcurrentSessions, Plan: plan.ID, Limit: *plan.MaxConcurrentSessions}
+	}
+	return nil
+}
+
+// ReleaseSession stops counting a session that ended or could not be created
+func (e *Enforcer) ReleaseSession(ctx context.Context, tenantID, sessionID uuid.UUID) {
+	if err := e.redis.ZRem(ctx, sessionsKey(tenantID), sessionID.String()).Err(); err != nil {
+		logrus.WithError(err).WithField("tenant_id", tenantID).Warn("Failed to release session quota")
+	}
+}
+
+// CountLocationUpdate counts one location update made at at against that UTC day's quota.
+// Call ReleaseLocationUpdate with the same time if storing the update fails.
+// The only error returned is *ExceededError.
+func (e *Enforcer) CountLocationUpdate(ctx context.Context, tenantID uuid.UUID, at time.Time) error {
+	plan, ok := e.plan(ctx, tenantID, LocationUpdates)
+	if !ok {
+		return nil
+	}
+
+	used, err := reserveCounter.Run(ctx, e.redis, []string{updatesKey(tenantID, at.UTC())},
+		limitArg(plan.MaxLocationUpdatesPerDay), 0, int(dailyCounterTTL.Seconds()),
+	).Int64()
+	if err != nil {
+		failOpen(err, tenantID, LocationUpdates)
+		return nil
+	}
+	if used == limitReached {
+		resetsAt := nextMidnight(at)
+		return &ExceededError{Quota: LocationUpdates, Plan: plan.ID, Limit: *plan.MaxLocationUpdatesPerDay, ResetsAt: &resetsAt}
+	}
+	return nil
+}
+
+// ReleaseLocationUpdate gives back an update counted by CountLocationUpdate at at
+func (e *Enforcer) ReleaseLocationUpdate(ctx context.Context, tenantID uuid.UUID, at time.Time) {
+	if err := releaseCounter.Run(ctx, e.redis, []string{updatesKey(tenantID, at.UTC())}).Err(); err != nil {
+		logrus.WithError(err).WithField("tenant_id", tenantID).Warn("Failed to release location update quota")
+	}
+}
+
+// Usage reports the tenant's plan and consumption. Users and sessions are counted in the
+// database, which is authoritative; location updates come from today's counter.
+func (e *Enforcer) Usage(ctx context.Context, tenantID uuid.UUID) (*models.TenantUsageResponse, error) {
+	plan, err := e.Plan(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	var users, sessions int64
+	if err := e.db.WithContext(ctx).Model(&models.User{}).Where("tenant_id = ?", tenantID).Count(&users).Error; err != nil {
+		return nil, fmt.Errorf("failed to count users: %w", err)
+	}
+	if err := activeSessions(e.db.WithContext(ctx), tenantID).Count(&sessions).Error; err != nil {
+		return nil, fmt.Errorf("failed to count active sessions: %w", err)
+	}
+
+	now := time.Now().UTC()
+	updates, err := e.redis.Get(ctx, updatesKey(tenantID, now)).Int64()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, fmt.Errorf("failed to read location update counter: %w", err)
+	}
+	resetsAt := nextMidnight(now)
+
+	dailyUsage := usage(plan.MaxLocationUpdatesPerDay, updates)
+	dailyUsage.ResetsAt = &resetsAt
+
+	return &models.TenantUsageResponse{
+		Plan:                 *plan,
+		Users:                usage(plan.MaxUsers, users),
+		ConcurrentSessions:   usage(plan.MaxConcurrentSessions, sessions),
+		LocationUpdatesToday: dailyUsage,
+		// No webhook endpoints can be registered yet
+		WebhookEndpoints: usage(plan.MaxWebhookEndpoints, 0),
+		RetentionDays:    plan.RetentionDays,
+	}, nil
+}
+
+// plan loads the tenant's plan for enforcing kind; false means skip enforcement
+func (e *Enforcer) plan(ctx context.Context, tenantID uuid.UUID, kind Kind) (*models.Plan, bool) {
+	plan, err := e.Plan(ctx, tenantID)
+	if err != nil {
+		failOpen(err, tenantID, kind)
+		return nil, false
+	}
+	return plan, true
+}
+
+// reserve increments the database-backed counter key against limit, seeding it from count
+// first if it is missing. Returns the new count or limitReached.
+func (e *Enforcer) reserve(ctx context.Context, key, limit string, count func() (int64, error)) (int64, error) {
+	for attempt := 0; ; attempt++ {
+		used, err := reserveCounter.Run(ctx, e.redis, []string{key}, limit, "", int(counterTTL.Seconds())).Int64()
+		if err != nil || used != counterMissing {
+			return used, err
+		}
+		if attempt > 0 {
+			return 0, fmt.Errorf("quota counter %s disappeared after seeding", key)
+		}
+		if err := e.seed(ctx, key, count); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// seed initialises a missing counter from count. Only one request counts at a time, under
+// a lock; the others wait for its result, so rows reserved meanwhile are counted once.
+func (e *Enforcer) seed(ctx context.Context, key string, count func() (int64, error)) error {
+	lock, token := key+":seeding", uuid.NewString()
+	deadline := time.Now().Add(seedLockTTL)
+	for {
+		acquired, err := e.redis.SetNX(ctx, lock, token, seedLockTTL).Result()
+		if err != nil {
+			return err
+		}
+		if acquired {
+			break
+		}
+
+		// Another request is counting; wait for the counter it sets
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(seedPollInterval):
+		}
+		exists, err := e.redis.Exists(ctx, key).Result()
+		if err != nil || exists == 1 {
+			return err
+		}
+		if time.Now().After(deadline) {
+			return errSeedTimeout
+		}
+	}
+	defer func() {
+		if err := releaseSeedLock.Run(ctx, e.redis, []string{lock}, token).Err(); err != nil {
+			logrus.WithError(err).WithField("key", key).Warn("Failed to release quota seed lock")
+		}
+	}()
+
+	used, err := count()
+	if err != nil {
+		return err
+	}
+	// The counter may have been seeded while this request waited for the lock to expire
+	return e.redis.SetNX(ctx, key, used, counterTTL).Err()
+}
+
+// seedSessions loads the tenant's unexpired active sessions into a missing session set
+func (e *Enforcer) seedSessions(ctx context.Context, key string, tenantID uuid.UUID) error {
+	exists, err := e.redis.Exists(ctx, key).Result()
+	if err != nil || exists == 1 {
+		return err
+	}
+
+	var sessions []models.LocationSession
+	if err := activeSessions(e.db.WithContext(ctx), tenantID).Select("id", "started_at", "duration").Find(&sessions).Error; err != nil {
+		return fmt.Errorf("failed to load active sessions: %w", err)
+	}
+	if len(sessions) == 0 {
+		return nil
+	}
+
+	members := make([]*redis.Z, 0, len(sessions))
+	for _, session := range sessions {
+		expiresAt := session.StartedAt.Add(time.Duration(session.Duration) * time.Second)
+		members = append(members, &redis.Z{Score: float64(expiresAt.UnixMilli()), Member: session.ID.String()})
+	}
+	pipe := e.redis.TxPipeline()
+	pipe.ZAdd(ctx, key, members...)
+	pipe.Expire(ctx, key, counterTTL)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// activeSessions selects the tenant's sessions that are active and not yet past their duration
+func activeSessions(db *gorm.DB, tenantID uuid.UUID) *gorm.DB {
+	return db.Model(&models.LocationSession{}).
+		Where("tenant_id = ? AND status = ?", tenantID, models.SessionStatusActive).
+		Where("started_at + duration * INTERVAL '1 second' > NOW()")
+}
+
+// failOpen logs an enforcement failure; the request goes ahead
+func failOpen(err error, tenantID uuid.UUID, kind Kind) {
+	logrus.WithError(err).WithFields(logrus.Fields{
+		"tenant_id": tenantID,
+		"quota":     kind,
+	}).Warn("Quota check failed; allowing request")
+}
+
+// limitArg passes a limit to the scripts
+func limitArg(limit *int) string {
+	if limit == nil {
+		return strconv.Itoa(unlimited)
+	}
+	return strconv.Itoa(*limit)
+}
+
+// usage builds the report for one quota
+func usage(limit *int, used int64) models.QuotaUsage {
+	report := models.QuotaUsage{Limit: limit, Used: used}
+	if limit != nil {
+		remaining := int64(*limit) - used
+		if remaining < 0 {
+			remaining = 0
+		}
+		report.Remaining = &remaining
+	}
+	return report
+}
+
+// nextMidnight returns the start of the UTC day after now
+func nextMidnight(now time.Time) time.Time {
+	year, month, day := now.UTC().Date()
+	return time.Date(year, month, day+1, 0, 0, 0, 0, time.UTC)
+}
+
+// ExceededResponse writes the error for a refused request. Daily quotas answer 429 with
+// Retry-After; the others 403.
+func ExceededResponse(c *gin.Context, err error) {
+	var exceeded *ExceededError
+	if !errors.As(err, &exceeded) {
+		utils.InternalServerErrorResponse(c, "Failed to check plan quota")
+		return
+	}
+
+	details := map[string]interface{}{
+		"quota": exceeded.Quota,
+		"plan":  exceeded.Plan,
+		"limit": exceeded.Limit,
+	}
+	if exceeded.ResetsAt != nil {
+		details["resets_at"] = exceeded.ResetsAt
+		c.Header("Retry-After", strconv.Itoa(int(time.Until(*exceeded.ResetsAt).Seconds())+1))
+		utils.CodedErrorResponse(c, utils.CodeDailyQuotaExceeded, fmt.Sprintf("Daily limit of %d location updates reached for plan %s", exceeded.Limit, exceeded.Plan), details)
+		return
+	}
+
+	what := "users"
+	if exceeded.Quota == ConcurrentSessions {
+		what = "concurrent tracking sessions"
+	}
+	utils.CodedErrorResponse(c, utils.CodeQuotaExceeded, fmt.Sprintf("Plan %s allows at most %d %s", exceeded.Plan, exceeded.Limit, what), details)
+}
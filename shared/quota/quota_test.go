@@ -0,0 +1,268 @@
+package quota
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+
+	"github.com/pavitra93/go-multi-tenant-system/shared/models"
+)
+
+const testCounter = "quota:test"
+
+// newTestEnforcer returns an enforcer counting in an in-memory Redis. It has no database,
+// so plans must be cached and counters seeded before use.
+func newTestEnforcer(t *testing.T) (*Enforcer, *miniredis.Miniredis) {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return NewEnforcer(nil, client), server
+}
+
+// cachePlan stores plan as tenantID's cached plan
+func cachePlan(t *testing.T, server *miniredis.Miniredis, tenantID uuid.UUID, plan models.Plan) {
+	t.Helper()
+
+	encoded, err := json.Marshal(plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := server.Set(planKey(tenantID), string(encoded)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// counterValue reads a counter, reporting a missing one as -1
+func counterValue(t *testing.T, server *miniredis.Miniredis, key string) int {
+	t.Helper()
+
+	if !server.Exists(key) {
+		return -1
+	}
+	value, err := server.Get(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func intPtr(n int) *int {
+	return &n
+}
+
+func TestReserveCounter(t *testing.T) {
+	tests := []struct {
+		name string
+		// existing is the counter's value before the call, -1 for missing
+		existing int
+		limit    int
+		seed     string
+
+		want      int64
+		wantValue int
+	}{
+		{name: "under the limit", existing: 2, limit: 3, want: 3, wantValue: 3},
+		{name: "at the limit", existing: 3, limit: 3, want: limitReached, wantValue: 3},
+		{name: "past a lowered limit", existing: 5, limit: 3, want: limitReached, wantValue: 5},
+		{name: "unlimited", existing: 100, limit: unlimited, want: 101, wantValue: 101},
+		{name: "zero limit", existing: 0, limit: 0, want: limitReached, wantValue: 0},
+		{name: "missing without a seed", existing: -1, limit: 3, want: counterMissing, wantValue: -1},
+		{name: "missing with a seed", existing: -1, limit: 3, seed: "1", want: 2, wantValue: 2},
+		{name: "missing with a seed at the limit", existing: -1, limit: 3, seed: "3", want: limitReached, wantValue: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enforcer, server := newTestEnforcer(t)
+			if tt.existing >= 0 {
+				server.Set(testCounter, strconv.Itoa(tt.existing))
+			}
+
+			got, err := reserveCounter.Run(context.Background(), enforcer.redis, []string{testCounter},
+				strconv.Itoa(tt.limit), tt.seed, int(counterTTL.Seconds()),
+			).Int64()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("reserveCounter = %d, want %d", got, tt.want)
+			}
+			if value := counterValue(t, server, testCounter); value != tt.wantValue {
+				t.Errorf("counter = %d, want %d", value, tt.wantValue)
+			}
+			if tt.seed != "" && server.TTL(testCounter) <= 0 {
+				t.Error("seeded counter has no TTL")
+			}
+		})
+	}
+}
+
+func TestReleaseCounter(t *testing.T) {
+	tests := []struct {
+		name      string
+		existing  int
+		wantValue int
+	}{
+		{name: "decrements", existing: 3, wantValue: 2},
+		{name: "leaves a missing counter missing", existing: -1, wantValue: -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enforcer, server := newTestEnforcer(t)
+			if tt.existing >= 0 {
+				server.Set(testCounter, strconv.Itoa(tt.existing))
+			}
+
+			if err := releaseCounter.Run(context.Background(), enforcer.redis, []string{testCounter}).Err(); err != nil {
+				t.Fatal(err)
+			}
+			if value := counterValue(t, server, testCounter); value != tt.wantValue {
+				t.Errorf("counter = %d, want %d", value, tt.wantValue)
+			}
+		})
+	}
+}
+
+func TestReserveSeedsOnce(t *testing.T) {
+	enforcer, server := newTestEnforcer(t)
+
+	const rows, limit, requests = 7, 10, 6
+	var counts int32
+	count := func() (int64, error) {
+		atomic.AddInt32(&counts, 1)
+		// Keep the lock long enough for the other requests to queue behind it
+		time.Sleep(2 * seedPollInterval)
+		return rows, nil
+	}
+
+	var wg sync.WaitGroup
+	results := make([]int64, requests)
+	errs := make([]error, requests)
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], errs[i] = enforcer.reserve(context.Background(), testCounter, strconv.Itoa(limit), count)
+		}(i)
+	}
+	wg.Wait()
+
+	reserved := 0
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+		if results[i] != limitReached {
+			reserved++
+		}
+	}
+	if counts != 1 {
+		t.Errorf("counted rows %d times, want 1", counts)
+	}
+	if reserved != limit-rows {
+		t.Errorf("%d requests reserved, want %d", reserved, limit-rows)
+	}
+	if value := counterValue(t, server, testCounter); value != limit {
+		t.Errorf("counter = %d, want %d", value, limit)
+	}
+	if server.Exists(testCounter + ":seeding") {
+		t.Error("seed lock was not released")
+	}
+}
+
+func TestReserveFailsWhenCountFails(t *testing.T) {
+	enforcer, server := newTestEnforcer(t)
+
+	countErr := errors.New("database unavailable")
+	_, err := enforcer.reserve(context.Background(), testCounter, "10", func() (int64, error) { return 0, countErr })
+	if !errors.Is(err, countErr) {
+		t.Errorf("reserve error = %v, want %v", err, countErr)
+	}
+	if server.Exists(testCounter) || server.Exists(testCounter+":seeding") {
+		t.Error("failed seed left keys behind")
+	}
+}
+
+func TestCountLocationUpdate(t *testing.T) {
+	enforcer, server := newTestEnforcer(t)
+	tenantID := uuid.New()
+	cachePlan(t, server, tenantID, models.Plan{ID: "free", MaxLocationUpdatesPerDay: intPtr(2)})
+
+	ctx := context.Background()
+	now := time.Now().UTC()
+	yesterday := now.AddDate(0, 0, -1)
+
+	for i := 0; i < 2; i++ {
+		if err := enforcer.CountLocationUpdate(ctx, tenantID, now); err != nil {
+			t.Fatalf("update %d: %v", i+1, err)
+		}
+	}
+
+	err := enforcer.CountLocationUpdate(ctx, tenantID, now)
+	var exceeded *ExceededError
+	if !errors.As(err, &exceeded) {
+		t.Fatalf("third update error = %v, want *ExceededError", err)
+	}
+	if exceeded.Quota != LocationUpdates || exceeded.Limit != 2 || exceeded.ResetsAt == nil || !exceeded.ResetsAt.Equal(nextMidnight(now)) {
+		t.Errorf("exceeded = %+v, want the daily quota of 2 resetting at %s", exceeded, nextMidnight(now))
+	}
+
+	// A failed save gives its count back
+	enforcer.ReleaseLocationUpdate(ctx, tenantID, now)
+	if err := enforcer.CountLocationUpdate(ctx, tenantID, now); err != nil {
+		t.Errorf("update after release: %v", err)
+	}
+
+	// Releasing an update counted yesterday leaves today's count alone
+	if err := enforcer.CountLocationUpdate(ctx, tenantID, yesterday); err != nil {
+		t.Fatal(err)
+	}
+	enforcer.ReleaseLocationUpdate(ctx, tenantID, yesterday)
+	if value := counterValue(t, server, updatesKey(tenantID, yesterday)); value != 0 {
+		t.Errorf("yesterday's counter = %d, want 0", value)
+	}
+	if value := counterValue(t, server, updatesKey(tenantID, now)); value != 2 {
+		t.Errorf("today's counter = %d, want 2", value)
+	}
+}
+
+func TestReserveUserAtLimit(t *testing.T) {
+	enforcer, server := newTestEnforcer(t)
+	tenantID := uuid.New()
+	cachePlan(t, server, tenantID, models.Plan{ID: "free", MaxUsers: intPtr(3)})
+	server.Set(usersKey(tenantID), "2")
+
+	ctx := context.Background()
+	if err := enforcer.ReserveUser(ctx, tenantID); err != nil {
+		t.Fatalf("reserving the last user: %v", err)
+	}
+
+	var exceeded *ExceededError
+	if err := enforcer.ReserveUser(ctx, tenantID); !errors.As(err, &exceeded) || exceeded.Quota != Users {
+		t.Fatalf("reserving past the limit: %v, want *ExceededError for users", err)
+	}
+
+	enforcer.ReleaseUser(ctx, tenantID)
+	if err := enforcer.ReserveUser(ctx, tenantID); err != nil {
+		t.Errorf("reserving after a release: %v", err)
+	}
+	if value := counterValue(t, server, usersKey(tenantID)); value != 3 {
+		t.Errorf("counter = %d, want 3", value)
+	}
+}
@@ -0,0 +1,116 @@
+// Package server runs a service's HTTP server and shuts it down gracefully.
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/pavitra93/go-multi-tenant-system/shared/config"
+)
+
+// DefaultShutdownTimeout bounds connection draining plus shutdown hooks
+const DefaultShutdownTimeout = 15 * time.Second
+
+// shutdownHook is cleanup that runs after the HTTP server has drained
+type shutdownHook struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+// Runner serves HTTP until the context is cancelled, then drains in-flight
+// requests and runs shutdown hooks within ShutdownTimeout
+type Runner struct {
+	name            string
+	server          *http.Server
+	shutdownTimeout time.Duration
+	hooks           []shutdownHook
+}
+
+// New creates a runner for handler on addr with the configured drain and header timeouts
+func New(name, addr string, handler http.Handler, cfg config.ServerConfig) *Runner {
+	timeout := cfg.ShutdownTimeout
+	if timeout <= 0 {
+		timeout = DefaultShutdownTimeout
+	}
+	readHeaderTimeout := cfg.ReadHeaderTimeout
+	if readHeaderTimeout <= 0 {
+		readHeaderTimeout = 10 * time.Second
+	}
+
+	return &Runner{
+		name: name,
+		server: &http.Server{
+			Addr:              addr,
+			Handler:           handler,
+			ReadHeaderTimeout: readHeaderTimeout,
+		},
+		shutdownTimeout: timeout,
+	}
+}
+
+// SetShutdownTimeout overrides the drain timeout
+func (r *Runner) SetShutdownTimeout(timeout time.Duration) {
+	r.shutdownTimeout = timeout
+}
+
+// OnShutdown registers cleanup to run once the HTTP server has stopped accepting
+// and finished in-flight requests. Hooks run in registration order and share the
+// remaining shutdown deadline.
+func (r *Runner) OnShutdown(name string, fn func(ctx context.Context) error) {
+	r.hooks = append(r.hooks, shutdownHook{name: name, fn: fn})
+}
+
+// Run serves until ctx is cancelled or the server fails, then shuts down gracefully
+func (r *Runner) Run(ctx context.Context) error {
+	serveErr := make(chan error, 1)
+	go func() {
+		logrus.Infof("%s starting on %s", r.name, r.server.Addr)
+		if err := r.server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serveErr <- err
+		}
+		close(serveErr)
+	}()
+
+	select {
+	case err := <-serveErr:
+		if err != nil {
+			return fmt.Errorf("failed to start %s: %w", r.name, err)
+		}
+	case <-ctx.Done():
+	}
+
+	logrus.WithField("timeout", r.shutdownTimeout.String()).Infof("%s shutting down", r.name)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), r.shutdownTimeout)
+	defer cancel()
+
+	var shutdownErr error
+	if err := r.server.Shutdown(shutdownCtx); err != nil {
+		shutdownErr = fmt.Errorf("failed to drain HTTP connections: %w", err)
+		logrus.WithError(err).Warn("HTTP server did not drain before the shutdown timeout")
+	}
+
+	for _, hook := range r.hooks {
+		if err := hook.fn(shutdownCtx); err != nil {
+			logrus.WithError(err).WithField("hook", hook.name).Error("Shutdown hook failed")
+			shutdownErr = errors.Join(shutdownErr, fmt.Errorf("%s: %w", hook.name, err))
+		}
+	}
+
+	if shutdownErr == nil {
+		logrus.Infof("%s stopped", r.name)
+	}
+	return shutdownErr
+}
+
+// SignalContext returns a context cancelled on SIGINT or SIGTERM
+func SignalContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+}
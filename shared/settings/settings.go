@@ -0,0 +1,87 @@
+// Package settings reads tenants' behaviour overrides for the services that apply them.
+//
+// Settings are cached in Redis and the cache is deleted when they change, so a change
+// applies on the next request everywhere; cacheTTL bounds how long it can take if the
+// delete fails. Lookups fail open: if the settings can't be read the platform defaults
+// apply and a warning is logged.
+package settings
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"github.com/pavitra93/go-multi-tenant-system/shared/models"
+)
+
+// cacheTTL bounds how long a settings change takes to apply when the cache could not be invalidated
+const cacheTTL = 5 * time.Minute
+
+// Store reads tenant settings through the Redis cache
+type Store struct {
+	db    *gorm.DB
+	redis *redis.Client
+}
+
+// NewStore creates a store reading settings from db and caching them in client.
+// A nil client reads the database every time.
+func NewStore(db *gorm.DB, client *redis.Client) *Store {
+	return &Store{db: db, redis: client}
+}
+
+// cacheKey is the Redis key caching a tenant's settings
+func cacheKey(tenantID uuid.UUID) string {
+	return fmt.Sprintf("tenant:settings:%s", tenantID)
+}
+
+// Get returns the tenant's settings, or nil if it has none or they can't be read.
+// The getters of a nil *TenantSettings return the defaults they are given.
+func (s *Store) Get(ctx context.Context, tenantID uuid.UUID) *models.TenantSettings {
+	log := logrus.WithField("tenant_id", tenantID)
+
+	if s.redis != nil {
+		cached, err := s.redis.Get(ctx, cacheKey(tenantID)).Bytes()
+		if err == nil {
+			var settings models.TenantSettings
+			if err := json.Unmarshal(cached, &settings); err == nil {
+				return &settings
+			}
+		} else if err != redis.Nil {
+			log.WithError(err).Warn("Failed to read cached tenant settings")
+		}
+	}
+
+	var record models.TenantSettingsRecord
+	err := s.db.WithContext(ctx).Where("tenant_id = ?", tenantID).First(&record).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		log.WithError(err).Warn("Failed to read tenant settings; using defaults")
+		return nil
+	}
+
+	// Tenants without a record cache an empty document, so defaults are cached too
+	if s.redis != nil {
+		if data, err := json.Marshal(record.Settings); err == nil {
+			if err := s.redis.Set(ctx, cacheKey(tenantID), data, cacheTTL).Err(); err != nil {
+				log.WithError(err).Warn("Failed to cache tenant settings")
+			}
+		}
+	}
+	return &record.Settings
+}
+
+// Invalidate drops the tenant's cached settings so every service re-reads them
+func (s *Store) Invalidate(ctx context.Context, tenantID uuid.UUID) {
+	if s.redis == nil {
+		return
+	}
+	if err := s.redis.Del(ctx, cacheKey(tenantID)).Err(); err != nil {
+		logrus.WithError(err).WithField("tenant_id", tenantID).Warn("Failed to invalidate tenant settings cache")
+	}
+}
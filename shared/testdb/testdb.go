@@ -0,0 +1,50 @@
+// Package testdb connects tests to a PostgreSQL database migrated with database/init.sql.
+// Tests using it are skipped unless TEST_DATABASE_URL is set; `make test-db` sets it to the
+// docker-compose database and runs them.
+package testdb
+
+import (
+	"os"
+	"testing"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// EnvVar names the DSN of the test database
+const EnvVar = "TEST_DATABASE_URL"
+
+// Open connects to the test database for the rest of the test, skipping it if EnvVar is not set
+func Open(t testing.TB) *gorm.DB {
+	t.Helper()
+
+	dsn := os.Getenv(EnvVar)
+	if dsn == "" {
+		t.Skipf("%s not set; run `make test-db` to include the database tests", EnvVar)
+	}
+
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+	return db
+}
+
+// Tx returns a transaction on the test database that is rolled back when the test ends,
+// so tests leave no rows behind
+func Tx(t testing.TB) *gorm.DB {
+	t.Helper()
+
+	tx := Open(t).Begin()
+	if tx.Error != nil {
+		t.Fatal(tx.Error)
+	}
+	t.Cleanup(func() { tx.Rollback() })
+	return tx
+}
@@ -0,0 +1,121 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// RequestIDHeader is the HTTP header carrying the request correlation ID
+	RequestIDHeader = "X-Request-ID"
+	// TraceParentHeader is the W3C trace context header
+	TraceParentHeader = "traceparent"
+	// RequestIDKey is the gin context and Kafka header key for the request ID
+	RequestIDKey = "request_id"
+)
+
+// requestIDPattern is what an incoming request ID must look like to be kept. It fits the
+// request_id columns and can't break up log lines.
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
+type requestIDContextKey struct{}
+
+// Init configures the global tracer provider and W3C propagator for a service.
+// Spans are always recorded, so every request gets trace IDs to propagate to other services
+// and Kafka; OTEL_TRACES_EXPORTER only selects where they are exported: "stdout" for local
+// debugging, or nowhere (default "none").
+func Init(serviceName string) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	options := []sdktrace.TracerProviderOption{
+		// Follow the caller's sampling decision; sample requests that start a trace
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.AlwaysSample())),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", serviceName))),
+	}
+
+	switch exporterName := os.Getenv("OTEL_TRACES_EXPORTER"); exporterName {
+	case "", "none":
+	case "stdout":
+		exporter, err := stdouttrace.New(stdouttrace.WithPrettyPrint())
+		if err != nil {
+			return nil, fmt.Errorf("failed to create stdout trace exporter: %w", err)
+		}
+		options = append(options, sdktrace.WithBatcher(exporter))
+	default:
+		return nil, fmt.Errorf("unsupported OTEL_TRACES_EXPORTER %q", exporterName)
+	}
+
+	provider := sdktrace.NewTracerProvider(options...)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+// Tracer returns the named tracer from the global provider
+func Tracer(name string) trace.Tracer {
+	return otel.Tracer(name)
+}
+
+// ValidRequestID reports whether a client-supplied request ID can be used as is
+func ValidRequestID(requestID string) bool {
+	return requestIDPattern.MatchString(requestID)
+}
+
+// WithRequestID stores the request ID in the context
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDContextKey{}, requestID)
+}
+
+// RequestIDFromContext returns the request ID stored in the context, if any
+func RequestIDFromContext(ctx context.Context) string {
+	if requestID, ok := ctx.Value(requestIDContextKey{}).(string); ok {
+		return requestID
+	}
+	return ""
+}
+
+// Inject writes the trace context from ctx into the carrier
+func Inject(ctx context.Context, carrier propagation.TextMapCarrier) {
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+}
+
+// Extract returns a context carrying the trace context found in the carrier
+func Extract(ctx context.Context, carrier propagation.TextMapCarrier) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, carrier)
+}
+
+// TraceParent returns the W3C traceparent value for the span in ctx
+func TraceParent(ctx context.Context) string {
+	carrier := propagation.MapCarrier{}
+	Inject(ctx, carrier)
+	return carrier.Get(TraceParentHeader)
+}
+
+// ContextFromTraceParent rebuilds a context from a stored traceparent and request ID
+func ContextFromTraceParent(ctx context.Context, traceParent, requestID string) context.Context {
+	if traceParent != "" {
+		ctx = Extract(ctx, propagation.MapCarrier{TraceParentHeader: traceParent})
+	}
+	if requestID != "" {
+		ctx = WithRequestID(ctx, requestID)
+	}
+	return ctx
+}
+
+// RequestIDAttribute returns the span attribute for a request ID
+func RequestIDAttribute(requestID string) attribute.KeyValue {
+	return attribute.String("request.id", requestID)
+}
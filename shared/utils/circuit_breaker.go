@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"context"
 	"errors"
 	"sync"
 	"time"
@@ -31,11 +32,12 @@ type CircuitBreaker struct {
 	resetTimeout time.Duration
 	halfOpenMax  int
 
-	mutex       sync.Mutex
-	state       CircuitState
-	failures    int
-	lastFailure time.Time
-	halfOpenReq int
+	mutex         sync.Mutex
+	state         CircuitState
+	failures      int
+	lastFailure   time.Time
+	halfOpenReq   int
+	onStateChange func(from, to CircuitState)
 }
 
 // NewCircuitBreaker creates a new circuit breaker
@@ -48,14 +50,15 @@ func NewCircuitBreaker(maxFailures int, resetTimeout time.Duration) *CircuitBrea
 	}
 }
 
-// Call executes the given function with circuit breaker protection
+// Call executes the given function with circuit breaker protection. A call that fails
+// because its caller cancelled it counts as neither success nor failure.
 func (cb *CircuitBreaker) Call(fn func() error) error {
 	cb.mutex.Lock()
 
 	// Check if circuit should transition from open to half-open
 	if cb.state == StateOpen {
 		if time.Since(cb.lastFailure) > cb.resetTimeout {
-			cb.state = StateHalfOpen
+			cb.setState(StateHalfOpen)
 			cb.halfOpenReq = 0
 		} else {
 			cb.mutex.Unlock()
@@ -80,6 +83,13 @@ func (cb *CircuitBreaker) Call(fn func() error) error {
 	cb.mutex.Lock()
 	defer cb.mutex.Unlock()
 
+	if errors.Is(err, context.Canceled) {
+		// The caller went away, which says nothing about the service; free the probe slot
+		if cb.state == StateHalfOpen && cb.halfOpenReq > 0 {
+			cb.halfOpenReq--
+		}
+		return err
+	}
 	if err != nil {
 		cb.onFailure()
 		return err
@@ -96,10 +106,10 @@ func (cb *CircuitBreaker) onFailure() {
 
 	if cb.state == StateHalfOpen {
 		// Go back to open state if half-open request fails
-		cb.state = StateOpen
+		cb.setState(StateOpen)
 		cb.failures = cb.maxFailures // Ensure it stays open
 	} else if cb.failures >= cb.maxFailures {
-		cb.state = StateOpen
+		cb.setState(StateOpen)
 	}
 }
 
@@ -107,7 +117,7 @@ func (cb *CircuitBreaker) onFailure() {
 func (cb *CircuitBreaker) onSuccess() {
 	if cb.state == StateHalfOpen {
 		// Transition to closed if half-open request succeeds
-		cb.state = StateClosed
+		cb.setState(StateClosed)
 		cb.failures = 0
 		cb.halfOpenReq = 0
 	} else if cb.state == StateClosed {
@@ -127,7 +137,28 @@ func (cb *CircuitBreaker) GetState() CircuitState {
 func (cb *CircuitBreaker) Reset() {
 	cb.mutex.Lock()
 	defer cb.mutex.Unlock()
-	cb.state = StateClosed
+	cb.setState(StateClosed)
 	cb.failures = 0
 	cb.halfOpenReq = 0
 }
+
+// OnStateChange registers a callback invoked on every state transition.
+// The callback runs while the breaker lock is held and must not call back into the breaker.
+func (cb *CircuitBreaker) OnStateChange(fn func(from, to CircuitState)) {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+	cb.onStateChange = fn
+}
+
+// setState transitions the breaker and notifies the state change callback (caller holds the lock)
+func (cb *CircuitBreaker) setState(state CircuitState) {
+	if cb.state == state {
+		return
+	}
+
+	from := cb.state
+	cb.state = state
+	if cb.onStateChange != nil {
+		cb.onStateChange(from, state)
+	}
+}
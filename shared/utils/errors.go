@@ -0,0 +1,287 @@
+package utils
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pavitra93/go-multi-tenant-system/shared/tracing"
+)
+
+// ErrorCode is a stable, machine-readable error identifier returned to clients.
+// Clients should branch on the code, never on the message text.
+type ErrorCode string
+
+// Error catalogue shared by all services
+const (
+	// Request errors
+	CodeBadRequest       ErrorCode = "BAD_REQUEST"
+	CodeValidationFailed ErrorCode = "VALIDATION_FAILED"
+	CodePayloadTooLarge  ErrorCode = "PAYLOAD_TOO_LARGE"
+	CodeInvalidCursor    ErrorCode = "INVALID_CURSOR"
+
+	// Authentication and authorization
+	CodeUnauthorized       ErrorCode = "UNAUTHORIZED"
+	CodeInvalidCredentials ErrorCode = "INVALID_CREDENTIALS"
+	CodeInvalidToken       ErrorCode = "INVALID_TOKEN"
+	CodeForbidden          ErrorCode = "FORBIDDEN"
+	CodeInsufficientRole   ErrorCode = "INSUFFICIENT_ROLE"
+	CodeTenantAccessDenied ErrorCode = "TENANT_ACCESS_DENIED"
+
+	// Resources
+	CodeNotFound            ErrorCode = "NOT_FOUND"
+	CodeConflict            ErrorCode = "CONFLICT"
+	CodeTenantNotFound      ErrorCode = "TENANT_NOT_FOUND"
+	CodeDomainAlreadyExists ErrorCode = "DOMAIN_ALREADY_EXISTS"
+	CodeSlugAlreadyExists   ErrorCode = "SLUG_ALREADY_EXISTS"
+
+	// Tenant lifecycle
+	CodeTenantSuspended         ErrorCode = "TENANT_SUSPENDED"
+	CodeTenantDeleted           ErrorCode = "TENANT_DELETED"
+	CodeInvalidTenantTransition ErrorCode = "INVALID_TENANT_TRANSITION"
+
+	// Invitations
+	CodeInvitationNotFound      ErrorCode = "INVITATION_NOT_FOUND"
+	CodeInvitationExpired       ErrorCode = "INVITATION_EXPIRED"
+	CodeInvitationNotPending    ErrorCode = "INVITATION_NOT_PENDING"
+	CodeInvitationAlreadyExists ErrorCode = "INVITATION_ALREADY_EXISTS"
+	CodeUserAlreadyExists       ErrorCode = "USER_ALREADY_EXISTS"
+
+	// Plans and quotas
+	CodeUnknownPlan        ErrorCode = "UNKNOWN_PLAN"
+	CodeQuotaExceeded      ErrorCode = "QUOTA_EXCEEDED"
+	CodeDailyQuotaExceeded ErrorCode = "DAILY_QUOTA_EXCEEDED"
+
+	// Tenant settings
+	CodeSettingsVersionConflict ErrorCode = "SETTINGS_VERSION_CONFLICT"
+
+	// Tenant exports
+	CodeExportInProgress    ErrorCode = "EXPORT_IN_PROGRESS"
+	CodeExportNotAvailable  ErrorCode = "EXPORT_NOT_AVAILABLE"
+	CodeInvalidDownloadLink ErrorCode = "INVALID_DOWNLOAD_LINK"
+
+	// Tenant users
+	CodeUserNotFound    ErrorCode = "USER_NOT_FOUND"
+	CodeLastTenantOwner ErrorCode = "LAST_TENANT_OWNER"
+
+	// User erasure and legal holds
+	CodeErasureInProgress ErrorCode = "ERASURE_IN_PROGRESS"
+	CodeLegalHoldActive   ErrorCode = "LEGAL_HOLD_ACTIVE"
+
+	// Location sessions
+	CodeSessionNotFound      ErrorCode = "SESSION_NOT_FOUND"
+	CodeSessionAlreadyActive ErrorCode = "SESSION_ALREADY_ACTIVE"
+	CodeSessionNotActive     ErrorCode = "SESSION_NOT_ACTIVE"
+	CodeSessionExpired       ErrorCode = "SESSION_EXPIRED"
+
+	// Idempotency
+	CodeIdempotencyKeyReused  ErrorCode = "IDEMPOTENCY_KEY_REUSED"
+	CodeIdempotencyInProgress ErrorCode = "IDEMPOTENCY_IN_PROGRESS"
+
+	// Server and dependency failures
+	CodeInternalError       ErrorCode = "INTERNAL_ERROR"
+	CodeServiceUnavailable  ErrorCode = "SERVICE_UNAVAILABLE"
+	CodeCircuitOpen         ErrorCode = "CIRCUIT_OPEN"
+	CodeUpstreamUnavailable ErrorCode = "UPSTREAM_UNAVAILABLE"
+)
+
+// errorDefinition is the HTTP status and RFC 7807 title of an error code
+type errorDefinition struct {
+	status int
+	title  string
+}
+
+// errorCatalogue maps every error code to its status and title.
+// Statuses match what the endpoints returned before codes were introduced.
+var errorCatalogue = map[ErrorCode]errorDefinition{
+	CodeBadRequest:       {http.StatusBadRequest, "Bad request"},
+	CodeValidationFailed: {http.StatusBadRequest, "Request validation failed"},
+	CodePayloadTooLarge:  {http.StatusRequestEntityTooLarge, "Request body too large"},
+	CodeInvalidCursor:    {http.StatusBadRequest, "Invalid pagination cursor"},
+
+	CodeUnauthorized:       {http.StatusUnauthorized, "Authentication required"},
+	CodeInvalidCredentials: {http.StatusUnauthorized, "Invalid credentials"},
+	CodeInvalidToken:       {http.StatusUnauthorized, "Invalid or expired token"},
+	CodeForbidden:          {http.StatusForbidden, "Forbidden"},
+	CodeInsufficientRole:   {http.StatusForbidden, "Insufficient permissions"},
+	CodeTenantAccessDenied: {http.StatusForbidden, "Access denied to this tenant"},
+
+	CodeNotFound:            {http.StatusNotFound, "Resource not found"},
+	CodeConflict:            {http.StatusConflict, "Conflict"},
+	CodeTenantNotFound:      {http.StatusNotFound, "Tenant not found"},
+	CodeDomainAlreadyExists: {http.StatusBadRequest, "Domain already exists"},
+	CodeSlugAlreadyExists:   {http.StatusBadRequest, "Slug already exists"},
+
+	CodeTenantSuspended:         {http.StatusForbidden, "Tenant suspended"},
+	CodeTenantDeleted:           {http.StatusForbidden, "Tenant deleted or scheduled for deletion"},
+	CodeInvalidTenantTransition: {http.StatusConflict, "Invalid tenant status transition"},
+
+	CodeInvitationNotFound:      {http.StatusNotFound, "Invitation not found"},
+	CodeInvitationExpired:       {http.StatusBadRequest, "Invitation has expired"},
+	CodeInvitationNotPending:    {http.StatusConflict, "Invitation is no longer pending"},
+	CodeInvitationAlreadyExists: {http.StatusConflict, "A pending invitation already exists"},
+	CodeUserAlreadyExists:       {http.StatusConflict, "User already exists"},
+
+	CodeUnknownPlan:        {http.StatusBadRequest, "Unknown plan"},
+	CodeQuotaExceeded:      {http.StatusForbidden, "Plan quota exceeded"},
+	CodeDailyQuotaExceeded: {http.StatusTooManyRequests, "Daily plan quota exceeded"},
+
+	CodeSettingsVersionConflict: {http.StatusConflict, "Settings were changed by another request"},
+
+	CodeExportInProgress:    {http.StatusConflict, "A tenant export is already in progress"},
+	CodeExportNotAvailable:  {http.StatusGone, "Export archive is not available"},
+	CodeInvalidDownloadLink: {http.StatusForbidden, "Invalid or expired download link"},
+
+	CodeUserNotFound:    {http.StatusNotFound, "User not found"},
+	CodeLastTenantOwner: {http.StatusConflict, "Tenant must keep at least one owner"},
+
+	CodeErasureInProgress: {http.StatusConflict, "An erasure of this user is already in progress"},
+	CodeLegalHoldActive:   {http.StatusConflict, "Tenant data is under legal hold"},
+
+	CodeSessionNotFound:      {http.StatusNotFound, "Session not found"},
+	CodeSessionAlreadyActive: {http.StatusBadRequest, "Session already active"},
+	CodeSessionNotActive:     {http.StatusBadRequest, "Session is not active"},
+	CodeSessionExpired:       {http.StatusBadRequest, "Session has expired"},
+
+	CodeIdempotencyKeyReused:  {http.StatusConflict, "Idempotency key reused"},
+	CodeIdempotencyInProgress: {http.StatusConflict, "Idempotent request in progress"},
+
+	CodeInternalError:       {http.StatusInternalServerError, "Internal server error"},
+	CodeServiceUnavailable:  {http.StatusServiceUnavailable, "Service unavailable"},
+	CodeCircuitOpen:         {http.StatusServiceUnavailable, "Circuit breaker open"},
+	CodeUpstreamUnavailable: {http.StatusServiceUnavailable, "Upstream service unavailable"},
+}
+
+// statusCodes is the default code for errors reported only by HTTP status
+var statusCodes = map[int]ErrorCode{
+	http.StatusBadRequest:            CodeBadRequest,
+	http.StatusUnauthorized:          CodeUnauthorized,
+	http.StatusForbidden:             CodeForbidden,
+	http.StatusNotFound:              CodeNotFound,
+	http.StatusConflict:              CodeConflict,
+	http.StatusRequestEntityTooLarge: CodePayloadTooLarge,
+	http.StatusInternalServerError:   CodeInternalError,
+	http.StatusServiceUnavailable:    CodeServiceUnavailable,
+}
+
+// Status returns the HTTP status for the code
+func (code ErrorCode) Status() int {
+	if definition, ok := errorCatalogue[code]; ok {
+		return definition.status
+	}
+	return http.StatusInternalServerError
+}
+
+// Title returns the short human-readable summary of the code
+func (code ErrorCode) Title() string {
+	if definition, ok := errorCatalogue[code]; ok {
+		return definition.title
+	}
+	return http.StatusText(code.Status())
+}
+
+// EnumValues lists every catalogued code, for the OpenAPI document
+func (ErrorCode) EnumValues() []string {
+	values := make([]string, 0, len(errorCatalogue))
+	for code := range errorCatalogue {
+		values = append(values, string(code))
+	}
+	sort.Strings(values)
+	return values
+}
+
+// codeForStatus returns the default code for an HTTP status
+func codeForStatus(status int) ErrorCode {
+	if code, ok := statusCodes[status]; ok {
+		return code
+	}
+	return ErrorCode(strings.ToUpper(strings.ReplaceAll(http.StatusText(status), " ", "_")))
+}
+
+// ProblemContentType is the RFC 7807 media type
+const ProblemContentType = "application/problem+json"
+
+// ProblemDetails is the RFC 7807 representation of an error, sent when the client
+// accepts application/problem+json
+type ProblemDetails struct {
+	Type      string                 `json:"type"`
+	Title     string                 `json:"title"`
+	Status    int                    `json:"status"`
+	Detail    string                 `json:"detail,omitempty"`
+	Instance  string                 `json:"instance,omitempty"`
+	Code      ErrorCode              `json:"code"`
+	RequestID string                 `json:"request_id,omitempty"`
+	Errors    []FieldError           `json:"errors,omitempty"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+}
+
+// writeError sends an error as an APIResponse envelope, or as problem+json when the client prefers it
+func writeError(c *gin.Context, status int, response APIResponse) {
+	response.Success = false
+	response.RequestID = c.GetString(tracing.RequestIDKey)
+
+	if !acceptsProblemJSON(c.GetHeader("Accept")) {
+		c.JSON(status, response)
+		return
+	}
+
+	problem := ProblemDetails{
+		Type:      "urn:problem-type:" + strings.ToLower(strings.ReplaceAll(string(response.Code), "_", "-")),
+		Title:     response.Code.Title(),
+		Status:    status,
+		Detail:    response.Error,
+		Instance:  c.Request.URL.Path,
+		Code:      response.Code,
+		RequestID: response.RequestID,
+		Errors:    response.Errors,
+		Details:   response.Details,
+	}
+	c.Render(status, problemRender{problem})
+}
+
+// acceptsProblemJSON reports whether the Accept header ranks problem+json at least as high as JSON
+func acceptsProblemJSON(accept string) bool {
+	if !strings.Contains(accept, ProblemContentType) {
+		return false
+	}
+
+	problemQ, jsonQ := 0.0, 0.0
+	for _, mediaRange := range strings.Split(accept, ",") {
+		mediaType, params, _ := strings.Cut(strings.TrimSpace(mediaRange), ";")
+		quality := 1.0
+		for _, param := range strings.Split(params, ";") {
+			if value, ok := strings.CutPrefix(strings.TrimSpace(param), "q="); ok {
+				if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+					quality = parsed
+				}
+			}
+		}
+
+		switch strings.ToLower(strings.TrimSpace(mediaType)) {
+		case ProblemContentType:
+			problemQ = quality
+		case "application/json":
+			jsonQ = quality
+		}
+	}
+	return problemQ > 0 && problemQ >= jsonQ
+}
+
+// problemRender renders ProblemDetails with the problem+json content type
+type problemRender struct {
+	problem ProblemDetails
+}
+
+// Render implements render.Render
+func (r problemRender) Render(w http.ResponseWriter) error {
+	r.WriteContentType(w)
+	return json.NewEncoder(w).Encode(r.problem)
+}
+
+// WriteContentType implements render.Render
+func (r problemRender) WriteContentType(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", ProblemContentType)
+}
@@ -6,7 +6,6 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
-	"os"
 	"time"
 
 	"github.com/go-redis/redis/v8"
@@ -19,35 +18,14 @@ var (
 	ctx         = context.Background()
 )
 
-// InitRedis initializes the Redis client
-func InitRedis() error {
-	redisHost := os.Getenv("REDIS_HOST")
-	if redisHost == "" {
-		redisHost = "localhost"
-	}
-
-	redisPort := os.Getenv("REDIS_PORT")
-	if redisPort == "" {
-		redisPort = "6379"
-	}
-
-	addr := fmt.Sprintf("%s:%s", redisHost, redisPort)
-
-	RedisClient = redis.NewClient(&redis.Options{
-		Addr:         addr,
-		Password:     "", // No password by default
-		DB:           0,  // Default DB
-		DialTimeout:  5 * time.Second,
-		ReadTimeout:  3 * time.Second,
-		WriteTimeout: 3 * time.Second,
-		PoolSize:     10,
-		MinIdleConns: 5,
-	})
+// InitRedis initializes the Redis client with the given options
+func InitRedis(options *redis.Options) error {
+	RedisClient = redis.NewClient(options)
 
 	// Test connection
 	_, err := RedisClient.Ping(ctx).Result()
 	if err != nil {
-		return fmt.Errorf("failed to connect to Redis at %s: %w", addr, err)
+		return fmt.Errorf("failed to connect to Redis at %s: %w", options.Addr, err)
 	}
 
 	return nil
@@ -75,6 +53,9 @@ func CacheGet(key string) (string, error) {
 
 // CacheDelete removes a key from Redis
 func CacheDelete(key string) error {
+	if RedisClient == nil {
+		return fmt.Errorf("Redis client not initialized")
+	}
 	return RedisClient.Del(ctx, key).Err()
 }
 
@@ -104,8 +85,8 @@ func CloseRedis() error {
 
 // Token Session Management Functions
 
-// generateTokenHash creates a SHA256 hash of the access token for use as Redis key
-func generateTokenHash(token string) string {
+// HashToken returns the SHA256 hex of a bearer token; only hashes are stored, never tokens
+func HashToken(token string) string {
 	hash := sha256.Sum256([]byte(token))
 	return hex.EncodeToString(hash[:])
 }
@@ -134,7 +115,7 @@ func CreateTokenSession(accessToken string, userProfile models.UserProfile, ttl
 	}
 
 	// Store in Redis with token hash as key (no token stored)
-	tokenHash := generateTokenHash(accessToken)
+	tokenHash := HashToken(accessToken)
 	key := fmt.Sprintf("token:session:%s", tokenHash)
 
 	err = RedisClient.Set(ctx, key, sessionData, ttl).Err()
@@ -151,7 +132,7 @@ func GetTokenSession(accessToken string) (*models.TokenSession, error) {
 		return nil, fmt.Errorf("Redis client not initialized")
 	}
 
-	tokenHash := generateTokenHash(accessToken)
+	tokenHash := HashToken(accessToken)
 	key := fmt.Sprintf("token:session:%s", tokenHash)
 
 	sessionData, err := RedisClient.Get(ctx, key).Result()
@@ -184,7 +165,7 @@ func UpdateTokenSessionLastUsed(accessToken string) error {
 		return fmt.Errorf("Redis client not initialized")
 	}
 
-	tokenHash := generateTokenHash(accessToken)
+	tokenHash := HashToken(accessToken)
 	key := fmt.Sprintf("token:session:%s", tokenHash)
 
 	// Get current session
@@ -217,7 +198,7 @@ func RevokeTokenSession(accessToken string) error {
 		return fmt.Errorf("Redis client not initialized")
 	}
 
-	tokenHash := generateTokenHash(accessToken)
+	tokenHash := HashToken(accessToken)
 	key := fmt.Sprintf("token:session:%s", tokenHash)
 
 	// Remove token session
@@ -231,30 +212,45 @@ func RevokeTokenSession(accessToken string) error {
 
 // RevokeAllUserSessions removes all sessions for a specific user
 func RevokeAllUserSessions(cognitoID string) error {
-	if RedisClient == nil {
-		return fmt.Errorf("Redis client not initialized")
-	}
+	_, err := revokeSessionsWhere(func(session *models.TokenSession) bool {
+		return session.UserProfile.CognitoID == cognitoID
+	})
+	return err
+}
 
-	// Scan all session keys and remove those belonging to the user
-	pattern := "token:session:*"
-	keys, err := RedisClient.Keys(ctx, pattern).Result()
-	if err != nil {
-		return fmt.Errorf("failed to scan session keys: %w", err)
+// RevokeTenantSessions removes all sessions of a tenant's users and returns how many were removed
+func RevokeTenantSessions(tenantID uuid.UUID) (int64, error) {
+	return revokeSessionsWhere(func(session *models.TokenSession) bool {
+		return session.UserProfile.TenantID != nil && *session.UserProfile.TenantID == tenantID
+	})
+}
+
+// revokeSessionsWhere scans all token sessions and removes those matching
+func revokeSessionsWhere(match func(*models.TokenSession) bool) (int64, error) {
+	if RedisClient == nil {
+		return 0, fmt.Errorf("Redis client not initialized")
 	}
 
-	for _, key := range keys {
+	var revoked int64
+	iter := RedisClient.Scan(ctx, 0, "token:session:*", 100).Iterator()
+	for iter.Next(ctx) {
+		key := iter.Val()
 		sessionData, err := RedisClient.Get(ctx, key).Result()
 		if err != nil {
 			continue
 		}
 
 		var session models.TokenSession
-		if json.Unmarshal([]byte(sessionData), &session) == nil {
-			if session.UserProfile.CognitoID == cognitoID {
-				RedisClient.Del(ctx, key)
+		if json.Unmarshal([]byte(sessionData), &session) == nil && match(&session) {
+			if err := RedisClient.Del(ctx, key).Err(); err != nil {
+				return revoked, fmt.Errorf("failed to revoke session: %w", err)
 			}
+			revoked++
 		}
 	}
+	if err := iter.Err(); err != nil {
+		return revoked, fmt.Errorf("failed to scan session keys: %w", err)
+	}
 
-	return nil
+	return revoked, nil
 }
@@ -8,10 +8,31 @@ import (
 
 // APIResponse represents a standard API response
 type APIResponse struct {
-	Success bool        `json:"success"`
-	Message string      `json:"message,omitempty"`
-	Data    interface{} `json:"data,omitempty"`
-	Error   string      `json:"error,omitempty"`
+	Success   bool                   `json:"success"`
+	Message   string                 `json:"message,omitempty"`
+	Data      interface{}            `json:"data,omitempty"`
+	Error     string                 `json:"error,omitempty"`
+	Code      ErrorCode              `json:"code,omitempty"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+	Errors    []FieldError           `json:"errors,omitempty"`
+	RequestID string                 `json:"request_id,omitempty"`
+
+	// Pagination is set on paginated list responses
+	Pagination *Pagination `json:"pagination,omitempty"`
+}
+
+// Pagination describes the position of a page within a cursor-paginated list
+type Pagination struct {
+	Limit      int    `json:"limit"`
+	HasMore    bool   `json:"has_more"`
+	NextCursor string `json:"next_cursor,omitempty"` // Pass as ?cursor= to fetch the next page
+}
+
+// FieldError describes why a single request field was rejected
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
 }
 
 // SuccessResponse sends a successful response
@@ -23,11 +44,29 @@ func SuccessResponse(c *gin.Context, statusCode int, message string, data interf
 	})
 }
 
-// ErrorResponse sends an error response
+// ErrorResponse sends an error response with the default code for the status
 func ErrorResponse(c *gin.Context, statusCode int, message string) {
-	c.JSON(statusCode, APIResponse{
-		Success: false,
+	writeError(c, statusCode, APIResponse{
+		Error: message,
+		Code:  codeForStatus(statusCode),
+	})
+}
+
+// CodedErrorResponse sends an error response for a catalogued code, with optional details
+func CodedErrorResponse(c *gin.Context, code ErrorCode, message string, details map[string]interface{}) {
+	writeError(c, code.Status(), APIResponse{
 		Error:   message,
+		Code:    code,
+		Details: details,
+	})
+}
+
+// ValidationErrorResponse sends a 400 Bad Request response listing the invalid fields
+func ValidationErrorResponse(c *gin.Context, fieldErrors []FieldError) {
+	writeError(c, CodeValidationFailed.Status(), APIResponse{
+		Error:  "Request validation failed",
+		Code:   CodeValidationFailed,
+		Errors: fieldErrors,
 	})
 }
 
@@ -70,3 +109,13 @@ func CreatedResponse(c *gin.Context, message string, data interface{}) {
 func OKResponse(c *gin.Context, message string, data interface{}) {
 	SuccessResponse(c, http.StatusOK, message, data)
 }
+
+// PaginatedResponse sends a 200 OK response carrying one page of a list
+func PaginatedResponse(c *gin.Context, message string, data interface{}, page Pagination) {
+	c.JSON(http.StatusOK, APIResponse{
+		Success:    true,
+		Message:    message,
+		Data:       data,
+		Pagination: &page,
+	})
+}
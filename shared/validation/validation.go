@@ -0,0 +1,253 @@
+// Package validation binds request bodies and query strings with shared
+// validation rules and reports failures as field-level errors.
+package validation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+
+	"github.com/pavitra93/go-multi-tenant-system/shared/utils"
+)
+
+// MaxFutureSkew is how far ahead of the server clock a client timestamp may be
+var MaxFutureSkew = 5 * time.Minute
+
+var registerOnce sync.Once
+
+// Register installs the custom validators on gin's validator. It is safe to call more than once;
+// BindJSON, BindStrictJSON and BindQuery call it automatically.
+//
+//	latitude   number in [-90, 90]
+//	longitude  number in [-180, 180]
+//	notfuture  time no later than now + MaxFutureSkew
+//
+// uuid.UUID fields validate as strings, so `required` rejects the nil UUID.
+func Register() {
+	registerOnce.Do(func() {
+		validate, ok := binding.Validator.Engine().(*validator.Validate)
+		if !ok {
+			return
+		}
+
+		// Report JSON field names rather than Go field names
+		validate.RegisterTagNameFunc(func(field reflect.StructField) string {
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "-" {
+				return ""
+			}
+			if name == "" {
+				return field.Name
+			}
+			return name
+		})
+
+		validate.RegisterCustomTypeFunc(func(field reflect.Value) interface{} {
+			if id, ok := field.Interface().(uuid.UUID); ok && id != uuid.Nil {
+				return id.String()
+			}
+			return ""
+		}, uuid.UUID{})
+
+		validate.RegisterValidation("latitude", inRange(-90, 90))
+		validate.RegisterValidation("longitude", inRange(-180, 180))
+		validate.RegisterValidation("notfuture", notFuture)
+	})
+}
+
+// BindJSON binds the request body into obj and validates it. On failure it writes a
+// 400 response listing every invalid field and returns false.
+func BindJSON(c *gin.Context, obj interface{}) bool {
+	Register()
+
+	if err := c.ShouldBindJSON(obj); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			utils.ErrorResponse(c, http.StatusRequestEntityTooLarge, fmt.Sprintf("Request body exceeds %d bytes", maxBytesErr.Limit))
+			return false
+		}
+
+		utils.ValidationErrorResponse(c, FieldErrors(err))
+		return false
+	}
+	return true
+}
+
+// BindStrictJSON is BindJSON for documents with a closed schema: fields obj doesn't
+// declare are rejected instead of ignored.
+func BindStrictJSON(c *gin.Context, obj interface{}) bool {
+	Register()
+
+	decoder := json.NewDecoder(c.Request.Body)
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(obj)
+	if err == nil {
+		err = binding.Validator.ValidateStruct(obj)
+	}
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			utils.ErrorResponse(c, http.StatusRequestEntityTooLarge, fmt.Sprintf("Request body exceeds %d bytes", maxBytesErr.Limit))
+			return false
+		}
+
+		// encoding/json reports unknown fields with a plain error naming the field
+		if field, found := strings.CutPrefix(err.Error(), "json: unknown field "); found {
+			utils.ValidationErrorResponse(c, []utils.FieldError{{Field: strings.Trim(field, `"`), Rule: "unknown", Message: "is not a known field"}})
+			return false
+		}
+
+		utils.ValidationErrorResponse(c, FieldErrors(err))
+		return false
+	}
+	return true
+}
+
+// BindQuery binds the query string into obj using its form tags and validates it.
+// On failure it writes a 400 response listing every invalid parameter and returns false.
+func BindQuery(c *gin.Context, obj interface{}) bool {
+	Register()
+
+	if err := c.ShouldBindQuery(obj); err != nil {
+		var validationErrs validator.ValidationErrors
+		if errors.As(err, &validationErrs) {
+			utils.ValidationErrorResponse(c, FieldErrors(err))
+			return false
+		}
+
+		// Values that don't parse (numbers, booleans, RFC 3339 times) fail before validation
+		utils.ValidationErrorResponse(c, []utils.FieldError{{Field: "query", Rule: "format", Message: err.Error()}})
+		return false
+	}
+	return true
+}
+
+// FieldErrors converts a binding error into field-level errors
+func FieldErrors(err error) []utils.FieldError {
+	var validationErrs validator.ValidationErrors
+	if errors.As(err, &validationErrs) {
+		fieldErrors := make([]utils.FieldError, 0, len(validationErrs))
+		for _, fieldErr := range validationErrs {
+			fieldErrors = append(fieldErrors, utils.FieldError{
+				Field:   fieldPath(fieldErr.Namespace()),
+				Rule:    fieldErr.Tag(),
+				Message: message(fieldErr),
+			})
+		}
+		return fieldErrors
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return []utils.FieldError{{
+			Field:   typeErr.Field,
+			Rule:    "type",
+			Message: fmt.Sprintf("must be a %s", jsonType(typeErr.Type)),
+		}}
+	}
+
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return []utils.FieldError{{Field: "body", Rule: "json", Message: "must be a valid JSON object"}}
+	}
+
+	// Values with custom decoders (uuid.UUID, time.Time) report parse errors directly
+	return []utils.FieldError{{Field: "body", Rule: "format", Message: err.Error()}}
+}
+
+// inRange validates that a number lies within [min, max]
+func inRange(min, max float64) validator.Func {
+	return func(fl validator.FieldLevel) bool {
+		field := fl.Field()
+		switch field.Kind() {
+		case reflect.Float32, reflect.Float64:
+			return field.Float() >= min && field.Float() <= max
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return float64(field.Int()) >= min && float64(field.Int()) <= max
+		default:
+			return false
+		}
+	}
+}
+
+// notFuture validates that a time is not beyond now + MaxFutureSkew
+func notFuture(fl validator.FieldLevel) bool {
+	timestamp, ok := fl.Field().Interface().(time.Time)
+	if !ok {
+		return false
+	}
+	return !timestamp.After(time.Now().Add(MaxFutureSkew))
+}
+
+// fieldPath strips the top-level struct name from a validator namespace
+func fieldPath(namespace string) string {
+	if _, path, found := strings.Cut(namespace, "."); found {
+		return path
+	}
+	return namespace
+}
+
+// message returns a human-readable description of a failed rule
+func message(fieldErr validator.FieldError) string {
+	switch fieldErr.Tag() {
+	case "required":
+		return "is required"
+	case "latitude":
+		return "must be between -90 and 90"
+	case "longitude":
+		return "must be between -180 and 180"
+	case "notfuture":
+		return fmt.Sprintf("must not be more than %s in the future", MaxFutureSkew)
+	case "uuid", "uuid4":
+		return "must be a valid UUID"
+	case "email":
+		return "must be a valid email address"
+	case "url":
+		return "must be a valid URL"
+	case "startswith":
+		return "must start with " + fieldErr.Param()
+	case "oneof":
+		return "must be one of: " + fieldErr.Param()
+	case "min", "gte":
+		if fieldErr.Kind() == reflect.String {
+			return fmt.Sprintf("must be at least %s characters", fieldErr.Param())
+		}
+		return "must be at least " + fieldErr.Param()
+	case "max", "lte":
+		if fieldErr.Kind() == reflect.String {
+			return fmt.Sprintf("must be at most %s characters", fieldErr.Param())
+		}
+		return "must be at most " + fieldErr.Param()
+	default:
+		return fmt.Sprintf("failed %q validation", fieldErr.Tag())
+	}
+}
+
+// jsonType names the JSON type a Go type decodes from
+func jsonType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.String:
+		return "string"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	default:
+		return "object"
+	}
+}